@@ -9,6 +9,14 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		if len(os.Args) != 3 {
+			fmt.Fprintln(os.Stderr, "Usage: keygen verify <key>")
+			os.Exit(2)
+		}
+		os.Exit(verify(os.Args[2]))
+	}
+
 	userID := "ADMIN"
 	if len(os.Args) > 1 {
 		userID = strings.Join(os.Args[1:], "")
@@ -18,3 +26,19 @@ func main() {
 	fmt.Println("Generated License Key:")
 	fmt.Println(key)
 }
+
+// verify prints what a key decodes to and whether it is valid, returning the exit code
+func verify(key string) int {
+	info, err := license.Parse(key)
+	if info.UserID != "" {
+		fmt.Printf("User ID:  %s\n", info.UserID)
+	}
+	fmt.Printf("Plan:     %s\n", license.GetPlanName(key))
+	fmt.Println("Expires:  never")
+	if err != nil {
+		fmt.Printf("Valid:    no (%v)\n", err)
+		return 1
+	}
+	fmt.Println("Valid:    yes")
+	return 0
+}
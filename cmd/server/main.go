@@ -1,10 +1,12 @@
 package main
 
 import (
+	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/gofiber/fiber/v2"
@@ -17,23 +19,38 @@ import (
 	"github.com/Vasteva/MediaConverter/internal/ai"
 	"github.com/Vasteva/MediaConverter/internal/api"
 	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/database"
+	"github.com/Vasteva/MediaConverter/internal/events"
 	"github.com/Vasteva/MediaConverter/internal/jobs"
 	"github.com/Vasteva/MediaConverter/internal/scanner"
+	"github.com/Vasteva/MediaConverter/internal/system"
 )
 
 func main() {
+	// Keep recent log output for GET /api/logs
+	log.SetOutput(io.MultiWriter(os.Stderr, system.Logs))
+
 	// Load environment variables
 	_ = godotenv.Load()
 
 	// Initialize configuration
 	cfg := config.Load()
 
+	// Ensure scratch space for intermediate files is usable
+	if err := os.MkdirAll(cfg.GetTempDir(), 0755); err != nil {
+		log.Printf("Warning: Failed to create temp dir %s: %v", cfg.GetTempDir(), err)
+	} else if err := system.CheckWritable(cfg.GetTempDir()); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
 	// Initialize AI Provider
 	aiProvider, err := ai.NewProvider(ai.AIConfig{
 		Provider: cfg.AIProvider,
 		APIKey:   cfg.AIApiKey,
 		Endpoint: cfg.AIEndpoint,
 		Model:    cfg.AIModel,
+
+		MaxAttempts: cfg.AIMaxAttempts,
 	})
 	if err != nil {
 		log.Printf("Warning: Failed to initialize AI provider: %v", err)
@@ -46,10 +63,27 @@ func main() {
 	if jobsFile == "" {
 		jobsFile = "./jobs.json"
 	}
-	jobManager, err := jobs.NewManager(cfg, aiProvider, jobsFile)
+	var jobStore jobs.Store = &jobs.FileStore{Path: jobsFile}
+	var processedStore scanner.ProcessedStore
+	if cfg.StorageBackend == "sqlite" {
+		db, err := database.OpenSQLite(cfg.SQLitePath)
+		if err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+		if jobStore, err = jobs.NewSQLiteStore(db); err != nil {
+			log.Fatalf("Failed to initialize job store: %v", err)
+		}
+		if processedStore, err = scanner.NewSQLiteProcessedStore(db); err != nil {
+			log.Fatalf("Failed to initialize processed file store: %v", err)
+		}
+		log.Printf("Storing jobs and processed files in %s", cfg.SQLitePath)
+	}
+	jobManager, err := jobs.NewManagerWithStore(cfg, aiProvider, jobStore)
 	if err != nil {
 		log.Fatalf("Failed to initialize job manager: %v", err)
 	}
+	eventLog := events.NewLog(events.DefaultCapacity)
+	jobManager.Events = eventLog
 	go jobManager.Start()
 	go jobManager.RequeuePendingJobs() // Requeue any pending jobs from previous session
 
@@ -71,23 +105,41 @@ func main() {
 		log.Println("Scanner will be disabled")
 		scannerCfg = &scanner.ScannerConfig{Enabled: false}
 	}
+	for _, dir := range scannerCfg.WatchDirectories {
+		if config.UploadDirOverlap(cfg.UploadDir, dir.Path) != "" {
+			log.Printf("Warning: UPLOAD_DIR %s overlaps the watch directory %s, uploads would be queued twice", cfg.UploadDir, dir.Path)
+		}
+	}
 
-	fileScanner, err := scanner.NewScanner(scannerCfg, jobManager)
+	if processedStore == nil {
+		processedStore = &scanner.FileProcessedStore{Path: scannerCfg.ProcessedFilePath}
+	}
+	fileScanner, err := scanner.NewScannerWithStore(scannerCfg, jobManager, processedStore)
 	if err != nil {
 		log.Printf("Warning: Failed to initialize scanner: %v", err)
-	} else if scannerCfg.Enabled {
+	} else {
+		fileScanner.Events = eventLog
+		fileScanner.ExcludeDirs = []string{cfg.GetTempDir()}
+		fileScanner.WatchDirsFile = watchDirsFile
+	}
+	if fileScanner != nil && scannerCfg.Enabled {
 		if err := fileScanner.Start(); err != nil {
 			log.Printf("Warning: Failed to start scanner: %v", err)
 		}
 	}
 
 	// Initialize Fiber app
+	// Request bodies are streamed so uploads go to disk rather than memory, and multipart
+	// bodies aren't parsed into temporary files before the upload handler sees them
 	app := fiber.New(fiber.Config{
-		AppName: "Vastiva v1.0.0",
+		AppName:                      "Vastiva v" + system.Version,
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
 	})
 
 	// Middleware
 	app.Use(logger.New())
+	app.Use(api.LimitRequestBodies(fiber.DefaultBodyLimit))
 
 	// Configure CORS with allowed origins from environment
 	corsOrigins := os.Getenv("CORS_ORIGINS")
@@ -112,15 +164,17 @@ func main() {
 		Index:      "index.html",
 	}))
 
-	// Fallback to index.html for SPA routing
-	app.Get("*", func(c *fiber.Ctx) error {
-		file, err := vastiva.StaticFS.ReadFile("web/dist/index.html")
-		if err != nil {
-			return c.SendStatus(http.StatusNotFound)
+	// Fallback to index.html for SPA routing, unknown API paths stay JSON 404s
+	api.RegisterSPAFallback(app, vastiva.StaticFS, "web/dist/index.html")
+
+	// Reload settings from disk on SIGHUP
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloadConfig(jobManager, fileScanner)
 		}
-		c.Set("Content-Type", "text/html")
-		return c.Send(file)
-	})
+	}()
 
 	// Graceful shutdown
 	c := make(chan os.Signal, 1)
@@ -145,3 +199,31 @@ func main() {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
+
+// reloadConfig re-reads the server and scanner settings without restarting
+func reloadConfig(jobManager *jobs.Manager, fileScanner *scanner.Scanner) {
+	log.Println("Received SIGHUP, reloading configuration...")
+
+	changed := jobManager.ReloadConfig()
+	if len(changed) == 0 {
+		log.Println("Configuration unchanged")
+	} else {
+		log.Printf("Configuration reloaded, changed: %s", strings.Join(changed, ", "))
+		for _, name := range changed {
+			switch name {
+			case "port", "maxConcurrentJobs", "ffmpegPath", "ffprobePath", "makemkvPath", "storageBackend", "sqlitePath":
+				log.Printf("Warning: %s takes effect on restart", name)
+			}
+		}
+	}
+
+	if fileScanner != nil {
+		if updated, err := fileScanner.Reload(); err != nil {
+			log.Printf("Warning: Failed to reload scanner config: %v", err)
+		} else if updated {
+			log.Println("Scanner configuration reloaded")
+		}
+	}
+
+	jobManager.Events.Append(events.Event{Type: events.ConfigChanged, Message: "Settings reloaded"})
+}
@@ -1,6 +1,12 @@
 package ai
 
-import "testing"
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
 
 func TestNewProvider(t *testing.T) {
 	tests := []struct {
@@ -26,3 +32,86 @@ func TestNewProvider(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatSRT(t *testing.T) {
+	got := FormatSRT([]SRTSegment{
+		{Start: 0, End: 2.5, Text: " Hello there."},
+		{Start: 3661.042, End: 3663, Text: "General Kenobi!"},
+	})
+	want := "1\n00:00:00,000 --> 00:00:02,500\nHello there.\n\n" +
+		"2\n01:01:01,042 --> 01:01:03,000\nGeneral Kenobi!\n\n"
+	if got != want {
+		t.Errorf("FormatSRT() = %q, want %q", got, want)
+	}
+}
+
+func TestAnalyzeRetriesRateLimits(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, `{"error":"rate limited"}`, http.StatusTooManyRequests)
+		case 2:
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"choices":[{"message":{"content":"The Matrix (1999)"}}]}`))
+		}
+	}))
+	defer server.Close()
+
+	p := NewOpenAIProvider("key", server.URL, "")
+	got, err := p.Analyze(context.Background(), "clean")
+	if err != nil || got != "The Matrix (1999)" {
+		t.Fatalf("Analyze() = %q, %v; want the answer after retrying", got, err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 requests, got %d", calls)
+	}
+
+	// Attempts are bounded, the last error is reported
+	calls = 0
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	})
+	p.MaxAttempts = 2
+	if _, err := p.Analyze(context.Background(), "clean"); err == nil || calls != 2 {
+		t.Errorf("expected failure after 2 attempts, got %v after %d", err, calls)
+	}
+
+	// Client errors aren't retried
+	calls = 0
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		http.Error(w, "bad key", http.StatusUnauthorized)
+	})
+	if _, err := p.Analyze(context.Background(), "clean"); err == nil || calls != 1 {
+		t.Errorf("expected one attempt for a 401, got %v after %d", err, calls)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		retryAfter string
+		attempt    int
+		want       time.Duration
+	}{
+		{"", 1, time.Second},
+		{"", 3, 4 * time.Second},
+		{"7", 1, 7 * time.Second},
+		{"Mon, 01 Jan 2024 12:00:30 GMT", 1, 30 * time.Second},
+		{"3600", 1, time.Minute}, // Capped
+		{"soon", 2, 2 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := retryDelay(tt.retryAfter, tt.attempt, now); got != tt.want {
+			t.Errorf("retryDelay(%q, %d) = %v, want %v", tt.retryAfter, tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -5,13 +5,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 )
 
 type ClaudeProvider struct {
-	APIKey string
-	Model  string
+	APIKey      string
+	Model       string
+	MaxAttempts int // Sends of a request answered with 429 or 5xx (0 = DefaultMaxAttempts)
 }
 
 func NewClaudeProvider(apiKey, model string) *ClaudeProvider {
@@ -52,15 +52,12 @@ func (p *ClaudeProvider) Analyze(ctx context.Context, prompt string) (string, er
 	req.Header.Set("x-api-key", p.APIKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
 
-	resp, err := http.DefaultClient.Do(req)
+	status, body, err := doWithRetry(req, p.MaxAttempts)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("claude api error (%d): %s", resp.StatusCode, string(body))
+	if status != http.StatusOK {
+		return "", fmt.Errorf("claude api error (%d): %s", status, string(body))
 	}
 
 	var result struct {
@@ -5,14 +5,14 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 )
 
 type GeminiProvider struct {
-	APIKey string
-	Model  string
+	APIKey      string
+	Model       string
+	MaxAttempts int // Sends of a request answered with 429 or 5xx (0 = DefaultMaxAttempts)
 }
 
 func NewGeminiProvider(apiKey, model string) *GeminiProvider {
@@ -55,15 +55,12 @@ func (p *GeminiProvider) Analyze(ctx context.Context, prompt string) (string, er
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	status, body, err := doWithRetry(req, p.MaxAttempts)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("gemini api error (%d): %s", resp.StatusCode, string(body))
+	if status != http.StatusOK {
+		return "", fmt.Errorf("gemini api error (%d): %s", status, string(body))
 	}
 
 	var result struct {
@@ -3,19 +3,93 @@ package meta
 import (
 	"context"
 	"fmt"
+	"log"
+	"regexp"
+	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/Vasteva/MediaConverter/internal/ai"
 )
 
 // Cleaner handles AI-powered metadata cleaning
 type Cleaner struct {
-	provider ai.Provider
+	provider              ai.Provider
+	cleanFilenamePrompt   *template.Template
+	analyzeEncodingPrompt *template.Template
+}
+
+// Prompts are prompt template overrides, see ai.LoadPrompt. Empty fields use the
+// built-in prompts.
+type Prompts struct {
+	CleanFilename   string // Rendered with {{.Filename}}
+	AnalyzeEncoding string // Rendered with {{.MediaInfo}}, the ffprobe JSON
+}
+
+// cleanFilenameData is what the CleanFilename prompt is rendered with
+type cleanFilenameData struct {
+	Filename string
+}
+
+// analyzeEncodingData is what the AnalyzeEncoding prompt is rendered with
+type analyzeEncodingData struct {
+	MediaInfo string
+}
+
+var defaultCleanFilenamePrompt = template.Must(template.New("cleanFilename").Parse(`
+		Extract the clean movie or TV show title and the release year from this filename.
+		Filename: "{{.Filename}}"
+		
+		Return ONLY the clean title and year in this format: "Title (Year)"
+		If year is unknown, return ONLY the Title.
+		Example Input: "The.Matrix.1999.1080p.BluRay.x264.mkv"
+		Example Output: "The Matrix (1999)"
+	`))
+
+var defaultAnalyzeEncodingPrompt = template.Must(template.New("analyzeEncoding").Parse(`
+		Analyze this ffprobe JSON output and recommend the optimal CRF (Constant Rate Factor) 
+		for H.265 encoding to balance high quality and small file size.
+		
+		Media Info: {{.MediaInfo}}
+		
+		Return ONLY the recommended CRF as an integer (typically between 18 and 28).
+		Example Output: 22
+	`))
+
+// LoadCleanFilenamePrompt parses a CleanFilename prompt override
+func LoadCleanFilenamePrompt(override string) (*template.Template, error) {
+	return ai.LoadPrompt(defaultCleanFilenamePrompt, override, cleanFilenameData{})
+}
+
+// LoadAnalyzeEncodingPrompt parses an AnalyzeEncoding prompt override
+func LoadAnalyzeEncodingPrompt(override string) (*template.Template, error) {
+	return ai.LoadPrompt(defaultAnalyzeEncodingPrompt, override, analyzeEncodingData{})
 }
 
 // NewCleaner creates a new metadata cleaner
 func NewCleaner(p ai.Provider) *Cleaner {
-	return &Cleaner{provider: p}
+	return &Cleaner{
+		provider:              p,
+		cleanFilenamePrompt:   defaultCleanFilenamePrompt,
+		analyzeEncodingPrompt: defaultAnalyzeEncodingPrompt,
+	}
+}
+
+// NewCleanerWithPrompts creates a metadata cleaner using prompt overrides. An override
+// that fails to load is logged and the built-in prompt used instead.
+func NewCleanerWithPrompts(p ai.Provider, prompts Prompts) *Cleaner {
+	c := NewCleaner(p)
+	if tmpl, err := LoadCleanFilenamePrompt(prompts.CleanFilename); err != nil {
+		log.Printf("[AI] %v, using the built-in prompt", err)
+	} else {
+		c.cleanFilenamePrompt = tmpl
+	}
+	if tmpl, err := LoadAnalyzeEncodingPrompt(prompts.AnalyzeEncoding); err != nil {
+		log.Printf("[AI] %v, using the built-in prompt", err)
+	} else {
+		c.analyzeEncodingPrompt = tmpl
+	}
+	return c
 }
 
 // CleanFilename uses AI to parse a messy filename and return a clean title and year
@@ -24,15 +98,10 @@ func (c *Cleaner) CleanFilename(ctx context.Context, filename string) (string, e
 		return "", fmt.Errorf("AI provider not configured")
 	}
 
-	prompt := fmt.Sprintf(`
-		Extract the clean movie or TV show title and the release year from this filename.
-		Filename: "%s"
-		
-		Return ONLY the clean title and year in this format: "Title (Year)"
-		If year is unknown, return ONLY the Title.
-		Example Input: "The.Matrix.1999.1080p.BluRay.x264.mkv"
-		Example Output: "The Matrix (1999)"
-	`, filename)
+	prompt, err := ai.RenderPrompt(c.cleanFilenamePrompt, cleanFilenameData{Filename: filename})
+	if err != nil {
+		return "", err
+	}
 
 	cleaned, err := c.provider.Analyze(ctx, prompt)
 	if err != nil {
@@ -42,21 +111,90 @@ func (c *Cleaner) CleanFilename(ctx context.Context, filename string) (string, e
 	return strings.TrimSpace(cleaned), nil
 }
 
+// CleanFilenames cleans several filenames in one request, numbered in the prompt and
+// matched back by number, and returns their "Title (Year)" in the order of filenames.
+// Filenames the response skipped or answered twice are cleaned one by one instead, and
+// are left "" when that fails too.
+func (c *Cleaner) CleanFilenames(ctx context.Context, filenames []string) ([]string, error) {
+	if c.provider == nil {
+		return nil, fmt.Errorf("AI provider not configured")
+	}
+	if len(filenames) == 0 {
+		return []string{}, nil
+	}
+
+	var list strings.Builder
+	for i, name := range filenames {
+		list.WriteString(fmt.Sprintf("%d. %s\n", i+1, name))
+	}
+
+	prompt := fmt.Sprintf(`
+		Extract the clean movie or TV show title and the release year from each of these filenames.
+		%s
+		Return ONLY one line per filename, numbered like the input, in this format: "N. Title (Year)"
+		If year is unknown, return ONLY the Title.
+		Example Input: "1. The.Matrix.1999.1080p.BluRay.x264.mkv"
+		Example Output: "1. The Matrix (1999)"
+	`, list.String())
+
+	response, err := c.provider.Analyze(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	titles := parseNumberedTitles(response, len(filenames))
+	for i, title := range titles {
+		if title != "" {
+			continue
+		}
+		if titles[i], err = c.CleanFilename(ctx, filenames[i]); err != nil {
+			log.Printf("[AI] Failed to clean %s: %v", filenames[i], err)
+		}
+	}
+	return titles, nil
+}
+
+var numberedLineRegex = regexp.MustCompile(`^\s*(\d+)[.):]\s*(.+)$`)
+
+// parseNumberedTitles reads "N. Title" response lines into the title of the Nth of n
+// filenames. Numbers out of range are ignored, and numbers answered more than once are
+// left "" as the model lost track of the list.
+func parseNumberedTitles(response string, n int) []string {
+	titles := make([]string, n)
+	answers := make([]int, n)
+	for _, line := range strings.Split(response, "\n") {
+		m := numberedLineRegex.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		i, err := strconv.Atoi(m[1])
+		if err != nil || i < 1 || i > n {
+			continue
+		}
+		title := strings.Trim(strings.TrimSpace(m[2]), `"`)
+		if title != "" {
+			titles[i-1] = title
+			answers[i-1]++
+		}
+	}
+	for i, count := range answers {
+		if count > 1 {
+			titles[i] = ""
+		}
+	}
+	return titles
+}
+
 // AnalyzeEncoding uses AI to recommend optimal encoding settings based on media info
 func (c *Cleaner) AnalyzeEncoding(ctx context.Context, rawJSON string) (int, error) {
 	if c.provider == nil {
 		return 23, fmt.Errorf("AI provider not configured")
 	}
 
-	prompt := fmt.Sprintf(`
-		Analyze this ffprobe JSON output and recommend the optimal CRF (Constant Rate Factor) 
-		for H.265 encoding to balance high quality and small file size.
-		
-		Media Info: %s
-		
-		Return ONLY the recommended CRF as an integer (typically between 18 and 28).
-		Example Output: 22
-	`, rawJSON)
+	prompt, err := ai.RenderPrompt(c.analyzeEncodingPrompt, analyzeEncodingData{MediaInfo: rawJSON})
+	if err != nil {
+		return 23, err
+	}
 
 	response, err := c.provider.Analyze(ctx, prompt)
 	if err != nil {
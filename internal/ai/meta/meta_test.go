@@ -0,0 +1,120 @@
+package meta
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recordingProvider is an ai.Provider that remembers the last prompt it was sent
+type recordingProvider struct {
+	prompt string
+	answer string
+}
+
+func (p *recordingProvider) Analyze(ctx context.Context, prompt string) (string, error) {
+	p.prompt = prompt
+	return p.answer, nil
+}
+
+func (p *recordingProvider) Transcribe(ctx context.Context, audioPath string) (string, error) {
+	return "", fmt.Errorf("not supported")
+}
+
+func (p *recordingProvider) GetName() string { return "test" }
+
+func TestCleanFilenamePromptOverride(t *testing.T) {
+	provider := &recordingProvider{answer: "The Matrix (1999)\n"}
+	cleaner := NewCleanerWithPrompts(provider, Prompts{CleanFilename: `Title and year of {{.Filename}}, nothing else.`})
+
+	title, err := cleaner.CleanFilename(context.Background(), "The.Matrix.1999.1080p.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.prompt != "Title and year of The.Matrix.1999.1080p.mkv, nothing else." {
+		t.Errorf("expected the custom prompt, got %q", provider.prompt)
+	}
+	if title != "The Matrix (1999)" {
+		t.Errorf("unexpected title %q", title)
+	}
+
+	// Templates can be read from a file
+	path := filepath.Join(t.TempDir(), "clean.tmpl")
+	if err := os.WriteFile(path, []byte(`From file: {{.Filename}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cleaner = NewCleanerWithPrompts(provider, Prompts{CleanFilename: "@" + path})
+	cleaner.CleanFilename(context.Background(), "movie.mkv")
+	if provider.prompt != "From file: movie.mkv" {
+		t.Errorf("expected the prompt from the file, got %q", provider.prompt)
+	}
+
+	// Unknown variables and syntax errors are rejected, the built-in prompt is used
+	for _, bad := range []string{`{{.Title}}`, `{{.Filename`} {
+		if _, err := LoadCleanFilenamePrompt(bad); err == nil {
+			t.Errorf("expected %q to be rejected", bad)
+		}
+	}
+	cleaner = NewCleanerWithPrompts(provider, Prompts{CleanFilename: `{{.Title}}`})
+	cleaner.CleanFilename(context.Background(), "movie.mkv")
+	if !strings.Contains(provider.prompt, `Filename: "movie.mkv"`) {
+		t.Errorf("expected the built-in prompt, got %q", provider.prompt)
+	}
+}
+
+// funcProvider is an ai.Provider that answers prompts with a function and counts them
+type funcProvider struct {
+	calls  int
+	answer func(prompt string) string
+}
+
+func (p *funcProvider) Analyze(ctx context.Context, prompt string) (string, error) {
+	p.calls++
+	return p.answer(prompt), nil
+}
+
+func (p *funcProvider) Transcribe(ctx context.Context, audioPath string) (string, error) {
+	return "", fmt.Errorf("not supported")
+}
+
+func (p *funcProvider) GetName() string { return "test" }
+
+func TestCleanFilenames(t *testing.T) {
+	provider := &funcProvider{answer: func(prompt string) string {
+		if strings.Contains(prompt, "numbered like the input") {
+			// 2 is skipped, 4 answered twice and 9 is out of range
+			return "1. The Matrix (1999)\n3) \"Heat (1995)\"\n4. Alien (1979)\n4. Aliens (1986)\n9. Extra\n"
+		}
+		// One by one for the entries the list got wrong
+		switch {
+		case strings.Contains(prompt, "Blade.Runner"):
+			return "Blade Runner (1982)"
+		case strings.Contains(prompt, "Alien.1979"):
+			return "Alien (1979)"
+		}
+		return ""
+	}}
+	cleaner := NewCleaner(provider)
+
+	names := []string{"The.Matrix.1999.mkv", "Blade.Runner.1982.mkv", "Heat.1995.mkv", "Alien.1979.mkv"}
+	titles, err := cleaner.CleanFilenames(context.Background(), names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"The Matrix (1999)", "Blade Runner (1982)", "Heat (1995)", "Alien (1979)"}
+	if strings.Join(titles, "|") != strings.Join(want, "|") {
+		t.Errorf("expected %q, got %q", want, titles)
+	}
+	if provider.calls != 3 {
+		t.Errorf("expected one batch request and two fallbacks, got %d requests", provider.calls)
+	}
+
+	// No request for an empty list
+	provider.calls = 0
+	if titles, err := cleaner.CleanFilenames(context.Background(), nil); err != nil || len(titles) != 0 || provider.calls != 0 {
+		t.Errorf("expected no titles and no requests, got %q, %v, %d requests", titles, err, provider.calls)
+	}
+}
@@ -0,0 +1,67 @@
+package meta
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// NFOInfo is the data NFO templates are rendered with
+type NFOInfo struct {
+	Title            string // Cleaned title without the year
+	Year             int    // Release year, 0 if unknown
+	OriginalFilename string // Source file name before cleaning
+	OutputFilename   string // File name of the optimized output
+}
+
+// DefaultNFOTemplate is a minimal movie NFO as read by Kodi and Jellyfin. Values go
+// through the xml function, custom templates should do the same.
+const DefaultNFOTemplate = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<movie>
+  <title>{{xml .Title}}</title>
+{{- if .Year}}
+  <year>{{.Year}}</year>
+{{- end}}
+  <originalfilename>{{xml .OriginalFilename}}</originalfilename>
+</movie>
+`
+
+var titleYearRegex = regexp.MustCompile(`^(.*?)\s*\(((?:19|20)\d{2})\)$`)
+
+// ParseTitleYear splits a cleaned "Title (Year)" into its parts, the year is 0 when
+// the title has none
+func ParseTitleYear(cleaned string) (string, int) {
+	cleaned = strings.TrimSpace(cleaned)
+	if m := titleYearRegex.FindStringSubmatch(cleaned); m != nil && m[1] != "" {
+		year, _ := strconv.Atoi(m[2])
+		return m[1], year
+	}
+	return cleaned, 0
+}
+
+// RenderNFO renders an NFO from tmpl, DefaultNFOTemplate when empty
+func RenderNFO(tmpl string, info NFOInfo) (string, error) {
+	if tmpl == "" {
+		tmpl = DefaultNFOTemplate
+	}
+	t, err := template.New("nfo").Funcs(template.FuncMap{"xml": escapeXML}).Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid NFO template: %w", err)
+	}
+
+	var b bytes.Buffer
+	if err := t.Execute(&b, info); err != nil {
+		return "", fmt.Errorf("failed to render NFO: %w", err)
+	}
+	return b.String(), nil
+}
+
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
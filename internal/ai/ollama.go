@@ -5,13 +5,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 )
 
 type OllamaProvider struct {
-	Endpoint string
-	Model    string
+	Endpoint    string
+	Model       string
+	MaxAttempts int // Sends of a request answered with 429 or 5xx (0 = DefaultMaxAttempts)
 }
 
 func NewOllamaProvider(endpoint, model string) *OllamaProvider {
@@ -48,15 +48,12 @@ func (p *OllamaProvider) Analyze(ctx context.Context, prompt string) (string, er
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	status, body, err := doWithRetry(req, p.MaxAttempts)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("ollama api error (%d): %s", resp.StatusCode, string(body))
+	if status != http.StatusOK {
+		return "", fmt.Errorf("ollama api error (%d): %s", status, string(body))
 	}
 
 	var result struct {
@@ -13,9 +13,10 @@ import (
 )
 
 type OpenAIProvider struct {
-	APIKey   string
-	Endpoint string
-	Model    string
+	APIKey      string
+	Endpoint    string
+	Model       string
+	MaxAttempts int // Sends of a request answered with 429 or 5xx (0 = DefaultMaxAttempts)
 }
 
 func NewOpenAIProvider(apiKey, endpoint, model string) *OpenAIProvider {
@@ -57,15 +58,12 @@ func (p *OpenAIProvider) Analyze(ctx context.Context, prompt string) (string, er
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.APIKey))
 
-	resp, err := http.DefaultClient.Do(req)
+	status, body, err := doWithRetry(req, p.MaxAttempts)
 	if err != nil {
 		return "", err
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("openai api error (%d): %s", resp.StatusCode, string(body))
+	if status != http.StatusOK {
+		return "", fmt.Errorf("openai api error (%d): %s", status, string(body))
 	}
 
 	var result struct {
@@ -87,6 +85,30 @@ func (p *OpenAIProvider) Analyze(ctx context.Context, prompt string) (string, er
 	return "", fmt.Errorf("no response from openai")
 }
 func (p *OpenAIProvider) Transcribe(ctx context.Context, audioPath string) (string, error) {
+	srt, _, err := p.TranscribeWithLanguage(ctx, audioPath, "")
+	return srt, err
+}
+
+// TranscribeWithLanguage requests verbose JSON so the detected language is returned
+// alongside the segments, which are converted to SRT locally
+func (p *OpenAIProvider) TranscribeWithLanguage(ctx context.Context, audioPath, language string) (string, string, error) {
+	respBody, err := p.transcribe(ctx, audioPath, language)
+	if err != nil {
+		return "", "", err
+	}
+
+	var result struct {
+		Language string       `json:"language"`
+		Segments []SRTSegment `json:"segments"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", "", fmt.Errorf("failed to parse transcription: %w", err)
+	}
+
+	return FormatSRT(result.Segments), result.Language, nil
+}
+
+func (p *OpenAIProvider) transcribe(ctx context.Context, audioPath, language string) ([]byte, error) {
 	url := fmt.Sprintf("%s/audio/transcriptions", p.Endpoint)
 
 	// Create multipart body
@@ -96,43 +118,43 @@ func (p *OpenAIProvider) Transcribe(ctx context.Context, audioPath string) (stri
 	// Add file
 	file, err := os.Open(audioPath)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer file.Close()
 
 	part, err := writer.CreateFormFile("file", filepath.Base(audioPath))
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if _, err := io.Copy(part, file); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	// Add other fields
 	_ = writer.WriteField("model", "whisper-1")
-	_ = writer.WriteField("response_format", "srt")
+	_ = writer.WriteField("response_format", "verbose_json")
+	if language != "" {
+		_ = writer.WriteField("language", language)
+	}
 
 	if err := writer.Close(); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", p.APIKey))
 
-	resp, err := http.DefaultClient.Do(req)
+	status, respBody, err := doWithRetry(req, p.MaxAttempts)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	respBody, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("openai transcription error (%d): %s", resp.StatusCode, string(respBody))
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("openai transcription error (%d): %s", status, string(respBody))
 	}
 
-	return string(respBody), nil
+	return respBody, nil
 }
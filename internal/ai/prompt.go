@@ -0,0 +1,45 @@
+package ai
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// LoadPrompt parses a prompt override, Go text/template source or "@" followed by the
+// path of a file holding it, and returns def when the override is empty. The override
+// is rendered once with sample, a value of the type the prompt is rendered with, so a
+// template using variables the prompt doesn't have is rejected up front.
+func LoadPrompt(def *template.Template, override string, sample interface{}) (*template.Template, error) {
+	if override == "" {
+		return def, nil
+	}
+
+	source := override
+	if path, ok := strings.CutPrefix(override, "@"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s prompt template: %w", def.Name(), err)
+		}
+		source = string(data)
+	}
+
+	tmpl, err := template.New(def.Name()).Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s prompt template: %w", def.Name(), err)
+	}
+	if _, err := RenderPrompt(tmpl, sample); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// RenderPrompt executes a prompt template with data
+func RenderPrompt(tmpl *template.Template, data interface{}) (string, error) {
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, data); err != nil {
+		return "", fmt.Errorf("failed to render %s prompt: %w", tmpl.Name(), err)
+	}
+	return prompt.String(), nil
+}
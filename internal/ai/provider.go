@@ -15,25 +15,43 @@ type Provider interface {
 	GetName() string
 }
 
+// LanguageTranscriber is implemented by providers that can take a language hint
+// and report the spoken language detected during transcription
+type LanguageTranscriber interface {
+	// TranscribeWithLanguage returns the SRT content and the detected language.
+	// An empty language lets the provider auto-detect it.
+	TranscribeWithLanguage(ctx context.Context, audioPath, language string) (string, string, error)
+}
+
 // Config holds settings for AI providers
 type AIConfig struct {
 	Provider string
 	APIKey   string
 	Endpoint string
 	Model    string
+
+	MaxAttempts int // Sends of a request answered with 429 or 5xx (0 = DefaultMaxAttempts)
 }
 
 // NewProvider creates a new AI provider based on configuration
 func NewProvider(cfg AIConfig) (Provider, error) {
 	switch cfg.Provider {
 	case "gemini":
-		return NewGeminiProvider(cfg.APIKey, cfg.Model), nil
+		p := NewGeminiProvider(cfg.APIKey, cfg.Model)
+		p.MaxAttempts = cfg.MaxAttempts
+		return p, nil
 	case "openai":
-		return NewOpenAIProvider(cfg.APIKey, cfg.Endpoint, cfg.Model), nil
+		p := NewOpenAIProvider(cfg.APIKey, cfg.Endpoint, cfg.Model)
+		p.MaxAttempts = cfg.MaxAttempts
+		return p, nil
 	case "claude":
-		return NewClaudeProvider(cfg.APIKey, cfg.Model), nil
+		p := NewClaudeProvider(cfg.APIKey, cfg.Model)
+		p.MaxAttempts = cfg.MaxAttempts
+		return p, nil
 	case "ollama":
-		return NewOllamaProvider(cfg.Endpoint, cfg.Model), nil
+		p := NewOllamaProvider(cfg.Endpoint, cfg.Model)
+		p.MaxAttempts = cfg.MaxAttempts
+		return p, nil
 	case "none", "":
 		return nil, nil
 	default:
@@ -0,0 +1,94 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultMaxAttempts is how many times a request is sent when the provider keeps
+// answering 429 or 5xx
+const DefaultMaxAttempts = 3
+
+// Backoff between attempts, doubling from retryBaseDelay. A Retry-After header replaces
+// it, up to maxRetryDelay.
+var (
+	retryBaseDelay = time.Second
+	maxRetryDelay  = time.Minute
+)
+
+// doWithRetry sends req and returns the status and body of the response. Rate limited
+// (429) and server error (5xx) responses are retried with exponential backoff, honoring
+// Retry-After, up to maxAttempts sends in all (0 uses DefaultMaxAttempts). The last
+// response is returned when every attempt failed, for the caller to report.
+func doWithRetry(req *http.Request, maxAttempts int) (int, []byte, error) {
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	// A body can only be sent again if the request can recreate it
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		maxAttempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return 0, nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0, nil, err
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !retryable || attempt >= maxAttempts {
+			return resp.StatusCode, body, nil
+		}
+
+		delay := retryDelay(resp.Header.Get("Retry-After"), attempt, time.Now())
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return 0, nil, fmt.Errorf("gave up retrying after status %d: %w", resp.StatusCode, err)
+		}
+	}
+}
+
+// retryDelay is the wait before the attempt after the given one, the Retry-After value
+// (seconds or an HTTP date) when the provider sent one
+func retryDelay(retryAfter string, attempt int, now time.Time) time.Duration {
+	delay := retryBaseDelay << (attempt - 1)
+	if retryAfter != "" {
+		if secs, err := strconv.Atoi(retryAfter); err == nil && secs >= 0 {
+			delay = time.Duration(secs) * time.Second
+		} else if at, err := http.ParseTime(retryAfter); err == nil {
+			delay = at.Sub(now)
+		}
+	}
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+	return delay
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -3,19 +3,60 @@ package search
 import (
 	"context"
 	"fmt"
+	"log"
 	"strings"
+	"text/template"
 
 	"github.com/Vasteva/MediaConverter/internal/ai"
 )
 
 // Searcher handles AI-powered natural language search
 type Searcher struct {
-	provider ai.Provider
+	provider    ai.Provider
+	matchPrompt *template.Template
+}
+
+// matchData is what the Match prompt is rendered with
+type matchData struct {
+	Query   string
+	Library string // One "- ID: <id>, Title: <title>" line per item
+	Items   []MediaItem
+}
+
+var defaultMatchPrompt = template.Must(template.New("search").Parse(`
+		You are a media discovery assistant. A user is searching for media with the query: "{{.Query}}"
+		
+		Here is the media library:
+		{{.Library}}
+		
+		Rank the media items by relevance to the query. 
+		Return ONLY a comma-separated list of the matching IDs in order of relevance.
+		If no items match, return "NONE".
+		
+		Example Output: 20240101-abc, 20240102-def
+	`))
+
+// LoadMatchPrompt parses a Match prompt override, rendered with {{.Query}}, {{.Library}}
+// and {{.Items}} (each with .ID, .Title and .Path)
+func LoadMatchPrompt(override string) (*template.Template, error) {
+	return ai.LoadPrompt(defaultMatchPrompt, override, matchData{})
 }
 
 // NewSearcher creates a new searcher
 func NewSearcher(p ai.Provider) *Searcher {
-	return &Searcher{provider: p}
+	return &Searcher{provider: p, matchPrompt: defaultMatchPrompt}
+}
+
+// NewSearcherWithPrompt creates a searcher using a Match prompt override. An override
+// that fails to load is logged and the built-in prompt used instead.
+func NewSearcherWithPrompt(p ai.Provider, override string) *Searcher {
+	s := NewSearcher(p)
+	if tmpl, err := LoadMatchPrompt(override); err != nil {
+		log.Printf("[AI] %v, using the built-in prompt", err)
+	} else {
+		s.matchPrompt = tmpl
+	}
+	return s
 }
 
 // MediaItem represents a searchable item
@@ -41,18 +82,10 @@ func (s *Searcher) Match(ctx context.Context, query string, items []MediaItem) (
 		libraryBuilder.WriteString(fmt.Sprintf("- ID: %s, Title: %s\n", item.ID, item.Title))
 	}
 
-	prompt := fmt.Sprintf(`
-		You are a media discovery assistant. A user is searching for media with the query: "%s"
-		
-		Here is the media library:
-		%s
-		
-		Rank the media items by relevance to the query. 
-		Return ONLY a comma-separated list of the matching IDs in order of relevance.
-		If no items match, return "NONE".
-		
-		Example Output: 20240101-abc, 20240102-def
-	`, query, libraryBuilder.String())
+	prompt, err := ai.RenderPrompt(s.matchPrompt, matchData{Query: query, Library: libraryBuilder.String(), Items: items})
+	if err != nil {
+		return nil, err
+	}
 
 	response, err := s.provider.Analyze(ctx, prompt)
 	if err != nil {
@@ -0,0 +1,34 @@
+package ai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SRTSegment is a timed piece of transcribed text
+type SRTSegment struct {
+	Start float64 `json:"start"` // Seconds
+	End   float64 `json:"end"`   // Seconds
+	Text  string  `json:"text"`
+}
+
+// FormatSRT renders transcription segments as an SRT document
+func FormatSRT(segments []SRTSegment) string {
+	var b strings.Builder
+	for i, seg := range segments {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1, formatSRTTime(seg.Start), formatSRTTime(seg.End), strings.TrimSpace(seg.Text))
+	}
+	return b.String()
+}
+
+// formatSRTTime formats seconds as HH:MM:SS,mmm
+func formatSRTTime(seconds float64) string {
+	ms := int64(seconds*1000 + 0.5)
+	h := ms / 3600000
+	ms -= h * 3600000
+	m := ms / 60000
+	ms -= m * 60000
+	s := ms / 1000
+	ms -= s * 1000
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", h, m, s, ms)
+}
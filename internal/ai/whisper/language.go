@@ -0,0 +1,73 @@
+package whisper
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// UndeterminedLanguage is used when the subtitle language is unknown
+const UndeterminedLanguage = "und"
+
+type language struct {
+	name  string // As reported by Whisper, e.g. "english"
+	code  string // ISO 639-1, used in sidecar filenames
+	code3 string // ISO 639-2/B, used in container metadata
+}
+
+var languages = []language{
+	{"english", "en", "eng"},
+	{"spanish", "es", "spa"},
+	{"french", "fr", "fre"},
+	{"german", "de", "ger"},
+	{"italian", "it", "ita"},
+	{"portuguese", "pt", "por"},
+	{"dutch", "nl", "dut"},
+	{"russian", "ru", "rus"},
+	{"japanese", "ja", "jpn"},
+	{"chinese", "zh", "chi"},
+	{"korean", "ko", "kor"},
+	{"arabic", "ar", "ara"},
+	{"hindi", "hi", "hin"},
+	{"swedish", "sv", "swe"},
+	{"norwegian", "no", "nor"},
+	{"danish", "da", "dan"},
+	{"finnish", "fi", "fin"},
+	{"polish", "pl", "pol"},
+	{"turkish", "tr", "tur"},
+	{"greek", "el", "gre"},
+	{"hebrew", "he", "heb"},
+	{"czech", "cs", "cze"},
+	{"hungarian", "hu", "hun"},
+	{"ukrainian", "uk", "ukr"},
+}
+
+func lookupLanguage(lang string) (language, bool) {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	for _, l := range languages {
+		if lang == l.name || lang == l.code || lang == l.code3 {
+			return l, true
+		}
+	}
+	return language{}, false
+}
+
+// LanguageCode normalizes a language name or code to ISO 639-1 ("und" if unknown)
+func LanguageCode(lang string) string {
+	if l, ok := lookupLanguage(lang); ok {
+		return l.code
+	}
+	return UndeterminedLanguage
+}
+
+// StreamLanguage returns the ISO 639-2 code used for container stream metadata ("und" if unknown)
+func StreamLanguage(lang string) string {
+	if l, ok := lookupLanguage(lang); ok {
+		return l.code3
+	}
+	return UndeterminedLanguage
+}
+
+// SRTPath returns the sidecar subtitle path for a video, tagged with the language (e.g. movie.en.srt)
+func SRTPath(videoPath, lang string) string {
+	return strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + "." + LanguageCode(lang) + ".srt"
+}
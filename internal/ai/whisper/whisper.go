@@ -6,48 +6,88 @@ import (
 	"log"
 	"os"
 	"os/exec"
-	"path/filepath"
-	"strings"
 
 	"github.com/Vasteva/MediaConverter/internal/ai"
 )
 
 type Generator struct {
 	provider ai.Provider
+	tempDir  string
 }
 
-func NewGenerator(p ai.Provider) *Generator {
-	return &Generator{provider: p}
+// Subtitles describes a generated subtitle file
+type Subtitles struct {
+	Path     string
+	Language string // ISO 639-1 code, or "und" if unknown
 }
 
-// GenerateSRT extracts audio from a video and generates an SRT file
-func (g *Generator) GenerateSRT(ctx context.Context, videoPath string) (string, error) {
+// NewGenerator creates a subtitle generator that extracts audio into tempDir
+// (the system temp dir if empty)
+func NewGenerator(p ai.Provider, tempDir string) *Generator {
+	if tempDir == "" {
+		tempDir = os.TempDir()
+	}
+	return &Generator{provider: p, tempDir: tempDir}
+}
+
+// GenerateSRT extracts audio from a video and generates an SRT file.
+// If language is empty, the language detected by the provider is used when available.
+func (g *Generator) GenerateSRT(ctx context.Context, videoPath, language string) (*Subtitles, error) {
 	if g.provider == nil {
-		return "", fmt.Errorf("AI provider not configured")
+		return nil, fmt.Errorf("AI provider not configured")
 	}
 
 	// 1. Extract audio to a temporary file
-	audioPath := filepath.Join(os.TempDir(), fmt.Sprintf("vastiva_audio_%d.mp3", os.Getpid()))
+	audioPath, err := g.newAudioPath()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp audio file: %v", err)
+	}
 	defer os.Remove(audioPath)
 
 	log.Printf("[Whisper] Extracting audio for transcription: %s", videoPath)
 	cmd := exec.CommandContext(ctx, "ffmpeg", "-i", videoPath, "-vn", "-acodec", "libmp3lame", "-ar", "16000", "-ac", "1", "-b:a", "64k", "-y", audioPath)
 	if output, err := cmd.CombinedOutput(); err != nil {
-		return "", fmt.Errorf("failed to extract audio: %v (Output: %s)", err, string(output))
+		return nil, fmt.Errorf("failed to extract audio: %v (Output: %s)", err, string(output))
 	}
 
 	// 2. Call AI provider to transcribe
 	log.Printf("[Whisper] Transcribing audio with %s...", g.provider.GetName())
-	srtContent, err := g.provider.Transcribe(ctx, audioPath)
+	var srtContent, detected string
+	if lt, ok := g.provider.(ai.LanguageTranscriber); ok {
+		hint := ""
+		if code := LanguageCode(language); code != UndeterminedLanguage {
+			hint = code
+		}
+		srtContent, detected, err = lt.TranscribeWithLanguage(ctx, audioPath, hint)
+	} else {
+		srtContent, err = g.provider.Transcribe(ctx, audioPath)
+	}
 	if err != nil {
-		return "", fmt.Errorf("transcription failed: %v", err)
+		return nil, fmt.Errorf("transcription failed: %v", err)
 	}
 
-	// 3. Save SRT content to a file
-	srtPath := strings.TrimSuffix(videoPath, filepath.Ext(videoPath)) + ".srt"
-	if err := os.WriteFile(srtPath, []byte(srtContent), 0644); err != nil {
-		return "", fmt.Errorf("failed to save SRT: %v", err)
+	if language == "" {
+		language = detected
 	}
 
-	return srtPath, nil
+	// 3. Save SRT content to a language-tagged file
+	subs := &Subtitles{
+		Path:     SRTPath(videoPath, language),
+		Language: LanguageCode(language),
+	}
+	if err := os.WriteFile(subs.Path, []byte(srtContent), 0644); err != nil {
+		return nil, fmt.Errorf("failed to save SRT: %v", err)
+	}
+
+	return subs, nil
+}
+
+// newAudioPath reserves a unique file in the temp dir for extracted audio
+func (g *Generator) newAudioPath() (string, error) {
+	f, err := os.CreateTemp(g.tempDir, "vastiva_audio_*.mp3")
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	return f.Name(), nil
 }
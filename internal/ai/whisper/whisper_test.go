@@ -0,0 +1,52 @@
+package whisper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSubtitleLanguageDerivation(t *testing.T) {
+	tests := []struct {
+		detected   string
+		wantPath   string
+		wantStream string
+	}{
+		{"english", "/output/movie.en.srt", "eng"},
+		{"German", "/output/movie.de.srt", "ger"},
+		{"fr", "/output/movie.fr.srt", "fre"},
+		{"jpn", "/output/movie.ja.srt", "jpn"},
+		{"", "/output/movie.und.srt", "und"},
+		{"klingon", "/output/movie.und.srt", "und"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.detected, func(t *testing.T) {
+			if got := SRTPath("/output/movie.mkv", tt.detected); got != tt.wantPath {
+				t.Errorf("SRTPath() = %s, want %s", got, tt.wantPath)
+			}
+			if got := StreamLanguage(tt.detected); got != tt.wantStream {
+				t.Errorf("StreamLanguage() = %s, want %s", got, tt.wantStream)
+			}
+		})
+	}
+}
+
+func TestAudioPathUsesTempDir(t *testing.T) {
+	tempDir := t.TempDir()
+	g := NewGenerator(nil, tempDir)
+
+	path, err := g.newAudioPath()
+	if err != nil {
+		t.Fatalf("newAudioPath() failed: %v", err)
+	}
+	defer os.Remove(path)
+
+	if filepath.Dir(path) != tempDir {
+		t.Errorf("expected audio in %s, got %s", tempDir, path)
+	}
+
+	if NewGenerator(nil, "").tempDir != os.TempDir() {
+		t.Error("expected default temp dir to be os.TempDir()")
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"crypto/sha256"
+	"crypto/subtle"
 	"fmt"
 	"time"
 
@@ -18,8 +19,10 @@ func AuthMiddleware(cfg *config.Config) fiber.Handler {
 			return c.Next()
 		}
 
+		settings := cfg.Snapshot()
+
 		// If not initialized, allow all setup routes
-		if !cfg.IsInitialized && (path == "/api/setup/probes" || path == "/api/setup/complete") {
+		if !settings.IsInitialized && (path == "/api/setup/probes" || path == "/api/setup/complete") {
 			return c.Next()
 		}
 
@@ -39,14 +42,26 @@ func AuthMiddleware(cfg *config.Config) fiber.Handler {
 		// Validate token
 		// For simplicity without a database, we compare it against a hash of the admin password
 		// In a real production app, you'd use JWT or a proper session store.
-		if !validateToken(token, cfg.AdminPassword) {
-			return c.Status(401).JSON(fiber.Map{"error": "Unauthorized: Invalid token"})
+		if validateToken(token, settings.AdminPassword) {
+			return c.Next()
+		}
+
+		// The read-only key may look but not change anything
+		if validateReadOnlyKey(token, settings.ReadOnlyAPIKey) {
+			if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead {
+				return c.Status(403).JSON(fiber.Map{"error": "Forbidden: read-only token"})
+			}
+			c.Locals(readOnlyLocal, true)
+			return c.Next()
 		}
 
-		return c.Next()
+		return c.Status(401).JSON(fiber.Map{"error": "Unauthorized: Invalid token"})
 	}
 }
 
+// readOnlyLocal marks requests authenticated with the read-only API key
+const readOnlyLocal = "readOnly"
+
 // GenerateToken creates a simple token for the session
 func GenerateToken(password string) string {
 	// A simple token could be a hash of the password + today's date
@@ -56,6 +71,14 @@ func GenerateToken(password string) string {
 	return fmt.Sprintf("%x", hash)
 }
 
+// validateReadOnlyKey reports whether token is the configured read-only API key
+func validateReadOnlyKey(token, key string) bool {
+	if key == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1
+}
+
 func validateToken(token, password string) bool {
 	if password == "" {
 		// If no password set, we might want to allow all or reject all.
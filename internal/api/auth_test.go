@@ -3,8 +3,16 @@ package api
 import (
 	"crypto/sha256"
 	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/jobs"
+	"github.com/gofiber/fiber/v2"
 )
 
 func TestGenerateToken(t *testing.T) {
@@ -75,3 +83,47 @@ func getYesterdaysToken(password string) string {
 	hash := sha256.Sum256([]byte(password + salt))
 	return fmt.Sprintf("%x", hash)
 }
+
+func TestReadOnlyAPIKey(t *testing.T) {
+	sourceDir := t.TempDir()
+	source := filepath.Join(sourceDir, "movie.mkv")
+	if err := os.WriteFile(source, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{SourceDir: sourceDir, AdminPassword: "secret", ReadOnlyAPIKey: "viewer-key", IsInitialized: true}
+	jm, _ := jobs.NewManager(cfg, nil, "")
+	app := fiber.New()
+	RegisterRoutes(app, jm, nil, cfg)
+
+	request := func(method, path, token string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"type":"optimize","sourcePath":"`+source+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := request("GET", "/api/jobs", "viewer-key"); code != 200 {
+		t.Errorf("expected read-only key to list jobs, got %d", code)
+	}
+	if code := request("POST", "/api/jobs", "viewer-key"); code != 403 {
+		t.Errorf("expected read-only key to be refused job creation, got %d", code)
+	}
+	if code := request("DELETE", "/api/jobs/some-job", "viewer-key"); code != 403 {
+		t.Errorf("expected read-only key to be refused cancellation, got %d", code)
+	}
+	if code := request("GET", "/api/jobs", "wrong-key"); code != 401 {
+		t.Errorf("expected unknown key to be unauthorized, got %d", code)
+	}
+
+	// The admin token keeps full access
+	if code := request("POST", "/api/jobs", GenerateToken("secret")); code != 201 {
+		t.Errorf("expected admin token to be allowed to create jobs, got %d", code)
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"log"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/media"
+	"github.com/Vasteva/MediaConverter/internal/system"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Capabilities is the response body of /api/capabilities, the options the UI can offer
+// on this host
+type Capabilities struct {
+	GPUVendor          string             `json:"gpuVendor"`
+	VideoEncoders      []encoderAvailable `json:"videoEncoders"`
+	AudioCodecs        []string           `json:"audioCodecs"` // Audio codec settings ffmpeg can encode
+	Containers         []string           `json:"containers"`
+	Presets            []string           `json:"presets"`
+	UpscaleResolutions []string           `json:"upscaleResolutions"`
+	Encoders           []string           `json:"encoders"` // Every encoder ffmpeg reports
+}
+
+// encoderAvailable is the video encoder a GPU vendor uses and whether ffmpeg has it
+type encoderAvailable struct {
+	Vendor    string `json:"vendor"`
+	Encoder   string `json:"encoder"`
+	Available bool   `json:"available"`
+}
+
+// listEncoders probes ffmpeg for its encoders, replaced in tests
+var listEncoders = system.ListEncoders
+
+func RegisterCapabilitiesRoutes(api fiber.Router, cfg *config.Config) {
+	api.Get("/capabilities", func(c *fiber.Ctx) error {
+		settings := cfg.Snapshot()
+		encoders, err := listEncoders(settings.FFmpegPath)
+		if err != nil {
+			log.Printf("[Capabilities] %v", err)
+		}
+		return c.JSON(buildCapabilities(settings.GPUVendor, encoders))
+	})
+}
+
+// buildCapabilities assembles the capabilities for a GPU vendor from the encoders ffmpeg
+// reports. Audio codecs and video encoders ffmpeg lacks are left out or marked unavailable.
+func buildCapabilities(gpuVendor string, encoders []string) Capabilities {
+	have := make(map[string]bool, len(encoders))
+	for _, e := range encoders {
+		have[e] = true
+	}
+
+	caps := Capabilities{
+		GPUVendor:          gpuVendor,
+		AudioCodecs:        []string{},
+		Containers:         config.Containers,
+		UpscaleResolutions: media.UpscaleResolutions,
+		Encoders:           encoders,
+	}
+	if caps.Encoders == nil {
+		caps.Encoders = []string{}
+	}
+
+	for _, vendor := range []media.GPUVendor{media.GPUVendorNvidia, media.GPUVendorIntel, media.GPUVendorAMD, media.GPUVendorCPU} {
+		encoder := media.VideoEncoders[vendor]
+		caps.VideoEncoders = append(caps.VideoEncoders, encoderAvailable{
+			Vendor:    string(vendor),
+			Encoder:   encoder,
+			Available: have[encoder],
+		})
+	}
+
+	for _, codec := range config.AudioCodecs {
+		if encoder, ok := media.AudioEncoders[codec]; !ok || have[encoder] {
+			caps.AudioCodecs = append(caps.AudioCodecs, codec) // "copy" needs no encoder
+		}
+	}
+
+	for _, preset := range media.Presets {
+		caps.Presets = append(caps.Presets, string(preset))
+	}
+	return caps
+}
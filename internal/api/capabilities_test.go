@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCapabilities(t *testing.T) {
+	caps := buildCapabilities("nvidia", []string{"libx265", "hevc_nvenc", "aac", "libopus"})
+
+	if caps.GPUVendor != "nvidia" {
+		t.Errorf("expected the configured vendor, got %q", caps.GPUVendor)
+	}
+	available := map[string]bool{}
+	for _, e := range caps.VideoEncoders {
+		available[e.Vendor] = e.Available
+	}
+	if !available["nvidia"] || !available["cpu"] || available["intel"] || available["amd"] {
+		t.Errorf("unexpected video encoder availability: %+v", caps.VideoEncoders)
+	}
+	if fmt.Sprint(caps.AudioCodecs) != "[copy aac opus]" {
+		t.Errorf("expected ac3 to be left out without its encoder, got %v", caps.AudioCodecs)
+	}
+	if fmt.Sprint(caps.Presets) != "[fast medium slow]" || fmt.Sprint(caps.UpscaleResolutions) != "[1080p 4k]" {
+		t.Errorf("unexpected presets or resolutions: %v %v", caps.Presets, caps.UpscaleResolutions)
+	}
+
+	// Without ffmpeg only options that need no encoder remain
+	defer func(orig func(string) ([]string, error)) { listEncoders = orig }(listEncoders)
+	listEncoders = func(string) ([]string, error) { return nil, fmt.Errorf("ffmpeg not found") }
+
+	app := fiber.New()
+	RegisterCapabilitiesRoutes(app.Group("/api"), &config.Config{GPUVendor: "cpu"})
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/capabilities", nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var got Capabilities
+	json.NewDecoder(resp.Body).Decode(&got)
+	if resp.StatusCode != 200 || fmt.Sprint(got.AudioCodecs) != "[copy]" || len(got.Encoders) != 0 {
+		t.Errorf("unexpected capabilities without ffmpeg: %d %+v", resp.StatusCode, got)
+	}
+}
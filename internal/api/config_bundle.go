@@ -0,0 +1,162 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Vasteva/MediaConverter/internal/ai"
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/events"
+	"github.com/Vasteva/MediaConverter/internal/jobs"
+	"github.com/Vasteva/MediaConverter/internal/media"
+	"github.com/Vasteva/MediaConverter/internal/scanner"
+	"github.com/Vasteva/MediaConverter/internal/security"
+	"github.com/gofiber/fiber/v2"
+)
+
+// configBundleVersion is the current format of exported config bundles
+const configBundleVersion = 1
+
+// ConfigBundle is the full configuration exported from one host to set up another
+type ConfigBundle struct {
+	Version    int                    `json:"version"`
+	ExportedAt time.Time              `json:"exportedAt"`
+	Config     *config.Config         `json:"config"`
+	Scanner    *scanner.ScannerConfig `json:"scanner,omitempty"`
+}
+
+func RegisterConfigBundleRoutes(api fiber.Router, jm *jobs.Manager, fs *scanner.Scanner, cfg *config.Config) {
+	// Secrets are masked unless includeSecrets=true and confirm=true are both given
+	api.Get("/config/export", func(c *fiber.Ctx) error {
+		includeSecrets := c.QueryBool("includeSecrets")
+		if includeSecrets && !c.QueryBool("confirm") {
+			return c.Status(400).JSON(fiber.Map{"error": "including secrets requires confirm=true"})
+		}
+		if includeSecrets && c.Locals(readOnlyLocal) == true {
+			return c.Status(403).JSON(fiber.Map{"error": "Forbidden: read-only token cannot export secrets"})
+		}
+
+		bundle := ConfigBundle{Version: configBundleVersion, ExportedAt: time.Now(), Config: cfg.Snapshot()}
+		if !includeSecrets {
+			bundle.Config.MaskSecrets()
+		}
+		if fs != nil {
+			bundle.Scanner = fs.GetConfig()
+		}
+		return c.JSON(bundle)
+	})
+
+	// Applies a bundle once all of it validates. This host keeps its own port and
+	// directories, and masked secrets keep their current value.
+	api.Post("/config/import", func(c *fiber.Ctx) error {
+		var bundle ConfigBundle
+		if err := c.BodyParser(&bundle); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if problems := validateConfigBundle(&bundle, cfg); len(problems) > 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid config bundle", "problems": problems})
+		}
+		if bundle.Scanner != nil && fs == nil {
+			return c.Status(503).JSON(fiber.Map{"error": "Scanner not initialized"})
+		}
+
+		changed := cfg.Import(bundle.Config)
+		if err := cfg.Save(); err != nil {
+			log.Printf("Failed to save config: %v", err)
+		}
+		updateAIProvider(jm, cfg)
+
+		if bundle.Scanner != nil {
+			settings := cfg.Snapshot()
+			for i, dir := range bundle.Scanner.WatchDirectories {
+				bundle.Scanner.WatchDirectories[i].Path, _ = security.ValidatePath(dir.Path, settings.SourceDir)
+			}
+			if bundle.Scanner.OutputDirectory != "" {
+				bundle.Scanner.OutputDirectory, _ = security.ValidatePath(bundle.Scanner.OutputDirectory, settings.DestDir)
+			}
+			if err := fs.UpdateConfig(bundle.Scanner); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+
+		log.Printf("Configuration imported, %d settings changed", len(changed))
+		jm.Events.Append(events.Event{Type: events.ConfigChanged, Message: "Settings imported"})
+
+		if changed == nil {
+			changed = []string{}
+		}
+		return c.JSON(fiber.Map{"success": true, "changed": changed})
+	})
+}
+
+// validateConfigBundle lists everything that would stop a bundle from being imported,
+// using the same checks as the config and scanner config endpoints
+func validateConfigBundle(bundle *ConfigBundle, cfg *config.Config) []string {
+	if bundle.Version > configBundleVersion {
+		return []string{fmt.Sprintf("bundle version %d is newer than supported version %d", bundle.Version, configBundleVersion)}
+	}
+	if bundle.Config == nil {
+		return []string{"bundle has no config"}
+	}
+
+	var problems []string
+	next := bundle.Config
+	if err := config.ValidateOutput(next.AudioCodec, next.Container); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := config.ValidateCRF(next.CRF); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := config.ValidateGPUDevice(next.GPUVendor, next.GPUDevice); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := config.ValidateSameOutputAction(next.SameOutputAction); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := config.ValidateUploadCleanup(next.UploadCleanup); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := config.ValidateEfficiencyAIWeight(next.EfficiencyAIWeight); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := media.ValidateLanguages(next.SubtitleLanguageList()); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := next.ValidateEncoderTuning(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := validateBitrates(next.MaxBitrate, next.BufSize); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := validateAudioBitrate(next.AudioBitrate); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := next.OutputMode(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if bundle.Scanner != nil {
+		for _, problem := range validateScannerConfig(bundle.Scanner, cfg) {
+			problems = append(problems, "scanner: "+problem)
+		}
+	}
+	return problems
+}
+
+// updateAIProvider re-initializes the job manager's AI provider from the config
+func updateAIProvider(jm *jobs.Manager, cfg *config.Config) {
+	settings := cfg.Snapshot()
+	provider, err := ai.NewProvider(ai.AIConfig{
+		Provider: settings.AIProvider,
+		APIKey:   settings.AIApiKey,
+		Endpoint: settings.AIEndpoint,
+		Model:    settings.AIModel,
+
+		MaxAttempts: settings.AIMaxAttempts,
+	})
+	if err != nil {
+		log.Printf("Error updating AI provider: %v", err)
+		return
+	}
+	jm.UpdateAIProvider(provider)
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/jobs"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestConfigBundleRoundTrip(t *testing.T) {
+	source := &config.Config{
+		SourceDir: "/old/source", DestDir: "/old/dest",
+		GPUVendor: "nvidia", GPUDevice: "1", QualityPreset: "slow", CRF: 20,
+		MaxBitrate: "8M", AudioCodec: "aac", Container: "mp4", MaxConcurrentJobs: 3,
+		AIProvider: "openai", AIApiKey: "sk-source-secret-key", AdminPassword: "source-password",
+		RipDir: "/old/rips", NFOTemplate: "/old/movie.nfo.tmpl", ScannerProcessedFile: "/old/processed.json", OutputUID: 1000,
+		AIPromptSearch: "@/old/search.tmpl", AIPromptCleanFilename: "Clean {{.Filename}}",
+		IsInitialized: true,
+	}
+	jm, _ := jobs.NewManager(source, nil, "")
+	app := fiber.New()
+	RegisterConfigBundleRoutes(app.Group("/api"), jm, nil, source)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/config/export", nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var bundle ConfigBundle
+	if err := json.NewDecoder(resp.Body).Decode(&bundle); err != nil {
+		t.Fatalf("failed to decode bundle: %v", err)
+	}
+	if bundle.Version != configBundleVersion || bundle.Config == nil {
+		t.Fatalf("unexpected bundle %+v", bundle)
+	}
+	if bundle.Config.AIApiKey == source.AIApiKey || bundle.Config.AdminPassword == source.AdminPassword {
+		t.Fatal("expected secrets to be masked in the export")
+	}
+
+	target := &config.Config{
+		SourceDir: "/new/source", DestDir: "/new/dest", GPUVendor: "cpu", CRF: 28,
+		AIApiKey: "sk-target-secret-key", AdminPassword: "target-password", IsInitialized: true,
+		RipDir: "/new/rips", ScannerProcessedFile: "/new/processed.json", AIPromptSearch: "@/new/search.tmpl",
+	}
+	if problems := validateConfigBundle(&bundle, target); len(problems) != 0 {
+		t.Fatalf("expected the bundle to validate, got %v", problems)
+	}
+	target.Import(bundle.Config)
+
+	if target.GPUVendor != "nvidia" || target.GPUDevice != "1" || target.QualityPreset != "slow" || target.CRF != 20 ||
+		target.MaxBitrate != "8M" || target.AudioCodec != "aac" || target.Container != "mp4" ||
+		target.MaxConcurrentJobs != 3 || target.AIProvider != "openai" {
+		t.Errorf("expected settings to be imported, got %+v", target.Snapshot())
+	}
+	if target.SourceDir != "/new/source" || target.DestDir != "/new/dest" {
+		t.Errorf("expected this host's directories to be kept, got %s and %s", target.SourceDir, target.DestDir)
+	}
+	if target.RipDir != "/new/rips" || target.NFOTemplate != "" || target.ScannerProcessedFile != "/new/processed.json" || target.OutputUID != 0 {
+		t.Errorf("expected this host's paths and ownership to be kept, got %+v", target.Snapshot())
+	}
+	if target.AIPromptSearch != "@/new/search.tmpl" || target.AIPromptCleanFilename != "Clean {{.Filename}}" {
+		t.Errorf("expected inline prompts imported and prompt files kept, got %q and %q", target.AIPromptCleanFilename, target.AIPromptSearch)
+	}
+	if target.AIApiKey != "sk-target-secret-key" || target.AdminPassword != "target-password" || !target.IsInitialized {
+		t.Error("expected masked secrets and state to be kept")
+	}
+}
+
+func TestConfigBundleExportSecrets(t *testing.T) {
+	cfg := &config.Config{AdminPassword: "secret", ReadOnlyAPIKey: "viewer-key", AIApiKey: "sk-secret-key-value", IsInitialized: true}
+	jm, _ := jobs.NewManager(cfg, nil, "")
+	app := fiber.New()
+	RegisterRoutes(app, jm, nil, cfg)
+
+	export := func(query, token string) (int, ConfigBundle) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/api/config/export"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var bundle ConfigBundle
+		json.NewDecoder(resp.Body).Decode(&bundle)
+		return resp.StatusCode, bundle
+	}
+
+	admin := GenerateToken("secret")
+	if code, _ := export("?includeSecrets=true", admin); code != 400 {
+		t.Errorf("expected secrets without confirm to be rejected, got %d", code)
+	}
+	if code, bundle := export("?includeSecrets=true&confirm=true", admin); code != 200 || bundle.Config.AIApiKey != "sk-secret-key-value" {
+		t.Errorf("expected confirmed export to include secrets, got %d", code)
+	}
+	if code, _ := export("?includeSecrets=true&confirm=true", "viewer-key"); code != 403 {
+		t.Errorf("expected the read-only key to be refused secrets, got %d", code)
+	}
+	if code, bundle := export("", "viewer-key"); code != 200 || bundle.Config.AIApiKey == "sk-secret-key-value" {
+		t.Errorf("expected a masked export for the read-only key, got %d", code)
+	}
+}
+
+func TestConfigBundleImportRejectsInvalid(t *testing.T) {
+	cfg := &config.Config{CRF: 23, AudioCodec: "copy"}
+	jm, _ := jobs.NewManager(cfg, nil, "")
+	app := fiber.New()
+	RegisterConfigBundleRoutes(app.Group("/api"), jm, nil, cfg)
+
+	body := `{"version":1,"config":{"crf":18,"audioCodec":"flac","maxBitrate":"fast"}}`
+	req := httptest.NewRequest("POST", "/api/config/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Problems []string `json:"problems"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != 400 || len(result.Problems) != 2 {
+		t.Errorf("expected 400 listing both problems, got %d %v", resp.StatusCode, result.Problems)
+	}
+	if cfg.CRF != 23 || cfg.AudioCodec != "copy" {
+		t.Error("expected nothing to be applied from an invalid bundle")
+	}
+}
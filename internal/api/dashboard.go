@@ -0,0 +1,61 @@
+package api
+
+import (
+	"github.com/Vasteva/MediaConverter/internal/scanner"
+	"github.com/Vasteva/MediaConverter/internal/system"
+)
+
+// buildDashboardStats totals the savings and AI features of the processed files.
+// aiWeight is the percent of the efficiency score that is AI feature usage.
+func buildDashboardStats(processed []scanner.ProcessedFile, aiWeight int) system.DashboardStats {
+	stats := system.DashboardStats{}
+
+	for _, f := range processed {
+		if f.InputSize > 0 && f.OutputSize > 0 {
+			saved := f.InputSize - f.OutputSize
+			if saved > 0 {
+				stats.TotalStorageSaved += saved
+			}
+		}
+		if f.AISubtitles {
+			stats.TotalSubtitlesCreated++
+		}
+		if f.AIUpscale {
+			stats.TotalUpscales++
+		}
+		if f.AICleaned {
+			stats.TotalCleaned++
+		}
+		if f.AISubtitles || f.AIUpscale || f.AICleaned {
+			stats.TotalAIJobs++
+		}
+	}
+
+	stats.EfficiencyScore = efficiencyScore(processed, stats.TotalAIJobs, aiWeight)
+	return stats
+}
+
+// efficiencyScore rates the processed files out of 100: the compression achieved
+// (1 - output/input, summed over the files with both sizes so large files weigh more),
+// blended with the share of files that used an AI feature by aiWeight percent
+func efficiencyScore(processed []scanner.ProcessedFile, aiJobs, aiWeight int) float64 {
+	if len(processed) == 0 {
+		return 0
+	}
+
+	var input, output int64
+	for _, f := range processed {
+		if f.InputSize > 0 && f.OutputSize > 0 {
+			input += f.InputSize
+			output += f.OutputSize
+		}
+	}
+	compression := 0.0
+	if input > 0 && output < input {
+		compression = 1 - float64(output)/float64(input)
+	}
+
+	weight := float64(aiWeight) / 100
+	aiUsage := float64(aiJobs) / float64(len(processed))
+	return 100 * ((1-weight)*compression + weight*aiUsage)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Vasteva/MediaConverter/internal/scanner"
+)
+
+func TestDashboardEfficiencyScore(t *testing.T) {
+	processed := []scanner.ProcessedFile{
+		{Path: "/a.mkv", InputSize: 6000, OutputSize: 1500, AICleaned: true}, // 75% smaller
+		{Path: "/b.mkv", InputSize: 4000, OutputSize: 2500},                  // 37.5% smaller
+		{Path: "/c.iso"}, // Sizes unknown, left out of the compression
+		{Path: "/d.mkv", InputSize: 1000, OutputSize: 1500}, // Grew
+	}
+
+	tests := []struct {
+		aiWeight int
+		want     float64
+	}{
+		// 11000 bytes in, 5500 out: 50% smaller by size
+		{0, 50},
+		// Blended with the share of files using AI, 1 of 4
+		{50, 0.5*50 + 0.5*25},
+		{100, 25},
+		{20, 0.8*50 + 0.2*25},
+	}
+	for _, tt := range tests {
+		stats := buildDashboardStats(processed, tt.aiWeight)
+		if math.Abs(stats.EfficiencyScore-tt.want) > 1e-9 {
+			t.Errorf("aiWeight %d: expected score %v, got %v", tt.aiWeight, tt.want, stats.EfficiencyScore)
+		}
+	}
+
+	// Without AI usage the weight only scales the compression
+	plain := processed[1:2]
+	if got := buildDashboardStats(plain, 40).EfficiencyScore; math.Abs(got-0.6*37.5) > 1e-9 {
+		t.Errorf("expected %v, got %v", 0.6*37.5, got)
+	}
+	if got := buildDashboardStats(nil, 0); got.EfficiencyScore != 0 || got.TotalAIJobs != 0 {
+		t.Errorf("expected an empty score without processed files, got %+v", got)
+	}
+
+	stats := buildDashboardStats(processed, 0)
+	if stats.TotalStorageSaved != 6000 || stats.TotalAIJobs != 1 || stats.TotalCleaned != 1 {
+		t.Errorf("unexpected totals: %+v", stats)
+	}
+}
@@ -0,0 +1,16 @@
+package api
+
+import (
+	"github.com/Vasteva/MediaConverter/internal/events"
+	"github.com/gofiber/fiber/v2"
+)
+
+func RegisterEventRoutes(api fiber.Router, log *events.Log) {
+	api.Get("/events", func(c *fiber.Ctx) error {
+		limit, err := queryInt(c, "limit", 50)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(log.Recent(limit))
+	})
+}
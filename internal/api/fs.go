@@ -8,6 +8,9 @@ import (
 	"sort"
 	"time"
 
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/security"
+	"github.com/Vasteva/MediaConverter/internal/system"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -28,8 +31,55 @@ type FileListResponse struct {
 	Error   string      `json:"error,omitempty"`
 }
 
-func RegisterFSRoutes(api fiber.Router) {
+func RegisterFSRoutes(api fiber.Router, cfg *config.Config) {
 	api.Get("/fs/list", handleListFiles)
+
+	// Check a destination can be written to before submitting jobs there
+	api.Post("/fs/check-writable", func(c *fiber.Ctx) error {
+		var req struct {
+			Path string `json:"path"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		path, err := security.ValidatePath(req.Path, cfg.Snapshot().DestDir)
+		if err != nil {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		resp := fiber.Map{"path": path, "writable": true}
+		if err := checkWritable(path); err != nil {
+			resp["writable"] = false
+			resp["error"] = err.Error()
+		}
+		return c.JSON(resp)
+	})
+}
+
+// checkWritable verifies files can be created in dir. Directories that don't exist yet
+// are checked at their nearest existing parent, since jobs create them.
+func checkWritable(dir string) error {
+	dir = filepath.Clean(dir)
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+
+	return system.CheckWritable(dir)
 }
 
 func handleListFiles(c *fiber.Ctx) error {
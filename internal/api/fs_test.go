@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/jobs"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCheckWritable(t *testing.T) {
+	destDir := t.TempDir()
+	app := fiber.New()
+	RegisterFSRoutes(app.Group("/api"), &config.Config{DestDir: destDir})
+
+	check := func(path string) (int, map[string]interface{}) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/fs/check-writable", strings.NewReader(`{"path":"`+path+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var body map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	if code, body := check(destDir); code != 200 || body["writable"] != true {
+		t.Errorf("expected writable dest dir, got %d %v", code, body)
+	}
+	// Directories jobs would create are checked at their parent
+	if code, body := check(filepath.Join(destDir, "new", "season 1")); code != 200 || body["writable"] != true {
+		t.Errorf("expected missing subdirectory to be writable, got %d %v", code, body)
+	}
+	entries, _ := os.ReadDir(destDir)
+	if len(entries) != 0 {
+		t.Errorf("expected the check to leave nothing behind, found %d entries", len(entries))
+	}
+
+	if code, _ := check(t.TempDir()); code != 403 {
+		t.Errorf("expected 403 outside the dest dir, got %d", code)
+	}
+
+	readOnly := filepath.Join(destDir, "readonly")
+	if err := os.Mkdir(readOnly, 0555); err != nil {
+		t.Fatal(err)
+	}
+	if os.Geteuid() == 0 {
+		t.Log("running as root, permissions are not enforced on the read-only directory")
+	} else if code, body := check(readOnly); code != 200 || body["writable"] != false || body["error"] == "" {
+		t.Errorf("expected read-only dir to be reported unwritable, got %d %v", code, body)
+	}
+
+	file := filepath.Join(destDir, "movie.mkv")
+	if err := os.WriteFile(file, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if code, body := check(file); code != 200 || body["writable"] != false {
+		t.Errorf("expected a file to be reported unwritable, got %d %v", code, body)
+	}
+}
+
+func TestCreateJobRejectsUnwritableDestination(t *testing.T) {
+	sourceDir := t.TempDir()
+	source := filepath.Join(sourceDir, "movie.mkv")
+	if err := os.WriteFile(source, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	blocker := filepath.Join(t.TempDir(), "not-a-dir")
+	if err := os.WriteFile(blocker, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{SourceDir: sourceDir, DestDir: t.TempDir(), AdminPassword: "secret", IsInitialized: true}
+	jm, _ := jobs.NewManager(cfg, nil, "")
+	app := fiber.New()
+	RegisterRoutes(app, jm, nil, cfg)
+
+	body := `{"type":"optimize","sourcePath":"` + source + `","destinationPath":"` + filepath.Join(blocker, "movie.mkv") + `"}`
+	req := httptest.NewRequest("POST", "/api/jobs", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+GenerateToken("secret"))
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result map[string]string
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != 400 || !strings.Contains(result["error"], "invalid destination") {
+		t.Errorf("expected 400 with a writability error, got %d %v", resp.StatusCode, result)
+	}
+	if len(jm.GetAllJobs()) != 0 {
+		t.Error("expected no job to be created")
+	}
+}
+
+func TestCreateJobRemoteSource(t *testing.T) {
+	cfg := &config.Config{SourceDir: t.TempDir(), DestDir: t.TempDir(), RemoteSourceSchemes: "https", AdminPassword: "secret", IsInitialized: true}
+	jm, _ := jobs.NewManager(cfg, nil, "")
+	app := fiber.New()
+	RegisterRoutes(app, jm, nil, cfg)
+
+	create := func(jobType, source string) (int, map[string]interface{}) {
+		t.Helper()
+		body := `{"type":"` + jobType + `","sourcePath":"` + source + `"}`
+		req := httptest.NewRequest("POST", "/api/jobs", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+GenerateToken("secret"))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	code, job := create("optimize", "https://media.example.com/movie.mkv")
+	if code != 201 || job["remoteSource"] != true || job["sourcePath"] != "https://media.example.com/movie.mkv" {
+		t.Fatalf("expected a remote job, got %d %v", code, job)
+	}
+	if want := filepath.Join(cfg.DestDir, "movie_optimized.mkv"); job["destinationPath"] != want {
+		t.Errorf("expected output %s, got %v", want, job["destinationPath"])
+	}
+
+	if code, _ := create("optimize", "http://media.example.com/movie.mkv"); code != 403 {
+		t.Errorf("expected 403 for a scheme outside the allowlist, got %d", code)
+	}
+	if code, _ := create("extract", "https://media.example.com/disc.iso"); code != 400 {
+		t.Errorf("expected 400 for a remote extraction, got %d", code)
+	}
+
+	// Remote sources are off without any schemes, the default
+	cfg.RemoteSourceSchemes = ""
+	if code, _ := create("optimize", "https://media.example.com/other.mkv"); code != 403 {
+		t.Errorf("expected 403 with remote sources disabled, got %d", code)
+	}
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/jobs"
+	"github.com/Vasteva/MediaConverter/internal/media"
+	"github.com/Vasteva/MediaConverter/internal/scanner"
+	"github.com/Vasteva/MediaConverter/internal/system"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	HealthOK        = "ok"
+	HealthDegraded  = "degraded"
+	HealthUnhealthy = "unhealthy"
+	HealthDisabled  = "disabled"
+)
+
+// HealthCheck is the result of probing a single subsystem
+type HealthCheck struct {
+	Status   string `json:"status"`
+	Critical bool   `json:"critical"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// HealthReport is the response body of /api/health
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Time   time.Time              `json:"time"`
+	Checks map[string]HealthCheck `json:"checks"`
+}
+
+// healthProbe checks one subsystem. A probe may return a detail of HealthDisabled
+// to report an intentionally unconfigured subsystem without degrading the report.
+type healthProbe struct {
+	name     string
+	critical bool
+	check    func() (string, error)
+}
+
+func RegisterHealthRoutes(api fiber.Router, jm *jobs.Manager, fs *scanner.Scanner, cfg *config.Config) {
+	api.Get("/health", healthHandler(defaultHealthProbes(jm, fs, cfg)))
+}
+
+func healthHandler(probes []healthProbe) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		report := buildHealthReport(probes)
+		code := 200
+		if report.Status == HealthUnhealthy {
+			code = 503
+		}
+		return c.Status(code).JSON(report)
+	}
+}
+
+func defaultHealthProbes(jm *jobs.Manager, fs *scanner.Scanner, cfg *config.Config) []healthProbe {
+	return []healthProbe{
+		{name: "ffmpeg", critical: true, check: func() (string, error) {
+			return system.ResolveTool("ffmpeg", cfg.Snapshot().FFmpegPath)
+		}},
+		{name: "ffprobe", critical: true, check: func() (string, error) {
+			return system.ResolveTool("ffprobe", cfg.Snapshot().FFprobePath)
+		}},
+		{name: "makemkv", check: func() (string, error) {
+			return system.ResolveTool("makemkvcon", cfg.Snapshot().MakeMKVPath)
+		}},
+		{name: "storage", critical: true, check: func() (string, error) {
+			if settings := cfg.Snapshot(); settings.StorageBackend == "sqlite" {
+				dir := filepath.Dir(settings.SQLitePath)
+				return settings.SQLitePath, system.CheckWritable(dir)
+			}
+			if jm.JobsFilePath() == "" {
+				return HealthDisabled, nil
+			}
+			dir := filepath.Dir(jm.JobsFilePath())
+			return dir, system.CheckWritable(dir)
+		}},
+		{name: "jobs", check: func() (string, error) {
+			if cfg.Snapshot().FailureAlertWindow <= 0 {
+				return HealthDisabled, nil
+			}
+			degraded, failed, total := jm.FailureAlert()
+			if degraded {
+				return "", fmt.Errorf("%d of the last %d jobs failed", failed, total)
+			}
+			return fmt.Sprintf("%d of the last %d jobs failed", failed, total), nil
+		}},
+		{name: "tempDir", check: func() (string, error) {
+			dir := cfg.Snapshot().GetTempDir()
+			return dir, system.CheckWritable(dir)
+		}},
+		{name: "scanner", check: func() (string, error) {
+			if fs == nil {
+				return "", fmt.Errorf("scanner not initialized")
+			}
+			if !fs.GetConfig().Enabled {
+				return HealthDisabled, nil
+			}
+			if lastErr := fs.GetStatus().LastError; lastErr != "" {
+				return "", fmt.Errorf("%s", lastErr)
+			}
+			return string(fs.GetConfig().Mode), nil
+		}},
+		{name: "gpu", check: func() (string, error) {
+			settings := cfg.Snapshot()
+			switch settings.GPUVendor {
+			case "", "cpu":
+				return HealthDisabled, nil
+			case "intel", "amd":
+				device := settings.GPUDevice
+				if device == "" {
+					device = media.DefaultRenderNode
+				}
+				if _, err := os.Stat(device); err != nil {
+					return "", fmt.Errorf("render node %s not available: %w", device, err)
+				}
+				return settings.GPUVendor + " " + device, nil
+			}
+			if settings.GPUDevice != "" {
+				return settings.GPUVendor + " " + settings.GPUDevice, nil
+			}
+			return settings.GPUVendor, nil
+		}},
+		{name: "ai", check: func() (string, error) {
+			provider := cfg.Snapshot().AIProvider
+			if provider == "" || provider == "none" {
+				return HealthDisabled, nil
+			}
+			if jm.GetAI() == nil {
+				return "", fmt.Errorf("provider %s failed to initialize", provider)
+			}
+			return jm.GetAI().GetName(), nil
+		}},
+	}
+}
+
+// buildHealthReport runs all probes. A failing critical probe makes the report
+// unhealthy, any other failure makes it degraded.
+func buildHealthReport(probes []healthProbe) HealthReport {
+	report := HealthReport{
+		Status: HealthOK,
+		Time:   time.Now(),
+		Checks: make(map[string]HealthCheck, len(probes)),
+	}
+
+	for _, p := range probes {
+		detail, err := p.check()
+		result := HealthCheck{Status: HealthOK, Critical: p.critical, Detail: detail}
+
+		switch {
+		case err != nil:
+			result.Detail = err.Error()
+			if p.critical {
+				result.Status = HealthUnhealthy
+				report.Status = HealthUnhealthy
+			} else {
+				result.Status = HealthDegraded
+				if report.Status == HealthOK {
+					report.Status = HealthDegraded
+				}
+			}
+		case detail == HealthDisabled:
+			result.Status = HealthDisabled
+			result.Detail = ""
+		}
+
+		report.Checks[p.name] = result
+	}
+
+	return report
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func probe(name string, critical bool, err error) healthProbe {
+	return healthProbe{name: name, critical: critical, check: func() (string, error) {
+		return "", err
+	}}
+}
+
+func TestHealthHandler(t *testing.T) {
+	disabledAI := healthProbe{name: "ai", check: func() (string, error) {
+		return HealthDisabled, nil
+	}}
+
+	tests := []struct {
+		name       string
+		probes     []healthProbe
+		wantStatus string
+		wantCode   int
+		wantChecks map[string]string
+	}{
+		{
+			name: "healthy",
+			probes: []healthProbe{
+				probe("ffmpeg", true, nil),
+				probe("scanner", false, nil),
+				disabledAI,
+			},
+			wantStatus: HealthOK,
+			wantCode:   200,
+			wantChecks: map[string]string{"ffmpeg": HealthOK, "scanner": HealthOK, "ai": HealthDisabled},
+		},
+		{
+			name: "degraded when optional subsystem fails",
+			probes: []healthProbe{
+				probe("ffmpeg", true, nil),
+				probe("makemkv", false, fmt.Errorf("makemkvcon not found in PATH")),
+				disabledAI,
+			},
+			wantStatus: HealthDegraded,
+			wantCode:   200,
+			wantChecks: map[string]string{"ffmpeg": HealthOK, "makemkv": HealthDegraded, "ai": HealthDisabled},
+		},
+		{
+			name: "unhealthy when critical subsystem fails",
+			probes: []healthProbe{
+				probe("ffmpeg", true, fmt.Errorf("ffmpeg not found in PATH")),
+				probe("makemkv", false, fmt.Errorf("makemkvcon not found in PATH")),
+				probe("storage", true, nil),
+			},
+			wantStatus: HealthUnhealthy,
+			wantCode:   503,
+			wantChecks: map[string]string{"ffmpeg": HealthUnhealthy, "makemkv": HealthDegraded, "storage": HealthOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/api/health", healthHandler(tt.probes))
+
+			resp, err := app.Test(httptest.NewRequest("GET", "/api/health", nil))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("expected HTTP %d, got %d", tt.wantCode, resp.StatusCode)
+			}
+
+			var report HealthReport
+			if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+				t.Fatalf("failed to decode report: %v", err)
+			}
+			if report.Status != tt.wantStatus {
+				t.Errorf("expected status %s, got %s", tt.wantStatus, report.Status)
+			}
+			for name, want := range tt.wantChecks {
+				if got := report.Checks[name].Status; got != want {
+					t.Errorf("check %s: expected %s, got %s", name, want, got)
+				}
+			}
+		})
+	}
+}
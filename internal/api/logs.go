@@ -0,0 +1,17 @@
+package api
+
+import (
+	"github.com/Vasteva/MediaConverter/internal/system"
+	"github.com/gofiber/fiber/v2"
+)
+
+func RegisterLogRoutes(api fiber.Router, logs *system.LogBuffer) {
+	// Last lines of server log output, oldest first
+	api.Get("/logs", func(c *fiber.Ctx) error {
+		lines, err := queryInt(c, "lines", 100)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(logs.Tail(lines))
+	})
+}
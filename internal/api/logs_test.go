@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Vasteva/MediaConverter/internal/system"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestLogsEndpoint(t *testing.T) {
+	buf := system.NewLogBuffer(5)
+	logger := log.New(buf, "", 0)
+	for i := 1; i <= 7; i++ {
+		logger.Printf("line %d", i)
+	}
+
+	app := fiber.New()
+	RegisterLogRoutes(app.Group("/api"), buf)
+
+	get := func(query string) (int, []string) {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/logs"+query, nil))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var lines []string
+		json.NewDecoder(resp.Body).Decode(&lines)
+		return resp.StatusCode, lines
+	}
+
+	code, lines := get("?lines=3")
+	if code != 200 || fmt.Sprint(lines) != "[line 5 line 6 line 7]" {
+		t.Errorf("expected the last 3 lines, got %d %v", code, lines)
+	}
+	if _, lines := get("?lines=50"); len(lines) != 5 || lines[0] != "line 3" {
+		t.Errorf("expected the buffer to keep only the last 5 lines, got %v", lines)
+	}
+	if code, _ := get("?lines=abc"); code != 400 {
+		t.Errorf("expected 400 for an invalid line count, got %d", code)
+	}
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"errors"
+	"os"
+
+	"github.com/Vasteva/MediaConverter/internal/scanner"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RegisterNotifyRoutes lets download clients (Sonarr, Radarr, SABnzbd post-processing
+// scripts) report a finished file so it is processed right away
+func RegisterNotifyRoutes(api fiber.Router, fs *scanner.Scanner) {
+	api.Post("/scanner/notify", func(c *fiber.Ctx) error {
+		if fs == nil {
+			return c.Status(503).JSON(fiber.Map{"error": "Scanner not initialized"})
+		}
+
+		var req struct {
+			Path string `json:"path"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if req.Path == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "path is required"})
+		}
+
+		created, err := fs.Notify(req.Path)
+		switch {
+		case errors.Is(err, scanner.ErrNotInWatchDirectory):
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		case errors.Is(err, os.ErrNotExist):
+			return c.Status(404).JSON(fiber.Map{"error": "File not found"})
+		case err != nil:
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if created {
+			return c.Status(201).JSON(fiber.Map{"created": true})
+		}
+		// Already processed, filtered out, or auto-create is disabled
+		return c.JSON(fiber.Map{"created": false})
+	})
+}
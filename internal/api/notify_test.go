@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/jobs"
+	"github.com/Vasteva/MediaConverter/internal/scanner"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestScannerNotify(t *testing.T) {
+	watchDir := t.TempDir()
+	jm, _ := jobs.NewManager(&config.Config{MaxConcurrentJobs: 1}, nil, "")
+	fs, err := scanner.NewScanner(&scanner.ScannerConfig{
+		ProcessedFilePath: filepath.Join(t.TempDir(), "processed.json"),
+		AutoCreateJobs:    true,
+		ExtensionJobTypes: map[string]jobs.JobType{".mkv": jobs.JobTypeOptimize},
+		WatchDirectories: []scanner.WatchDirectory{
+			// The age wait must not apply to notified files
+			{Path: watchDir, Recursive: true, MinFileAgeMinutes: 60},
+		},
+	}, jm)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+
+	app := fiber.New()
+	RegisterNotifyRoutes(app.Group("/api"), fs)
+
+	notify := func(path string) int {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/scanner/notify", strings.NewReader(`{"path":"`+path+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	moviePath := filepath.Join(watchDir, "movie.mkv")
+	if err := os.WriteFile(moviePath, []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if code := notify(moviePath); code != 201 {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	all := jm.GetAllJobs()
+	if len(all) != 1 || all[0].SourcePath != moviePath || all[0].Type != jobs.JobTypeOptimize {
+		t.Fatalf("expected one optimize job for %s, got %+v", moviePath, all)
+	}
+
+	// A second notification for the same file doesn't create another job
+	if code := notify(moviePath); code != 200 {
+		t.Errorf("expected 200 for an already processed file, got %d", code)
+	}
+	if len(jm.GetAllJobs()) != 1 {
+		t.Errorf("expected still one job, got %d", len(jm.GetAllJobs()))
+	}
+
+	if code := notify(filepath.Join(t.TempDir(), "other.mkv")); code != 403 {
+		t.Errorf("expected 403 outside watch directories, got %d", code)
+	}
+	if code := notify(filepath.Join(watchDir, "missing.mkv")); code != 404 {
+		t.Errorf("expected 404 for a missing file, got %d", code)
+	}
+}
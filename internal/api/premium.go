@@ -0,0 +1,17 @@
+package api
+
+import (
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequirePremium creates a middleware refusing the route with 403 unless a valid
+// license is active
+func RequirePremium(cfg *config.Config, feature string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if err := cfg.RequirePremium(feature); err != nil {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/jobs"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestCreateJobPremiumFeatures(t *testing.T) {
+	sourceDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(sourceDir, "movie.mkv"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, premium := range []bool{false, true} {
+		cfg := &config.Config{SourceDir: sourceDir, AdminPassword: "secret", IsInitialized: true, IsPremium: premium}
+		jm, _ := jobs.NewManager(cfg, nil, "")
+		app := fiber.New()
+		RegisterRoutes(app, jm, nil, cfg)
+
+		body := `{"type":"optimize","sourcePath":"` + filepath.Join(sourceDir, "movie.mkv") + `","upscale":true,"resolution":"4k"}`
+		req := httptest.NewRequest("POST", "/api/jobs", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+GenerateToken("secret"))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+
+		if !premium {
+			if resp.StatusCode != 403 || !strings.Contains(result["error"].(string), "upscaling") {
+				t.Errorf("expected non-premium upscaling to be refused, got %d %v", resp.StatusCode, result)
+			}
+			if n := len(jm.GetAllJobs()); n != 0 {
+				t.Errorf("expected no job to be queued, got %d", n)
+			}
+			continue
+		}
+		if resp.StatusCode != 201 || result["upscale"] != true {
+			t.Errorf("expected premium upscaling to be accepted, got %d %v", resp.StatusCode, result)
+		}
+	}
+}
+
+func TestRequirePremiumMiddleware(t *testing.T) {
+	cfg := &config.Config{}
+	app := fiber.New()
+	app.Get("/feature", RequirePremium(cfg, "AI search"), func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	for _, premium := range []bool{false, true} {
+		cfg.IsPremium = premium
+		resp, err := app.Test(httptest.NewRequest("GET", "/feature", nil))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if want := map[bool]int{false: 403, true: 200}[premium]; resp.StatusCode != want {
+			t.Errorf("premium=%v: expected %d, got %d", premium, want, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Vasteva/MediaConverter/internal/scanner"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ProcessedEntry is a processed file record as exposed to the library view
+type ProcessedEntry struct {
+	scanner.ProcessedFile
+	Savings int64 `json:"savings"`
+}
+
+func RegisterProcessedRoutes(api fiber.Router, fs *scanner.Scanner) {
+	api.Get("/processed", func(c *fiber.Ctx) error {
+		if fs == nil {
+			return c.Status(503).JSON(fiber.Map{"error": "Scanner not initialized"})
+		}
+		return handleListProcessed(c, fs)
+	})
+}
+
+func handleListProcessed(c *fiber.Ctx, fs *scanner.Scanner) error {
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	limit, err := queryInt(c, "limit", 0)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	// Newest first so pagination is stable across requests
+	files, total, err := fs.QueryProcessed(scanner.ProcessedQuery{JobType: c.Query("type"), Offset: offset, Limit: limit})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	entries := make([]ProcessedEntry, 0, len(files))
+	for _, f := range files {
+		entry := ProcessedEntry{ProcessedFile: f}
+		if f.InputSize > 0 && f.OutputSize > 0 {
+			entry.Savings = f.InputSize - f.OutputSize
+		}
+		entries = append(entries, entry)
+	}
+
+	c.Set("X-Total-Count", strconv.Itoa(total))
+	return c.JSON(entries)
+}
+
+func queryInt(c *fiber.Ctx, key string, fallback int) (int, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return fallback, nil
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid %s: %s", key, raw)
+	}
+	return value, nil
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/jobs"
+	"github.com/Vasteva/MediaConverter/internal/scanner"
+	"github.com/gofiber/fiber/v2"
+)
+
+func newTestScanner(t *testing.T) *scanner.Scanner {
+	t.Helper()
+	jm, _ := jobs.NewManager(&config.Config{MaxConcurrentJobs: 1}, nil, "")
+	fs, err := scanner.NewScanner(&scanner.ScannerConfig{
+		ProcessedFilePath: filepath.Join(t.TempDir(), "processed.json"),
+	}, jm)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+	return fs
+}
+
+func getProcessed(t *testing.T, app *fiber.App, url string) ([]ProcessedEntry, string) {
+	t.Helper()
+	resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	var entries []ProcessedEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return entries, resp.Header.Get("X-Total-Count")
+}
+
+func TestListProcessed(t *testing.T) {
+	fs := newTestScanner(t)
+	app := fiber.New()
+	RegisterProcessedRoutes(app.Group("/api"), fs)
+
+	entries, total := getProcessed(t, app, "/api/processed")
+	if len(entries) != 0 || total != "0" {
+		t.Fatalf("expected empty library, got %d entries (total %s)", len(entries), total)
+	}
+
+	fs.CompleteProcessed(&jobs.Job{
+		ID:          "job-1",
+		Type:        jobs.JobTypeOptimize,
+		SourcePath:  "/media/movie.mkv",
+		InputSize:   1000,
+		OutputSize:  400,
+		AISubtitles: true,
+	})
+	fs.CompleteProcessed(&jobs.Job{
+		ID:         "job-2",
+		Type:       jobs.JobTypeExtract,
+		SourcePath: "/media/disc.iso",
+	})
+
+	entries, total = getProcessed(t, app, "/api/processed")
+	if len(entries) != 2 || total != "2" {
+		t.Fatalf("expected 2 entries, got %d (total %s)", len(entries), total)
+	}
+
+	entries, total = getProcessed(t, app, "/api/processed?type=optimize")
+	if len(entries) != 1 || total != "1" {
+		t.Fatalf("expected 1 optimize entry, got %d (total %s)", len(entries), total)
+	}
+	got := entries[0]
+	if got.JobID != "job-1" || got.Path != "/media/movie.mkv" {
+		t.Errorf("unexpected entry: %+v", got)
+	}
+	if got.InputSize != 1000 || got.OutputSize != 400 || got.Savings != 600 {
+		t.Errorf("unexpected sizes: input=%d output=%d savings=%d", got.InputSize, got.OutputSize, got.Savings)
+	}
+	if !got.AISubtitles {
+		t.Error("expected AISubtitles to be set")
+	}
+
+	entries, total = getProcessed(t, app, "/api/processed?limit=1&offset=1")
+	if len(entries) != 1 || total != "2" {
+		t.Errorf("expected 1 entry of 2 on second page, got %d (total %s)", len(entries), total)
+	}
+}
+
+func TestCreateJobForceReprocess(t *testing.T) {
+	sourceDir := t.TempDir()
+	source := filepath.Join(sourceDir, "movie.mkv")
+	if err := os.WriteFile(source, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{SourceDir: sourceDir, DestDir: t.TempDir(), AdminPassword: "secret", IsInitialized: true}
+	jm, _ := jobs.NewManager(cfg, nil, "")
+	fs := newTestScanner(t)
+	fs.CompleteProcessed(&jobs.Job{ID: "old", Type: jobs.JobTypeOptimize, SourcePath: source})
+	app := fiber.New()
+	RegisterRoutes(app, jm, fs, cfg)
+
+	create := func(force bool) (int, map[string]interface{}) {
+		t.Helper()
+		body := fmt.Sprintf(`{"type":"optimize","sourcePath":%q,"force":%v}`, source, force)
+		req := httptest.NewRequest("POST", "/api/jobs", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+GenerateToken("secret"))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		return resp.StatusCode, result
+	}
+
+	if code, result := create(false); code != 409 {
+		t.Errorf("expected 409 for an already processed source, got %d %v", code, result)
+	}
+
+	code, result := create(true)
+	if code != 201 || result["force"] != true {
+		t.Fatalf("expected the forced job to be created, got %d %v", code, result)
+	}
+	if job := jm.GetJob(result["id"].(string)); job == nil || job.Status != jobs.StatusPending {
+		t.Error("expected the forced job to be queued")
+	}
+
+	// The queued job now blocks a duplicate unless that is forced too
+	if code, result := create(false); code != 409 || result["jobId"] == nil {
+		t.Errorf("expected 409 naming the queued job, got %d %v", code, result)
+	}
+	if code, _ := create(true); code != 201 {
+		t.Errorf("expected a forced duplicate to be created, got %d", code)
+	}
+}
@@ -3,52 +3,76 @@ package api
 import (
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"log"
 	"math/big"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/Vasteva/MediaConverter/internal/ai"
+	"github.com/Vasteva/MediaConverter/internal/ai/meta"
 	"github.com/Vasteva/MediaConverter/internal/ai/search"
 	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/events"
 	"github.com/Vasteva/MediaConverter/internal/jobs"
 	"github.com/Vasteva/MediaConverter/internal/license"
+	"github.com/Vasteva/MediaConverter/internal/media"
 	"github.com/Vasteva/MediaConverter/internal/scanner"
 	"github.com/Vasteva/MediaConverter/internal/security"
 	"github.com/Vasteva/MediaConverter/internal/system"
 	"github.com/gofiber/fiber/v2"
 )
 
+// jobView is a job as returned by the API, with its current place in the queue.
+// QueuePosition is 1-based among pending jobs and 0 for jobs that aren't waiting.
+type jobView struct {
+	*jobs.Job
+	QueuePosition int `json:"queuePosition"`
+}
+
 func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *config.Config) {
 	if fs != nil {
 		jm.OnJobComplete = fs.CompleteProcessed
 	}
 
 	api := app.Group("/api", AuthMiddleware(cfg))
-	RegisterFSRoutes(api)
+	RegisterFSRoutes(api, cfg)
+	RegisterProcessedRoutes(api, fs)
+	RegisterHealthRoutes(api, jm, fs, cfg)
+	RegisterScannerConfigRoutes(api, cfg)
+	RegisterConfigBundleRoutes(api, jm, fs, cfg)
+	RegisterEventRoutes(api, jm.Events)
+	RegisterLogRoutes(api, system.Logs)
+	RegisterVersionRoutes(api, cfg)
+	RegisterCapabilitiesRoutes(api, cfg)
+	RegisterNotifyRoutes(api, fs)
+	RegisterWatchDirectoryRoutes(api, fs, jm.Events, cfg)
+	RegisterStreamRoutes(api, jm, cfg)
+	RegisterUploadRoutes(api, jm, cfg)
 
 	// Setup Wizard
 	setup := api.Group("/setup")
 	setup.Get("/status", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
-			"isInitialized": cfg.IsInitialized,
+			"isInitialized": cfg.Snapshot().IsInitialized,
 		})
 	})
 
 	setup.Get("/probes", func(c *fiber.Ctx) error {
 		probes := fiber.Map{
-			"gpu": system.DetectGPU(),
+			"gpu":        system.DetectGPU(),
+			"gpuDevices": system.ListGPUDevices(),
 		}
 
 		// Check for binaries
-		_, err := exec.LookPath("ffmpeg")
+		settings := cfg.Snapshot()
+		_, err := system.ResolveTool("ffmpeg", settings.FFmpegPath)
 		probes["ffmpeg"] = err == nil
 
-		_, err = exec.LookPath("makemkvcon")
+		_, err = system.ResolveTool("makemkvcon", settings.MakeMKVPath)
 		probes["makemkv"] = err == nil
 
 		return c.JSON(probes)
@@ -65,6 +89,7 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 		}
 
+		cfg.Lock()
 		if req.AdminPassword != "" {
 			cfg.AdminPassword = req.AdminPassword
 		}
@@ -78,6 +103,7 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 			cfg.LicenseKey = req.LicenseKey
 			cfg.IsPremium = license.Validate(req.LicenseKey)
 		}
+		cfg.Unlock()
 
 		if err := cfg.Save(); err != nil {
 			log.Printf("Failed to save config: %v", err)
@@ -101,17 +127,18 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 		}
 
 		// Check if password is configured
-		if cfg.AdminPassword == "" {
+		adminPassword := cfg.Snapshot().AdminPassword
+		if adminPassword == "" {
 			return c.Status(500).JSON(fiber.Map{"error": "Admin password not configured"})
 		}
 
 		// Validate password
-		if req.Password != cfg.AdminPassword {
+		if req.Password != adminPassword {
 			return c.Status(401).JSON(fiber.Map{"error": "Invalid password"})
 		}
 
 		// Generate and return token
-		token := GenerateToken(cfg.AdminPassword)
+		token := GenerateToken(adminPassword)
 		return c.JSON(fiber.Map{
 			"success": true,
 			"token":   token,
@@ -120,37 +147,8 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 
 	// Dashboard Stats
 	api.Get("/dashboard/stats", func(c *fiber.Ctx) error {
-		processed := fs.GetProcessedFiles()
-		stats := system.DashboardStats{}
-
-		for _, f := range processed {
-			if f.InputSize > 0 && f.OutputSize > 0 {
-				saved := f.InputSize - f.OutputSize
-				if saved > 0 {
-					stats.TotalStorageSaved += saved
-				}
-			}
-			if f.AISubtitles {
-				stats.TotalSubtitlesCreated++
-			}
-			if f.AIUpscale {
-				stats.TotalUpscales++
-			}
-			if f.AICleaned {
-				stats.TotalCleaned++
-			}
-			if f.AISubtitles || f.AIUpscale || f.AICleaned {
-				stats.TotalAIJobs++
-			}
-		}
-
-		// Calculate efficiency (rough score out of 100 based on compression and AI usage)
-		if len(processed) > 0 {
-			stats.EfficiencyScore = 85.0 + (float64(stats.TotalAIJobs) * 2.0)
-			if stats.EfficiencyScore > 100 {
-				stats.EfficiencyScore = 100
-			}
-		}
+		stats := buildDashboardStats(fs.GetProcessedFiles(), cfg.Snapshot().EfficiencyAIWeight)
+		stats.PendingFiles, stats.EstimatedSavings = jm.PendingSavings()
 
 		return c.JSON(stats)
 	})
@@ -160,34 +158,163 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 		return c.JSON(system.GetStats())
 	})
 
-	// Health check
-	api.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"status": "ok", "time": time.Now()})
-	})
-
 	// Jobs
 	api.Get("/jobs", func(c *fiber.Ctx) error {
-		return c.JSON(jm.GetAllJobs())
+		positions := jm.QueuePositions()
+		all := jm.GetAllJobs()
+		result := make([]jobView, 0, len(all))
+		for _, job := range all {
+			result = append(result, jobView{Job: job, QueuePosition: positions[job.ID]})
+		}
+		return c.JSON(result)
+	})
+
+	// Estimated time to clear the queue
+	api.Get("/queue/eta", func(c *fiber.Ctx) error {
+		return c.JSON(jm.QueueETA())
 	})
 
 	api.Post("/jobs", func(c *fiber.Ctx) error {
 		var req struct {
-			Type            jobs.JobType `json:"type"`
-			SourcePath      string       `json:"sourcePath"`
-			DestPath        string       `json:"destinationPath"`
-			Priority        int          `json:"priority"`
-			CreateSubtitles bool         `json:"createSubtitles"`
-			Upscale         bool         `json:"upscale"`
-			Resolution      string       `json:"resolution"`
+			Type             jobs.JobType `json:"type"`
+			SourcePath       string       `json:"sourcePath"`
+			DestPath         string       `json:"destinationPath"`
+			Priority         int          `json:"priority"`
+			CreateSubtitles  bool         `json:"createSubtitles"`
+			Upscale          bool         `json:"upscale"`
+			Resolution       string       `json:"resolution"`
+			MaxResolution    string       `json:"maxResolution"`
+			KeepRip          bool         `json:"keepRip"`
+			MinLength        int          `json:"minLength"`
+			MaxTitles        int          `json:"maxTitles"`
+			MakeMKVProfile   string       `json:"makemkvProfile"`
+			EmbedSubtitles   bool         `json:"embedSubtitles"`
+			KeepSidecarSRT   bool         `json:"keepSidecarSrt"`
+			SubtitleLanguage string       `json:"subtitleLanguage"`
+			NormalizeAudio   bool         `json:"normalizeAudio"`
+			LoudnormTwoPass  bool         `json:"loudnormTwoPass"`
+			CRF              *int         `json:"crf"` // Omitted uses the configured (or AI-suggested) CRF
+			MaxBitrate       string       `json:"maxBitrate"`
+			BufSize          string       `json:"bufSize"`
+			AudioCodec       string       `json:"audioCodec"`
+			AudioBitrate     string       `json:"audioBitrate"`
+			Container        string       `json:"container"`
+			StreamSelection  string       `json:"streamSelection"`
+			StreamLanguages  []string     `json:"streamLanguages"`
+			SubtitleLangs    []string     `json:"subtitleLanguages"`
+			KeepForcedSubs   bool         `json:"keepForcedSubtitles"`
+			SkipEfficient    bool         `json:"skipIfAlreadyEfficient"`
+			VideoCopy        bool         `json:"videoCopyIfCompliant"`
+			GenerateChapters bool         `json:"generateChapters"`
+			ForceChapters    bool         `json:"forceChapters"`
+			AllowNoDuration  bool         `json:"allowUnknownDuration"`
+			MaxDurationSec   int          `json:"maxDurationSec"`
+			AttachSubtitles  bool         `json:"attachSubtitles"`
+			SubtitlePath     string       `json:"subtitlePath"`
+			Force            bool         `json:"force"`
+			WriteNFO         bool         `json:"writeNfo"`
+			PreserveMTime    bool         `json:"preserveMtime"`
+			PostCommand      string       `json:"postCommand"`
+
+			CustomVideoFilters string   `json:"customVideoFilters"`
+			CustomArgs         []string `json:"customArgs"`
 		}
 		if err := c.BodyParser(&req); err != nil {
 			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 		}
 
-		// Security: Validate paths to prevent arbitrary file access
-		sourcePath, err := security.ValidatePath(req.SourcePath, cfg.SourceDir)
-		if err != nil {
-			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		if err := validateBitrates(req.MaxBitrate, req.BufSize); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := config.ValidateOutput(req.AudioCodec, req.Container); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := validateAudioBitrate(req.AudioBitrate); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if req.CRF != nil {
+			if err := config.ValidateCRF(*req.CRF); err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+		if req.MaxTitles < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "maxTitles must not be negative"})
+		}
+		if req.MakeMKVProfile != "" {
+			if _, err := media.ResolveMakeMKVProfile(req.MakeMKVProfile); err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+		if req.MaxDurationSec < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "maxDurationSec must not be negative"})
+		}
+		if _, err := media.ParseMaxResolution(req.MaxResolution); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := media.ValidateStreamSelection(media.StreamSelection(req.StreamSelection), req.StreamLanguages); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := media.ValidateLanguages(req.SubtitleLangs); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := media.ValidateVideoFilters(req.CustomVideoFilters); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		settings := cfg.Snapshot()
+		if req.PostCommand != "" && !settings.PostCommandEnabled {
+			return c.Status(403).JSON(fiber.Map{"error": "post commands are disabled, set POST_COMMAND_ENABLED=true to allow them"})
+		}
+		if len(req.CustomArgs) > 0 && !settings.CustomArgsEnabled {
+			return c.Status(403).JSON(fiber.Map{"error": "custom ffmpeg arguments are disabled, set CUSTOM_FFMPEG_ARGS_ENABLED=true to allow them"})
+		}
+		if req.AudioCodec == "" {
+			req.AudioCodec = settings.AudioCodec
+		}
+		if req.Container == "" {
+			req.Container = settings.Container
+		}
+
+		// Security: Validate paths to prevent arbitrary file access. Remote sources are
+		// streamed by ffmpeg instead, so only their scheme is checked.
+		var sourcePath string
+		var err error
+		remote := media.IsRemoteSource(req.SourcePath)
+		sourceName := ""
+		if remote {
+			if req.Type != jobs.JobTypeOptimize || media.IsDiscImage(strings.ToLower(req.SourcePath)) {
+				return c.Status(400).JSON(fiber.Map{"error": "remote sources can only be optimized, disc images and extraction need a local file"})
+			}
+			u, err := security.ValidateSourceURL(req.SourcePath, settings.RemoteSchemes())
+			if err != nil {
+				return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+			}
+			sourcePath = u.String()
+			sourceName = media.RemoteFileName(sourcePath)
+		} else {
+			if sourcePath, err = security.ValidatePath(req.SourcePath, settings.SourceDir); err != nil {
+				return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+			}
+			sourceName = filepath.Base(sourcePath)
+		}
+
+		// Force re-encodes a source that is queued or processed already
+		if !req.Force {
+			if active := jm.ActiveJobFor(sourcePath); active != nil {
+				return c.Status(409).JSON(fiber.Map{"error": "a job for this source is already queued, set force to add another", "jobId": active.ID})
+			}
+			if fs != nil && fs.IsProcessed(sourcePath) {
+				return c.Status(409).JSON(fiber.Map{"error": "source was already processed, set force to re-encode it"})
+			}
+		}
+
+		subtitlePath := ""
+		if req.SubtitlePath != "" {
+			if subtitlePath, err = security.ValidatePath(req.SubtitlePath, settings.SourceDir); err != nil {
+				return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+			}
+			if err := media.ValidateSubtitleFile(subtitlePath); err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			}
 		}
 
 		destPath := req.DestPath
@@ -196,30 +323,195 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 			destPath = filepath.Clean(destPath)
 			// Check if it's a directory - if so, use source filename
 			if info, err := os.Stat(destPath); err == nil && info.IsDir() {
-				destPath = filepath.Join(destPath, filepath.Base(sourcePath))
+				if sourceName == "" {
+					return c.Status(400).JSON(fiber.Map{"error": "the source URL has no file name, destinationPath must name the output file"})
+				}
+				destPath = filepath.Join(destPath, sourceName)
 			}
 		} else {
-			// Default: same directory as source with _optimized suffix
-			sourceDir := filepath.Dir(sourcePath)
-			sourceExt := filepath.Ext(sourcePath)
-			sourceBase := strings.TrimSuffix(filepath.Base(sourcePath), sourceExt)
-			destPath = filepath.Join(sourceDir, sourceBase+"_optimized"+sourceExt)
+			// Default: same directory as source with _optimized suffix, remote sources
+			// are written to the destination directory
+			if sourceName == "" {
+				return c.Status(400).JSON(fiber.Map{"error": "the source URL has no file name, destinationPath is required"})
+			}
+			outDir := filepath.Dir(sourcePath)
+			if remote {
+				outDir = settings.DestDir
+			}
+			sourceExt := filepath.Ext(sourceName)
+			sourceBase := strings.TrimSuffix(sourceName, sourceExt)
+			destPath = filepath.Join(outDir, sourceBase+"_optimized"+sourceExt)
+		}
+
+		// ffmpeg would destroy a source it also writes to
+		if !remote && jobs.SamePath(sourcePath, destPath) &&
+			(req.Type != jobs.JobTypeOptimize || settings.SameOutputAction != config.SameOutputReplace) {
+			return c.Status(400).JSON(fiber.Map{"error": "destinationPath is the source file, set SAME_OUTPUT_ACTION=replace to replace sources in place"})
+		}
+
+		// Catch an unwritable destination now rather than when the encode finishes
+		outputDir := filepath.Dir(destPath)
+		if req.Type == jobs.JobTypeExtract {
+			outputDir = destPath
+		}
+		if err := checkWritable(outputDir); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("invalid destination: %v", err)})
 		}
 
 		job := &jobs.Job{
-			ID:              generateID(),
-			Type:            req.Type,
+			ID:               generateID(),
+			Type:             req.Type,
+			SourcePath:       sourcePath,
+			DestinationPath:  destPath,
+			Status:           jobs.StatusPending,
+			Priority:         req.Priority,
+			CreateSubtitles:  req.CreateSubtitles,
+			Upscale:          req.Upscale,
+			Resolution:       req.Resolution,
+			MaxResolution:    req.MaxResolution,
+			KeepRip:          req.KeepRip,
+			MinLength:        req.MinLength,
+			MaxTitles:        req.MaxTitles,
+			MakeMKVProfile:   req.MakeMKVProfile,
+			EmbedSubtitles:   req.EmbedSubtitles,
+			KeepSidecarSRT:   req.KeepSidecarSRT,
+			SubtitleLanguage: req.SubtitleLanguage,
+			NormalizeAudio:   req.NormalizeAudio,
+			LoudnormTwoPass:  req.LoudnormTwoPass,
+			CRF:              req.CRF,
+			MaxBitrate:       req.MaxBitrate,
+			BufSize:          req.BufSize,
+			AudioCodec:       req.AudioCodec,
+			AudioBitrate:     req.AudioBitrate,
+			Container:        req.Container,
+			StreamSelection:  req.StreamSelection,
+			StreamLanguages:  req.StreamLanguages,
+			SubtitleLangs:    req.SubtitleLangs,
+			KeepForcedSubs:   req.KeepForcedSubs,
+			SkipEfficient:    req.SkipEfficient,
+			VideoCopy:        req.VideoCopy,
+			GenerateChapters: req.GenerateChapters,
+			ForceChapters:    req.ForceChapters,
+			AllowNoDuration:  req.AllowNoDuration,
+			MaxDurationSec:   req.MaxDurationSec,
+			AttachSubtitles:  req.AttachSubtitles,
+			SubtitlePath:     subtitlePath,
+			Force:            req.Force,
+			RemoteSource:     remote,
+			WriteNFO:         req.WriteNFO,
+			PreserveMTime:    req.PreserveMTime,
+			PostCommand:      req.PostCommand,
+			CreatedAt:        time.Now(),
+
+			CustomVideoFilters: strings.TrimSpace(req.CustomVideoFilters),
+			CustomArgs:         req.CustomArgs,
+		}
+		// Premium options are refused up front rather than ignored once the job runs
+		if features := job.PremiumFeatures(); len(features) > 0 {
+			if err := cfg.RequirePremium(strings.Join(features, " and ")); err != nil {
+				return c.Status(403).JSON(fiber.Map{"error": err.Error(), "features": features})
+			}
+		}
+		if warning := config.OutputWarning(req.AudioCodec, req.Container); warning != "" {
+			log.Printf("[Job %s] Warning: %s", job.ID, warning)
+			job.Warnings = append(job.Warnings, warning)
+		}
+		if job.Force {
+			log.Printf("[Job %s] Forced re-encode of %s", job.ID, sourcePath)
+		}
+		if err := jm.AddJob(job); err != nil {
+			return c.Status(503).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(201).JSON(job)
+	})
+
+	// The ffmpeg command an optimize job with these options would run, nothing is executed
+	api.Post("/jobs/preview-command", func(c *fiber.Ctx) error {
+		var req struct {
+			SourcePath      string   `json:"sourcePath"`
+			DestPath        string   `json:"destinationPath"`
+			Upscale         bool     `json:"upscale"`
+			Resolution      string   `json:"resolution"`
+			MaxResolution   string   `json:"maxResolution"`
+			NormalizeAudio  bool     `json:"normalizeAudio"`
+			CRF             *int     `json:"crf"`
+			MaxBitrate      string   `json:"maxBitrate"`
+			BufSize         string   `json:"bufSize"`
+			AudioCodec      string   `json:"audioCodec"`
+			AudioBitrate    string   `json:"audioBitrate"`
+			Container       string   `json:"container"`
+			StreamSelection string   `json:"streamSelection"`
+			StreamLanguages []string `json:"streamLanguages"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if err := validateBitrates(req.MaxBitrate, req.BufSize); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := config.ValidateOutput(req.AudioCodec, req.Container); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := validateAudioBitrate(req.AudioBitrate); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if req.CRF != nil {
+			if err := config.ValidateCRF(*req.CRF); err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+		if _, err := media.ParseMaxResolution(req.MaxResolution); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err := media.ValidateStreamSelection(media.StreamSelection(req.StreamSelection), req.StreamLanguages); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		settings := cfg.Snapshot()
+		var sourcePath string
+		if media.IsRemoteSource(req.SourcePath) {
+			u, err := security.ValidateSourceURL(req.SourcePath, settings.RemoteSchemes())
+			if err != nil {
+				return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+			}
+			sourcePath = u.String()
+		} else {
+			var err error
+			if sourcePath, err = security.ValidatePath(req.SourcePath, settings.SourceDir); err != nil {
+				return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+		destPath := filepath.Clean(req.DestPath)
+		if req.DestPath == "" {
+			ext := filepath.Ext(sourcePath)
+			destPath = strings.TrimSuffix(sourcePath, ext) + "_optimized" + ext
+		}
+
+		argv, err := jm.PreviewCommand(&jobs.Job{
+			Type:            jobs.JobTypeOptimize,
 			SourcePath:      sourcePath,
 			DestinationPath: destPath,
-			Status:          jobs.StatusPending,
-			Priority:        req.Priority,
-			CreateSubtitles: req.CreateSubtitles,
 			Upscale:         req.Upscale,
 			Resolution:      req.Resolution,
-			CreatedAt:       time.Now(),
+			MaxResolution:   req.MaxResolution,
+			NormalizeAudio:  req.NormalizeAudio,
+			CRF:             req.CRF,
+			MaxBitrate:      req.MaxBitrate,
+			BufSize:         req.BufSize,
+			AudioCodec:      req.AudioCodec,
+			AudioBitrate:    req.AudioBitrate,
+			Container:       req.Container,
+			StreamSelection: req.StreamSelection,
+			StreamLanguages: req.StreamLanguages,
+		})
+		if err != nil {
+			return c.Status(503).JSON(fiber.Map{"error": err.Error()})
 		}
-		jm.AddJob(job)
-		return c.Status(201).JSON(job)
+		return c.JSON(fiber.Map{
+			"argv":    argv,
+			"command": media.ShellJoin(argv),
+		})
 	})
 
 	api.Get("/jobs/:id", func(c *fiber.Ctx) error {
@@ -227,7 +519,45 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 		if job == nil {
 			return c.Status(404).JSON(fiber.Map{"error": "Job not found"})
 		}
-		return c.JSON(job)
+		return c.JSON(jobView{Job: job, QueuePosition: jm.QueuePositions()[job.ID]})
+	})
+
+	api.Post("/jobs/:id/retry", func(c *fiber.Ctx) error {
+		if jm.GetJob(c.Params("id")) == nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Job not found"})
+		}
+
+		job, err := jm.RetryJob(c.Params("id"), generateID())
+		if errors.Is(err, jobs.ErrQueueFull) {
+			return c.Status(503).JSON(fiber.Map{"error": err.Error()})
+		}
+		if err != nil {
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(201).JSON(job)
+	})
+
+	// Send a pending job to the front or back of the queue
+	api.Post("/jobs/:id/move", func(c *fiber.Ctx) error {
+		if jm.GetJob(c.Params("id")) == nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Job not found"})
+		}
+
+		var req struct {
+			Position string `json:"position"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if req.Position != jobs.MoveTop && req.Position != jobs.MoveBottom {
+			return c.Status(400).JSON(fiber.Map{"error": "position must be top or bottom"})
+		}
+
+		job, err := jm.MoveJob(c.Params("id"), req.Position)
+		if err != nil {
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(jobView{Job: job, QueuePosition: jm.QueuePositions()[job.ID]})
 	})
 
 	api.Delete("/jobs/:id", func(c *fiber.Ctx) error {
@@ -239,42 +569,98 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 
 	// Config
 	api.Get("/config", func(c *fiber.Ctx) error {
+		settings := cfg.Snapshot()
 		return c.JSON(fiber.Map{
-			"sourceDir":     cfg.SourceDir,
-			"destDir":       cfg.DestDir,
-			"gpuVendor":     cfg.GPUVendor,
-			"qualityPreset": cfg.QualityPreset,
-			"crf":           cfg.CRF,
-			"aiProvider":    cfg.AIProvider,
-			"aiApiKey":      security.MaskKey(cfg.AIApiKey),
-			"aiEndpoint":    cfg.AIEndpoint,
-			"aiModel":       cfg.AIModel,
-			"licenseKey":    security.MaskKey(cfg.LicenseKey),
-			"isPremium":     cfg.IsPremium,
-			"planName":      license.GetPlanName(cfg.LicenseKey),
+			"sourceDir":      settings.SourceDir,
+			"destDir":        settings.DestDir,
+			"gpuVendor":      settings.GPUVendor,
+			"gpuDevice":      settings.GPUDevice,
+			"qualityPreset":  settings.QualityPreset,
+			"crf":            settings.CRF,
+			"maxBitrate":     settings.MaxBitrate,
+			"bufSize":        settings.BufSize,
+			"audioCodec":     settings.AudioCodec,
+			"audioBitrate":   settings.AudioBitrate,
+			"container":      settings.Container,
+			"hybridHwDecode": settings.HybridHWDecode,
+			"aiProvider":     settings.AIProvider,
+			"aiApiKey":       security.MaskKey(settings.AIApiKey),
+			"aiEndpoint":     settings.AIEndpoint,
+			"aiModel":        settings.AIModel,
+			"licenseKey":     security.MaskKey(settings.LicenseKey),
+			"isPremium":      settings.IsPremium,
+			"planName":       license.GetPlanName(settings.LicenseKey),
 		})
 	})
 
 	api.Post("/config", func(c *fiber.Ctx) error {
 		var req struct {
-			QualityPreset string `json:"qualityPreset"`
-			CRF           int    `json:"crf"`
-			AIProvider    string `json:"aiProvider"`
-			AIApiKey      string `json:"aiApiKey"`
-			AIEndpoint    string `json:"aiEndpoint"`
-			AIModel       string `json:"aiModel"`
-			LicenseKey    string `json:"licenseKey"`
+			QualityPreset  string  `json:"qualityPreset"`
+			CRF            *int    `json:"crf"`        // Pointer so 0 can be set, omitted keeps the current value
+			MaxBitrate     *string `json:"maxBitrate"` // Pointers so an empty string removes the cap
+			BufSize        *string `json:"bufSize"`
+			AudioCodec     string  `json:"audioCodec"`
+			AudioBitrate   *string `json:"audioBitrate"` // Pointer so an empty string restores the codec default
+			Container      string  `json:"container"`
+			HybridHWDecode *bool   `json:"hybridHwDecode"`
+			AIProvider     string  `json:"aiProvider"`
+			AIApiKey       string  `json:"aiApiKey"`
+			AIEndpoint     string  `json:"aiEndpoint"`
+			AIModel        string  `json:"aiModel"`
+			LicenseKey     string  `json:"licenseKey"`
 		}
 		if err := c.BodyParser(&req); err != nil {
 			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 		}
 
+		// Validate before changing anything
+		if err := config.ValidateOutput(req.AudioCodec, req.Container); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if req.CRF != nil {
+			if err := config.ValidateCRF(*req.CRF); err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+		if req.AudioBitrate != nil {
+			if err := validateAudioBitrate(*req.AudioBitrate); err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+		cfg.RLock()
+		maxBitrate, bufSize := cfg.MaxBitrate, cfg.BufSize
+		cfg.RUnlock()
+		if req.MaxBitrate != nil {
+			maxBitrate = *req.MaxBitrate
+		}
+		if req.BufSize != nil {
+			bufSize = *req.BufSize
+		}
+		if err := validateBitrates(maxBitrate, bufSize); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
 		// Update config
+		before := cfg.Snapshot()
+		cfg.Lock()
 		if req.QualityPreset != "" {
 			cfg.QualityPreset = req.QualityPreset
 		}
-		if req.CRF != 0 {
-			cfg.CRF = req.CRF
+		if req.CRF != nil {
+			cfg.CRF = *req.CRF
+		}
+		cfg.MaxBitrate, cfg.BufSize = maxBitrate, bufSize
+		if req.AudioCodec != "" {
+			cfg.AudioCodec = req.AudioCodec
+		}
+		if req.AudioBitrate != nil {
+			cfg.AudioBitrate = *req.AudioBitrate
+		}
+		if req.Container != "" {
+			cfg.Container = req.Container
+		}
+		if req.HybridHWDecode != nil {
+			cfg.HybridHWDecode = *req.HybridHWDecode
 		}
 		if req.AIProvider != "" {
 			cfg.AIProvider = req.AIProvider
@@ -295,27 +681,43 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 			cfg.LicenseKey = req.LicenseKey
 			cfg.IsPremium = license.Validate(req.LicenseKey)
 		}
-
-		// Re-initialize AI provider in manager
-		newAI, err := ai.NewProvider(ai.AIConfig{
+		aiCfg := ai.AIConfig{
 			Provider: cfg.AIProvider,
 			APIKey:   cfg.AIApiKey,
 			Endpoint: cfg.AIEndpoint,
 			Model:    cfg.AIModel,
-		})
+
+			MaxAttempts: cfg.AIMaxAttempts,
+		}
+		cfg.Unlock()
+
+		// Re-initialize AI provider in manager
+		newAI, err := ai.NewProvider(aiCfg)
 		if err == nil {
 			jm.UpdateAIProvider(newAI)
 		} else {
 			log.Printf("Error updating AI provider: %v", err)
 		}
 
-		log.Printf("Configuration updated: AI Provider=%s, Premium=%v", cfg.AIProvider, cfg.IsPremium)
+		// Report what actually took effect, masked keys and empty fields change nothing
+		changes := config.Diff(before, cfg.Snapshot())
+		if len(changes) == 0 {
+			log.Println("Configuration updated, nothing changed")
+			changes = []config.Change{}
+		} else {
+			summary := make([]string, len(changes))
+			for i, change := range changes {
+				summary[i] = change.String()
+			}
+			log.Printf("Configuration updated: %s", strings.Join(summary, ", "))
+		}
+		jm.Events.Append(events.Event{Type: events.ConfigChanged, Message: "Settings updated"})
 
 		if err := cfg.Save(); err != nil {
 			log.Printf("Failed to save config: %v", err)
 		}
 
-		return c.JSON(fiber.Map{"success": true})
+		return c.JSON(fiber.Map{"success": true, "changes": changes})
 	})
 
 	// Test AI Connection
@@ -339,8 +741,8 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 		if strings.Contains(apiKey, "....") && len(apiKey) > 8 {
 			// If it looks masked, check if it matches the current masked key
 			// If so, rely on the stored config key
-			if apiKey == security.MaskKey(cfg.AIApiKey) {
-				apiKey = cfg.AIApiKey
+			if storedKey := cfg.Snapshot().AIApiKey; apiKey == security.MaskKey(storedKey) {
+				apiKey = storedKey
 			}
 		}
 
@@ -398,8 +800,9 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 		}
 
 		// Security: Validate watch directories
+		settings := cfg.Snapshot()
 		for i, dir := range newCfg.WatchDirectories {
-			validPath, err := security.ValidatePath(dir.Path, cfg.SourceDir)
+			validPath, err := security.ValidatePath(dir.Path, settings.SourceDir)
 			if err != nil {
 				return c.Status(403).JSON(fiber.Map{"error": fmt.Sprintf("Watch directory %d: %v", i, err)})
 			}
@@ -408,7 +811,7 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 
 		// Security: Validate output directory
 		if newCfg.OutputDirectory != "" {
-			validOutput, err := security.ValidatePath(newCfg.OutputDirectory, cfg.DestDir)
+			validOutput, err := security.ValidatePath(newCfg.OutputDirectory, settings.DestDir)
 			if err != nil {
 				return c.Status(403).JSON(fiber.Map{"error": fmt.Sprintf("Output directory: %v", err)})
 			}
@@ -418,6 +821,7 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 		if err := fs.UpdateConfig(&newCfg); err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
 		}
+		jm.Events.Append(events.Event{Type: events.ConfigChanged, Message: "Scanner settings updated"})
 
 		return c.JSON(fiber.Map{"success": true})
 	})
@@ -428,6 +832,10 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 			return c.Status(503).JSON(fiber.Map{"error": "Scanner not initialized"})
 		}
 
+		if fs.GetStatus().IsScanning {
+			return c.Status(409).JSON(fiber.Map{"error": scanner.ErrScanInProgress.Error()})
+		}
+
 		// Run scan asynchronously to avoid blocking
 		go func() {
 			if err := fs.ScanAll(); err != nil {
@@ -438,17 +846,26 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 		return c.JSON(fiber.Map{"success": true, "message": "Scan started"})
 	})
 
+	// Rebuild processed entries from outputs already on disk
+	api.Post("/scanner/reconcile", func(c *fiber.Ctx) error {
+		if fs == nil {
+			return c.Status(503).JSON(fiber.Map{"error": "Scanner not initialized"})
+		}
+
+		result, err := fs.Reconcile()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(result)
+	})
+
 	// AI Search
-	api.Get("/search", func(c *fiber.Ctx) error {
+	api.Get("/search", RequirePremium(cfg, "AI search"), func(c *fiber.Ctx) error {
 		query := c.Query("q")
 		if query == "" {
 			return c.Status(400).JSON(fiber.Map{"error": "Query is required"})
 		}
 
-		if !cfg.IsPremium {
-			return c.Status(403).JSON(fiber.Map{"error": "AI Search is a premium feature"})
-		}
-
 		aiProv := jm.GetAI()
 		if aiProv == nil {
 			return c.Status(500).JSON(fiber.Map{"error": "AI provider not configured"})
@@ -466,7 +883,7 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 		}
 
 		// 2. Perform AI match
-		searcher := search.NewSearcher(aiProv)
+		searcher := search.NewSearcherWithPrompt(aiProv, cfg.Snapshot().AIPromptSearch)
 		matchingIDs, err := searcher.Match(c.Context(), query, searchItems)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
@@ -487,6 +904,28 @@ func RegisterRoutes(app *fiber.App, jm *jobs.Manager, fs *scanner.Scanner, cfg *
 
 		return c.JSON(results)
 	})
+
+	// Library titles with more than one copy. Premium uses AI-cleaned titles,
+	// otherwise titles come from the filename.
+	api.Get("/duplicates", func(c *fiber.Ctx) error {
+		if fs == nil {
+			return c.Status(503).JSON(fiber.Map{"error": "Scanner not initialized"})
+		}
+
+		var cleaner *meta.Cleaner
+		method := "filename"
+		settings := cfg.Snapshot()
+		if aiProv := jm.GetAI(); settings.IsPremium && aiProv != nil {
+			cleaner = meta.NewCleanerWithPrompts(aiProv, settings.MetaPrompts())
+			method = "ai"
+		}
+
+		clusters, err := fs.FindDuplicates(c.UserContext(), cleaner)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"method": method, "clusters": clusters})
+	})
 }
 
 func generateID() string {
@@ -507,3 +946,27 @@ func randomString(n int) string {
 	}
 	return string(b)
 }
+
+// validateBitrates checks an optional bitrate cap and buffer size
+func validateBitrates(maxBitrate, bufSize string) error {
+	if maxBitrate != "" && !media.ValidBitrate(maxBitrate) {
+		return fmt.Errorf("invalid maxBitrate %q, expected a value like 8M or 8000k", maxBitrate)
+	}
+	if bufSize != "" {
+		if maxBitrate == "" {
+			return fmt.Errorf("bufSize requires maxBitrate")
+		}
+		if !media.ValidBitrate(bufSize) {
+			return fmt.Errorf("invalid bufSize %q, expected a value like 16M or 16000k", bufSize)
+		}
+	}
+	return nil
+}
+
+// validateAudioBitrate checks an optional audio bitrate
+func validateAudioBitrate(bitrate string) error {
+	if bitrate != "" && !media.ValidBitrate(bitrate) {
+		return fmt.Errorf("invalid audioBitrate %q, expected a value like 192k", bitrate)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/jobs"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUpdateConfigReportsChanges(t *testing.T) {
+	configFile := config.ConfigFile
+	config.ConfigFile = filepath.Join(t.TempDir(), "config.json")
+	defer func() { config.ConfigFile = configFile }()
+
+	cfg := &config.Config{
+		AdminPassword: "secret", IsInitialized: true,
+		QualityPreset: "medium", CRF: 23, AIProvider: "none", AIApiKey: "sk-current-secret-key",
+	}
+	jm, _ := jobs.NewManager(cfg, nil, "")
+	app := fiber.New()
+	RegisterRoutes(app, jm, nil, cfg)
+
+	// The key comes back masked, as the settings page sends it
+	body := `{"crf":20,"qualityPreset":"medium","aiProvider":"openai","aiApiKey":"sk-c....-key"}`
+	req := httptest.NewRequest("POST", "/api/config", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+GenerateToken("secret"))
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Changes []config.Change `json:"changes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+
+	changes := make(map[string]config.Change)
+	for _, change := range result.Changes {
+		changes[change.Field] = change
+	}
+	if len(changes) != 2 {
+		t.Errorf("expected only crf and aiProvider to change, got %v", result.Changes)
+	}
+	if ch := changes["crf"]; ch.Old != float64(23) || ch.New != float64(20) {
+		t.Errorf("expected crf 23 -> 20, got %v", ch)
+	}
+	if ch := changes["aiProvider"]; ch.Old != "none" || ch.New != "openai" {
+		t.Errorf("expected aiProvider none -> openai, got %v", ch)
+	}
+	if _, ok := changes["aiApiKey"]; ok || cfg.AIApiKey != "sk-current-secret-key" {
+		t.Error("expected the masked key to be left unchanged")
+	}
+}
+
+func TestCreateJobOpusInMP4Warning(t *testing.T) {
+	sourceDir := t.TempDir()
+	source := filepath.Join(sourceDir, "movie.mkv")
+	if err := os.WriteFile(source, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{SourceDir: sourceDir, AdminPassword: "secret", IsInitialized: true, AudioCodec: "copy", Container: "mkv"}
+	jm, _ := jobs.NewManager(cfg, nil, "")
+	app := fiber.New()
+	RegisterRoutes(app, jm, nil, cfg)
+
+	create := func(container string) (int, jobs.Job) {
+		t.Helper()
+		dest := filepath.Join(sourceDir, "out."+container)
+		body := fmt.Sprintf(`{"type":"optimize","sourcePath":%q,"destinationPath":%q,"audioCodec":"opus","container":%q,"force":true}`, source, dest, container)
+		req := httptest.NewRequest("POST", "/api/jobs", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+GenerateToken("secret"))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var job jobs.Job
+		json.NewDecoder(resp.Body).Decode(&job)
+		return resp.StatusCode, job
+	}
+
+	if code, job := create("mp4"); code != 201 || len(job.Warnings) != 1 {
+		t.Errorf("expected the job to be created with a warning, got %d %v", code, job.Warnings)
+	}
+	if code, job := create("mkv"); code != 201 || len(job.Warnings) != 0 {
+		t.Errorf("expected no warning for opus in mkv, got %d %v", code, job.Warnings)
+	}
+}
+
+func TestCRFValidation(t *testing.T) {
+	configFile := config.ConfigFile
+	config.ConfigFile = filepath.Join(t.TempDir(), "config.json")
+	defer func() { config.ConfigFile = configFile }()
+
+	sourceDir := t.TempDir()
+	source := filepath.Join(sourceDir, "movie.mkv")
+	if err := os.WriteFile(source, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{SourceDir: sourceDir, AdminPassword: "secret", IsInitialized: true, CRF: 23, AIProvider: "none", AudioCodec: "copy", Container: "mkv"}
+	jm, _ := jobs.NewManager(cfg, nil, "")
+	app := fiber.New()
+	RegisterRoutes(app, jm, nil, cfg)
+
+	post := func(path, body string) int {
+		t.Helper()
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+GenerateToken("secret"))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	for _, crf := range []int{-1, 52} {
+		if code := post("/api/config", fmt.Sprintf(`{"crf":%d}`, crf)); code != 400 || cfg.CRF != 23 {
+			t.Errorf("expected crf %d to be rejected, got %d (crf now %d)", crf, code, cfg.CRF)
+		}
+		body := fmt.Sprintf(`{"type":"optimize","sourcePath":%q,"crf":%d}`, source, crf)
+		if code := post("/api/jobs", body); code != 400 {
+			t.Errorf("expected job crf %d to be rejected, got %d", crf, code)
+		}
+	}
+
+	// Omitting crf leaves it alone, an explicit 0 is set
+	if code := post("/api/config", `{"qualityPreset":"slow"}`); code != 200 || cfg.CRF != 23 {
+		t.Errorf("expected a missing crf to keep 23, got %d (crf now %d)", code, cfg.CRF)
+	}
+	if code := post("/api/config", `{"crf":0}`); code != 200 || cfg.CRF != 0 {
+		t.Errorf("expected crf 0 to be accepted, got %d (crf now %d)", code, cfg.CRF)
+	}
+	body := fmt.Sprintf(`{"type":"optimize","sourcePath":%q,"crf":0}`, source)
+	if code := post("/api/jobs", body); code != 201 {
+		t.Errorf("expected job crf 0 to be accepted, got %d", code)
+	}
+}
+
+func TestCreateJobSameSourceAndDestination(t *testing.T) {
+	sourceDir := t.TempDir()
+	source := filepath.Join(sourceDir, "movie.mkv")
+	if err := os.WriteFile(source, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(sourceDir, "link.mkv")
+	if err := os.Symlink(source, link); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{SourceDir: sourceDir, AdminPassword: "secret", IsInitialized: true, SameOutputAction: config.SameOutputReject}
+	jm, _ := jobs.NewManager(cfg, nil, "")
+	app := fiber.New()
+	RegisterRoutes(app, jm, nil, cfg)
+
+	create := func(dest string) int {
+		t.Helper()
+		body := fmt.Sprintf(`{"type":"optimize","sourcePath":%q,"destinationPath":%q,"force":true}`, source, dest)
+		req := httptest.NewRequest("POST", "/api/jobs", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+GenerateToken("secret"))
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := create(source); code != 400 {
+		t.Errorf("expected the source as destination to be rejected, got %d", code)
+	}
+	if code := create(filepath.Join(sourceDir, "sub", "..", "link.mkv")); code != 400 {
+		t.Errorf("expected a symlink to the source to be rejected, got %d", code)
+	}
+
+	// Replacing in place is allowed when configured
+	cfg.SameOutputAction = config.SameOutputReplace
+	if code := create(source); code != 201 {
+		t.Errorf("expected the job to be created, got %d", code)
+	}
+}
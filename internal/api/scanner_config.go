@@ -0,0 +1,90 @@
+package api
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/scanner"
+	"github.com/Vasteva/MediaConverter/internal/security"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ScannerConfigValidation is the result of checking a scanner config without applying it
+type ScannerConfigValidation struct {
+	Valid    bool     `json:"valid"`
+	Problems []string `json:"problems"`
+}
+
+func RegisterScannerConfigRoutes(api fiber.Router, cfg *config.Config) {
+	api.Post("/scanner/config/validate", func(c *fiber.Ctx) error {
+		var newCfg scanner.ScannerConfig
+		if err := c.BodyParser(&newCfg); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		problems := validateScannerConfig(&newCfg, cfg)
+		return c.JSON(ScannerConfigValidation{Valid: len(problems) == 0, Problems: problems})
+	})
+}
+
+// validateScannerConfig lists everything that would make a scanner config fail or
+// misbehave: watch directories must exist under SourceDir, the output directory must be
+// under DestDir, and the config itself must be consistent (see ScannerConfig.Check).
+func validateScannerConfig(newCfg *scanner.ScannerConfig, cfg *config.Config) []string {
+	problems := newCfg.Check()
+	cfg = cfg.Snapshot()
+
+	for i, dir := range newCfg.WatchDirectories {
+		if dir.Path == "" {
+			continue
+		}
+		path, err := security.ValidatePath(dir.Path, cfg.SourceDir)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("watch directory %d: %v", i, err))
+			continue
+		}
+		if problem := checkDirectory(path); problem != "" {
+			problems = append(problems, fmt.Sprintf("watch directory %d: %s", i, problem))
+		}
+	}
+
+	if newCfg.OutputDirectory != "" {
+		path, err := security.ValidatePath(newCfg.OutputDirectory, cfg.DestDir)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("output directory: %v", err))
+		} else if problem := checkDirectory(path); problem != "" {
+			problems = append(problems, fmt.Sprintf("output directory: %s", problem))
+		}
+	}
+
+	if newCfg.AutoUpscale {
+		if err := cfg.RequirePremium("auto upscaling"); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if newCfg.AutoCreateSubtitles {
+		if err := cfg.RequirePremium("auto AI subtitles"); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if problems == nil {
+		problems = []string{}
+	}
+	return problems
+}
+
+func checkDirectory(path string) string {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return fmt.Sprintf("%s does not exist", path)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	if !info.IsDir() {
+		return fmt.Sprintf("%s is not a directory", path)
+	}
+	return ""
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/scanner"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestValidateScannerConfig(t *testing.T) {
+	sourceDir, destDir := t.TempDir(), t.TempDir()
+	movies := filepath.Join(sourceDir, "movies")
+	if err := os.Mkdir(movies, 0755); err != nil {
+		t.Fatal(err)
+	}
+	notDir := filepath.Join(sourceDir, "file.mkv")
+	if err := os.WriteFile(notDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{SourceDir: sourceDir, DestDir: destDir}
+
+	tests := []struct {
+		name string
+		cfg  scanner.ScannerConfig
+		want string // substring of the single expected problem, empty for none
+	}{
+		{"valid", scanner.ScannerConfig{Mode: scanner.ScanModeWatch, OutputDirectory: destDir, WatchDirectories: []scanner.WatchDirectory{{Path: movies}}}, ""},
+		{"missing directory", scanner.ScannerConfig{Mode: scanner.ScanModeWatch, WatchDirectories: []scanner.WatchDirectory{{Path: filepath.Join(sourceDir, "tv")}}}, "does not exist"},
+		{"not a directory", scanner.ScannerConfig{Mode: scanner.ScanModeWatch, WatchDirectories: []scanner.WatchDirectory{{Path: notDir}}}, "is not a directory"},
+		{"outside source root", scanner.ScannerConfig{Mode: scanner.ScanModeWatch, WatchDirectories: []scanner.WatchDirectory{{Path: destDir}}}, "outside allowed directories"},
+		{"output outside dest root", scanner.ScannerConfig{Mode: scanner.ScanModeManual, OutputDirectory: movies}, "output directory"},
+		{"config rule", scanner.ScannerConfig{Mode: scanner.ScanModePeriodic, WatchDirectories: []scanner.WatchDirectory{{Path: movies}}}, "scanIntervalSec"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := validateScannerConfig(&tt.cfg, cfg)
+			if tt.want == "" {
+				if len(problems) != 0 {
+					t.Errorf("expected no problems, got %v", problems)
+				}
+				return
+			}
+			if len(problems) != 1 || !strings.Contains(problems[0], tt.want) {
+				t.Errorf("expected one problem containing %q, got %v", tt.want, problems)
+			}
+		})
+	}
+}
+
+func TestValidateScannerConfigEndpoint(t *testing.T) {
+	app := fiber.New()
+	RegisterScannerConfigRoutes(app.Group("/api"), &config.Config{SourceDir: t.TempDir()})
+
+	req := httptest.NewRequest("POST", "/api/scanner/config/validate", strings.NewReader(`{"mode":"watch","watchDirectories":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	var result ScannerConfigValidation
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if result.Valid || len(result.Problems) != 1 {
+		t.Errorf("expected one problem for watch mode without directories, got %+v", result)
+	}
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"io/fs"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RegisterSPAFallback serves the UI's index page for any GET the static files don't
+// match, so client-side routes survive a reload. Unknown /api paths get a JSON 404
+// instead, API clients shouldn't receive the UI for a mistyped endpoint.
+func RegisterSPAFallback(app *fiber.App, static fs.FS, indexPath string) {
+	app.All("/api/*", func(c *fiber.Ctx) error {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Not found: " + c.Method() + " " + c.Path()})
+	})
+
+	app.Get("*", func(c *fiber.Ctx) error {
+		file, err := fs.ReadFile(static, indexPath)
+		if err != nil {
+			return c.SendStatus(http.StatusNotFound)
+		}
+		c.Set("Content-Type", "text/html")
+		return c.Send(file)
+	})
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestSPAFallback(t *testing.T) {
+	app := fiber.New()
+	app.Get("/api/jobs", func(c *fiber.Ctx) error { return c.JSON([]string{}) })
+	RegisterSPAFallback(app, fstest.MapFS{
+		"web/dist/index.html": {Data: []byte("<html>app</html>")},
+	}, "web/dist/index.html")
+
+	// A mistyped API path is a JSON 404, not the UI
+	for _, method := range []string{"GET", "POST"} {
+		resp, err := app.Test(httptest.NewRequest(method, "/api/jobz", nil))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Errorf("%s /api/jobz: expected a JSON body: %v", method, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 404 || !strings.Contains(resp.Header.Get("Content-Type"), "application/json") || body["error"] == "" {
+			t.Errorf("%s /api/jobz: expected a JSON 404, got %d %q %v", method, resp.StatusCode, resp.Header.Get("Content-Type"), body)
+		}
+	}
+
+	// Known API routes are unaffected
+	resp, err := app.Test(httptest.NewRequest("GET", "/api/jobs", nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("expected /api/jobs to be served, got %d", resp.StatusCode)
+	}
+
+	// Client-side routes get the index page
+	resp, err = app.Test(httptest.NewRequest("GET", "/settings/scanner", nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || string(data) != "<html>app</html>" || resp.Header.Get("Content-Type") != "text/html" {
+		t.Errorf("expected the index page, got %d %q %q", resp.StatusCode, resp.Header.Get("Content-Type"), data)
+	}
+}
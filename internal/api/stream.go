@@ -0,0 +1,124 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/jobs"
+	"github.com/Vasteva/MediaConverter/internal/security"
+	"github.com/gofiber/fiber/v2"
+)
+
+// videoTypes are the content types of the containers jobs write, which the system mime
+// table may lack
+var videoTypes = map[string]string{
+	".mkv":  "video/x-matroska",
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".webm": "video/webm",
+	".ts":   "video/mp2t",
+}
+
+func RegisterStreamRoutes(api fiber.Router, jm *jobs.Manager, cfg *config.Config) {
+	// A job's output for in-browser preview, with range requests for seeking
+	api.Get("/jobs/:id/stream", func(c *fiber.Ctx) error {
+		job := jm.GetJob(c.Params("id"))
+		if job == nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Job not found"})
+		}
+
+		path, err := security.ValidatePath(job.DestinationPath, cfg.Snapshot().DestDir)
+		if err != nil {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Output not found"})
+		}
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			f.Close()
+			return c.Status(404).JSON(fiber.Map{"error": "Output not found"})
+		}
+
+		c.Set(fiber.HeaderContentType, contentType(path))
+		c.Set(fiber.HeaderAcceptRanges, "bytes")
+		start, length := int64(0), info.Size()
+		if header := c.Get(fiber.HeaderRange); header != "" {
+			var ok bool
+			if start, length, ok = parseRange(header, info.Size()); !ok {
+				f.Close()
+				c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", info.Size()))
+				return c.Status(fiber.StatusRequestedRangeNotSatisfiable).JSON(fiber.Map{"error": "Invalid range"})
+			}
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, info.Size()))
+			c.Status(fiber.StatusPartialContent)
+		}
+
+		// The body stream closes the file once sent
+		c.Context().SetBodyStream(struct {
+			io.Reader
+			io.Closer
+		}{io.NewSectionReader(f, start, length), f}, int(length))
+		return nil
+	})
+}
+
+// contentType returns the content type of a media file by extension
+func contentType(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if t, ok := videoTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// parseRange parses a single "bytes=" range against a file size into the start and
+// length to send. Ranges past the end are clipped, multiple ranges aren't supported.
+func parseRange(header string, size int64) (start, length int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	if first == "" {
+		// The last n bytes
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, false
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true
+	}
+
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+	end := size - 1
+	if last != "" {
+		if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+			return 0, 0, false
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end - start + 1, true
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/jobs"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestStreamJobOutput(t *testing.T) {
+	destDir := t.TempDir()
+	output := filepath.Join(destDir, "movie.mkv")
+	if err := os.WriteFile(output, []byte("0123456789"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{DestDir: destDir}
+	jm, _ := jobs.NewManager(cfg, nil, "")
+	for _, job := range []*jobs.Job{
+		{ID: "done", Type: jobs.JobTypeOptimize, Status: jobs.StatusCompleted, DestinationPath: output},
+		{ID: "missing", Type: jobs.JobTypeOptimize, Status: jobs.StatusCompleted, DestinationPath: filepath.Join(destDir, "gone.mkv")},
+		{ID: "outside", Type: jobs.JobTypeOptimize, Status: jobs.StatusCompleted, DestinationPath: "/etc/passwd"},
+	} {
+		if err := jm.AddJob(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+	app := fiber.New()
+	RegisterStreamRoutes(app.Group("/api"), jm, cfg)
+
+	get := func(id, rangeHeader string) (int, string, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/api/jobs/"+id+"/stream", nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode < 400 && resp.Header.Get("Content-Type") != "video/x-matroska" {
+			t.Errorf("expected the matroska content type, got %q", resp.Header.Get("Content-Type"))
+		}
+		return resp.StatusCode, resp.Header.Get("Content-Range"), string(body)
+	}
+
+	if code, _, body := get("done", ""); code != 200 || body != "0123456789" {
+		t.Errorf("expected the whole output, got %d %q", code, body)
+	}
+	if code, contentRange, body := get("done", "bytes=2-5"); code != 206 || contentRange != "bytes 2-5/10" || body != "2345" {
+		t.Errorf("expected bytes 2-5, got %d %q %q", code, contentRange, body)
+	}
+	if code, contentRange, body := get("done", "bytes=-3"); code != 206 || contentRange != "bytes 7-9/10" || body != "789" {
+		t.Errorf("expected the last 3 bytes, got %d %q %q", code, contentRange, body)
+	}
+	if code, contentRange, _ := get("done", "bytes=20-"); code != 416 || contentRange != "bytes */10" {
+		t.Errorf("expected 416 past the end, got %d %q", code, contentRange)
+	}
+
+	if code, _, _ := get("missing", ""); code != 404 {
+		t.Errorf("expected 404 for a missing output, got %d", code)
+	}
+	if code, _, _ := get("unknown", ""); code != 404 {
+		t.Errorf("expected 404 for an unknown job, got %d", code)
+	}
+	if code, _, _ := get("outside", ""); code != 403 {
+		t.Errorf("expected 403 outside the dest dir, got %d", code)
+	}
+}
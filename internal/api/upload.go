@@ -0,0 +1,214 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/jobs"
+	"github.com/Vasteva/MediaConverter/internal/scanner"
+	"github.com/gofiber/fiber/v2"
+)
+
+// errUploadTooLarge is returned once an upload passes UploadMaxSizeMB
+var errUploadTooLarge = errors.New("upload exceeds the size limit")
+
+// RegisterUploadRoutes accepts a video as a multipart "file" field, writes it to the
+// upload directory and queues an optimize job for it. The body is streamed to disk, the
+// server must run with StreamRequestBody so large files aren't buffered in memory.
+func RegisterUploadRoutes(api fiber.Router, jm *jobs.Manager, cfg *config.Config) {
+	// Remove uploads once their job is done with them, after any hook already set
+	next := jm.OnJobComplete
+	jm.OnJobComplete = func(job *jobs.Job) {
+		if next != nil {
+			next(job)
+		}
+		cleanupUpload(job, cfg.Snapshot())
+	}
+
+	api.Post("/upload", func(c *fiber.Ctx) error {
+		settings := cfg.Snapshot()
+		if settings.UploadDir == "" {
+			return c.Status(403).JSON(fiber.Map{"error": "uploads are disabled, set UPLOAD_DIR to allow them"})
+		}
+		mediaType, params, err := mime.ParseMediaType(c.Get(fiber.HeaderContentType))
+		if err != nil || mediaType != fiber.MIMEMultipartForm || params["boundary"] == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "expected a multipart/form-data body"})
+		}
+
+		// Refuse what can't fit before reading it, the limit is checked again while copying
+		maxBytes := int64(settings.UploadMaxSizeMB) << 20
+		if length := c.Request().Header.ContentLength(); length > 0 && int64(length) > maxBytes+(1<<20) {
+			return c.Status(413).JSON(fiber.Map{"error": fmt.Sprintf("uploads are limited to %d MB", settings.UploadMaxSizeMB)})
+		}
+		if err := checkWritable(settings.DestDir); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("invalid destination: %v", err)})
+		}
+
+		body := c.Context().RequestBodyStream()
+		if body == nil {
+			body = bytes.NewReader(c.Body())
+		}
+		reader := multipart.NewReader(body, params["boundary"])
+
+		var sourcePath string
+		for sourcePath == "" {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return c.Status(400).JSON(fiber.Map{"error": "the form has no file field"})
+			}
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("invalid multipart body: %v", err)})
+			}
+			if part.FormName() != "file" {
+				part.Close()
+				continue
+			}
+
+			sourcePath, err = saveUpload(part, settings.UploadDir, maxBytes)
+			part.Close()
+			if errors.Is(err, errUploadTooLarge) {
+				return c.Status(413).JSON(fiber.Map{"error": fmt.Sprintf("uploads are limited to %d MB", settings.UploadMaxSizeMB)})
+			}
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+			}
+		}
+
+		sourceName := filepath.Base(sourcePath)
+		sourceExt := filepath.Ext(sourceName)
+		job := &jobs.Job{
+			ID:              generateID(),
+			Type:            jobs.JobTypeOptimize,
+			SourcePath:      sourcePath,
+			DestinationPath: filepath.Join(settings.DestDir, strings.TrimSuffix(sourceName, sourceExt)+"_optimized"+sourceExt),
+			Status:          jobs.StatusPending,
+			AudioCodec:      settings.AudioCodec,
+			Container:       settings.Container,
+			Uploaded:        true,
+			CreatedAt:       time.Now(),
+		}
+		if err := jm.AddJob(job); err != nil {
+			os.Remove(sourcePath)
+			return c.Status(503).JSON(fiber.Map{"error": err.Error()})
+		}
+		log.Printf("[Upload] Queued job %s for %s", job.ID, sourcePath)
+		return c.Status(201).JSON(job)
+	})
+}
+
+// saveUpload streams an uploaded video into dir and returns its path. The file is written
+// under a hidden name and only renamed into place once complete, so a watched upload
+// directory never sees a partial file. Names already taken are numbered, e.g. Movie_2.mkv.
+func saveUpload(part *multipart.Part, dir string, maxBytes int64) (string, error) {
+	name := part.FileName()
+	ext := strings.ToLower(filepath.Ext(name))
+	if name == "" || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("the file field has no file name")
+	}
+	if scanner.DefaultExtensionJobTypes()[ext] != jobs.JobTypeOptimize {
+		return "", fmt.Errorf("unsupported file type %q, only video files can be uploaded", ext)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create upload directory: %v", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload file: %v", err)
+	}
+	n, err := io.Copy(tmp, io.LimitReader(part, maxBytes+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && n > maxBytes {
+		err = errUploadTooLarge
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		if errors.Is(err, errUploadTooLarge) {
+			return "", err
+		}
+		return "", fmt.Errorf("failed to save upload: %v", err)
+	}
+
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	path := filepath.Join(dir, name)
+	for i := 2; ; i++ {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			break
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s_%d%s", base, i, filepath.Ext(name)))
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to save upload: %v", err)
+	}
+	return path, nil
+}
+
+// cleanupUpload removes a finished job's source if it was uploaded, per UploadCleanup.
+// With the default policy failed and cancelled jobs keep theirs so they can be retried.
+// Only jobs created by an upload, and their retries, are marked Uploaded, so sources that
+// merely sit in the upload directory are never removed.
+func cleanupUpload(job *jobs.Job, settings *config.Config) {
+	if !job.Uploaded || job.RemoteSource {
+		return
+	}
+	switch settings.UploadCleanup {
+	case config.UploadCleanupNever:
+		return
+	case config.UploadCleanupAlways:
+	default:
+		if job.Status != jobs.StatusCompleted {
+			return
+		}
+	}
+	if err := os.Remove(job.SourcePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Upload] Failed to remove %s: %v", job.SourcePath, err)
+		return
+	}
+	log.Printf("[Upload] Removed %s after job %s", job.SourcePath, job.ID)
+}
+
+// LimitRequestBodies enforces the body limit on every route but the upload. With
+// StreamRequestBody fiber streams bodies over its BodyLimit, or of unknown length, instead
+// of refusing them, so other routes read theirs here through a reader capped at limit.
+func LimitRequestBodies(limit int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Path() == "/api/upload" {
+			return c.Next()
+		}
+		if c.Request().Header.ContentLength() > limit {
+			return bodyTooLarge(c)
+		}
+		if stream := c.Context().RequestBodyStream(); stream != nil {
+			body, err := io.ReadAll(io.LimitReader(stream, int64(limit)+1))
+			if err != nil {
+				c.Context().SetConnectionClose()
+				return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("failed to read request body: %v", err)})
+			}
+			if len(body) > limit {
+				return bodyTooLarge(c)
+			}
+			c.Request().SetBody(body)
+		}
+		return c.Next()
+	}
+}
+
+// bodyTooLarge refuses a request with 413 and closes the connection, the rest of the body
+// is left unread
+func bodyTooLarge(c *fiber.Ctx) error {
+	c.Context().SetConnectionClose()
+	return c.Status(413).JSON(fiber.Map{"error": "request body too large"})
+}
@@ -0,0 +1,153 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/jobs"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestUpload(t *testing.T) {
+	uploadDir, destDir := t.TempDir(), t.TempDir()
+	cfg := &config.Config{UploadDir: uploadDir, DestDir: destDir, UploadMaxSizeMB: 1, UploadCleanup: config.UploadCleanupCompleted, Container: "mkv"}
+	jm, _ := jobs.NewManager(cfg, nil, "")
+	app := fiber.New(fiber.Config{StreamRequestBody: true, DisablePreParseMultipartForm: true})
+	RegisterUploadRoutes(app.Group("/api"), jm, cfg)
+
+	upload := func(name string, data []byte) (int, jobs.Job) {
+		t.Helper()
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("note", "ignored")
+		part, _ := form.CreateFormFile("file", name)
+		part.Write(data)
+		form.Close()
+
+		req := httptest.NewRequest("POST", "/api/upload", &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var job jobs.Job
+		json.NewDecoder(resp.Body).Decode(&job)
+		return resp.StatusCode, job
+	}
+
+	code, job := upload("Movie.mkv", []byte("video data"))
+	if code != 201 {
+		t.Fatalf("expected the upload to create a job, got %d", code)
+	}
+	if job.Type != jobs.JobTypeOptimize || job.SourcePath != filepath.Join(uploadDir, "Movie.mkv") ||
+		job.DestinationPath != filepath.Join(destDir, "Movie_optimized.mkv") {
+		t.Errorf("unexpected job: %+v", job)
+	}
+	if data, err := os.ReadFile(job.SourcePath); err != nil || string(data) != "video data" {
+		t.Errorf("expected the upload on disk, got %q %v", data, err)
+	}
+	if queued := jm.GetJob(job.ID); queued == nil || queued.Status != jobs.StatusPending {
+		t.Errorf("expected the job to be queued, got %+v", queued)
+	}
+
+	// A second upload of the same name doesn't overwrite the first
+	if code, second := upload("Movie.mkv", []byte("other")); code != 201 || second.SourcePath != filepath.Join(uploadDir, "Movie_2.mkv") {
+		t.Errorf("expected a numbered second upload, got %d %q", code, second.SourcePath)
+	}
+
+	if code, _ := upload("notes.txt", []byte("text")); code != 400 {
+		t.Errorf("expected non-video uploads to be refused, got %d", code)
+	}
+	if code, _ := upload("Big.mkv", make([]byte, 1<<20+1)); code != 413 {
+		t.Errorf("expected uploads over the limit to be refused, got %d", code)
+	}
+	if _, err := os.Stat(filepath.Join(uploadDir, "Big.mkv")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing left of a refused upload, got %v", err)
+	}
+
+	if !job.Uploaded {
+		t.Errorf("expected the job marked as uploaded")
+	}
+
+	// Sources not uploaded are kept, even in the upload directory
+	other := filepath.Join(uploadDir, "Other.mkv")
+	os.WriteFile(other, []byte("video data"), 0644)
+	jm.OnJobComplete(&jobs.Job{ID: "scanned", SourcePath: other, Status: jobs.StatusCompleted})
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("expected a source that wasn't uploaded to be kept: %v", err)
+	}
+
+	// Failed jobs keep their upload, completed ones remove it
+	finished := &jobs.Job{ID: job.ID, SourcePath: job.SourcePath, Status: jobs.StatusFailed, Uploaded: true}
+	jm.OnJobComplete(finished)
+	if _, err := os.Stat(job.SourcePath); err != nil {
+		t.Errorf("expected a failed job to keep its upload: %v", err)
+	}
+	finished.Status = jobs.StatusCompleted
+	jm.OnJobComplete(finished)
+	if _, err := os.Stat(job.SourcePath); !os.IsNotExist(err) {
+		t.Errorf("expected the upload removed once its job completed, got %v", err)
+	}
+
+	// Without an upload directory uploads are off
+	cfg.UploadDir = ""
+	if code, _ := upload("Movie.mkv", []byte("video data")); code != 403 {
+		t.Errorf("expected uploads to be disabled, got %d", code)
+	}
+}
+
+func TestLimitRequestBodies(t *testing.T) {
+	// The server's config, JSON routes still get their bodies
+	app := fiber.New(fiber.Config{StreamRequestBody: true, DisablePreParseMultipartForm: true})
+	app.Use(LimitRequestBodies(fiber.DefaultBodyLimit))
+	app.Post("/api/echo", func(c *fiber.Ctx) error {
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.JSON(req)
+	})
+
+	post := func(body io.Reader, chunked bool) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/echo", body)
+		req.Header.Set("Content-Type", "application/json")
+		if chunked {
+			req.ContentLength = -1
+			req.TransferEncoding = []string{"chunked"}
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	if code, body := post(strings.NewReader(`{"name":"movies"}`), false); code != 200 || body != `{"name":"movies"}` {
+		t.Errorf("expected the JSON body to be parsed, got %d %s", code, body)
+	}
+	if code, body := post(strings.NewReader(`{"name":"chunked"}`), true); code != 200 || body != `{"name":"chunked"}` {
+		t.Errorf("expected a chunked JSON body to be parsed, got %d %s", code, body)
+	}
+
+	large := `{"name":"` + strings.Repeat("x", fiber.DefaultBodyLimit) + `"}`
+	if code, _ := post(strings.NewReader(large), false); code != 413 {
+		t.Errorf("expected a body over the limit to be refused, got %d", code)
+	}
+	if code, _ := post(strings.NewReader(large), true); code != 413 {
+		t.Errorf("expected a chunked body over the limit to be refused, got %d", code)
+	}
+}
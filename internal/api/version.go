@@ -0,0 +1,31 @@
+package api
+
+import (
+	"runtime"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/system"
+	"github.com/gofiber/fiber/v2"
+)
+
+// VersionInfo is the response body of /api/version
+type VersionInfo struct {
+	Version   string            `json:"version"`
+	GoVersion string            `json:"goVersion"`
+	Tools     map[string]string `json:"tools"`
+}
+
+func RegisterVersionRoutes(api fiber.Router, cfg *config.Config) {
+	api.Get("/version", func(c *fiber.Ctx) error {
+		settings := cfg.Snapshot()
+		return c.JSON(VersionInfo{
+			Version:   system.Version,
+			GoVersion: runtime.Version(),
+			Tools: system.ToolVersions(map[string]string{
+				"ffmpeg":     settings.FFmpegPath,
+				"ffprobe":    settings.FFprobePath,
+				"makemkvcon": settings.MakeMKVPath,
+			}),
+		})
+	})
+}
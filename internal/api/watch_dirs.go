@@ -0,0 +1,83 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/events"
+	"github.com/Vasteva/MediaConverter/internal/scanner"
+	"github.com/Vasteva/MediaConverter/internal/security"
+	"github.com/gofiber/fiber/v2"
+)
+
+// RegisterWatchDirectoryRoutes lists, adds and removes single watch directories without
+// resending the whole scanner config
+func RegisterWatchDirectoryRoutes(api fiber.Router, fs *scanner.Scanner, eventLog *events.Log, cfg *config.Config) {
+	api.Get("/scanner/directories", func(c *fiber.Ctx) error {
+		if fs == nil {
+			return c.Status(503).JSON(fiber.Map{"error": "Scanner not initialized"})
+		}
+		dirs := fs.GetConfig().WatchDirectories
+		if dirs == nil {
+			dirs = []scanner.WatchDirectory{}
+		}
+		return c.JSON(dirs)
+	})
+
+	api.Post("/scanner/directories", func(c *fiber.Ctx) error {
+		if fs == nil {
+			return c.Status(503).JSON(fiber.Map{"error": "Scanner not initialized"})
+		}
+
+		var dir scanner.WatchDirectory
+		if err := c.BodyParser(&dir); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		if dir.Path == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "path is required"})
+		}
+
+		// Security: watch directories must be under the source root
+		validPath, err := security.ValidatePath(dir.Path, cfg.Snapshot().SourceDir)
+		if err != nil {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
+		if problem := checkDirectory(validPath); problem != "" {
+			return c.Status(400).JSON(fiber.Map{"error": problem})
+		}
+		dir.Path = validPath
+
+		if err := fs.AddWatchDirectory(dir); errors.Is(err, scanner.ErrWatchDirectoryExists) {
+			return c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		eventLog.Append(events.Event{Type: events.ConfigChanged, Message: fmt.Sprintf("Watch directory %s added", dir.Path)})
+
+		return c.Status(201).JSON(dir)
+	})
+
+	api.Delete("/scanner/directories", func(c *fiber.Ctx) error {
+		if fs == nil {
+			return c.Status(503).JSON(fiber.Map{"error": "Scanner not initialized"})
+		}
+
+		if c.Query("path") == "" {
+			return c.Status(400).JSON(fiber.Map{"error": "path is required"})
+		}
+		path, err := security.ValidatePath(c.Query("path"), cfg.Snapshot().SourceDir)
+		if err != nil {
+			return c.Status(403).JSON(fiber.Map{"error": err.Error()})
+		}
+
+		if err := fs.RemoveWatchDirectory(path); errors.Is(err, scanner.ErrWatchDirectoryNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		} else if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		eventLog.Append(events.Event{Type: events.ConfigChanged, Message: fmt.Sprintf("Watch directory %s removed", path)})
+
+		return c.JSON(fiber.Map{"success": true})
+	})
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/scanner"
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestWatchDirectoryRoutes(t *testing.T) {
+	sourceDir := t.TempDir()
+	movies, tv := filepath.Join(sourceDir, "movies"), filepath.Join(sourceDir, "tv")
+	for _, dir := range []string{movies, tv} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fs, err := scanner.NewScanner(&scanner.ScannerConfig{
+		Mode:              scanner.ScanModeManual,
+		ProcessedFilePath: filepath.Join(t.TempDir(), "processed.json"),
+		WatchDirectories:  []scanner.WatchDirectory{{Path: movies}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+	fs.WatchDirsFile = filepath.Join(t.TempDir(), "scanner-config.json")
+
+	app := fiber.New()
+	RegisterWatchDirectoryRoutes(app.Group("/api"), fs, nil, &config.Config{SourceDir: sourceDir})
+
+	do := func(method, target, body string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	listed := func() []string {
+		t.Helper()
+		resp, err := app.Test(httptest.NewRequest("GET", "/api/scanner/directories", nil))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var dirs []scanner.WatchDirectory
+		if err := json.NewDecoder(resp.Body).Decode(&dirs); err != nil {
+			t.Fatal(err)
+		}
+		var paths []string
+		for _, d := range dirs {
+			paths = append(paths, d.Path)
+		}
+		return paths
+	}
+	saved := func() int {
+		t.Helper()
+		data, err := os.ReadFile(fs.WatchDirsFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var dirs []scanner.WatchDirectory
+		if err := json.Unmarshal(data, &dirs); err != nil {
+			t.Fatal(err)
+		}
+		return len(dirs)
+	}
+
+	// Add, then adding again conflicts
+	if code := do("POST", "/api/scanner/directories", `{"path":"`+tv+`","recursive":true}`); code != 201 {
+		t.Fatalf("expected 201, got %d", code)
+	}
+	if got := listed(); len(got) != 2 || got[1] != tv {
+		t.Fatalf("expected %s to be added, got %v", tv, got)
+	}
+	if !fs.GetConfig().WatchDirectories[1].Recursive || saved() != 2 {
+		t.Errorf("expected the added directory to be applied and saved")
+	}
+	if code := do("POST", "/api/scanner/directories", `{"path":"`+tv+`/"}`); code != 409 {
+		t.Errorf("expected 409 for a watched directory, got %d", code)
+	}
+
+	// Paths must be existing directories under the source root
+	if code := do("POST", "/api/scanner/directories", `{"path":"`+t.TempDir()+`"}`); code != 403 {
+		t.Errorf("expected 403 outside the source root, got %d", code)
+	}
+	if code := do("POST", "/api/scanner/directories", `{"path":"`+filepath.Join(sourceDir, "music")+`"}`); code != 400 {
+		t.Errorf("expected 400 for a missing directory, got %d", code)
+	}
+	if code := do("POST", "/api/scanner/directories", `{}`); code != 400 {
+		t.Errorf("expected 400 without a path, got %d", code)
+	}
+
+	// Remove, then removing again is not found
+	target := "/api/scanner/directories?path=" + url.QueryEscape(movies)
+	if code := do("DELETE", target, ""); code != 200 {
+		t.Fatalf("expected 200, got %d", code)
+	}
+	if got := listed(); len(got) != 1 || got[0] != tv {
+		t.Errorf("expected only %s left, got %v", tv, got)
+	}
+	if saved() != 1 {
+		t.Errorf("expected the removal to be saved")
+	}
+	if code := do("DELETE", target, ""); code != 404 {
+		t.Errorf("expected 404 for a directory not watched, got %d", code)
+	}
+	if code := do("DELETE", "/api/scanner/directories?path="+url.QueryEscape(t.TempDir()), ""); code != 403 {
+		t.Errorf("expected 403 outside the source root, got %d", code)
+	}
+	if code := do("DELETE", "/api/scanner/directories", ""); code != 400 {
+		t.Errorf("expected 400 without a path, got %d", code)
+	}
+}
@@ -2,12 +2,23 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 
+	"github.com/Vasteva/MediaConverter/internal/ai"
+	"github.com/Vasteva/MediaConverter/internal/ai/meta"
+	"github.com/Vasteva/MediaConverter/internal/ai/search"
 	"github.com/Vasteva/MediaConverter/internal/license"
+	"github.com/Vasteva/MediaConverter/internal/media"
 	"github.com/Vasteva/MediaConverter/internal/system"
 )
 
@@ -19,13 +30,114 @@ type Config struct {
 	SourceDir string `json:"sourceDir"`
 	DestDir   string `json:"destDir"`
 
+	// Scratch space for intermediate files (audio extraction, disc rips)
+	TempDir string `json:"tempDir"`
+
+	// External tools, looked up in PATH when empty. Changes take effect on restart.
+	FFmpegPath  string `json:"ffmpegPath"`
+	FFprobePath string `json:"ffprobePath"`
+	MakeMKVPath string `json:"makemkvPath"`
+
+	// MakeMKV conversion profile for extractions, an .mmcp.xml path or a profile name in ~/.MakeMKV
+	MakeMKVProfile string `json:"makemkvProfile"`
+
+	// Titles of a multi-title extract job (maxTitles) ripped at once, 1 rips them in turn
+	ExtractParallelTitles int `json:"extractParallelTitles"`
+
+	// Where jobs and processed files are kept, see StorageBackends. Changes take effect on restart.
+	StorageBackend string `json:"storageBackend"`
+	SQLitePath     string `json:"sqlitePath"` // Database file for the sqlite backend
+
 	// Encoding
 	GPUVendor     string `json:"gpuVendor"`
+	GPUDevice     string `json:"gpuDevice"` // Render node for VAAPI or device index for NVIDIA (empty = default)
 	QualityPreset string `json:"qualityPreset"`
-	CRF           int    `json:"crf"`
+	CRF           int    `json:"crf"`          // MinCRF-MaxCRF, 0 is a value rather than "default", not lossless
+	MaxBitrate    string `json:"maxBitrate"`   // Peak video bitrate cap, e.g. "8M" (empty = uncapped)
+	BufSize       string `json:"bufSize"`      // VBV buffer size, defaults to MaxBitrate
+	AudioCodec    string `json:"audioCodec"`   // Default audio codec, see AudioCodecs
+	AudioBitrate  string `json:"audioBitrate"` // Bitrate when re-encoding audio, e.g. "192k" (empty = codec default)
+	Container     string `json:"container"`    // Default output container, see Containers (empty = destination's extension)
+
+	// Keep only subtitle tracks in these ISO 639-2 languages, comma-separated (empty keeps
+	// them all), plus forced tracks in any language with KeepForcedSubtitles
+	SubtitleLanguages   string `json:"subtitleLanguages"`
+	KeepForcedSubtitles bool   `json:"keepForcedSubtitles"`
+
+	// Encoder option overrides per GPU vendor as "key=value,...", see media.TuningKeys.
+	// Unset options keep the built-in values.
+	NvidiaTuning string `json:"nvidiaTuning"`
+	IntelTuning  string `json:"intelTuning"`
+	AMDTuning    string `json:"amdTuning"`
+
+	// Decode on the GPU but encode with libx265, trading speed for quality
+	HybridHWDecode bool `json:"hybridHwDecode"`
+
+	// Add chapters from scene detection to outputs whose source has none
+	GenerateChapters bool `json:"generateChapters"`
+
+	// Write a .nfo with the AI-cleaned title next to optimized outputs
+	WriteNFO    bool   `json:"writeNfo"`
+	NFOTemplate string `json:"nfoTemplate"` // Path to a custom NFO template (empty uses the built-in movie NFO)
+
+	// Give outputs the source's modification time, the disc image's for rips
+	PreserveMTime bool `json:"preserveMtime"`
+
+	// What optimize jobs whose destination is their source do, see SameOutputActions
+	SameOutputAction string `json:"sameOutputAction"`
 
 	// Jobs
-	MaxConcurrentJobs int `json:"maxConcurrentJobs"`
+	MaxConcurrentJobs int    `json:"maxConcurrentJobs"`
+	MaxQueuedJobs     int    `json:"maxQueuedJobs"`     // Pending jobs allowed before new ones are refused
+	KeepRip           bool   `json:"keepRip"`           // Keep the intermediate MKV from disc image jobs
+	RipDir            string `json:"ripDir"`            // Where kept rips are moved (defaults to the output directory)
+	ShutdownGraceSec  int    `json:"shutdownGraceSec"`  // How long running jobs may finish on shutdown
+	MaxJobDurationSec int    `json:"maxJobDurationSec"` // Running jobs are failed with a timeout after this long (0 disables)
+	ProbeTimeoutSec   int    `json:"probeTimeoutSec"`   // Longest one ffprobe of a source may take. Changes take effect on restart.
+	MinFreeSpaceGB    int    `json:"minFreeSpaceGB"`    // Free space required at the destination before a job starts (0 disables)
+	JobRetentionDays  int    `json:"jobRetentionDays"`  // Days finished jobs are kept (0 keeps them forever)
+	MaxStoredJobs     int    `json:"maxStoredJobs"`     // Cap on stored jobs, oldest finished are pruned first (0 is unlimited)
+
+	// Progress updates are persisted at most this often, status changes always are (0 saves every update)
+	ProgressSaveIntervalSec int `json:"progressSaveIntervalSec"`
+
+	// Optimize jobs skip sources shorter than this (0 disables)
+	MinSourceDurationSec int `json:"minSourceDurationSec"`
+
+	// Alert once more than FailureAlertPercent of the last FailureAlertWindow finished jobs
+	// failed, e.g. after a GPU driver crash (a window of 0 disables)
+	FailureAlertWindow  int `json:"failureAlertWindow"`
+	FailureAlertPercent int `json:"failureAlertPercent"`
+
+	// URL schemes allowed for remote optimize sources, comma separated (empty or "none"
+	// disables). Off by default, a source URL makes the server fetch from any host.
+	RemoteSourceSchemes string `json:"remoteSourceSchemes"`
+
+	// Applied to finished outputs, empty/0 leave the mode and owner as written
+	OutputFileMode string `json:"outputFileMode"` // Octal, e.g. "0664"
+	OutputUID      int    `json:"outputUid"`
+	OutputGID      int    `json:"outputGid"`
+
+	// Shell command run after each successful job with the job in VASTIVA_* variables.
+	// Arbitrary execution, so it only runs with PostCommandEnabled, which is read from the
+	// environment alone and can't be turned on through the API or config file.
+	PostCommand           string `json:"postCommand"`
+	PostCommandEnabled    bool   `json:"postCommandEnabled"`
+	PostCommandTimeoutSec int    `json:"postCommandTimeoutSec"`
+
+	// Allow jobs to pass their own ffmpeg arguments (customArgs). They can overwrite files
+	// or read any path ffmpeg can, so like PostCommandEnabled this is environment only.
+	CustomArgsEnabled bool `json:"customArgsEnabled"`
+
+	// Files uploaded to /api/upload are written to UploadDir (empty disables uploads), at
+	// most UploadMaxSizeMB each, and removed per UploadCleanup once their job finishes
+	UploadDir       string `json:"uploadDir"`
+	UploadMaxSizeMB int    `json:"uploadMaxSizeMb"`
+	UploadCleanup   string `json:"uploadCleanup"`
+
+	// Skip optimizing sources that are already HEVC at or under EfficientMaxBitrateKbps
+	SkipIfAlreadyEfficient  bool `json:"skipIfAlreadyEfficient"`
+	EfficientMaxBitrateKbps int  `json:"efficientMaxBitrateKbps"`
 
 	// AI
 	AIProvider string `json:"aiProvider"`
@@ -33,45 +145,137 @@ type Config struct {
 	AIEndpoint string `json:"aiEndpoint"`
 	AIModel    string `json:"aiModel"`
 
+	// AI requests the jobs may have in flight at once, later ones wait up to
+	// AIQueueTimeoutSec for a slot. Changes take effect on restart.
+	AIMaxConcurrent   int `json:"aiMaxConcurrent"`
+	AIQueueTimeoutSec int `json:"aiQueueTimeoutSec"`
+	AIMaxAttempts     int `json:"aiMaxAttempts"` // Sends of an AI request answered with 429 or 5xx, with backoff between
+
+	// AI prompt overrides, Go text/template source or "@" and the path of a template
+	// file (empty = built-in prompt)
+	AIPromptCleanFilename   string `json:"aiPromptCleanFilename"`
+	AIPromptAnalyzeEncoding string `json:"aiPromptAnalyzeEncoding"`
+	AIPromptSearch          string `json:"aiPromptSearch"`
+
 	// Auth
-	AdminPassword string `json:"adminPassword"`
-	LicenseKey    string `json:"licenseKey"`
+	AdminPassword  string `json:"adminPassword"`
+	ReadOnlyAPIKey string `json:"readOnlyApiKey"` // Bearer key limited to GET requests (empty disables)
+	LicenseKey     string `json:"licenseKey"`
 
 	// Scanner
-	ScannerEnabled       bool   `json:"scannerEnabled"`
-	ScannerMode          string `json:"scannerMode"`
-	ScannerIntervalSec   int    `json:"scannerIntervalSec"`
-	ScannerAutoCreate    bool   `json:"scannerAutoCreate"`
-	ScannerProcessedFile string `json:"scannerProcessedFile"`
+	ScannerEnabled        bool   `json:"scannerEnabled"`
+	ScannerMode           string `json:"scannerMode"`
+	ScannerIntervalSec    int    `json:"scannerIntervalSec"`
+	ScannerAutoCreate     bool   `json:"scannerAutoCreate"`
+	ScannerProcessedFile  string `json:"scannerProcessedFile"`
+	ScannerMaxJobsPerScan int    `json:"scannerMaxJobsPerScan"`
+
+	// Hold periodic scans while jobs are encoding, so the encode gets the disk to itself
+	ScannerPauseWhileEncoding bool `json:"scannerPauseWhileEncoding"`
+
+	// Percent of the dashboard efficiency score that is AI feature usage, the rest is the
+	// compression achieved
+	EfficiencyAIWeight int `json:"efficiencyAIWeight"`
 
 	// State
 	IsPremium     bool `json:"-"`
 	IsInitialized bool `json:"-"`
+
+	// Guards the fields above, the config is shared by the HTTP handlers, job workers and scanner
+	mu sync.RWMutex
+
+	// Stored secrets that failed to decrypt, by JSON name, written back unchanged on save
+	undecrypted map[string]string
 }
 
-const ConfigFile = "/data/config.json"
+// ConfigFile is where settings changed at runtime are saved
+var ConfigFile = "/data/config.json"
+
+// saveMu serializes writes of ConfigFile and its backup
+var saveMu sync.Mutex
 
 func Load() *Config {
 	// Default values
 	cfg := &Config{
-		Port:                 getEnv("PORT", "8080"),
-		SourceDir:            getEnv("SOURCE_DIR", "/storage"),
-		DestDir:              getEnv("DEST_DIR", "/output"),
-		GPUVendor:            getEnv("GPU_VENDOR", "auto"),
-		QualityPreset:        getEnv("QUALITY_PRESET", "medium"),
-		CRF:                  getEnvInt("CRF", 23),
-		MaxConcurrentJobs:    getEnvInt("MAX_CONCURRENT_JOBS", 2),
-		AIProvider:           getEnv("AI_PROVIDER", "none"),
-		AIApiKey:             getEnv("AI_API_KEY", ""),
-		AIEndpoint:           getEnv("AI_ENDPOINT", ""),
-		AIModel:              getEnv("AI_MODEL", ""),
-		AdminPassword:        getEnv("ADMIN_PASSWORD", ""),
-		LicenseKey:           getEnv("LICENSE_KEY", ""),
-		ScannerEnabled:       getEnvBool("SCANNER_ENABLED", false),
-		ScannerMode:          getEnv("SCANNER_MODE", "manual"),
-		ScannerIntervalSec:   getEnvInt("SCANNER_INTERVAL_SEC", 300),
-		ScannerAutoCreate:    getEnvBool("SCANNER_AUTO_CREATE", true),
-		ScannerProcessedFile: getEnv("SCANNER_PROCESSED_FILE", "/data/processed.json"),
+		Port:                      getEnv("PORT", "8080"),
+		SourceDir:                 getEnv("SOURCE_DIR", "/storage"),
+		DestDir:                   getEnv("DEST_DIR", "/output"),
+		TempDir:                   getEnv("TEMP_DIR", ""),
+		FFmpegPath:                getEnv("FFMPEG_PATH", ""),
+		FFprobePath:               getEnv("FFPROBE_PATH", ""),
+		MakeMKVPath:               getEnv("MAKEMKV_PATH", ""),
+		MakeMKVProfile:            getEnv("MAKEMKV_PROFILE", ""),
+		ExtractParallelTitles:     getEnvInt("EXTRACT_PARALLEL_TITLES", 1),
+		StorageBackend:            getEnv("STORAGE_BACKEND", "json"),
+		SQLitePath:                getEnv("SQLITE_PATH", "/data/vastiva.db"),
+		GPUVendor:                 getEnv("GPU_VENDOR", "auto"),
+		GPUDevice:                 getEnv("GPU_DEVICE", ""),
+		SubtitleLanguages:         getEnv("SUBTITLE_LANGUAGES", ""),
+		KeepForcedSubtitles:       getEnvBool("KEEP_FORCED_SUBTITLES", false),
+		NvidiaTuning:              getEnv("NVIDIA_TUNING", ""),
+		IntelTuning:               getEnv("INTEL_TUNING", ""),
+		AMDTuning:                 getEnv("AMD_TUNING", ""),
+		QualityPreset:             getEnv("QUALITY_PRESET", "medium"),
+		CRF:                       getEnvInt("CRF", DefaultCRF),
+		MaxBitrate:                getEnv("MAX_BITRATE", ""),
+		BufSize:                   getEnv("BUF_SIZE", ""),
+		AudioCodec:                getEnv("AUDIO_CODEC", "copy"),
+		AudioBitrate:              getEnv("AUDIO_BITRATE", ""),
+		Container:                 getEnv("CONTAINER", ""),
+		HybridHWDecode:            getEnvBool("HYBRID_HW_DECODE", false),
+		GenerateChapters:          getEnvBool("GENERATE_CHAPTERS", false),
+		WriteNFO:                  getEnvBool("WRITE_NFO", false),
+		NFOTemplate:               getEnv("NFO_TEMPLATE", ""),
+		PreserveMTime:             getEnvBool("PRESERVE_MTIME", false),
+		SameOutputAction:          getEnv("SAME_OUTPUT_ACTION", SameOutputReject),
+		MaxConcurrentJobs:         getEnvInt("MAX_CONCURRENT_JOBS", 2),
+		MaxQueuedJobs:             getEnvInt("MAX_QUEUED_JOBS", 1000),
+		KeepRip:                   getEnvBool("KEEP_RIP", false),
+		RipDir:                    getEnv("RIP_DIR", ""),
+		ShutdownGraceSec:          getEnvInt("SHUTDOWN_GRACE_SEC", 30),
+		MaxJobDurationSec:         getEnvInt("MAX_JOB_DURATION_SEC", 0),
+		FailureAlertWindow:        getEnvInt("FAILURE_ALERT_WINDOW", DefaultFailureAlertWindow),
+		FailureAlertPercent:       getEnvInt("FAILURE_ALERT_PERCENT", DefaultFailureAlertPercent),
+		ProbeTimeoutSec:           getEnvInt("PROBE_TIMEOUT_SEC", DefaultProbeTimeoutSec),
+		MinFreeSpaceGB:            getEnvInt("MIN_FREE_SPACE_GB", 5),
+		JobRetentionDays:          getEnvInt("JOB_RETENTION_DAYS", 0),
+		MaxStoredJobs:             getEnvInt("MAX_STORED_JOBS", 0),
+		ProgressSaveIntervalSec:   getEnvInt("PROGRESS_SAVE_INTERVAL_SEC", 5),
+		MinSourceDurationSec:      getEnvInt("MIN_SOURCE_DURATION_SEC", 0),
+		RemoteSourceSchemes:       getEnv("REMOTE_SOURCE_SCHEMES", ""),
+		OutputFileMode:            getEnv("OUTPUT_FILE_MODE", ""),
+		OutputUID:                 getEnvInt("OUTPUT_UID", 0),
+		OutputGID:                 getEnvInt("OUTPUT_GID", 0),
+		PostCommand:               getEnv("POST_COMMAND", ""),
+		PostCommandEnabled:        getEnvBool("POST_COMMAND_ENABLED", false),
+		CustomArgsEnabled:         getEnvBool("CUSTOM_FFMPEG_ARGS_ENABLED", false),
+		UploadDir:                 getEnv("UPLOAD_DIR", ""),
+		UploadMaxSizeMB:           getEnvInt("UPLOAD_MAX_SIZE_MB", DefaultUploadMaxSizeMB),
+		UploadCleanup:             getEnv("UPLOAD_CLEANUP", UploadCleanupCompleted),
+		PostCommandTimeoutSec:     getEnvInt("POST_COMMAND_TIMEOUT_SEC", DefaultPostCommandTimeoutSec),
+		SkipIfAlreadyEfficient:    getEnvBool("SKIP_IF_ALREADY_EFFICIENT", false),
+		EfficientMaxBitrateKbps:   getEnvInt("EFFICIENT_MAX_BITRATE_KBPS", 8000),
+		AIProvider:                getEnv("AI_PROVIDER", "none"),
+		AIApiKey:                  getEnv("AI_API_KEY", ""),
+		AIEndpoint:                getEnv("AI_ENDPOINT", ""),
+		AIModel:                   getEnv("AI_MODEL", ""),
+		AIMaxConcurrent:           getEnvInt("AI_MAX_CONCURRENT", DefaultAIMaxConcurrent),
+		AIQueueTimeoutSec:         getEnvInt("AI_QUEUE_TIMEOUT_SEC", DefaultAIQueueTimeoutSec),
+		AIMaxAttempts:             getEnvInt("AI_MAX_ATTEMPTS", ai.DefaultMaxAttempts),
+		AIPromptCleanFilename:     getEnv("AI_PROMPT_CLEAN_FILENAME", ""),
+		AIPromptAnalyzeEncoding:   getEnv("AI_PROMPT_ANALYZE_ENCODING", ""),
+		AIPromptSearch:            getEnv("AI_PROMPT_SEARCH", ""),
+		AdminPassword:             getEnv("ADMIN_PASSWORD", ""),
+		ReadOnlyAPIKey:            getEnv("READ_ONLY_API_KEY", ""),
+		LicenseKey:                getEnv("LICENSE_KEY", ""),
+		ScannerEnabled:            getEnvBool("SCANNER_ENABLED", false),
+		ScannerMode:               getEnv("SCANNER_MODE", "manual"),
+		ScannerIntervalSec:        getEnvInt("SCANNER_INTERVAL_SEC", 300),
+		ScannerAutoCreate:         getEnvBool("SCANNER_AUTO_CREATE", true),
+		ScannerProcessedFile:      getEnv("SCANNER_PROCESSED_FILE", "/data/processed.json"),
+		ScannerMaxJobsPerScan:     getEnvInt("SCANNER_MAX_JOBS_PER_SCAN", 0),
+		ScannerPauseWhileEncoding: getEnvBool("SCANNER_PAUSE_WHILE_ENCODING", false),
+		EfficiencyAIWeight:        getEnvInt("EFFICIENCY_AI_WEIGHT", 0),
 	}
 
 	if cfg.GPUVendor == "auto" || cfg.GPUVendor == "" {
@@ -83,6 +287,117 @@ func Load() *Config {
 		// Log error but continue
 	}
 
+	if err := ValidateOutput(cfg.AudioCodec, ""); err != nil {
+		log.Printf("[Config] %v, using copy", err)
+		cfg.AudioCodec = "copy"
+	}
+	if err := ValidateOutput("", cfg.Container); err != nil {
+		log.Printf("[Config] %v, keeping each destination's extension", err)
+		cfg.Container = ""
+	}
+	if warning := OutputWarning(cfg.AudioCodec, cfg.Container); warning != "" {
+		log.Printf("[Config] Warning: %s", warning)
+	}
+
+	if err := ValidateStorageBackend(cfg.StorageBackend); err != nil {
+		log.Printf("[Config] %v, using json", err)
+		cfg.StorageBackend = "json"
+	}
+
+	if err := ValidateCRF(cfg.CRF); err != nil {
+		log.Printf("[Config] %v, using %d", err, DefaultCRF)
+		cfg.CRF = DefaultCRF
+	}
+
+	if err := ValidateGPUDevice(cfg.GPUVendor, cfg.GPUDevice); err != nil {
+		log.Printf("[Config] %v, using the default device", err)
+		cfg.GPUDevice = ""
+	}
+	if err := media.ValidateLanguages(cfg.SubtitleLanguageList()); err != nil {
+		log.Printf("[Config] %v, keeping every subtitle track", err)
+		cfg.SubtitleLanguages = ""
+	}
+	for _, tuning := range cfg.encoderTunings() {
+		if _, err := media.ParseEncoderTuning(tuning.vendor, *tuning.value); err != nil {
+			log.Printf("[Config] %v, using the built-in %s encoder settings", err, tuning.vendor)
+			*tuning.value = ""
+		}
+	}
+	if err := ValidateSameOutputAction(cfg.SameOutputAction); err != nil {
+		log.Printf("[Config] %v, using %s", err, SameOutputReject)
+		cfg.SameOutputAction = SameOutputReject
+	}
+	if err := ValidateEfficiencyAIWeight(cfg.EfficiencyAIWeight); err != nil {
+		log.Printf("[Config] %v, using 0", err)
+		cfg.EfficiencyAIWeight = 0
+	}
+	if _, err := cfg.OutputMode(); err != nil {
+		log.Printf("[Config] %v, leaving output permissions unchanged", err)
+		cfg.OutputFileMode = ""
+	}
+
+	if cfg.ProbeTimeoutSec <= 0 {
+		log.Printf("[Config] probeTimeoutSec must be greater than 0, using %d", DefaultProbeTimeoutSec)
+		cfg.ProbeTimeoutSec = DefaultProbeTimeoutSec
+	}
+	if cfg.FailureAlertPercent <= 0 || cfg.FailureAlertPercent > 100 {
+		log.Printf("[Config] failureAlertPercent must be between 1 and 100, using %d", DefaultFailureAlertPercent)
+		cfg.FailureAlertPercent = DefaultFailureAlertPercent
+	}
+	if cfg.UploadMaxSizeMB <= 0 {
+		log.Printf("[Config] uploadMaxSizeMb must be greater than 0, using %d", DefaultUploadMaxSizeMB)
+		cfg.UploadMaxSizeMB = DefaultUploadMaxSizeMB
+	}
+	if err := ValidateUploadCleanup(cfg.UploadCleanup); err != nil {
+		log.Printf("[Config] %v, using %s", err, UploadCleanupCompleted)
+		cfg.UploadCleanup = UploadCleanupCompleted
+	}
+	if dir := UploadDirOverlap(cfg.UploadDir, cfg.SourceDir); dir != "" {
+		log.Printf("[Config] Warning: uploadDir %s overlaps the source directory %s, keep uploads out of scanned directories", cfg.UploadDir, dir)
+	}
+	if cfg.ExtractParallelTitles <= 0 {
+		log.Printf("[Config] extractParallelTitles must be greater than 0, using 1")
+		cfg.ExtractParallelTitles = 1
+	}
+	if cfg.AIMaxConcurrent <= 0 {
+		log.Printf("[Config] aiMaxConcurrent must be greater than 0, using %d", DefaultAIMaxConcurrent)
+		cfg.AIMaxConcurrent = DefaultAIMaxConcurrent
+	}
+	if cfg.AIQueueTimeoutSec <= 0 {
+		log.Printf("[Config] aiQueueTimeoutSec must be greater than 0, using %d", DefaultAIQueueTimeoutSec)
+		cfg.AIQueueTimeoutSec = DefaultAIQueueTimeoutSec
+	}
+	if cfg.AIMaxAttempts <= 0 {
+		log.Printf("[Config] aiMaxAttempts must be greater than 0, using %d", ai.DefaultMaxAttempts)
+		cfg.AIMaxAttempts = ai.DefaultMaxAttempts
+	}
+	if cfg.PostCommandTimeoutSec <= 0 {
+		log.Printf("[Config] postCommandTimeoutSec must be greater than 0, using %d", DefaultPostCommandTimeoutSec)
+		cfg.PostCommandTimeoutSec = DefaultPostCommandTimeoutSec
+	}
+
+	if cfg.MakeMKVProfile != "" {
+		if _, err := media.ResolveMakeMKVProfile(cfg.MakeMKVProfile); err != nil {
+			log.Printf("[Config] %v, using MakeMKV's default profile", err)
+			cfg.MakeMKVProfile = ""
+		}
+	}
+
+	prompts := []struct {
+		override *string
+		load     func(string) (*template.Template, error)
+	}{
+		{&cfg.AIPromptCleanFilename, meta.LoadCleanFilenamePrompt},
+		{&cfg.AIPromptAnalyzeEncoding, meta.LoadAnalyzeEncodingPrompt},
+		{&cfg.AIPromptSearch, search.LoadMatchPrompt},
+	}
+	for _, prompt := range prompts {
+		if _, err := prompt.load(*prompt.override); err != nil {
+			log.Printf("[Config] %v, using the built-in prompt", err)
+			*prompt.override = ""
+		}
+	}
+
 	cfg.IsPremium = license.Validate(cfg.LicenseKey)
 	cfg.IsInitialized = checkInitialized(cfg.ScannerProcessedFile)
 
@@ -90,19 +405,31 @@ func Load() *Config {
 }
 
 func (c *Config) loadFromDisk() error {
-	data, err := os.ReadFile(ConfigFile)
-	if err != nil {
-		return err
-	}
 	// We decode into a temporary struct to only override non-empty values or we just overwrite everything?
 	// For simplicity, let's just overwrite. The disk config is the source of truth for changes.
 	// However, we must be careful not to zero out environment variables if the json is partial.
 	// But usually if we save, we save the whole struct.
 	// Let's unmarshal directly into c.
 	importJSON := &Config{}
-	if err := json.Unmarshal(data, importJSON); err != nil {
+	// A saved CRF of 0 is a real setting, so the key's presence decides rather than its value
+	var present struct {
+		CRF *int `json:"crf"`
+	}
+	err := system.LoadWithBackup(ConfigFile, func(data []byte) error {
+		*importJSON = Config{}
+		present.CRF = nil
+		if err := json.Unmarshal(data, importJSON); err != nil {
+			return err
+		}
+		return json.Unmarshal(data, &present)
+	})
+	if err != nil {
 		return err
 	}
+	if err := importJSON.decryptSecrets(encryptionKey()); err != nil {
+		log.Printf("[Config] Ignoring stored secrets, they are kept encrypted until ENCRYPTION_KEY is fixed: %v", err)
+	}
+	c.undecrypted = importJSON.undecrypted
 
 	// Apply overrides
 	// Note: Strings will be overwritten if they are empty in JSON? No, Unmarshal does that.
@@ -118,6 +445,30 @@ func (c *Config) loadFromDisk() error {
 	if importJSON.DestDir != "" {
 		c.DestDir = importJSON.DestDir
 	}
+	if importJSON.TempDir != "" {
+		c.TempDir = importJSON.TempDir
+	}
+	if importJSON.FFmpegPath != "" {
+		c.FFmpegPath = importJSON.FFmpegPath
+	}
+	if importJSON.FFprobePath != "" {
+		c.FFprobePath = importJSON.FFprobePath
+	}
+	if importJSON.MakeMKVPath != "" {
+		c.MakeMKVPath = importJSON.MakeMKVPath
+	}
+	if importJSON.MakeMKVProfile != "" {
+		c.MakeMKVProfile = importJSON.MakeMKVProfile
+	}
+	if importJSON.ExtractParallelTitles != 0 {
+		c.ExtractParallelTitles = importJSON.ExtractParallelTitles
+	}
+	if importJSON.StorageBackend != "" {
+		c.StorageBackend = importJSON.StorageBackend
+	}
+	if importJSON.SQLitePath != "" {
+		c.SQLitePath = importJSON.SQLitePath
+	}
 	if importJSON.GPUVendor != "" && importJSON.GPUVendor != "cpu" && importJSON.GPUVendor != "auto" {
 		// Only use saved GPU if it's an explicit choice (nvidia, intel, amd)
 		c.GPUVendor = importJSON.GPUVendor
@@ -126,12 +477,135 @@ func (c *Config) loadFromDisk() error {
 	if importJSON.QualityPreset != "" {
 		c.QualityPreset = importJSON.QualityPreset
 	}
-	if importJSON.CRF != 0 {
-		c.CRF = importJSON.CRF
+	if present.CRF != nil {
+		c.CRF = *present.CRF
+	}
+	if importJSON.GPUDevice != "" {
+		c.GPUDevice = importJSON.GPUDevice
+	}
+	if importJSON.SubtitleLanguages != "" {
+		c.SubtitleLanguages = importJSON.SubtitleLanguages
+	}
+	if importJSON.KeepForcedSubtitles {
+		c.KeepForcedSubtitles = true
+	}
+	if importJSON.NvidiaTuning != "" {
+		c.NvidiaTuning = importJSON.NvidiaTuning
+	}
+	if importJSON.IntelTuning != "" {
+		c.IntelTuning = importJSON.IntelTuning
+	}
+	if importJSON.AMDTuning != "" {
+		c.AMDTuning = importJSON.AMDTuning
+	}
+	if importJSON.HybridHWDecode {
+		c.HybridHWDecode = true
+	}
+	if importJSON.GenerateChapters {
+		c.GenerateChapters = true
+	}
+	if importJSON.WriteNFO {
+		c.WriteNFO = true
+	}
+	if importJSON.NFOTemplate != "" {
+		c.NFOTemplate = importJSON.NFOTemplate
+	}
+	if importJSON.PreserveMTime {
+		c.PreserveMTime = true
+	}
+	if importJSON.SameOutputAction != "" {
+		c.SameOutputAction = importJSON.SameOutputAction
+	}
+	if importJSON.MaxBitrate != "" {
+		c.MaxBitrate = importJSON.MaxBitrate
+	}
+	if importJSON.BufSize != "" {
+		c.BufSize = importJSON.BufSize
+	}
+	if importJSON.AudioCodec != "" {
+		c.AudioCodec = importJSON.AudioCodec
+	}
+	if importJSON.AudioBitrate != "" {
+		c.AudioBitrate = importJSON.AudioBitrate
+	}
+	if importJSON.Container != "" {
+		c.Container = importJSON.Container
 	}
 	if importJSON.MaxConcurrentJobs != 0 {
 		c.MaxConcurrentJobs = importJSON.MaxConcurrentJobs
 	}
+	if importJSON.MaxQueuedJobs != 0 {
+		c.MaxQueuedJobs = importJSON.MaxQueuedJobs
+	}
+	if importJSON.KeepRip {
+		c.KeepRip = true
+	}
+	if importJSON.RipDir != "" {
+		c.RipDir = importJSON.RipDir
+	}
+	if importJSON.ShutdownGraceSec != 0 {
+		c.ShutdownGraceSec = importJSON.ShutdownGraceSec
+	}
+	if importJSON.MaxJobDurationSec != 0 {
+		c.MaxJobDurationSec = importJSON.MaxJobDurationSec
+	}
+	if importJSON.UploadDir != "" {
+		c.UploadDir = importJSON.UploadDir
+	}
+	if importJSON.UploadMaxSizeMB != 0 {
+		c.UploadMaxSizeMB = importJSON.UploadMaxSizeMB
+	}
+	if importJSON.UploadCleanup != "" {
+		c.UploadCleanup = importJSON.UploadCleanup
+	}
+	if importJSON.FailureAlertWindow != 0 {
+		c.FailureAlertWindow = importJSON.FailureAlertWindow
+	}
+	if importJSON.FailureAlertPercent != 0 {
+		c.FailureAlertPercent = importJSON.FailureAlertPercent
+	}
+	if importJSON.ProbeTimeoutSec != 0 {
+		c.ProbeTimeoutSec = importJSON.ProbeTimeoutSec
+	}
+	if importJSON.MinFreeSpaceGB != 0 {
+		c.MinFreeSpaceGB = importJSON.MinFreeSpaceGB
+	}
+	if importJSON.JobRetentionDays != 0 {
+		c.JobRetentionDays = importJSON.JobRetentionDays
+	}
+	if importJSON.MaxStoredJobs != 0 {
+		c.MaxStoredJobs = importJSON.MaxStoredJobs
+	}
+	if importJSON.ProgressSaveIntervalSec != 0 {
+		c.ProgressSaveIntervalSec = importJSON.ProgressSaveIntervalSec
+	}
+	if importJSON.MinSourceDurationSec != 0 {
+		c.MinSourceDurationSec = importJSON.MinSourceDurationSec
+	}
+	if importJSON.RemoteSourceSchemes != "" {
+		c.RemoteSourceSchemes = importJSON.RemoteSourceSchemes
+	}
+	if importJSON.OutputFileMode != "" {
+		c.OutputFileMode = importJSON.OutputFileMode
+	}
+	if importJSON.OutputUID != 0 {
+		c.OutputUID = importJSON.OutputUID
+	}
+	if importJSON.OutputGID != 0 {
+		c.OutputGID = importJSON.OutputGID
+	}
+	if importJSON.PostCommand != "" {
+		c.PostCommand = importJSON.PostCommand
+	}
+	if importJSON.PostCommandTimeoutSec != 0 {
+		c.PostCommandTimeoutSec = importJSON.PostCommandTimeoutSec
+	}
+	if importJSON.SkipIfAlreadyEfficient {
+		c.SkipIfAlreadyEfficient = true
+	}
+	if importJSON.EfficientMaxBitrateKbps != 0 {
+		c.EfficientMaxBitrateKbps = importJSON.EfficientMaxBitrateKbps
+	}
 
 	if importJSON.AIProvider != "" {
 		c.AIProvider = importJSON.AIProvider
@@ -145,10 +619,31 @@ func (c *Config) loadFromDisk() error {
 	if importJSON.AIModel != "" {
 		c.AIModel = importJSON.AIModel
 	}
+	if importJSON.AIMaxConcurrent != 0 {
+		c.AIMaxConcurrent = importJSON.AIMaxConcurrent
+	}
+	if importJSON.AIQueueTimeoutSec != 0 {
+		c.AIQueueTimeoutSec = importJSON.AIQueueTimeoutSec
+	}
+	if importJSON.AIMaxAttempts != 0 {
+		c.AIMaxAttempts = importJSON.AIMaxAttempts
+	}
+	if importJSON.AIPromptCleanFilename != "" {
+		c.AIPromptCleanFilename = importJSON.AIPromptCleanFilename
+	}
+	if importJSON.AIPromptAnalyzeEncoding != "" {
+		c.AIPromptAnalyzeEncoding = importJSON.AIPromptAnalyzeEncoding
+	}
+	if importJSON.AIPromptSearch != "" {
+		c.AIPromptSearch = importJSON.AIPromptSearch
+	}
 
 	if importJSON.AdminPassword != "" {
 		c.AdminPassword = importJSON.AdminPassword
 	}
+	if importJSON.ReadOnlyAPIKey != "" {
+		c.ReadOnlyAPIKey = importJSON.ReadOnlyAPIKey
+	}
 	if importJSON.LicenseKey != "" {
 		c.LicenseKey = importJSON.LicenseKey
 	}
@@ -175,12 +670,192 @@ func (c *Config) loadFromDisk() error {
 	if importJSON.ScannerProcessedFile != "" {
 		c.ScannerProcessedFile = importJSON.ScannerProcessedFile
 	}
+	if importJSON.ScannerMaxJobsPerScan != 0 {
+		c.ScannerMaxJobsPerScan = importJSON.ScannerMaxJobsPerScan
+	}
+	if importJSON.ScannerPauseWhileEncoding {
+		c.ScannerPauseWhileEncoding = true
+	}
+	if importJSON.EfficiencyAIWeight != 0 {
+		c.EfficiencyAIWeight = importJSON.EfficiencyAIWeight
+	}
 
 	return nil
 }
 
+// Lock acquires the config for writing
+func (c *Config) Lock() { c.mu.Lock() }
+
+// Unlock releases the write lock
+func (c *Config) Unlock() { c.mu.Unlock() }
+
+// RLock acquires the config for reading
+func (c *Config) RLock() { c.mu.RLock() }
+
+// RUnlock releases the read lock
+func (c *Config) RUnlock() { c.mu.RUnlock() }
+
+// Snapshot returns a consistent copy of the settings. Readers that aren't holding
+// the lock should read from a snapshot rather than the shared config.
+func (c *Config) Snapshot() *Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	s := &Config{}
+	s.apply(c)
+	return s
+}
+
+// Reload re-reads the config from the environment and disk, the same way as on
+// startup, and applies it in place. It returns the names of the settings that changed.
+func (c *Config) Reload() []string {
+	next := Load()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.undecrypted = next.undecrypted
+	return c.apply(next)
+}
+
+// apply copies every exported field of next into c and returns the JSON names
+// (or field names for unserialized state) of the fields that changed
+func (c *Config) apply(next *Config) []string {
+	var changed []string
+	dst, src := reflect.ValueOf(c).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		field := dst.Type().Field(i)
+		if !field.IsExported() || reflect.DeepEqual(dst.Field(i).Interface(), src.Field(i).Interface()) {
+			continue
+		}
+		dst.Field(i).Set(src.Field(i))
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			name = field.Name
+		}
+		changed = append(changed, name)
+	}
+	return changed
+}
+
+// Change is one setting that differs between two configs
+type Change struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+func (ch Change) String() string {
+	return fmt.Sprintf("%s %v -> %v", ch.Field, ch.Old, ch.New)
+}
+
+// Diff lists the settings that differ from old to next, named as in apply. Secrets
+// are masked on both sides.
+func Diff(old, next *Config) []Change {
+	var changes []Change
+	secrets := old.secrets()
+	before, after := reflect.ValueOf(old).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < before.NumField(); i++ {
+		field := before.Type().Field(i)
+		if !field.IsExported() || reflect.DeepEqual(before.Field(i).Interface(), after.Field(i).Interface()) {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			name = field.Name
+		}
+		change := Change{Field: name, Old: before.Field(i).Interface(), New: after.Field(i).Interface()}
+		if _, ok := secrets[name]; ok {
+			change.Old, change.New = maskSecret(change.Old.(string)), maskSecret(change.New.(string))
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// portableSettings are the JSON names of the settings Import takes from another host.
+// Paths, tools, storage, file ownership and the security switches are left out.
+var portableSettings = map[string]bool{
+	"extractParallelTitles": true, "gpuVendor": true, "gpuDevice": true, "qualityPreset": true,
+	"crf": true, "maxBitrate": true, "bufSize": true, "audioCodec": true, "audioBitrate": true,
+	"container": true, "subtitleLanguages": true, "keepForcedSubtitles": true,
+	"nvidiaTuning": true, "intelTuning": true, "amdTuning": true, "hybridHwDecode": true,
+	"generateChapters": true, "writeNfo": true, "preserveMtime": true, "sameOutputAction": true,
+	"maxConcurrentJobs": true, "maxQueuedJobs": true, "keepRip": true, "shutdownGraceSec": true,
+	"maxJobDurationSec": true, "probeTimeoutSec": true, "minFreeSpaceGB": true,
+	"jobRetentionDays": true, "maxStoredJobs": true, "progressSaveIntervalSec": true,
+	"minSourceDurationSec": true, "failureAlertWindow": true, "failureAlertPercent": true,
+	"outputFileMode": true, "postCommandTimeoutSec": true, "uploadMaxSizeMb": true,
+	"uploadCleanup": true, "skipIfAlreadyEfficient": true, "efficientMaxBitrateKbps": true,
+	"aiProvider": true, "aiApiKey": true, "aiEndpoint": true, "aiModel": true,
+	"aiMaxConcurrent": true, "aiQueueTimeoutSec": true, "aiMaxAttempts": true,
+	"aiPromptCleanFilename": true, "aiPromptAnalyzeEncoding": true, "aiPromptSearch": true,
+	"adminPassword": true, "readOnlyApiKey": true, "licenseKey": true,
+	"scannerEnabled": true, "scannerMode": true, "scannerIntervalSec": true,
+	"scannerAutoCreate": true, "scannerMaxJobsPerScan": true, "scannerPauseWhileEncoding": true,
+	"efficiencyAIWeight": true,
+}
+
+// Import applies the portableSettings of a config exported from another host in place
+// and returns the names of the settings that changed. Secrets left empty or masked in
+// the export and prompts read from a file on the other host are kept.
+func (c *Config) Import(next *Config) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	imported := &Config{}
+	imported.apply(c)
+	dst, src := reflect.ValueOf(imported).Elem(), reflect.ValueOf(next).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		name, _, _ := strings.Cut(dst.Type().Field(i).Tag.Get("json"), ",")
+		if portableSettings[name] {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+	for name, field := range imported.secrets() {
+		if *field == "" || isMasked(*field) {
+			*field = *c.secrets()[name]
+		}
+	}
+	prompts := []*string{&imported.AIPromptCleanFilename, &imported.AIPromptAnalyzeEncoding, &imported.AIPromptSearch}
+	current := []string{c.AIPromptCleanFilename, c.AIPromptAnalyzeEncoding, c.AIPromptSearch}
+	for i, prompt := range prompts {
+		if strings.HasPrefix(*prompt, "@") {
+			*prompt = current[i]
+		}
+	}
+	imported.IsPremium = license.Validate(imported.LicenseKey)
+	return c.apply(imported)
+}
+
+// isMasked reports whether a secret is a placeholder from security.MaskKey
+func isMasked(value string) bool {
+	return value == "****" || strings.Contains(value, "....")
+}
+
+// Save writes the config to disk. When ENCRYPTION_KEY is set, secrets are encrypted.
 func (c *Config) Save() error {
-	data, err := json.MarshalIndent(c, "", "  ")
+	c.mu.RLock()
+	data, err := json.Marshal(c)
+	c.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	// Encrypt a copy, the in-memory config keeps the plaintext
+	out := &Config{}
+	if err := json.Unmarshal(data, out); err != nil {
+		return err
+	}
+	if err := out.encryptSecrets(encryptionKey()); err != nil {
+		return err
+	}
+	c.mu.RLock()
+	c.keepUndecrypted(out)
+	c.mu.RUnlock()
+
+	data, err = json.MarshalIndent(out, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -191,7 +866,278 @@ func (c *Config) Save() error {
 		return err
 	}
 
-	return os.WriteFile(ConfigFile, data, 0644)
+	saveMu.Lock()
+	defer saveMu.Unlock()
+	return system.WriteFileAtomic(ConfigFile, data, 0644)
+}
+
+// CRF bounds shared by libx265 and the GPU encoders' constant quality modes
+const (
+	MinCRF     = 0
+	MaxCRF     = 51
+	DefaultCRF = 23
+)
+
+// ValidateCRF checks a CRF is within MinCRF and MaxCRF
+func ValidateCRF(crf int) error {
+	if crf < MinCRF || crf > MaxCRF {
+		return fmt.Errorf("CRF %d is out of range (allowed: %d-%d)", crf, MinCRF, MaxCRF)
+	}
+	return nil
+}
+
+// Supported output settings
+var (
+	AudioCodecs = []string{"copy", "aac", "ac3", "opus"}
+	Containers  = []string{"mkv", "mp4"}
+)
+
+// DefaultProbeTimeoutSec is how long ffprobe may take on one source
+const DefaultProbeTimeoutSec = 60
+
+// Defaults for the failing jobs alert: more than half of the last 10 finished jobs
+const (
+	DefaultFailureAlertWindow  = 10
+	DefaultFailureAlertPercent = 50
+)
+
+// Defaults for the AI request limit, small enough to stay under provider rate limits
+const (
+	DefaultAIMaxConcurrent   = 2
+	DefaultAIQueueTimeoutSec = 120
+)
+
+// DefaultPostCommandTimeoutSec is how long the post command may run before it is killed
+const DefaultPostCommandTimeoutSec = 300
+
+// StorageBackends are the supported persistence backends, json is the default
+var StorageBackends = []string{"json", "sqlite"}
+
+// ValidateStorageBackend checks a storage backend is supported
+func ValidateStorageBackend(backend string) error {
+	if !containsString(StorageBackends, backend) {
+		return fmt.Errorf("unsupported storage backend %q (allowed: %v)", backend, StorageBackends)
+	}
+	return nil
+}
+
+// What optimize jobs do when their destination is their source: fail, or encode to a
+// temporary file that replaces the source once complete. reject is the default.
+const (
+	SameOutputReject  = "reject"
+	SameOutputReplace = "replace"
+)
+
+var SameOutputActions = []string{SameOutputReject, SameOutputReplace}
+
+// ValidateSameOutputAction checks a same output action is supported, empty means reject
+func ValidateSameOutputAction(action string) error {
+	if action != "" && !containsString(SameOutputActions, action) {
+		return fmt.Errorf("unsupported same output action %q (allowed: %v)", action, SameOutputActions)
+	}
+	return nil
+}
+
+// DefaultUploadMaxSizeMB is the largest file /api/upload accepts, 4 GB
+const DefaultUploadMaxSizeMB = 4096
+
+// When uploaded sources are removed: once their job completes (failed jobs keep the upload
+// so they can be retried), once it finishes whatever the outcome, or never.
+const (
+	UploadCleanupCompleted = "completed"
+	UploadCleanupAlways    = "always"
+	UploadCleanupNever     = "never"
+)
+
+var UploadCleanupPolicies = []string{UploadCleanupCompleted, UploadCleanupAlways, UploadCleanupNever}
+
+// ValidateUploadCleanup checks an upload cleanup policy is supported, empty means completed
+func ValidateUploadCleanup(policy string) error {
+	if policy != "" && !containsString(UploadCleanupPolicies, policy) {
+		return fmt.Errorf("unsupported upload cleanup policy %q (allowed: %v)", policy, UploadCleanupPolicies)
+	}
+	return nil
+}
+
+// UploadDirOverlap returns the first of dirs that uploadDir is inside of or contains, ""
+// if there is none. Uploads landing in a scanned directory would be queued twice.
+func UploadDirOverlap(uploadDir string, dirs ...string) string {
+	if uploadDir == "" {
+		return ""
+	}
+	upload := filepath.Clean(uploadDir)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		dir = filepath.Clean(dir)
+		if within(upload, dir) || within(dir, upload) {
+			return dir
+		}
+	}
+	return ""
+}
+
+// within reports whether path is dir or below it
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// ValidateEfficiencyAIWeight checks the AI share of the efficiency score is a percentage
+func ValidateEfficiencyAIWeight(weight int) error {
+	if weight < 0 || weight > 100 {
+		return fmt.Errorf("efficiencyAIWeight must be between 0 and 100, got %d", weight)
+	}
+	return nil
+}
+
+// ValidateOutput checks an audio codec and container against the supported values.
+// Empty values are allowed and mean the configured default.
+func ValidateOutput(audioCodec, container string) error {
+	if audioCodec != "" && !containsString(AudioCodecs, audioCodec) {
+		return fmt.Errorf("unsupported audio codec %q (allowed: %v)", audioCodec, AudioCodecs)
+	}
+	if container != "" && !containsString(Containers, container) {
+		return fmt.Errorf("unsupported container %q (allowed: %v)", container, Containers)
+	}
+	return nil
+}
+
+// OutputWarning returns a caveat about an audio codec and container that ffmpeg can
+// write together but not every player can read, or "" when there is none
+func OutputWarning(audioCodec, container string) string {
+	if audioCodec == "opus" && container == "mp4" {
+		return "Opus audio in MP4 is not supported by every player, mkv is the safer container"
+	}
+	return ""
+}
+
+// ValidateGPUDevice checks a GPU device suits the vendor: a device index for NVIDIA, a
+// render node path for Intel and AMD. An empty device is always valid.
+func ValidateGPUDevice(vendor, device string) error {
+	if device == "" {
+		return nil
+	}
+	switch vendor {
+	case "nvidia":
+		if n, err := strconv.Atoi(device); err != nil || n < 0 {
+			return fmt.Errorf("invalid NVIDIA GPU device %q (expected an index such as 0)", device)
+		}
+	case "intel", "amd":
+		if !strings.HasPrefix(device, "/dev/dri/") {
+			return fmt.Errorf("invalid VAAPI GPU device %q (expected a render node such as /dev/dri/renderD129)", device)
+		}
+	default:
+		return fmt.Errorf("GPU device %q has no effect with GPU vendor %q", device, vendor)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// encoderTuning is one vendor's tuning setting
+type encoderTuning struct {
+	vendor media.GPUVendor
+	value  *string
+}
+
+func (c *Config) encoderTunings() []encoderTuning {
+	return []encoderTuning{
+		{media.GPUVendorNvidia, &c.NvidiaTuning},
+		{media.GPUVendorIntel, &c.IntelTuning},
+		{media.GPUVendorAMD, &c.AMDTuning},
+	}
+}
+
+// ValidateEncoderTuning checks the tuning of every vendor, see media.ParseEncoderTuning
+func (c *Config) ValidateEncoderTuning() error {
+	for _, tuning := range c.encoderTunings() {
+		if _, err := media.ParseEncoderTuning(tuning.vendor, *tuning.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncoderTuning returns the encoder option overrides for the configured GPU vendor, nil
+// when it has none or they don't parse
+func (c *Config) EncoderTuning() map[string]string {
+	for _, tuning := range c.encoderTunings() {
+		if string(tuning.vendor) == c.GPUVendor {
+			parsed, _ := media.ParseEncoderTuning(tuning.vendor, *tuning.value)
+			return parsed
+		}
+	}
+	return nil
+}
+
+// OutputMode parses OutputFileMode, returning 0 when it is unset
+func (c *Config) OutputMode() (os.FileMode, error) {
+	if c.OutputFileMode == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(c.OutputFileMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid output file mode %q (expected octal such as 0664)", c.OutputFileMode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// MetaPrompts returns the prompt overrides for the metadata cleaner
+func (c *Config) MetaPrompts() meta.Prompts {
+	return meta.Prompts{CleanFilename: c.AIPromptCleanFilename, AnalyzeEncoding: c.AIPromptAnalyzeEncoding}
+}
+
+// SubtitleLanguageList returns the lowercased SubtitleLanguages, nil when unset
+func (c *Config) SubtitleLanguageList() []string {
+	var languages []string
+	for _, lang := range strings.Split(c.SubtitleLanguages, ",") {
+		if lang = strings.ToLower(strings.TrimSpace(lang)); lang != "" {
+			languages = append(languages, lang)
+		}
+	}
+	return languages
+}
+
+// RemoteSchemes returns the lowercased URL schemes allowed for remote sources
+func (c *Config) RemoteSchemes() []string {
+	var schemes []string
+	for _, scheme := range strings.Split(c.RemoteSourceSchemes, ",") {
+		if scheme = strings.ToLower(strings.TrimSpace(scheme)); scheme != "" && scheme != "none" {
+			schemes = append(schemes, scheme)
+		}
+	}
+	return schemes
+}
+
+// ErrPremiumRequired is wrapped by RequirePremium when no valid license is active
+var ErrPremiumRequired = errors.New("requires a premium license")
+
+// RequirePremium returns an error naming feature unless a valid license is active.
+// Every premium check goes through here so they all agree.
+func (c *Config) RequirePremium(feature string) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.IsPremium {
+		return nil
+	}
+	return fmt.Errorf("%s %w", feature, ErrPremiumRequired)
+}
+
+// GetTempDir returns the directory for intermediate files, defaulting to the system temp dir
+func (c *Config) GetTempDir() string {
+	if c.TempDir != "" {
+		return c.TempDir
+	}
+	return os.TempDir()
 }
 
 func checkInitialized(processedFile string) bool {
@@ -203,6 +1149,9 @@ func checkInitialized(processedFile string) bool {
 
 // MarkInitialized creates the .initialized file
 func (c *Config) MarkInitialized() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
 	dir := filepath.Dir(c.ScannerProcessedFile)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
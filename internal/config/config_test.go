@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -56,3 +58,242 @@ func TestGetEnvDefaults(t *testing.T) {
 		t.Errorf("expected default ScannerEnabled false, got %v", cfg.ScannerEnabled)
 	}
 }
+
+func TestSecretsRoundTrip(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEY", "correct horse battery staple")
+	key := encryptionKey()
+
+	stored := &Config{AIApiKey: "sk-test", LicenseKey: "VASTIVA-1234", AdminPassword: "supersecret", AIProvider: "openai"}
+	if err := stored.encryptSecrets(key); err != nil {
+		t.Fatalf("encryptSecrets failed: %v", err)
+	}
+
+	for _, v := range []string{stored.AIApiKey, stored.LicenseKey, stored.AdminPassword} {
+		if !strings.HasPrefix(v, encryptedPrefix) {
+			t.Errorf("expected encrypted value, got %q", v)
+		}
+	}
+	if stored.AIProvider != "openai" {
+		t.Errorf("expected non-secret fields untouched, got %q", stored.AIProvider)
+	}
+
+	if err := stored.decryptSecrets(key); err != nil {
+		t.Fatalf("decryptSecrets failed: %v", err)
+	}
+	if stored.AIApiKey != "sk-test" || stored.LicenseKey != "VASTIVA-1234" || stored.AdminPassword != "supersecret" {
+		t.Errorf("round trip mismatch: got %q, %q, %q", stored.AIApiKey, stored.LicenseKey, stored.AdminPassword)
+	}
+
+	// A different key must not yield the ciphertext as a usable value
+	if err := stored.encryptSecrets(key); err != nil {
+		t.Fatalf("encryptSecrets failed: %v", err)
+	}
+	t.Setenv("ENCRYPTION_KEY", "another key")
+	if err := stored.decryptSecrets(encryptionKey()); err == nil {
+		t.Error("expected error decrypting with the wrong key")
+	}
+	if stored.AdminPassword != "" {
+		t.Errorf("expected undecryptable secret to be cleared, got %q", stored.AdminPassword)
+	}
+}
+
+func TestUndecryptableSecretsKept(t *testing.T) {
+	orig := ConfigFile
+	ConfigFile = filepath.Join(t.TempDir(), "config.json")
+	t.Cleanup(func() { ConfigFile = orig })
+
+	t.Setenv("ENCRYPTION_KEY", "correct horse battery staple")
+	if err := (&Config{AdminPassword: "supersecret", AIApiKey: "sk-test"}).Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// With the wrong key the secrets aren't usable, but saving doesn't lose them
+	t.Setenv("ENCRYPTION_KEY", "another key")
+	cfg := &Config{}
+	cfg.loadFromDisk()
+	if cfg.AdminPassword != "" || cfg.AIApiKey != "" {
+		t.Fatalf("expected undecryptable secrets to be cleared, got %q, %q", cfg.AdminPassword, cfg.AIApiKey)
+	}
+	cfg.AIApiKey = "sk-new"
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	t.Setenv("ENCRYPTION_KEY", "correct horse battery staple")
+	restored := &Config{}
+	restored.loadFromDisk()
+	if restored.AdminPassword != "supersecret" {
+		t.Errorf("expected the stored secret to survive a save with the wrong key, got %q", restored.AdminPassword)
+	}
+	t.Setenv("ENCRYPTION_KEY", "another key")
+	replaced := &Config{}
+	replaced.loadFromDisk()
+	if replaced.AIApiKey != "sk-new" {
+		t.Errorf("expected a secret set since to be saved, got %q", replaced.AIApiKey)
+	}
+}
+
+func TestSecretsWithoutKey(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEY", "")
+	key := encryptionKey()
+	if key != nil {
+		t.Fatal("expected no key when ENCRYPTION_KEY is unset")
+	}
+
+	stored := &Config{AIApiKey: "sk-test", AdminPassword: "supersecret"}
+	if err := stored.encryptSecrets(key); err != nil {
+		t.Fatalf("encryptSecrets failed: %v", err)
+	}
+	if stored.AIApiKey != "sk-test" || stored.AdminPassword != "supersecret" {
+		t.Errorf("expected plaintext passthrough, got %q, %q", stored.AIApiKey, stored.AdminPassword)
+	}
+	if err := stored.decryptSecrets(key); err != nil {
+		t.Fatalf("decryptSecrets failed: %v", err)
+	}
+	if stored.AIApiKey != "sk-test" || stored.AdminPassword != "supersecret" {
+		t.Errorf("expected plaintext passthrough, got %q, %q", stored.AIApiKey, stored.AdminPassword)
+	}
+}
+
+func TestOutputMode(t *testing.T) {
+	for in, want := range map[string]os.FileMode{"": 0, "0664": 0664, "660": 0660, "0775": 0775} {
+		cfg := &Config{OutputFileMode: in}
+		if got, err := cfg.OutputMode(); err != nil || got != want {
+			t.Errorf("OutputMode(%q) = %o, %v, want %o", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"rw-r--r--", "0999", "10000"} {
+		cfg := &Config{OutputFileMode: in}
+		if _, err := cfg.OutputMode(); err == nil {
+			t.Errorf("expected error for %q", in)
+		}
+	}
+}
+
+func TestValidateGPUDevice(t *testing.T) {
+	valid := [][2]string{{"nvidia", ""}, {"nvidia", "1"}, {"intel", "/dev/dri/renderD129"}, {"amd", "/dev/dri/renderD128"}, {"cpu", ""}}
+	for _, v := range valid {
+		if err := ValidateGPUDevice(v[0], v[1]); err != nil {
+			t.Errorf("ValidateGPUDevice(%q, %q) unexpected error: %v", v[0], v[1], err)
+		}
+	}
+	invalid := [][2]string{{"nvidia", "/dev/dri/renderD128"}, {"nvidia", "-1"}, {"intel", "1"}, {"cpu", "0"}}
+	for _, v := range invalid {
+		if err := ValidateGPUDevice(v[0], v[1]); err == nil {
+			t.Errorf("ValidateGPUDevice(%q, %q) expected an error", v[0], v[1])
+		}
+	}
+}
+
+func TestConfigRecoversFromBackup(t *testing.T) {
+	t.Setenv("ENCRYPTION_KEY", "")
+	orig := ConfigFile
+	ConfigFile = filepath.Join(t.TempDir(), "config.json")
+	t.Cleanup(func() { ConfigFile = orig })
+
+	for _, crf := range []int{20, 18} {
+		if err := (&Config{CRF: crf, AdminPassword: "secret"}).Save(); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	}
+	if _, err := os.Stat(ConfigFile + ".bak"); err != nil {
+		t.Fatalf("expected a backup of the previous config: %v", err)
+	}
+
+	// A write cut short by a crash
+	if err := os.WriteFile(ConfigFile, []byte(`{"crf": 18, "adminPass`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{CRF: 23}
+	if err := cfg.loadFromDisk(); err != nil {
+		t.Fatalf("expected recovery from backup, got %v", err)
+	}
+	if cfg.CRF != 20 || cfg.AdminPassword != "secret" {
+		t.Errorf("expected the backup's settings, got crf %d", cfg.CRF)
+	}
+}
+
+func TestDiffMasksSecrets(t *testing.T) {
+	before := &Config{CRF: 23, AIApiKey: "sk-old-secret-value"}
+	after := &Config{CRF: 23, AIApiKey: "sk-new-secret-value"}
+
+	changes := Diff(before, after)
+	if len(changes) != 1 || changes[0].Field != "aiApiKey" {
+		t.Fatalf("expected only the key change, got %v", changes)
+	}
+	if s := changes[0].String(); strings.Contains(s, "old-secret") || strings.Contains(s, "new-secret") {
+		t.Errorf("expected the key to be masked, got %s", s)
+	}
+}
+
+func TestValidateOutputOpus(t *testing.T) {
+	for _, container := range []string{"mkv", "mp4"} {
+		if err := ValidateOutput("opus", container); err != nil {
+			t.Errorf("expected opus in %s to be accepted, got %v", container, err)
+		}
+	}
+	if warning := OutputWarning("opus", "mp4"); warning == "" {
+		t.Error("expected a warning for opus in mp4")
+	}
+	if warning := OutputWarning("opus", "mkv"); warning != "" {
+		t.Errorf("expected no warning for opus in mkv, got %q", warning)
+	}
+	if warning := OutputWarning("aac", "mp4"); warning != "" {
+		t.Errorf("expected no warning for aac in mp4, got %q", warning)
+	}
+}
+
+func TestCRFBounds(t *testing.T) {
+	for _, crf := range []int{MinCRF, DefaultCRF, MaxCRF} {
+		if err := ValidateCRF(crf); err != nil {
+			t.Errorf("ValidateCRF(%d) unexpected error: %v", crf, err)
+		}
+	}
+	for _, crf := range []int{-1, MaxCRF + 1} {
+		if err := ValidateCRF(crf); err == nil {
+			t.Errorf("ValidateCRF(%d) expected an error", crf)
+		}
+	}
+
+	t.Setenv("ENCRYPTION_KEY", "")
+	orig := ConfigFile
+	ConfigFile = filepath.Join(t.TempDir(), "config.json")
+	t.Cleanup(func() { ConfigFile = orig })
+
+	// A saved 0 is a value, not "unset"
+	if err := os.WriteFile(ConfigFile, []byte(`{"crf": 0}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{CRF: DefaultCRF}
+	if err := cfg.loadFromDisk(); err != nil || cfg.CRF != 0 {
+		t.Errorf("expected an explicit crf 0 to be loaded, got %d (%v)", cfg.CRF, err)
+	}
+
+	// A file without the key keeps the current value
+	if err := os.WriteFile(ConfigFile, []byte(`{"qualityPreset": "slow"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg = &Config{CRF: DefaultCRF}
+	if err := cfg.loadFromDisk(); err != nil || cfg.CRF != DefaultCRF {
+		t.Errorf("expected a missing crf to keep %d, got %d (%v)", DefaultCRF, cfg.CRF, err)
+	}
+}
+
+func TestUploadDirOverlap(t *testing.T) {
+	tests := []struct {
+		uploadDir string
+		dirs      []string
+		want      string
+	}{
+		{"/storage/uploads", []string{"/storage"}, "/storage"},
+		{"/storage", []string{"/media", "/storage/movies/"}, "/storage/movies"},
+		{"/uploads", []string{"/uploads"}, "/uploads"},
+		{"/storage/uploads", []string{"/storage/uploads-old", "/media"}, ""},
+		{"", []string{"/storage"}, ""},
+	}
+	for _, tt := range tests {
+		if got := UploadDirOverlap(tt.uploadDir, tt.dirs...); got != tt.want {
+			t.Errorf("UploadDirOverlap(%q, %v) = %q, want %q", tt.uploadDir, tt.dirs, got, tt.want)
+		}
+	}
+}
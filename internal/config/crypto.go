@@ -0,0 +1,153 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Vasteva/MediaConverter/internal/security"
+)
+
+// encryptedPrefix marks a config value encrypted with ENCRYPTION_KEY
+const encryptedPrefix = "enc:v1:"
+
+// encryptionKey derives the AES-256 key from ENCRYPTION_KEY, or returns nil when unset
+func encryptionKey() []byte {
+	secret := os.Getenv("ENCRYPTION_KEY")
+	if secret == "" {
+		return nil
+	}
+	sum := sha256.Sum256([]byte("vastiva-config:" + secret))
+	return sum[:]
+}
+
+// encryptValue seals a value with AES-GCM. Empty values stay empty.
+func encryptValue(key []byte, plaintext string) (string, error) {
+	if plaintext == "" || strings.HasPrefix(plaintext, encryptedPrefix) {
+		return plaintext, nil
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptValue opens a value written by encryptValue. Plaintext values pass through
+// unchanged, so configs saved before encryption was enabled still load.
+func decryptValue(key []byte, value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	if key == nil {
+		return "", errors.New("value is encrypted but ENCRYPTION_KEY is not set")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("invalid encrypted value: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("invalid encrypted value: too short")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("failed to decrypt value, was ENCRYPTION_KEY changed?")
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// secrets returns the fields encrypted at rest
+func (c *Config) secrets() map[string]*string {
+	return map[string]*string{
+		"aiApiKey":       &c.AIApiKey,
+		"licenseKey":     &c.LicenseKey,
+		"adminPassword":  &c.AdminPassword,
+		"readOnlyApiKey": &c.ReadOnlyAPIKey,
+	}
+}
+
+// MaskSecrets replaces the secrets with security.MaskKey placeholders, unset ones stay empty
+func (c *Config) MaskSecrets() {
+	for _, field := range c.secrets() {
+		*field = maskSecret(*field)
+	}
+}
+
+func maskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return security.MaskKey(value)
+}
+
+// encryptSecrets encrypts the sensitive fields in place. A nil key leaves them as is.
+func (c *Config) encryptSecrets(key []byte) error {
+	if key == nil {
+		return nil
+	}
+	for name, field := range c.secrets() {
+		enc, err := encryptValue(key, *field)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", name, err)
+		}
+		*field = enc
+	}
+	return nil
+}
+
+// decryptSecrets decrypts the sensitive fields in place. Fields that can't be
+// decrypted are cleared rather than used as ciphertext, and reported in the error.
+// Their ciphertext is kept for Save, so a wrong key doesn't lose them.
+func (c *Config) decryptSecrets(key []byte) error {
+	var errs []error
+	for name, field := range c.secrets() {
+		dec, err := decryptValue(key, *field)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			if c.undecrypted == nil {
+				c.undecrypted = make(map[string]string)
+			}
+			c.undecrypted[name] = *field
+		}
+		*field = dec
+	}
+	return errors.Join(errs...)
+}
+
+// keepUndecrypted restores into out the stored ciphertext of secrets that failed to
+// decrypt at load and haven't been set since
+func (c *Config) keepUndecrypted(out *Config) {
+	fields := out.secrets()
+	for name, ciphertext := range c.undecrypted {
+		if *fields[name] == "" {
+			*fields[name] = ciphertext
+		}
+	}
+}
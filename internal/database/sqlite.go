@@ -0,0 +1,36 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// OpenSQLite opens (creating if needed) the SQLite database at path. ":memory:" opens a
+// private in-memory database, used by tests. The jobs and processed file stores share
+// one database, each creates its own tables.
+func OpenSQLite(path string) (*sql.DB, error) {
+	dsn := "file::memory:?_busy_timeout=5000&_foreign_keys=on"
+	if path != ":memory:" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create database dir: %w", err)
+		}
+		dsn = "file:" + path + "?_busy_timeout=5000&_journal_mode=WAL&_synchronous=NORMAL&_foreign_keys=on"
+	}
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// One connection serializes writers, and keeps an in-memory database from being
+	// a different, empty database on every pooled connection
+	db.SetMaxOpenConns(1)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open SQLite database %s: %w", path, err)
+	}
+	return db, nil
+}
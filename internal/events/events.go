@@ -0,0 +1,94 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultCapacity is how many events the activity feed keeps
+const DefaultCapacity = 500
+
+// Event types
+const (
+	JobCreated    = "job.created"
+	JobStarted    = "job.started"
+	JobCompleted  = "job.completed"
+	JobFailed     = "job.failed"
+	JobCancelled  = "job.cancelled"
+	JobsFailing   = "jobs.failing"   // Too many recent jobs failed, see jobs.Manager.FailureAlert
+	JobsRecovered = "jobs.recovered" // Recent jobs are succeeding again
+	ScanCompleted = "scan.completed"
+	ScanFailed    = "scan.failed"
+	ConfigChanged = "config.changed"
+)
+
+// Event is a single entry in the activity feed
+type Event struct {
+	ID      uint64    `json:"id"`
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Message string    `json:"message"`
+	JobID   string    `json:"jobId,omitempty"`
+}
+
+// Log is a bounded, concurrency-safe ring buffer of recent events. A nil *Log
+// discards appends, so emitters don't need to check whether one is configured.
+type Log struct {
+	mu     sync.RWMutex
+	buf    []Event
+	next   int // Slot the next event is written to
+	count  int
+	lastID uint64
+}
+
+// NewLog creates a log holding the last capacity events
+func NewLog(capacity int) *Log {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Log{buf: make([]Event, capacity)}
+}
+
+// Append records an event, overwriting the oldest one when the log is full.
+// ID and Time are filled in when not set.
+func (l *Log) Append(e Event) Event {
+	if l == nil {
+		return e
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lastID++
+	e.ID = l.lastID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	l.buf[l.next] = e
+	l.next = (l.next + 1) % len(l.buf)
+	if l.count < len(l.buf) {
+		l.count++
+	}
+	return e
+}
+
+// Recent returns up to n events, newest first. n <= 0 returns everything kept.
+func (l *Log) Recent(n int) []Event {
+	if l == nil {
+		return []Event{}
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if n <= 0 || n > l.count {
+		n = l.count
+	}
+	result := make([]Event, n)
+	for i := 0; i < n; i++ {
+		idx := (l.next - 1 - i + len(l.buf)) % len(l.buf)
+		result[i] = l.buf[idx]
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestLogWraparound(t *testing.T) {
+	l := NewLog(3)
+
+	if got := l.Recent(10); len(got) != 0 {
+		t.Fatalf("expected empty log, got %d events", len(got))
+	}
+
+	for i := 1; i <= 5; i++ {
+		l.Append(Event{Type: JobCreated, Message: fmt.Sprintf("event %d", i)})
+	}
+
+	got := l.Recent(0)
+	if len(got) != 3 {
+		t.Fatalf("expected 3 events after wraparound, got %d", len(got))
+	}
+	for i, want := range []string{"event 5", "event 4", "event 3"} {
+		if got[i].Message != want {
+			t.Errorf("event %d: expected %q, got %q", i, want, got[i].Message)
+		}
+	}
+	if got[0].ID != 5 || got[0].Time.IsZero() {
+		t.Errorf("expected ID and time to be set, got %+v", got[0])
+	}
+
+	if got := l.Recent(2); len(got) != 2 || got[1].Message != "event 4" {
+		t.Errorf("expected the 2 newest events, got %+v", got)
+	}
+}
+
+func TestLogConcurrentAppend(t *testing.T) {
+	l := NewLog(100)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 10; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				l.Append(Event{Type: JobStarted})
+				l.Recent(5)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got := l.Recent(0)
+	if len(got) != 100 {
+		t.Fatalf("expected a full log of 100 events, got %d", len(got))
+	}
+	// IDs are unique and newest first
+	for i := 1; i < len(got); i++ {
+		if got[i].ID != got[i-1].ID-1 {
+			t.Fatalf("expected consecutive IDs, got %d after %d", got[i].ID, got[i-1].ID)
+		}
+	}
+	if got[0].ID != 500 {
+		t.Errorf("expected newest ID 500, got %d", got[0].ID)
+	}
+}
+
+func TestNilLog(t *testing.T) {
+	var l *Log
+	l.Append(Event{Type: JobCreated})
+	if got := l.Recent(10); len(got) != 0 {
+		t.Errorf("expected nil log to be empty, got %v", got)
+	}
+}
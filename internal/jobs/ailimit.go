@@ -0,0 +1,96 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Vasteva/MediaConverter/internal/ai"
+	"github.com/Vasteva/MediaConverter/internal/config"
+)
+
+// aiLimiter bounds the AI requests in flight, so concurrent jobs each making several
+// calls don't burst past the provider's rate limits
+type aiLimiter struct {
+	slots   chan struct{}
+	timeout time.Duration // Longest wait for a slot
+}
+
+// newAILimiter creates the limiter for cfg, values unset in cfg use the defaults
+func newAILimiter(cfg *config.Config) *aiLimiter {
+	max := cfg.AIMaxConcurrent
+	if max <= 0 {
+		max = config.DefaultAIMaxConcurrent
+	}
+	timeout := time.Duration(cfg.AIQueueTimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = config.DefaultAIQueueTimeoutSec * time.Second
+	}
+	return &aiLimiter{slots: make(chan struct{}, max), timeout: timeout}
+}
+
+// acquire waits for a free slot, until ctx is done or the queue timeout passes
+func (l *aiLimiter) acquire(ctx context.Context) error {
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return fmt.Errorf("AI request not started: still waiting for one of %d slots after %v", cap(l.slots), l.timeout)
+	}
+}
+
+func (l *aiLimiter) release() {
+	<-l.slots
+}
+
+// limitedProvider is an AI provider whose requests each hold a slot of the limiter
+type limitedProvider struct {
+	ai.Provider
+	limiter *aiLimiter
+}
+
+func (p *limitedProvider) Analyze(ctx context.Context, prompt string) (string, error) {
+	if err := p.limiter.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer p.limiter.release()
+	return p.Provider.Analyze(ctx, prompt)
+}
+
+func (p *limitedProvider) Transcribe(ctx context.Context, audioPath string) (string, error) {
+	if err := p.limiter.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer p.limiter.release()
+	return p.Provider.Transcribe(ctx, audioPath)
+}
+
+// limitedTranscriber keeps the language hint of providers that take one
+type limitedTranscriber struct {
+	*limitedProvider
+	transcriber ai.LanguageTranscriber
+}
+
+func (p *limitedTranscriber) TranscribeWithLanguage(ctx context.Context, audioPath, language string) (string, string, error) {
+	if err := p.limiter.acquire(ctx); err != nil {
+		return "", "", err
+	}
+	defer p.limiter.release()
+	return p.transcriber.TranscribeWithLanguage(ctx, audioPath, language)
+}
+
+// limit wraps provider so its requests wait for the limiter, nil stays nil
+func (l *aiLimiter) limit(provider ai.Provider) ai.Provider {
+	if provider == nil || l == nil {
+		return provider
+	}
+	limited := &limitedProvider{Provider: provider, limiter: l}
+	if lt, ok := provider.(ai.LanguageTranscriber); ok {
+		return &limitedTranscriber{limitedProvider: limited, transcriber: lt}
+	}
+	return limited
+}
@@ -0,0 +1,111 @@
+package jobs
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Vasteva/MediaConverter/internal/media"
+)
+
+// encodeSpeedWindow is how many completed encodes the rolling speed average covers
+const encodeSpeedWindow = 10
+
+// QueueETA estimates how long it will take to clear the queue
+type QueueETA struct {
+	Seconds     float64 `json:"seconds"`
+	ETA         string  `json:"eta"` // HH:MM:SS
+	Running     int     `json:"running"`
+	Pending     int     `json:"pending"`
+	Unestimated int     `json:"unestimated"` // Jobs left out because their duration is unknown
+	AvgSpeed    float64 `json:"avgSpeed"`    // Rolling encode speed used for pending jobs
+}
+
+// recordEncodeSpeed adds a finished encode to the rolling speed average
+func (m *Manager) recordEncodeSpeed(mediaSeconds float64, elapsed time.Duration) {
+	if mediaSeconds <= 0 || elapsed <= 0 {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.encodeSpeeds = append(m.encodeSpeeds, mediaSeconds/elapsed.Seconds())
+	if len(m.encodeSpeeds) > encodeSpeedWindow {
+		m.encodeSpeeds = m.encodeSpeeds[len(m.encodeSpeeds)-encodeSpeedWindow:]
+	}
+}
+
+// averageEncodeSpeed returns the rolling average, assuming realtime before any encode finished
+func (m *Manager) averageEncodeSpeed() float64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.encodeSpeeds) == 0 {
+		return 1.0
+	}
+	var sum float64
+	for _, s := range m.encodeSpeeds {
+		sum += s
+	}
+	return sum / float64(len(m.encodeSpeeds))
+}
+
+// QueueETA sums the remaining time of running jobs and the estimated encode time of
+// pending jobs, spread over the configured workers. Pending jobs count once probeLoop
+// has found their duration, until then they are unestimated.
+func (m *Manager) QueueETA() QueueETA {
+	speed := m.averageEncodeSpeed()
+	result := QueueETA{AvgSpeed: speed}
+
+	var running, pending []float64
+	m.mu.RLock()
+	for _, job := range m.jobs {
+		switch job.Status {
+		case StatusProcessing:
+			result.Running++
+			if job.ETA != "" {
+				running = append(running, media.ParseTimestamp(job.ETA))
+			} else if job.Duration > 0 {
+				running = append(running, job.Duration*float64(100-job.Progress)/100/speed)
+			} else {
+				result.Unestimated++
+			}
+		case StatusPending:
+			result.Pending++
+			if job.Duration > 0 {
+				pending = append(pending, job.Duration)
+			} else {
+				result.Unestimated++
+			}
+		}
+	}
+	m.mu.RUnlock()
+
+	result.Seconds = estimateQueueSeconds(running, pending, speed, m.maxConcurrent)
+	result.ETA = formatSeconds(result.Seconds)
+	return result
+}
+
+// estimateQueueSeconds converts pending media durations to encode time at speed and
+// divides all remaining work across the workers
+func estimateQueueSeconds(running, pendingDurations []float64, speed float64, workers int) float64 {
+	if speed <= 0 {
+		speed = 1.0
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	var total float64
+	for _, r := range running {
+		total += r
+	}
+	for _, d := range pendingDurations {
+		total += d / speed
+	}
+	return total / float64(workers)
+}
+
+func formatSeconds(seconds float64) string {
+	s := int(seconds)
+	return fmt.Sprintf("%02d:%02d:%02d", s/3600, s%3600/60, s%60)
+}
@@ -0,0 +1,81 @@
+package jobs
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/Vasteva/MediaConverter/internal/events"
+)
+
+// failureWindow keeps the outcomes of the most recently finished jobs, to alert once
+// when too many of them fail instead of leaving a backlog of failures to be found later
+type failureWindow struct {
+	outcomes []bool // True for a failure, oldest first
+	degraded bool   // Set while the failures are over the threshold
+}
+
+// record adds an outcome to a window of size jobs. It reports whether the failures just
+// went over percent of the window, or a success just brought them back under.
+func (w *failureWindow) record(failed bool, size, percent int) (tripped, recovered bool) {
+	if size <= 0 {
+		w.outcomes, w.degraded = nil, false
+		return false, false
+	}
+
+	w.outcomes = append(w.outcomes, failed)
+	if len(w.outcomes) > size {
+		w.outcomes = append([]bool(nil), w.outcomes[len(w.outcomes)-size:]...)
+	}
+
+	over := w.failed()*100 > percent*size
+	switch {
+	case over && !w.degraded:
+		w.degraded = true
+		return true, false
+	case !over && w.degraded && !failed:
+		w.degraded = false
+		return false, true
+	}
+	return false, false
+}
+
+// failed counts the failures in the window
+func (w *failureWindow) failed() int {
+	n := 0
+	for _, failed := range w.outcomes {
+		if failed {
+			n++
+		}
+	}
+	return n
+}
+
+// recordOutcome adds a finished job to the failure window, raising a single event when
+// the failures go over FailureAlertPercent and another when they recover
+func (m *Manager) recordOutcome(failed bool) {
+	cfg := m.config.Snapshot()
+
+	m.mu.Lock()
+	tripped, recovered := m.failures.record(failed, cfg.FailureAlertWindow, cfg.FailureAlertPercent)
+	count, total := m.failures.failed(), len(m.failures.outcomes)
+	m.mu.Unlock()
+
+	switch {
+	case tripped:
+		message := fmt.Sprintf("%d of the last %d jobs failed, check the encoder and GPU", count, total)
+		log.Printf("[Jobs] Alert: %s", message)
+		m.Events.Append(events.Event{Type: events.JobsFailing, Message: message})
+	case recovered:
+		message := fmt.Sprintf("Jobs are succeeding again, %d of the last %d failed", count, total)
+		log.Printf("[Jobs] %s", message)
+		m.Events.Append(events.Event{Type: events.JobsRecovered, Message: message})
+	}
+}
+
+// FailureAlert reports whether too many recent jobs failed, and how many of the recent
+// jobs failed out of how many
+func (m *Manager) FailureAlert() (degraded bool, failed, total int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.failures.degraded, m.failures.failed(), len(m.failures.outcomes)
+}
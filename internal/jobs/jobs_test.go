@@ -2,10 +2,22 @@ package jobs
 
 import (
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/database"
+	"github.com/Vasteva/MediaConverter/internal/events"
+	"github.com/Vasteva/MediaConverter/internal/media"
+	"github.com/Vasteva/MediaConverter/internal/system"
 )
 
 func TestManager_AddAndGetJob(t *testing.T) {
@@ -80,13 +92,1439 @@ func TestManager_Lifecycle(t *testing.T) {
 	// Actually, let's verify it gets picked up
 	time.Sleep(100 * time.Millisecond)
 
+	if status := jobStatus(mgr, job.ID); status == StatusPending {
+		// It should be processing at least
+	}
+
+	mgr.Stop()
+}
+
+func TestCleanupExtraction(t *testing.T) {
+	setup := func(t *testing.T) (string, string) {
+		extractDir := filepath.Join(t.TempDir(), "extract_job")
+		if err := os.MkdirAll(extractDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		ripFile := filepath.Join(extractDir, "title_t00.mkv")
+		if err := os.WriteFile(ripFile, []byte("rip"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return extractDir, ripFile
+	}
+
+	t.Run("delete by default", func(t *testing.T) {
+		extractDir, ripFile := setup(t)
+		mgr := &Manager{config: &config.Config{}}
+		job := &Job{ID: "job", SourcePath: "/media/Movie.iso", DestinationPath: filepath.Join(t.TempDir(), "Movie.mkv")}
+
+		if err := mgr.cleanupExtraction(job, extractDir, ripFile); err != nil {
+			t.Fatalf("cleanup failed: %v", err)
+		}
+		if _, err := os.Stat(extractDir); !os.IsNotExist(err) {
+			t.Error("expected extract dir to be removed")
+		}
+		if job.RipPath != "" {
+			t.Errorf("expected no rip path, got %s", job.RipPath)
+		}
+	})
+
+	t.Run("keep rip", func(t *testing.T) {
+		extractDir, ripFile := setup(t)
+		ripDir := filepath.Join(t.TempDir(), "rips")
+		mgr := &Manager{config: &config.Config{RipDir: ripDir}}
+		job := &Job{ID: "job", SourcePath: "/media/Movie.iso", DestinationPath: filepath.Join(t.TempDir(), "Movie.mkv"), KeepRip: true}
+
+		if err := mgr.cleanupExtraction(job, extractDir, ripFile); err != nil {
+			t.Fatalf("cleanup failed: %v", err)
+		}
+		if _, err := os.Stat(extractDir); !os.IsNotExist(err) {
+			t.Error("expected extract dir to be removed")
+		}
+
+		want := filepath.Join(ripDir, "Movie_rip.mkv")
+		if job.RipPath != want {
+			t.Errorf("expected rip path %s, got %s", want, job.RipPath)
+		}
+		if data, err := os.ReadFile(want); err != nil || string(data) != "rip" {
+			t.Errorf("expected rip to be moved intact, got %q (%v)", data, err)
+		}
+	})
+}
+
+func TestManager_RetryJob(t *testing.T) {
+	cfg := &config.Config{MaxConcurrentJobs: 1}
+	mgr, _ := NewManager(cfg, nil, "")
+
+	job := &Job{
+		ID:         "test-retry",
+		Type:       JobTypeTest,
+		SourcePath: "/tmp/source.mkv",
+		Priority:   3,
+		Status:     StatusPending,
+		Uploaded:   true,
+	}
+	mgr.AddJob(job)
+
+	if _, err := mgr.RetryJob("test-retry", "test-retry-2"); err == nil {
+		t.Error("expected pending job to be rejected for retry")
+	}
+
+	job.Status = StatusFailed
+	job.Error = "transient failure"
+	job.Progress = 42
+	job.Warnings = []string{"output /tmp/out.mkv is in use by another job, writing out_2.mkv instead"}
+	job.StreamLanguages = []string{"eng", "jpn"}
+	job.StartedAt = time.Now()
+	job.CompletedAt = time.Now()
+
+	retried, err := mgr.RetryJob("test-retry", "test-retry-2")
+	if err != nil {
+		t.Fatalf("RetryJob failed: %v", err)
+	}
+	if retried.ID != "test-retry-2" {
+		t.Errorf("expected new ID test-retry-2, got %s", retried.ID)
+	}
+	if retried.Status != StatusPending || retried.Progress != 0 || retried.Error != "" {
+		t.Errorf("expected fresh pending job, got status=%s progress=%d error=%q", retried.Status, retried.Progress, retried.Error)
+	}
+	if !retried.StartedAt.IsZero() || !retried.CompletedAt.IsZero() {
+		t.Error("expected timestamps to be reset")
+	}
+	if retried.Type != JobTypeTest || retried.SourcePath != job.SourcePath || retried.Priority != 3 || !retried.Uploaded {
+		t.Errorf("expected job settings to be cloned, got %+v", retried)
+	}
+	if len(retried.Warnings) != 0 {
+		t.Errorf("expected the failed job's warnings to be dropped, got %v", retried.Warnings)
+	}
+	retried.StreamLanguages[0] = "fre"
+	if job.StreamLanguages[0] != "eng" {
+		t.Error("expected the retried job not to share the original's languages")
+	}
+	if mgr.GetJob("test-retry-2") == nil {
+		t.Error("expected retried job to be registered")
+	}
+	if len(mgr.GetAllJobs()) != 2 {
+		t.Errorf("expected original job to be kept, got %d jobs", len(mgr.GetAllJobs()))
+	}
+}
+
+func TestManager_RetryJobRestoresDiscImageSource(t *testing.T) {
+	cfg := &config.Config{MaxConcurrentJobs: 1}
+	mgr, _ := NewManager(cfg, nil, "")
+
+	job := &Job{
+		ID:                 "test-iso",
+		Type:               JobTypeOptimize,
+		SourcePath:         "/output/extract_test-iso/title_t00.mkv",
+		OriginalSourcePath: "/media/Movie.iso",
+		Status:             StatusFailed,
+	}
+	mgr.AddJob(job)
+
+	retried, err := mgr.RetryJob("test-iso", "test-iso-2")
+	if err != nil {
+		t.Fatalf("RetryJob failed: %v", err)
+	}
+	if retried.SourcePath != "/media/Movie.iso" {
+		t.Errorf("expected original source to be restored, got %s", retried.SourcePath)
+	}
+}
+
+// jobStatus reads a job's status under the manager lock, workers update it concurrently
+func jobStatus(mgr *Manager, id string) Status {
+	job := mgr.GetJob(id)
 	mgr.mu.RLock()
-	status := job.Status
-	mgr.mu.RUnlock()
+	defer mgr.mu.RUnlock()
+	return job.Status
+}
 
-	if status == StatusPending {
-		// It should be processing at least
+func waitForStatus(t *testing.T, mgr *Manager, job *Job, status Status) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if jobStatus(mgr, job.ID) == status {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
 	}
+	t.Fatalf("job %s never reached status %s", job.ID, status)
+}
+
+func TestManager_StopDrainsRunningJob(t *testing.T) {
+	defer func(d time.Duration) { testJobDuration = d }(testJobDuration)
+	testJobDuration = time.Second
+
+	cfg := &config.Config{MaxConcurrentJobs: 1, ShutdownGraceSec: 5}
+	mgr, _ := NewManager(cfg, nil, "")
+	mgr.Start()
 
+	job := &Job{ID: "test-drain", Type: JobTypeTest, Status: StatusPending}
+	mgr.AddJob(job)
+	waitForStatus(t, mgr, job, StatusProcessing)
+
+	mgr.Stop()
+
+	if job.Status != StatusCompleted {
+		t.Errorf("expected running job to complete during grace period, got %s", job.Status)
+	}
+
+	// Jobs added while draining are kept pending instead of started
+	late := &Job{ID: "test-late", Type: JobTypeTest, Status: StatusPending}
+	mgr.AddJob(late)
+	if late.Status != StatusPending {
+		t.Errorf("expected job added after Stop to stay pending, got %s", late.Status)
+	}
+}
+
+func TestManager_StopInterruptsAfterGrace(t *testing.T) {
+	cfg := &config.Config{MaxConcurrentJobs: 1}
+	mgr, _ := NewManager(cfg, nil, "")
+	mgr.Start()
+
+	job := &Job{ID: "test-interrupt", Type: JobTypeTest, Status: StatusPending}
+	mgr.AddJob(job)
+	waitForStatus(t, mgr, job, StatusProcessing)
+
+	start := time.Now()
 	mgr.Stop()
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("expected Stop to interrupt the job without waiting for it, took %v", time.Since(start))
+	}
+
+	if job.Status != StatusPending {
+		t.Errorf("expected interrupted job to be pending for next start, got %s", job.Status)
+	}
+}
+
+func TestManager_JobTimeout(t *testing.T) {
+	cfg := &config.Config{MaxConcurrentJobs: 1, MaxJobDurationSec: 3600}
+	mgr, _ := NewManager(cfg, nil, "")
+
+	// The job's own limit wins over the config's
+	job := &Job{ID: "test-timeout", Type: JobTypeTest, Status: StatusPending, MaxDurationSec: 1}
+	start := time.Now()
+	mgr.processJob(job)
+
+	if job.Status != StatusFailed || !strings.HasPrefix(job.Error, "timeout") {
+		t.Errorf("expected a timeout failure, got %s %q", job.Status, job.Error)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("expected the job to be stopped after about 1s, took %v", elapsed)
+	}
+	if d := (&Job{}).maxDuration(&config.Config{}); d != 0 {
+		t.Errorf("expected no limit by default, got %v", d)
+	}
+}
+
+func TestManager_PostCommand(t *testing.T) {
+	defer func(d time.Duration) { testJobDuration = d }(testJobDuration)
+	testJobDuration = 0
+
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "env")
+	cfg := &config.Config{
+		MaxConcurrentJobs:     1,
+		PostCommand:           `printf '%s\n' "$VASTIVA_JOB_ID" "$VASTIVA_JOB_TYPE" "$VASTIVA_INPUT" "$VASTIVA_OUTPUT" > "$ENV_FILE"`,
+		PostCommandEnabled:    true,
+		PostCommandTimeoutSec: 10,
+	}
+	t.Setenv("ENV_FILE", envFile)
+	mgr, _ := NewManager(cfg, nil, "")
+
+	job := &Job{ID: "post-ok", Type: JobTypeTest, SourcePath: "/media/in put.mkv", DestinationPath: "/output/out.mkv", Status: StatusPending}
+	mgr.processJob(job)
+	if job.Status != StatusCompleted {
+		t.Fatalf("expected the job to complete, got %s %q", job.Status, job.Error)
+	}
+	data, err := os.ReadFile(envFile)
+	if err != nil {
+		t.Fatalf("expected the post command to run: %v", err)
+	}
+	if want := "post-ok\ntest\n/media/in put.mkv\n/output/out.mkv\n"; string(data) != want {
+		t.Errorf("expected the job in the environment, got %q", data)
+	}
+
+	// Nothing runs unless enabled, and a job's own command wins over the config's
+	os.Remove(envFile)
+	cfg.PostCommandEnabled = false
+	mgr.processJob(&Job{ID: "post-disabled", Type: JobTypeTest, Status: StatusPending})
+	if _, err := os.Stat(envFile); !os.IsNotExist(err) {
+		t.Error("expected no post command when POST_COMMAND_ENABLED is off")
+	}
+	cfg.PostCommandEnabled = true
+	mgr.processJob(&Job{ID: "post-job", Type: JobTypeTest, Status: StatusPending, PostCommand: `echo own > "$ENV_FILE"`})
+	if data, _ := os.ReadFile(envFile); string(data) != "own\n" {
+		t.Errorf("expected the job's own post command, got %q", data)
+	}
+
+	// The timeout kills what the command started too, not only the shell
+	cfg.PostCommandTimeoutSec = 1
+	start := time.Now()
+	mgr.processJob(&Job{ID: "post-slow", Type: JobTypeTest, Status: StatusPending, PostCommand: "sleep 30 & sleep 30"})
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the post command to be killed after its timeout, took %v", elapsed)
+	}
+}
+
+func TestManager_InsufficientDiskSpace(t *testing.T) {
+	defer func(f func(string) (uint64, error)) { diskFree = f }(diskFree)
+	var free uint64 = 1 << 30
+	diskFree = func(string) (uint64, error) { return free, nil }
+
+	cfg := &config.Config{MaxConcurrentJobs: 1, MinFreeSpaceGB: 5}
+	mgr, _ := NewManager(cfg, nil, "")
+
+	job := &Job{
+		ID:              "low-space",
+		Type:            JobTypeOptimize,
+		SourcePath:      "/media/missing.mkv",
+		DestinationPath: filepath.Join(t.TempDir(), "out.mkv"),
+		Status:          StatusPending,
+	}
+	mgr.processJob(job)
+
+	if job.Status != StatusFailed {
+		t.Fatalf("expected job to fail, got %s", job.Status)
+	}
+	if !strings.Contains(job.Error, "insufficient disk space") {
+		t.Errorf("unexpected error: %s", job.Error)
+	}
+
+	// The source size raises the requirement above the configured headroom
+	free = 8 << 30
+	job.InputSize = 10 << 30
+	if err := mgr.checkDiskSpace(job); err == nil {
+		t.Error("expected source larger than free space to be rejected")
+	}
+	job.InputSize = 1 << 30
+	if err := mgr.checkDiskSpace(job); err != nil {
+		t.Errorf("expected enough space, got %v", err)
+	}
+}
+
+func TestEstimateQueueSeconds(t *testing.T) {
+	// 10 minutes left on the running job, plus two 1h movies encoded at 2x
+	got := estimateQueueSeconds([]float64{600}, []float64{3600, 3600}, 2.0, 1)
+	if got != 600+1800+1800 {
+		t.Errorf("expected 4200s, got %v", got)
+	}
+
+	// The same work split over two workers
+	if got := estimateQueueSeconds([]float64{600}, []float64{3600, 3600}, 2.0, 2); got != 2100 {
+		t.Errorf("expected 2100s with two workers, got %v", got)
+	}
+
+	if got := estimateQueueSeconds(nil, nil, 0, 0); got != 0 {
+		t.Errorf("expected empty queue to be 0s, got %v", got)
+	}
+}
+
+func TestManager_QueueETA(t *testing.T) {
+	mgr, _ := NewManager(&config.Config{MaxConcurrentJobs: 1}, nil, "")
+
+	// Two encodes of 1h media, in 20 and 40 minutes: 3x and 1.5x, averaging 2.25x
+	mgr.recordEncodeSpeed(3600, 20*time.Minute)
+	mgr.recordEncodeSpeed(3600, 40*time.Minute)
+
+	running := &Job{ID: "running", Type: JobTypeOptimize}
+	mgr.AddJob(running)
+	running.Status = StatusProcessing
+	running.ETA = "00:15:00"
+
+	mgr.AddJob(&Job{ID: "pending-1", Type: JobTypeOptimize, Status: StatusPending, Duration: 4500})
+	mgr.AddJob(&Job{ID: "pending-2", Type: JobTypeOptimize, Status: StatusPending, Duration: 2250})
+	mgr.AddJob(&Job{ID: "pending-3", Type: JobTypeTest, Status: StatusPending})
+
+	eta := mgr.QueueETA()
+	if eta.AvgSpeed != 2.25 {
+		t.Errorf("expected average speed 2.25, got %v", eta.AvgSpeed)
+	}
+	if eta.Running != 1 || eta.Pending != 3 || eta.Unestimated != 1 {
+		t.Errorf("unexpected counts: %+v", eta)
+	}
+	// 900s running + 2000s + 1000s pending
+	if eta.Seconds != 3900 || eta.ETA != "01:05:00" {
+		t.Errorf("expected 3900s (01:05:00), got %v (%s)", eta.Seconds, eta.ETA)
+	}
+
+	// Pending optimize jobs are left to the background probe, once each
+	if unprobed := mgr.unprobedJobs(); len(unprobed) != 2 {
+		t.Errorf("expected the two pending optimize jobs to need probing, got %d", len(unprobed))
+	}
+	if unprobed := mgr.unprobedJobs(); len(unprobed) != 0 {
+		t.Errorf("expected each job to be probed once, got %v", unprobed)
+	}
+}
+
+func TestManager_PendingSavings(t *testing.T) {
+	mgr, _ := NewManager(&config.Config{MaxConcurrentJobs: 1, EfficientMaxBitrateKbps: 8000}, nil, "")
+
+	// Probed 1 GB sources: 400s at 8000 kb/s shrinks to 400 MB, 1200s would grow
+	mgr.probes = map[string]sourceProbe{
+		"/media/movie1.mkv": {inputSize: 1_000_000_000, duration: 400},
+		"/media/movie2.mkv": {inputSize: 1_000_000_000, duration: 1200},
+		"/media/gone.mkv":   {inputSize: 1_000_000_000, duration: 400},
+	}
+
+	mgr.AddJob(&Job{ID: "pending-1", Type: JobTypeOptimize, Status: StatusPending, SourcePath: "/media/movie1.mkv"})
+	mgr.AddJob(&Job{ID: "pending-2", Type: JobTypeOptimize, Status: StatusPending, SourcePath: "/media/movie2.mkv"})
+	mgr.AddJob(&Job{ID: "pending-3", Type: JobTypeTest, Status: StatusPending, SourcePath: "/media/movie1.mkv"})
+	mgr.AddJob(&Job{ID: "unprobed", Type: JobTypeOptimize, Status: StatusPending, SourcePath: "/media/movie3.mkv"})
+
+	files, saved := mgr.PendingSavings()
+	if files != 3 || saved != 600_000_000 {
+		t.Errorf("expected 3 files saving 600000000 bytes, got %d files saving %d", files, saved)
+	}
+	if _, ok := mgr.probes["/media/gone.mkv"]; ok || len(mgr.probes) != 2 {
+		t.Errorf("expected the probe of a job no longer pending to be dropped, got %v", mgr.probes)
+	}
+
+	// An hour at 8000 kb/s is 3.6 GB, capped at the source size
+	info := &media.MediaInfo{Duration: 3600, Size: 10_000_000_000}
+	if got := EstimateOutputSize(info, 8000); got != 3_600_000_000 {
+		t.Errorf("expected 3600000000 bytes, got %d", got)
+	}
+	info.Size = 1_000_000_000
+	if got := EstimateOutputSize(info, 8000); got != info.Size {
+		t.Errorf("expected the source size, got %d", got)
+	}
+	if got := EstimateOutputSize(&media.MediaInfo{Size: 1000}, 8000); got != 0 {
+		t.Errorf("expected 0 without a duration, got %d", got)
+	}
+}
+
+func TestManager_FailureAlert(t *testing.T) {
+	mgr, _ := NewManager(&config.Config{MaxConcurrentJobs: 1, FailureAlertWindow: 4, FailureAlertPercent: 50}, nil, "")
+	mgr.Events = events.NewLog(0)
+
+	alerts := func(eventType string) int {
+		n := 0
+		for _, e := range mgr.Events.Recent(0) {
+			if e.Type == eventType {
+				n++
+			}
+		}
+		return n
+	}
+
+	// More than 2 of the last 4 failing trips the alert on the third failure, and only once
+	for i := 1; i <= 6; i++ {
+		mgr.recordOutcome(true)
+		if degraded, _, _ := mgr.FailureAlert(); degraded != (i >= 3) {
+			t.Errorf("after %d failures: expected degraded %v", i, i >= 3)
+		}
+	}
+	if n := alerts(events.JobsFailing); n != 1 {
+		t.Errorf("expected one alert, got %d", n)
+	}
+	if degraded, failed, total := mgr.FailureAlert(); !degraded || failed != 4 || total != 4 {
+		t.Errorf("expected 4 of 4 failed and degraded, got %d of %d (degraded %v)", failed, total, degraded)
+	}
+
+	// Successes bring it back under the threshold: 3 of 4 failed is still over, 2 is not
+	mgr.recordOutcome(false)
+	if degraded, _, _ := mgr.FailureAlert(); !degraded {
+		t.Error("expected to stay degraded with 3 of 4 failed")
+	}
+	mgr.recordOutcome(false)
+	if degraded, _, _ := mgr.FailureAlert(); degraded {
+		t.Error("expected to recover with 2 of 4 failed")
+	}
+	if alerts(events.JobsRecovered) != 1 {
+		t.Error("expected a recovery event")
+	}
+
+	// Failing again raises a new alert once 3 of the last 4 failed
+	for i := 0; i < 3; i++ {
+		mgr.recordOutcome(true)
+	}
+	if n := alerts(events.JobsFailing); n != 2 {
+		t.Errorf("expected a second alert, got %d", n)
+	}
+}
+
+func TestTitleProgress(t *testing.T) {
+	job := &Job{}
+	progress := newTitleProgress([]int{3600, 1200})
+
+	progress.report(job, 0, 50)
+	if job.Progress != 37 {
+		t.Errorf("Progress = %d, want 37", job.Progress)
+	}
+	progress.finish(job, 1)
+	if job.Progress != 62 {
+		t.Errorf("Progress = %d, want 62", job.Progress)
+	}
+	if job.StatusDetail != "Extracted 1 of 2 titles" {
+		t.Errorf("StatusDetail = %q", job.StatusDetail)
+	}
+
+	// Unknown durations weight every title the same
+	job = &Job{}
+	progress = newTitleProgress([]int{3600, 0})
+	progress.report(job, 0, 50)
+	if job.Progress != 25 {
+		t.Errorf("Progress = %d, want 25", job.Progress)
+	}
+}
+
+func TestBuildTranscodeOptions(t *testing.T) {
+	mgr := &Manager{config: &config.Config{
+		GPUVendor:     "cpu",
+		QualityPreset: "medium",
+		AudioCodec:    "aac",
+		Container:     "mp4",
+	}}
+
+	job := &Job{SourcePath: "/media/movie.mkv", DestinationPath: "/output/movie_optimized.mkv"}
+	opts := mgr.buildTranscodeOptions(job, 3600, 23)
+	if opts.AudioCodec != "aac" || opts.Container != "mp4" {
+		t.Errorf("expected configured aac/mp4, got %s/%s", opts.AudioCodec, opts.Container)
+	}
+	if opts.OutputPath != "/output/movie_optimized.mp4" || job.DestinationPath != opts.OutputPath {
+		t.Errorf("expected destination to match the container, got %s (job %s)", opts.OutputPath, job.DestinationPath)
+	}
+	if opts.CRF != 23 || opts.TotalDuration != 3600 {
+		t.Errorf("unexpected CRF/duration: %d/%v", opts.CRF, opts.TotalDuration)
+	}
+
+	// Job settings override the configured defaults
+	job = &Job{SourcePath: "/media/movie.mp4", DestinationPath: "/output/movie.mp4", AudioCodec: "ac3", Container: "mkv"}
+	opts = mgr.buildTranscodeOptions(job, 0, 23)
+	if opts.AudioCodec != "ac3" || opts.Container != "mkv" || opts.OutputPath != "/output/movie.mkv" {
+		t.Errorf("expected job override ac3/mkv, got %s/%s -> %s", opts.AudioCodec, opts.Container, opts.OutputPath)
+	}
+
+	// Without a container the destination's extension decides
+	mgr.config.Container = ""
+	job = &Job{SourcePath: "/media/movie.mkv", DestinationPath: "/output/movie.MP4"}
+	opts = mgr.buildTranscodeOptions(job, 0, 23)
+	if opts.Container != "mp4" || opts.OutputPath != "/output/movie.MP4" {
+		t.Errorf("expected the mp4 destination kept, got %s -> %s", opts.Container, opts.OutputPath)
+	}
+}
+
+// crfProvider is an ai.Provider that answers every analysis with a fixed CRF
+type crfProvider struct{ crf string }
+
+func (p crfProvider) Analyze(ctx context.Context, prompt string) (string, error) {
+	return p.crf, nil
+}
+
+func (p crfProvider) Transcribe(ctx context.Context, audioPath string) (string, error) {
+	return "", fmt.Errorf("not supported")
+}
+
+func (p crfProvider) GetName() string { return "test" }
+
+// countingProvider records the most AI requests it had in flight at once
+type countingProvider struct {
+	mu       sync.Mutex
+	inFlight int
+	max      int
+	calls    int
+}
+
+func (p *countingProvider) Analyze(ctx context.Context, prompt string) (string, error) {
+	p.mu.Lock()
+	p.inFlight++
+	p.calls++
+	if p.inFlight > p.max {
+		p.max = p.inFlight
+	}
+	p.mu.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+
+	p.mu.Lock()
+	p.inFlight--
+	p.mu.Unlock()
+	return "23", nil
+}
+
+func (p *countingProvider) Transcribe(ctx context.Context, audioPath string) (string, error) {
+	return p.Analyze(ctx, audioPath)
+}
+
+func (p *countingProvider) GetName() string { return "counting" }
+
+func TestManager_AIConcurrencyLimit(t *testing.T) {
+	provider := &countingProvider{}
+	mgr, _ := NewManager(&config.Config{MaxConcurrentJobs: 8, AIMaxConcurrent: 2, AIQueueTimeoutSec: 10}, provider, "")
+
+	// Eight jobs each cleaning a filename, analyzing the source and transcribing at once
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			aiProv := mgr.GetAI()
+			for _, call := range []func() (string, error){
+				func() (string, error) { return aiProv.Analyze(context.Background(), "clean") },
+				func() (string, error) { return aiProv.Analyze(context.Background(), "analyze") },
+				func() (string, error) { return aiProv.Transcribe(context.Background(), "audio.wav") },
+			} {
+				if _, err := call(); err != nil {
+					t.Errorf("unexpected AI error: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if provider.calls != 24 {
+		t.Errorf("expected 24 AI calls, got %d", provider.calls)
+	}
+	if provider.max > 2 {
+		t.Errorf("expected at most 2 AI requests in flight, got %d", provider.max)
+	}
+
+	// A request that can't get a slot in time fails instead of waiting forever
+	mgr.aiLimit.timeout = 50 * time.Millisecond
+	mgr.aiLimit.slots <- struct{}{}
+	mgr.aiLimit.slots <- struct{}{}
+	if _, err := mgr.GetAI().Analyze(context.Background(), "late"); err == nil {
+		t.Error("expected a queue timeout with every slot taken")
+	}
+
+	if (&Manager{aiLimit: newAILimiter(&config.Config{})}).GetAI() != nil {
+		t.Error("expected no provider when AI isn't configured")
+	}
+}
+
+func TestPrepareEncodingRecordsSettings(t *testing.T) {
+	cfg := &config.Config{
+		GPUVendor:     "cpu",
+		QualityPreset: "slow",
+		CRF:           23,
+		AudioCodec:    "aac",
+		IsPremium:     true,
+	}
+	mgr := &Manager{config: cfg, ai: crfProvider{crf: "19"}}
+
+	job := &Job{ID: "enc", SourcePath: "/media/movie.mkv", DestinationPath: "/output/movie.mkv", ctx: context.Background()}
+	opts := mgr.prepareEncoding(job, &media.MediaInfo{Duration: 60, RawJSON: "{}"}, cfg)
+
+	if opts.CRF != 19 {
+		t.Errorf("expected AI CRF 19 in the options, got %d", opts.CRF)
+	}
+	enc := job.Encoding
+	if enc == nil {
+		t.Fatal("expected encoding settings on the job")
+	}
+	if enc.CRF != 19 || !enc.AIAdjustedCRF {
+		t.Errorf("expected AI-adjusted CRF 19 recorded, got %d (adjusted %v)", enc.CRF, enc.AIAdjustedCRF)
+	}
+	if enc.VideoCodec != "hevc" || enc.GPUVendor != "cpu" || enc.Preset != "slow" || enc.AudioCodec != "aac" {
+		t.Errorf("unexpected recorded settings: %+v", enc)
+	}
+
+	// Without premium the configured CRF is used as-is
+	cfg.IsPremium = false
+	job = &Job{ID: "enc2", SourcePath: "/media/movie.mkv", DestinationPath: "/output/movie.mkv", ctx: context.Background()}
+	mgr.prepareEncoding(job, &media.MediaInfo{Duration: 60}, cfg)
+	if job.Encoding.CRF != 23 || job.Encoding.AIAdjustedCRF {
+		t.Errorf("expected configured CRF 23, got %d (adjusted %v)", job.Encoding.CRF, job.Encoding.AIAdjustedCRF)
+	}
+}
+
+func TestManager_QueuePositions(t *testing.T) {
+	mgr, _ := NewManager(&config.Config{MaxConcurrentJobs: 1}, nil, "")
+
+	now := time.Now()
+	running := &Job{ID: "running", Type: JobTypeTest, Priority: 10, CreatedAt: now}
+	mgr.AddJob(running)
+	running.Status = StatusProcessing
+
+	mgr.AddJob(&Job{ID: "low", Type: JobTypeTest, Status: StatusPending, Priority: 1, CreatedAt: now})
+	mgr.AddJob(&Job{ID: "high", Type: JobTypeTest, Status: StatusPending, Priority: 10, CreatedAt: now.Add(time.Second)})
+	mgr.AddJob(&Job{ID: "normal", Type: JobTypeTest, Status: StatusPending, Priority: 5, CreatedAt: now.Add(2 * time.Second)})
+
+	positions := mgr.QueuePositions()
+	want := map[string]int{"high": 1, "normal": 2, "low": 3}
+	for id, pos := range want {
+		if positions[id] != pos {
+			t.Errorf("expected %s at position %d, got %d", id, pos, positions[id])
+		}
+	}
+	if pos, ok := positions["running"]; ok {
+		t.Errorf("expected no position for processing job, got %d", pos)
+	}
+}
+
+func TestManager_MoveJob(t *testing.T) {
+	mgr, _ := NewManager(&config.Config{MaxConcurrentJobs: 1}, nil, "")
+
+	now := time.Now()
+	var queued []*Job
+	for i, priority := range []int{10, 5, 5, 1} {
+		job := &Job{ID: fmt.Sprintf("job-%d", i), Type: JobTypeTest, Status: StatusPending, Priority: priority, CreatedAt: now.Add(time.Duration(i) * time.Second)}
+		mgr.AddJob(job)
+		queued = append(queued, job)
+	}
+
+	last := queued[len(queued)-1]
+	if _, err := mgr.MoveJob(last.ID, MoveTop); err != nil {
+		t.Fatalf("MoveJob top failed: %v", err)
+	}
+	if last.Priority != 11 || mgr.QueuePositions()[last.ID] != 1 {
+		t.Fatalf("expected moved job first with priority 11, got position %d priority %d", mgr.QueuePositions()[last.ID], last.Priority)
+	}
+	if _, err := mgr.MoveJob(queued[0].ID, MoveBottom); err != nil {
+		t.Fatalf("MoveJob bottom failed: %v", err)
+	}
+	if queued[0].Priority != 4 || mgr.QueuePositions()[queued[0].ID] != 4 {
+		t.Errorf("expected job-0 last with priority 4, got position %d priority %d", mgr.QueuePositions()[queued[0].ID], queued[0].Priority)
+	}
+	if _, err := mgr.MoveJob(last.ID, "middle"); err == nil {
+		t.Error("expected an invalid position to be rejected")
+	}
+
+	mgr.Start()
+	defer mgr.Stop()
+	waitForStatus(t, mgr, last, StatusProcessing)
+	mgr.mu.RLock()
+	for _, job := range queued[:len(queued)-1] {
+		if job.Status != StatusPending {
+			t.Errorf("expected moved job to start before %s, which is %s", job.ID, job.Status)
+		}
+	}
+	mgr.mu.RUnlock()
+	if _, err := mgr.MoveJob(last.ID, MoveTop); err == nil {
+		t.Error("expected a running job to be rejected")
+	}
+}
+
+func TestManager_OutputCollision(t *testing.T) {
+	mgr, _ := NewManager(&config.Config{MaxConcurrentJobs: 1}, nil, "")
+
+	first := &Job{ID: "first", Type: JobTypeOptimize, SourcePath: "/media/Movie.mkv", DestinationPath: "/out/Movie_optimized.mkv", Status: StatusPending}
+	second := &Job{ID: "second", Type: JobTypeOptimize, SourcePath: "/media/Movie.mp4", DestinationPath: "/out/Movie_optimized.mkv", Status: StatusPending}
+	disc := &Job{ID: "disc", Type: JobTypeExtract, SourcePath: "/media/Movie.iso", DestinationPath: "/out/Movie", Status: StatusPending}
+	folder := &Job{ID: "folder", Type: JobTypeExtract, SourcePath: "/media/Movie.img", DestinationPath: "/out/Movie/", Status: StatusPending}
+	for _, job := range []*Job{first, second, disc, folder} {
+		mgr.AddJob(job)
+	}
+
+	if first.DestinationPath != "/out/Movie_optimized.mkv" || len(first.Warnings) != 0 {
+		t.Errorf("expected the first job to keep its output, got %s %v", first.DestinationPath, first.Warnings)
+	}
+	if second.DestinationPath != "/out/Movie_optimized_2.mkv" || len(second.Warnings) != 1 {
+		t.Errorf("expected the second job to be renamed with a warning, got %s %v", second.DestinationPath, second.Warnings)
+	}
+	if folder.DestinationPath != "/out/Movie_2" {
+		t.Errorf("expected the extract directory to be numbered as a whole, got %s", folder.DestinationPath)
+	}
+	if !mgr.IsOutputActive("/out/Movie_optimized_2.mkv") {
+		t.Error("expected the renamed output to be active")
+	}
+
+	// Finished jobs free their output
+	first.Status = StatusCompleted
+	if mgr.IsOutputActive("/out/Movie_optimized.mkv") {
+		t.Error("expected a completed job's output to be free")
+	}
+}
+
+func TestManager_QueueFull(t *testing.T) {
+	mgr, _ := NewManager(&config.Config{MaxConcurrentJobs: 1, MaxQueuedJobs: 3}, nil, "")
+
+	for i := 0; i < 3; i++ {
+		if err := mgr.AddJob(&Job{ID: fmt.Sprintf("job-%d", i), Type: JobTypeTest, Status: StatusPending}); err != nil {
+			t.Fatalf("AddJob %d failed: %v", i, err)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- mgr.AddJob(&Job{ID: "overflow", Type: JobTypeTest, Status: StatusPending}) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrQueueFull) {
+			t.Errorf("expected ErrQueueFull, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("AddJob blocked on a full queue")
+	}
+	if mgr.GetJob("overflow") != nil {
+		t.Error("expected the refused job not to be registered")
+	}
+
+	// A started job frees a slot
+	if started := mgr.claimNext(); started == nil {
+		t.Fatal("expected a pending job to be claimed")
+	}
+	if err := mgr.AddJob(&Job{ID: "next", Type: JobTypeTest, Status: StatusPending}); err != nil {
+		t.Errorf("expected room once a job started, got %v", err)
+	}
+}
+
+func TestManager_PruneJobs(t *testing.T) {
+	mgr, _ := NewManager(&config.Config{MaxConcurrentJobs: 1, JobRetentionDays: 7, MaxStoredJobs: 3}, nil, "")
+
+	now := time.Now()
+	old := now.AddDate(0, 0, -30)
+	for _, job := range []*Job{
+		{ID: "old-completed", Status: StatusCompleted, CreatedAt: old, CompletedAt: old},
+		{ID: "old-test", Type: JobTypeTest, Status: StatusCompleted, CreatedAt: old, CompletedAt: old},
+		{ID: "old-cancelled", Status: StatusCancelled, CreatedAt: old},
+		{ID: "old-pending", Status: StatusPending, CreatedAt: old},
+		{ID: "old-processing", Status: StatusProcessing, CreatedAt: old, StartedAt: old},
+		{ID: "recent-failed", Status: StatusFailed, CreatedAt: now.AddDate(0, 0, -3), CompletedAt: now.AddDate(0, 0, -3)},
+		{ID: "recent-completed", Status: StatusCompleted, CreatedAt: now.AddDate(0, 0, -1), CompletedAt: now.AddDate(0, 0, -1)},
+	} {
+		mgr.jobs[job.ID] = job
+	}
+
+	// Three jobs are past retention, then the cap of 3 drops the oldest remaining finished job
+	if removed := mgr.PruneJobs(now); removed != 4 {
+		t.Errorf("expected 4 jobs pruned, got %d", removed)
+	}
+
+	for _, id := range []string{"old-pending", "old-processing", "recent-completed"} {
+		if mgr.GetJob(id) == nil {
+			t.Errorf("expected %s to be kept", id)
+		}
+	}
+	for _, id := range []string{"old-completed", "old-test", "old-cancelled", "recent-failed"} {
+		if mgr.GetJob(id) != nil {
+			t.Errorf("expected %s to be pruned", id)
+		}
+	}
+
+	// Disabled policy prunes nothing
+	mgr.config.JobRetentionDays, mgr.config.MaxStoredJobs = 0, 0
+	mgr.jobs["old-completed"] = &Job{ID: "old-completed", Status: StatusCompleted, CreatedAt: old, CompletedAt: old}
+	if removed := mgr.PruneJobs(now); removed != 0 {
+		t.Errorf("expected nothing pruned with retention disabled, got %d", removed)
+	}
+}
+
+func TestManager_ReloadConfig(t *testing.T) {
+	t.Setenv("GPU_VENDOR", "cpu")
+	t.Setenv("CRF", "23")
+	t.Setenv("AI_PROVIDER", "none")
+	cfg := config.Load()
+	mgr, _ := NewManager(cfg, nil, "")
+
+	if changed := mgr.ReloadConfig(); len(changed) != 0 {
+		t.Errorf("expected no changes, got %v", changed)
+	}
+
+	t.Setenv("CRF", "30")
+	t.Setenv("AI_PROVIDER", "ollama")
+	changed := mgr.ReloadConfig()
+
+	want := map[string]bool{"crf": true, "aiProvider": true}
+	if len(changed) != len(want) {
+		t.Errorf("expected changes %v, got %v", want, changed)
+	}
+	for _, name := range changed {
+		if !want[name] {
+			t.Errorf("unexpected change %s", name)
+		}
+	}
+
+	if cfg.CRF != 30 || cfg.AIProvider != "ollama" {
+		t.Errorf("expected reloaded CRF 30 and provider ollama, got %d and %s", cfg.CRF, cfg.AIProvider)
+	}
+	if mgr.GetAI() == nil || mgr.GetAI().GetName() != "ollama" {
+		t.Errorf("expected AI provider to be re-initialized, got %v", mgr.GetAI())
+	}
+}
+
+// Run with -race: settings changes from the API must not race with job workers
+func TestManager_ConfigConcurrentAccess(t *testing.T) {
+	cfg := &config.Config{MaxConcurrentJobs: 1, CRF: 23, AudioCodec: "copy", Container: "mkv"}
+	mgr, _ := NewManager(cfg, nil, "")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			cfg.Lock()
+			cfg.CRF = 18 + i%10
+			cfg.AudioCodec = config.AudioCodecs[i%len(config.AudioCodecs)]
+			cfg.MaxBitrate = fmt.Sprintf("%dM", i%20)
+			cfg.IsPremium = i%2 == 0
+			cfg.Unlock()
+		}
+	}()
+
+	job := &Job{ID: "race", Type: JobTypeOptimize, SourcePath: "/in/a.mkv", DestinationPath: "/out/a.mkv"}
+	for i := 0; i < 1000; i++ {
+		opts := mgr.buildTranscodeOptions(job, 60, 23)
+		if opts.AudioCodec == "" {
+			t.Fatal("expected an audio codec")
+		}
+		mgr.PruneJobs(time.Now())
+	}
+	<-done
+}
+
+func TestAlreadyEfficient(t *testing.T) {
+	tests := []struct {
+		name string
+		info *media.MediaInfo
+		want bool
+	}{
+		{"hevc at low bitrate", &media.MediaInfo{VideoCodec: "hevc", BitRate: 4_500_000}, true},
+		{"hevc bitrate from size", &media.MediaInfo{VideoCodec: "hevc", Size: 1_800_000_000, Duration: 3600}, true},
+		{"hevc at high bitrate", &media.MediaInfo{VideoCodec: "hevc", BitRate: 25_000_000}, false},
+		{"h264 at low bitrate", &media.MediaInfo{VideoCodec: "h264", BitRate: 4_500_000}, false},
+		{"hevc with unknown bitrate", &media.MediaInfo{VideoCodec: "hevc"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := alreadyEfficient(tt.info, 8000)
+			if got != tt.want {
+				t.Errorf("alreadyEfficient() = %v, want %v", got, tt.want)
+			}
+			if got && !strings.Contains(reason, "hevc") {
+				t.Errorf("expected reason to name the codec, got %q", reason)
+			}
+		})
+	}
+
+	if got, _ := alreadyEfficient(&media.MediaInfo{VideoCodec: "hevc", BitRate: 4_500_000}, 0); got {
+		t.Error("expected no skip with a zero threshold")
+	}
+}
+
+func TestPrepareEncodingVideoCopyIfCompliant(t *testing.T) {
+	cfg := &config.Config{GPUVendor: "nvidia", QualityPreset: "medium", CRF: 23, AudioCodec: "aac", Container: "mkv", EfficientMaxBitrateKbps: 8000}
+	mgr := &Manager{config: cfg}
+	compliant := &media.MediaInfo{Duration: 60, VideoCodec: "av1", BitRate: 4_500_000, Height: 1080}
+
+	job := &Job{ID: "copy", SourcePath: "/media/movie.mkv", DestinationPath: "/output/movie.mkv", VideoCopy: true, ctx: context.Background()}
+	opts := mgr.prepareEncoding(job, compliant, cfg)
+	if !opts.CopyVideo || !job.Encoding.VideoCopied || job.Encoding.VideoCodec != "av1" {
+		t.Fatalf("expected compliant video to be copied, got %+v", job.Encoding)
+	}
+	if opts.AudioCodec != "aac" {
+		t.Errorf("expected audio to still be re-encoded, got %q", opts.AudioCodec)
+	}
+
+	tests := []struct {
+		name string
+		job  *Job
+		info *media.MediaInfo
+	}{
+		{"option off", &Job{SourcePath: "/media/movie.mkv", DestinationPath: "/output/movie.mkv"}, compliant},
+		{"h264 source", &Job{SourcePath: "/media/movie.mkv", DestinationPath: "/output/movie.mkv", VideoCopy: true}, &media.MediaInfo{VideoCodec: "h264", BitRate: 4_500_000}},
+		{"high bitrate", &Job{SourcePath: "/media/movie.mkv", DestinationPath: "/output/movie.mkv", VideoCopy: true}, &media.MediaInfo{VideoCodec: "hevc", BitRate: 25_000_000}},
+		{"other container", &Job{SourcePath: "/media/movie.mp4", DestinationPath: "/output/movie.mp4", VideoCopy: true}, compliant},
+		{"downscaled", &Job{SourcePath: "/media/movie.mkv", DestinationPath: "/output/movie.mkv", VideoCopy: true, MaxResolution: "720p"}, compliant},
+	}
+	for _, tt := range tests {
+		tt.job.ctx = context.Background()
+		if opts := mgr.prepareEncoding(tt.job, tt.info, cfg); opts.CopyVideo || tt.job.Encoding.VideoCopied {
+			t.Errorf("%s: expected the video to be re-encoded", tt.name)
+		}
+	}
+}
+
+func TestApplyOutputPermissions(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "movie.mkv")
+	if err := os.WriteFile(output, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr := &Manager{config: &config.Config{OutputFileMode: "0660"}}
+	mgr.applyOutputPermissions(&Job{ID: "perm", Type: JobTypeOptimize, DestinationPath: output})
+
+	info, err := os.Stat(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0660 {
+		t.Errorf("expected mode 0660, got %o", info.Mode().Perm())
+	}
+
+	// Extraction directories get search permission wherever read is granted
+	extractDir := filepath.Join(dir, "disc")
+	title := filepath.Join(extractDir, "title.mkv")
+	if err := os.MkdirAll(extractDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(title, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mgr.config.OutputFileMode = "0664"
+	mgr.applyOutputPermissions(&Job{ID: "perm2", Type: JobTypeExtract, DestinationPath: extractDir, OutputFiles: []string{title}})
+
+	if info, _ := os.Stat(extractDir); info.Mode().Perm() != 0775 {
+		t.Errorf("expected directory mode 0775, got %o", info.Mode().Perm())
+	}
+	if info, _ := os.Stat(title); info.Mode().Perm() != 0664 {
+		t.Errorf("expected title mode 0664, got %o", info.Mode().Perm())
+	}
+
+	// Unset leaves the mode as written
+	mgr.config.OutputFileMode = ""
+	os.Chmod(output, 0600)
+	mgr.applyOutputPermissions(&Job{ID: "perm3", Type: JobTypeOptimize, DestinationPath: output})
+	if info, _ := os.Stat(output); info.Mode().Perm() != 0600 {
+		t.Errorf("expected mode to be left alone, got %o", info.Mode().Perm())
+	}
+}
+
+func TestCheckSourceDuration(t *testing.T) {
+	short := &media.MediaInfo{Duration: 5}
+	if reason, err := checkSourceDuration(short, 60, false); err != nil || !strings.Contains(reason, "under the 60s minimum") {
+		t.Errorf("expected short source to be skipped, got %q, %v", reason, err)
+	}
+	if reason, err := checkSourceDuration(short, 0, false); err != nil || reason != "" {
+		t.Errorf("expected no minimum when disabled, got %q, %v", reason, err)
+	}
+	if reason, err := checkSourceDuration(&media.MediaInfo{Duration: 5400}, 60, false); err != nil || reason != "" {
+		t.Errorf("expected feature-length source to pass, got %q, %v", reason, err)
+	}
+
+	zero := &media.MediaInfo{Duration: 0}
+	if _, err := checkSourceDuration(zero, 60, false); err == nil || !strings.Contains(err.Error(), "allowUnknownDuration") {
+		t.Errorf("expected zero duration to fail with the override hint, got %v", err)
+	}
+	if reason, err := checkSourceDuration(zero, 60, true); err != nil || reason != "" {
+		t.Errorf("expected override to allow unknown duration, got %q, %v", reason, err)
+	}
+}
+
+func TestExternalSubtitle(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "movie.mkv")
+	sibling := filepath.Join(dir, "movie.fr.srt")
+	if err := os.WriteFile(sibling, []byte("1\n00:00:01,000 --> 00:00:02,000\nBonjour\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if path, lang := externalSubtitle(&Job{SourcePath: source, AttachSubtitles: true}); path != sibling || lang != "fre" {
+		t.Errorf("expected sibling %s in fre, got %s (%s)", sibling, path, lang)
+	}
+
+	// An explicit path wins and takes the job's language
+	explicit := filepath.Join(dir, "subs", "custom.srt")
+	if path, lang := externalSubtitle(&Job{SourcePath: source, SubtitlePath: explicit, SubtitleLanguage: "de"}); path != explicit || lang != "ger" {
+		t.Errorf("expected explicit %s in ger, got %s (%s)", explicit, path, lang)
+	}
+
+	if path, _ := externalSubtitle(&Job{SourcePath: filepath.Join(dir, "other.mkv")}); path != "" {
+		t.Errorf("expected no subtitle, got %s", path)
+	}
+}
+
+func TestLoadJobsFileFormats(t *testing.T) {
+	load := func(contents string) *Manager {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "jobs.json")
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mgr, err := NewManager(&config.Config{MaxConcurrentJobs: 1}, nil, path)
+		if err != nil {
+			t.Fatalf("failed to load jobs: %v", err)
+		}
+		return mgr
+	}
+
+	// Version 0 is a bare array; a broken entry is skipped, not the whole file
+	legacy := load(`[
+		{"id": "a", "type": "optimize", "status": "completed"},
+		{"id": 42, "type": "optimize"},
+		{"id": "b", "type": "optimize", "status": "failed"}
+	]`)
+	if len(legacy.GetAllJobs()) != 2 || legacy.GetJob("a") == nil || legacy.GetJob("b") == nil {
+		t.Errorf("expected jobs a and b from the legacy file, got %d jobs", len(legacy.GetAllJobs()))
+	}
+
+	versioned := load(`{"version": 1, "jobs": [
+		{"id": "c", "type": "optimize", "status": "completed", "futureField": {"x": 1}}
+	]}`)
+	job := versioned.GetJob("c")
+	if job == nil {
+		t.Fatal("expected job c from the versioned file")
+	}
+
+	// Saving writes the current version and keeps fields this version doesn't know
+	if err := versioned.Save(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(versioned.JobsFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"version": 1`) || !strings.Contains(string(data), `"futureField"`) {
+		t.Errorf("expected a versioned file keeping unknown fields, got %s", data)
+	}
+
+	if _, err := decodeJobsFile([]byte(`{not json`)); err == nil {
+		t.Error("expected an unreadable file to fail")
+	}
+}
+
+func TestSaveJobsFileAtomically(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "jobs.json")
+	first, _ := encodeJobsFile([]*Job{{ID: "first", Type: JobTypeTest, Status: StatusCompleted}})
+	second, _ := encodeJobsFile([]*Job{
+		{ID: "first", Type: JobTypeTest, Status: StatusCompleted},
+		{ID: "second", Type: JobTypeTest, Status: StatusCompleted},
+	})
+	for _, data := range [][]byte{first, second} {
+		if err := system.WriteFileAtomic(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the file and the previous version remain, no temp files
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("expected jobs.json and its backup, found %d entries", len(entries))
+	}
+	current, err := decodeJobsFileAt(path)
+	if err != nil || len(current) != 2 {
+		t.Errorf("expected 2 jobs in the file, got %d (%v)", len(current), err)
+	}
+	backup, err := decodeJobsFileAt(path + system.BackupSuffix)
+	if err != nil || len(backup) != 1 || backup[0].ID != "first" {
+		t.Errorf("expected the backup to hold the previous save, got %d jobs (%v)", len(backup), err)
+	}
+}
+
+func TestLoadJobsFileFromBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	backup, _ := encodeJobsFile([]*Job{{ID: "saved", Type: JobTypeTest, Status: StatusCompleted}})
+	if err := os.WriteFile(path+system.BackupSuffix, backup, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A write cut short by a crash
+	if err := os.WriteFile(path, []byte(`{"version": 1, "jobs": [{"id": "sav`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	mgr, _ := NewManager(&config.Config{MaxConcurrentJobs: 1}, nil, path)
+	if mgr.GetJob("saved") == nil || len(mgr.GetAllJobs()) != 1 {
+		t.Errorf("expected the job from the backup, got %d jobs", len(mgr.GetAllJobs()))
+	}
+
+	// Without a backup a corrupt file still fails to load
+	os.Remove(path + system.BackupSuffix)
+	if _, err := readJobsFile(path); err == nil {
+		t.Error("expected a corrupt file without a backup to fail")
+	}
+}
+
+func decodeJobsFileAt(path string) ([]*Job, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJobsFile(data)
+}
+
+func TestWriteNFO(t *testing.T) {
+	dir := t.TempDir()
+	mgr, _ := NewManager(&config.Config{MaxConcurrentJobs: 1, WriteNFO: true}, nil, "")
+
+	job := &Job{
+		ID:              "nfo",
+		Type:            JobTypeOptimize,
+		SourcePath:      "/storage/The.Matrix.1999.1080p.BluRay.x264.mkv",
+		DestinationPath: filepath.Join(dir, "The Matrix (1999).mkv"),
+		AICleaned:       true,
+		CleanTitle:      "The Matrix (1999)",
+	}
+	mgr.writeNFO(job)
+
+	data, err := os.ReadFile(filepath.Join(dir, "The Matrix (1999).nfo"))
+	if err != nil {
+		t.Fatalf("expected an NFO next to the output: %v", err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<movie>
+  <title>The Matrix</title>
+  <year>1999</year>
+  <originalfilename>The.Matrix.1999.1080p.BluRay.x264.mkv</originalfilename>
+</movie>
+`
+	if string(data) != want {
+		t.Errorf("unexpected NFO:\n%s\nwant:\n%s", data, want)
+	}
+	if job.NFOPath != filepath.Join(dir, "The Matrix (1999).nfo") {
+		t.Errorf("expected the NFO path to be recorded, got %q", job.NFOPath)
+	}
+
+	// Titles are escaped, and there's nothing to write without AI cleaning
+	job = &Job{ID: "escape", Type: JobTypeOptimize, DestinationPath: filepath.Join(dir, "tom.mkv"), AICleaned: true, CleanTitle: "Tom & Jerry <Uncut>"}
+	mgr.writeNFO(job)
+	if data, _ := os.ReadFile(filepath.Join(dir, "tom.nfo")); !strings.Contains(string(data), "<title>Tom &amp; Jerry &lt;Uncut&gt;</title>") || strings.Contains(string(data), "<year>") {
+		t.Errorf("expected an escaped title without a year, got:\n%s", data)
+	}
+	job = &Job{ID: "plain", Type: JobTypeOptimize, DestinationPath: filepath.Join(dir, "plain.mkv")}
+	mgr.writeNFO(job)
+	if _, err := os.Stat(filepath.Join(dir, "plain.nfo")); !os.IsNotExist(err) || job.NFOPath != "" {
+		t.Error("expected no NFO without AI cleaning")
+	}
+}
+
+func TestSaveProgressThrottled(t *testing.T) {
+	cfg := &config.Config{MaxConcurrentJobs: 1, ProgressSaveIntervalSec: 5}
+	mgr, _ := NewManager(cfg, nil, filepath.Join(t.TempDir(), "jobs.json"))
+
+	// Status changes always save, progress right after them doesn't
+	mgr.AddJob(&Job{ID: "job", Type: JobTypeTest, Status: StatusPending})
+	saves := 0
+	for i := 0; i < 1000; i++ {
+		if mgr.saveProgress(mgr.GetJob("job")) {
+			saves++
+		}
+	}
+	if saves != 0 {
+		t.Errorf("expected no progress saves within the interval of a status save, got %d", saves)
+	}
+
+	// Once the interval has passed a single tick saves, the following ones wait again
+	mgr.saveMu.Lock()
+	mgr.lastSave = time.Now().Add(-6 * time.Second)
+	mgr.saveMu.Unlock()
+	for i := 0; i < 1000; i++ {
+		if mgr.saveProgress(mgr.GetJob("job")) {
+			saves++
+		}
+	}
+	if saves != 1 {
+		t.Errorf("expected 1 progress save after the interval, got %d", saves)
+	}
+
+	cfg.ProgressSaveIntervalSec = 0
+	if !mgr.saveProgress(mgr.GetJob("job")) || !mgr.saveProgress(mgr.GetJob("job")) {
+		t.Error("expected every update to save with no interval")
+	}
+}
+
+func TestDropPremiumFeatures(t *testing.T) {
+	job := &Job{ID: "scanned", Upscale: true, Resolution: "4k", CreateSubtitles: true}
+	dropPremiumFeatures(job, &config.Config{IsPremium: true})
+	if !job.Upscale || !job.CreateSubtitles {
+		t.Error("expected premium options to be kept with a license")
+	}
+
+	dropPremiumFeatures(job, &config.Config{})
+	if job.Upscale || job.CreateSubtitles {
+		t.Error("expected premium options to be cleared without a license")
+	}
+	if len(job.PremiumFeatures()) != 0 {
+		t.Errorf("expected no premium features left, got %v", job.PremiumFeatures())
+	}
+}
+
+// memStore is a Store keeping the last saved jobs in memory
+type memStore struct {
+	saved []*Job
+	saves int
+}
+
+func (s *memStore) LoadJobs() ([]*Job, error) { return s.saved, nil }
+
+func (s *memStore) SaveJobs(jobList []*Job) error {
+	s.saved = append([]*Job(nil), jobList...)
+	s.saves++
+	return nil
+}
+
+func TestManagerWithStore(t *testing.T) {
+	store := &memStore{}
+	mgr, _ := NewManagerWithStore(&config.Config{MaxConcurrentJobs: 1}, nil, store)
+	mgr.AddJob(&Job{ID: "queued", Type: JobTypeTest, Status: StatusPending})
+	mgr.AddJob(&Job{ID: "running", Type: JobTypeTest, Status: StatusPending})
+	mgr.GetJob("running").Status = StatusProcessing
+	if err := mgr.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.saved) != 2 || store.saves != 3 {
+		t.Errorf("expected every change saved to the store, got %d jobs in %d saves", len(store.saved), store.saves)
+	}
+	if mgr.JobsFilePath() != "" {
+		t.Errorf("expected no jobs file for a custom store, got %s", mgr.JobsFilePath())
+	}
+
+	// A new manager picks the jobs up again, interrupted ones as pending
+	reloaded, _ := NewManagerWithStore(&config.Config{MaxConcurrentJobs: 1}, nil, store)
+	if job := reloaded.GetJob("running"); job == nil || job.Status != StatusPending {
+		t.Errorf("expected the running job back as pending, got %+v", job)
+	}
+	if reloaded.GetJob("queued") == nil {
+		t.Error("expected the queued job to be loaded")
+	}
+}
+
+// totalChanges is the number of rows written on the (single) connection so far
+func totalChanges(t *testing.T, db *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT total_changes()`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestSQLiteStore(t *testing.T) {
+	db, err := database.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	store, err := NewSQLiteStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	mgr, _ := NewManagerWithStore(&config.Config{MaxConcurrentJobs: 1}, nil, store)
+	mgr.AddJob(&Job{ID: "first", Type: JobTypeOptimize, SourcePath: "/media/a.mkv", Status: StatusPending, CreatedAt: now})
+	mgr.AddJob(&Job{ID: "second", Type: JobTypeTest, SourcePath: "/media/b.mkv", Status: StatusPending, CreatedAt: now.Add(time.Second)})
+	mgr.AddJob(&Job{ID: "third", Type: JobTypeTest, SourcePath: "/media/c.mkv", Status: StatusPending, CreatedAt: now.Add(2 * time.Second),
+		unknownFields: map[string]json.RawMessage{"futureField": json.RawMessage(`"kept"`)}})
+
+	// An update to one job writes only that job, full saves only the changed ones
+	before := totalChanges(t, db)
+	second := mgr.GetJob("second")
+	second.Status = StatusCompleted
+	second.CompletedAt = now
+	if err := mgr.saveJob(second); err != nil {
+		t.Fatal(err)
+	}
+	if changes := totalChanges(t, db) - before; changes != 1 {
+		t.Errorf("expected one row written for one changed job, got %d", changes)
+	}
+	mgr.GetJob("third").Progress = 50
+	before = totalChanges(t, db)
+	if err := mgr.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if changes := totalChanges(t, db) - before; changes != 1 {
+		t.Errorf("expected one row written by a full save, got %d", changes)
+	}
+	before = totalChanges(t, db)
+	if err := mgr.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if changes := totalChanges(t, db) - before; changes != 0 {
+		t.Errorf("expected nothing written without changes, got %d", changes)
+	}
+
+	// Deleted jobs are removed from the table
+	mgr.mu.Lock()
+	delete(mgr.jobs, "first")
+	mgr.mu.Unlock()
+	if err := mgr.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := NewSQLiteStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jobList, err := reopened.LoadJobs()
+	if err != nil {
+		t.Fatalf("LoadJobs failed: %v", err)
+	}
+	if len(jobList) != 2 || jobList[0].ID != "second" || jobList[1].ID != "third" {
+		t.Fatalf("expected second and third oldest first, got %v", jobList)
+	}
+	if jobList[0].Status != StatusCompleted || !jobList[0].CompletedAt.Equal(now) {
+		t.Errorf("expected the update to round-trip, got %s at %v", jobList[0].Status, jobList[0].CompletedAt)
+	}
+	if string(jobList[1].unknownFields["futureField"]) != `"kept"` {
+		t.Errorf("expected unknown fields to be kept, got %v", jobList[1].unknownFields)
+	}
+}
+
+func TestManager_PreserveMTime(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "movie.mkv")
+	iso := filepath.Join(dir, "disc.iso")
+	output := filepath.Join(dir, "movie_optimized.mkv")
+	for _, path := range []string{source, iso, output} {
+		if err := os.WriteFile(path, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sourceTime := time.Date(2019, 5, 1, 12, 0, 0, 0, time.UTC)
+	isoTime := time.Date(2015, 1, 2, 3, 4, 5, 0, time.UTC)
+	os.Chtimes(source, sourceTime, sourceTime)
+	os.Chtimes(iso, isoTime, isoTime)
+
+	cfg := &config.Config{MaxConcurrentJobs: 1}
+	mgr, _ := NewManager(cfg, nil, "")
+	mtime := func() time.Time {
+		info, err := os.Stat(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.ModTime()
+	}
+
+	// Off unless the job or the config asks for it
+	job := &Job{ID: "mtime", Type: JobTypeOptimize, SourcePath: source, DestinationPath: output}
+	mgr.preserveMTime(job)
+	if mtime().Equal(sourceTime) {
+		t.Fatal("expected the output's modification time to be left alone")
+	}
+
+	job.PreserveMTime = true
+	mgr.preserveMTime(job)
+	if !mtime().Equal(sourceTime) {
+		t.Errorf("expected the source's modification time %v, got %v", sourceTime, mtime())
+	}
+
+	// Rips take the disc image's time, here through the config option
+	job.PreserveMTime = false
+	cfg.PreserveMTime = true
+	job.OriginalSourcePath = iso
+	mgr.preserveMTime(job)
+	if !mtime().Equal(isoTime) {
+		t.Errorf("expected the disc image's modification time %v, got %v", isoTime, mtime())
+	}
+}
+
+func TestSamePath(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "movie.mkv")
+	if err := os.WriteFile(source, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	linkedDir := filepath.Join(t.TempDir(), "linked")
+	if err := os.Symlink(dir, linkedDir); err != nil {
+		t.Fatal(err)
+	}
+	hardLink := filepath.Join(dir, "hard.mkv")
+	if err := os.Link(source, hardLink); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "other.mkv")
+	os.WriteFile(other, []byte("x"), 0644)
+
+	for _, tt := range []struct {
+		path string
+		same bool
+	}{
+		{source, true},
+		{filepath.Join(dir, ".", "x", "..", "movie.mkv"), true},
+		{filepath.Join(linkedDir, "movie.mkv"), true},
+		{hardLink, true},
+		{other, false},
+		{filepath.Join(linkedDir, "movie_optimized.mkv"), false},
+		{"", false},
+	} {
+		if got := SamePath(source, tt.path); got != tt.same {
+			t.Errorf("SamePath(%q, %q) = %v, expected %v", source, tt.path, got, tt.same)
+		}
+	}
+
+	// A new file is compared through its directory
+	if !SamePath(filepath.Join(dir, "new.mkv"), filepath.Join(linkedDir, "new.mkv")) {
+		t.Error("expected a new file to match through a symlinked directory")
+	}
 }
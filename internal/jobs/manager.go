@@ -3,7 +3,9 @@ package jobs
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -16,7 +18,9 @@ import (
 	"github.com/Vasteva/MediaConverter/internal/ai/meta"
 	"github.com/Vasteva/MediaConverter/internal/ai/whisper"
 	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/events"
 	"github.com/Vasteva/MediaConverter/internal/media"
+	"github.com/Vasteva/MediaConverter/internal/system"
 )
 
 type Status string
@@ -37,39 +41,127 @@ const (
 	JobTypeTest     JobType = "test"
 )
 
+// EncodingSettings are the effective options an optimize job was encoded with, after
+// job overrides and AI adjustment
+type EncodingSettings struct {
+	VideoCodec      string   `json:"videoCodec"`
+	GPUVendor       string   `json:"gpuVendor"`
+	GPUDevice       string   `json:"gpuDevice,omitempty"`
+	Preset          string   `json:"preset"`
+	CRF             int      `json:"crf"`
+	AIAdjustedCRF   bool     `json:"aiAdjustedCrf"` // CRF was suggested by the AI rather than the config
+	AudioCodec      string   `json:"audioCodec"`
+	AudioBitrate    string   `json:"audioBitrate,omitempty"`
+	Container       string   `json:"container,omitempty"`
+	MaxBitrate      string   `json:"maxBitrate,omitempty"`
+	BufSize         string   `json:"bufSize,omitempty"`
+	NormalizeAudio  bool     `json:"normalizeAudio"`
+	StreamSelection string   `json:"streamSelection,omitempty"`
+	Languages       []string `json:"languages,omitempty"`
+	Resolution      string   `json:"resolution,omitempty"`    // Upscale target, when upscaling
+	MaxResolution   string   `json:"maxResolution,omitempty"` // Resolution cap, when the source was downscaled
+	HybridHWDecode  bool     `json:"hybridHwDecode"`          // GPU decode feeding a libx265 encode
+	VideoCopied     bool     `json:"videoCopied"`             // Compliant video was stream copied, VideoCodec is the source's
+}
+
 type Job struct {
-	ID              string    `json:"id"`
-	Type            JobType   `json:"type"`
-	SourcePath      string    `json:"sourcePath"`
-	DestinationPath string    `json:"destinationPath"`
-	Status          Status    `json:"status"`
-	StatusDetail    string    `json:"statusDetail,omitempty"`
-	Progress        int       `json:"progress"`
-	ETA             string    `json:"eta"`
-	FPS             float64   `json:"fps"`
-	Priority        int       `json:"priority"`
-	CreatedAt       time.Time `json:"createdAt"`
-	StartedAt       time.Time `json:"startedAt,omitempty"`
-	CompletedAt     time.Time `json:"completedAt,omitempty"`
-	Error           string    `json:"error,omitempty"`
-	CreateSubtitles bool      `json:"createSubtitles"` // Premium feature
-	Upscale         bool      `json:"upscale"`         // Premium feature
-	Resolution      string    `json:"resolution"`      // Premium feature
-	InputSize       int64     `json:"inputSize"`
-	OutputSize      int64     `json:"outputSize"`
-	AICleaned       bool      `json:"aiCleaned"`
-	AISubtitles     bool      `json:"aiSubtitles"`
+	ID               string    `json:"id"`
+	Type             JobType   `json:"type"`
+	SourcePath       string    `json:"sourcePath"`
+	DestinationPath  string    `json:"destinationPath"`
+	Status           Status    `json:"status"`
+	StatusDetail     string    `json:"statusDetail,omitempty"`
+	Progress         int       `json:"progress"`
+	ETA              string    `json:"eta"`
+	FPS              float64   `json:"fps"`
+	Priority         int       `json:"priority"`
+	CreatedAt        time.Time `json:"createdAt"`
+	StartedAt        time.Time `json:"startedAt,omitempty"`
+	CompletedAt      time.Time `json:"completedAt,omitempty"`
+	Error            string    `json:"error,omitempty"`
+	CreateSubtitles  bool      `json:"createSubtitles"`         // Premium feature
+	Upscale          bool      `json:"upscale"`                 // Premium feature
+	Resolution       string    `json:"resolution"`              // Premium feature
+	MaxResolution    string    `json:"maxResolution,omitempty"` // Downscale sources taller than this, e.g. "1080p"
+	InputSize        int64     `json:"inputSize"`
+	OutputSize       int64     `json:"outputSize"`
+	AICleaned        bool      `json:"aiCleaned"`
+	CleanTitle       string    `json:"cleanTitle,omitempty"` // "Title (Year)" from AI filename cleaning
+	WriteNFO         bool      `json:"writeNfo"`             // Write a .nfo with the cleaned title next to the output
+	NFOPath          string    `json:"nfoPath,omitempty"`    // The .nfo written
+	PreserveMTime    bool      `json:"preserveMtime"`        // Give outputs the source's modification time
+	AISubtitles      bool      `json:"aiSubtitles"`
+	KeepRip          bool      `json:"keepRip"`                    // Keep the intermediate MKV from disc images
+	RipPath          string    `json:"ripPath,omitempty"`          // Where the kept rip was moved
+	MinLength        int       `json:"minLength,omitempty"`        // Extract: all titles at least this long (seconds)
+	MaxTitles        int       `json:"maxTitles,omitempty"`        // Extract: only the N longest titles, one numbered output each
+	MakeMKVProfile   string    `json:"makemkvProfile,omitempty"`   // Extract: MakeMKV conversion profile, overrides the configured one
+	OutputFiles      []string  `json:"outputFiles,omitempty"`      // Extract: final paths of extracted titles
+	EmbedSubtitles   bool      `json:"embedSubtitles"`             // Mux generated subtitles into the output
+	KeepSidecarSRT   bool      `json:"keepSidecarSrt"`             // Keep the .srt next to the output after embedding
+	SubtitleLanguage string    `json:"subtitleLanguage,omitempty"` // Requested or detected subtitle language
+	NormalizeAudio   bool      `json:"normalizeAudio"`             // EBU R128 loudness normalization
+	LoudnormTwoPass  bool      `json:"loudnormTwoPass"`            // Measure loudness first for a more accurate result
+	CRF              *int      `json:"crf,omitempty"`              // Overrides the configured and AI-suggested CRF, nil for the default
+	MaxBitrate       string    `json:"maxBitrate,omitempty"`       // Peak bitrate cap, overrides the config default
+	BufSize          string    `json:"bufSize,omitempty"`          // VBV buffer size, overrides the config default
+	Duration         float64   `json:"duration,omitempty"`         // Source media duration in seconds, once probed
+	ProgressUnknown  bool      `json:"progressUnknown,omitempty"`  // Duration unknown, progress is reported as FramesEncoded
+	FramesEncoded    int       `json:"framesEncoded,omitempty"`    // Frames encoded so far
+	AudioCodec       string    `json:"audioCodec,omitempty"`       // Overrides the configured audio codec
+	AudioBitrate     string    `json:"audioBitrate,omitempty"`     // Overrides the configured audio bitrate
+	Container        string    `json:"container,omitempty"`        // Overrides the configured container
+	StreamSelection  string    `json:"streamSelection,omitempty"`  // keep-all, keep-video-audio or keep-by-language
+	StreamLanguages  []string  `json:"streamLanguages,omitempty"`  // ISO 639-2 codes for keep-by-language
+	SkipEfficient    bool      `json:"skipIfAlreadyEfficient"`     // Skip sources already in the target codec at a low bitrate
+	VideoCopy        bool      `json:"videoCopyIfCompliant"`       // Copy compliant video instead of re-encoding, audio and streams are still processed
+	SkipReason       string    `json:"skipReason,omitempty"`       // Why the job completed without encoding
+	GenerateChapters bool      `json:"generateChapters"`           // Add chapters from scene detection when the source has none
+	ForceChapters    bool      `json:"forceChapters"`              // Replace existing chapters too
+	ChaptersAdded    int       `json:"chaptersAdded,omitempty"`    // Chapter markers generated
+	AllowNoDuration  bool      `json:"allowUnknownDuration"`       // Encode sources whose duration can't be determined
+	MaxDurationSec   int       `json:"maxDurationSec,omitempty"`   // Fail with a timeout after this long, overrides the config (0 uses it)
+	AttachSubtitles  bool      `json:"attachSubtitles"`            // Embed an existing .srt next to the source
+	SubtitlePath     string    `json:"subtitlePath,omitempty"`     // Explicit .srt to embed instead of looking for a sibling
+	ExternalSubs     bool      `json:"externalSubtitles"`          // An existing subtitle was embedded
+	Force            bool      `json:"force"`                      // Created past the duplicate and processed checks, never skipped as efficient
+	RemoteSource     bool      `json:"remoteSource"`               // SourcePath is a URL ffmpeg streams from, the output is local
+	Warnings         []string  `json:"warnings,omitempty"`         // Caveats about the requested settings, e.g. a codec players may not support
+	PostCommand      string    `json:"postCommand,omitempty"`      // Run after the job succeeds, overrides the configured post command
+
+	// Subtitle tracks to keep by language, overriding the configured subtitle languages
+	SubtitleLangs  []string `json:"subtitleLanguages,omitempty"`
+	KeepForcedSubs bool     `json:"keepForcedSubtitles"` // Also keep forced subtitles in other languages
+
+	// Power user ffmpeg options, see media.TranscodeOptions
+	CustomVideoFilters string   `json:"customVideoFilters,omitempty"`
+	CustomArgs         []string `json:"customArgs,omitempty"` // Only passed to ffmpeg with CUSTOM_FFMPEG_ARGS_ENABLED
+
+	// Encoding records the options the encode actually ran with, once known
+	Encoding *EncodingSettings `json:"encoding,omitempty"`
+
+	// OriginalSourcePath records the disc image an auto-extracted rip came from
+	OriginalSourcePath string `json:"originalSourcePath,omitempty"`
+
+	// Uploaded marks a source received by /api/upload, removed per UPLOAD_CLEANUP once done
+	Uploaded bool `json:"uploaded,omitempty"`
 
 	// Internal
-	ctx    context.Context
-	cancel context.CancelFunc
-	cmd    *exec.Cmd
+	ctx         context.Context
+	cancel      context.CancelFunc
+	cmd         *exec.Cmd
+	interrupted bool // Cancelled by shutdown, to be resumed on next start
+	probed      bool // Duration probe attempted, see probeLoop
+
+	// Persisted fields this version doesn't know, written back on save
+	unknownFields map[string]json.RawMessage
 }
 
 type Manager struct {
 	jobs          map[string]*Job
-	queue         chan *Job
+	queue         chan *Job // Wakes a worker per pending job, see claimNext
 	maxConcurrent int
+	maxQueued     int
 	mu            sync.RWMutex
 	wg            sync.WaitGroup
 	stopCh        chan struct{}
@@ -77,31 +169,66 @@ type Manager struct {
 	ffmpeg        *media.FFmpegWrapper
 	makemkv       *media.MakeMKVWrapper
 	ai            ai.Provider
+	aiLimit       *aiLimiter // Bounds the AI requests in flight across jobs
 	OnJobComplete func(*Job)
-	jobsFilePath  string
+	Events        *events.Log // Activity feed, nil disables events
+	store         Store       // Persisted jobs, nil disables persistence
+	saveMu        sync.Mutex  // Serializes writes of the jobs file and its backup
+	lastSave      time.Time   // When the jobs file was last written, guarded by saveMu
+	draining      bool
+	encodeSpeeds  []float64 // Recent encode speeds (media seconds per second), see recordEncodeSpeed
+
+	// Wakes probeLoop when jobs are added
+	probeWake chan struct{}
+
+	// Probed sizes and durations of pending sources, guarded by mu, see PendingSavings
+	probes map[string]sourceProbe
+
+	// Outcomes of recently finished jobs, guarded by mu, see FailureAlert
+	failures failureWindow
 }
 
+// NewManager creates a manager persisting jobs to a JSON file ("" disables persistence)
 func NewManager(cfg *config.Config, aiProvider ai.Provider, jobsFilePath string) (*Manager, error) {
-	ffmpeg, err := media.NewFFmpegWrapper()
+	var store Store
+	if jobsFilePath != "" {
+		store = &FileStore{Path: jobsFilePath}
+	}
+	return NewManagerWithStore(cfg, aiProvider, store)
+}
+
+// NewManagerWithStore creates a manager persisting jobs to store (nil disables persistence)
+func NewManagerWithStore(cfg *config.Config, aiProvider ai.Provider, store Store) (*Manager, error) {
+	ffmpeg, err := media.NewFFmpegWrapper(cfg.FFmpegPath, cfg.FFprobePath)
 	if err != nil {
 		log.Printf("Warning: FFmpeg not available: %v", err)
+	} else {
+		ffmpeg.ProbeTimeout = time.Duration(cfg.ProbeTimeoutSec) * time.Second
 	}
 
-	makemkv, err := media.NewMakeMKVWrapper()
+	makemkv, err := media.NewMakeMKVWrapper(cfg.MakeMKVPath)
 	if err != nil {
 		log.Printf("Warning: MakeMKV not available: %v", err)
 	}
 
+	maxQueued := cfg.MaxQueuedJobs
+	if maxQueued <= 0 {
+		maxQueued = DefaultMaxQueuedJobs
+	}
+
 	m := &Manager{
 		jobs:          make(map[string]*Job),
-		queue:         make(chan *Job, 1000),
+		queue:         make(chan *Job, maxQueued),
 		maxConcurrent: cfg.MaxConcurrentJobs,
+		maxQueued:     maxQueued,
 		stopCh:        make(chan struct{}),
+		probeWake:     make(chan struct{}, 1),
 		config:        cfg,
 		ffmpeg:        ffmpeg,
 		makemkv:       makemkv,
 		ai:            aiProvider,
-		jobsFilePath:  jobsFilePath,
+		aiLimit:       newAILimiter(cfg),
+		store:         store,
 	}
 
 	// Load existing jobs from disk
@@ -118,17 +245,89 @@ func (m *Manager) Start() {
 		m.wg.Add(1)
 		go m.worker(i)
 	}
+
+	m.wg.Add(1)
+	go m.retentionLoop()
+
+	m.wg.Add(1)
+	go m.probeLoop()
 }
 
+// Stop drains the manager: no new jobs are started, in-flight jobs get up to
+// ShutdownGraceSec to finish and are then cancelled and left pending for the next start.
 func (m *Manager) Stop() {
+	m.mu.Lock()
+	m.draining = true
+	m.mu.Unlock()
 	close(m.stopCh)
-	m.wg.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	grace := time.Duration(m.config.Snapshot().ShutdownGraceSec) * time.Second
+	if grace > 0 {
+		log.Printf("Job manager draining (grace period %v)", grace)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(grace):
+		m.interruptRunning()
+		<-done
+	}
+
+	if err := m.Save(); err != nil {
+		log.Printf("Warning: Failed to persist jobs on shutdown: %v", err)
+	}
 	log.Println("Job manager stopped")
 }
 
-// GetAI returns the current AI provider
+// interruptRunning cancels all in-flight jobs so they are requeued on the next start
+func (m *Manager) interruptRunning() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range m.jobs {
+		if job.Status == StatusProcessing && job.cancel != nil {
+			log.Printf("[Job %s] Grace period expired, interrupting", job.ID)
+			job.interrupted = true
+			job.cancel()
+		}
+	}
+}
+
+func (m *Manager) isDraining() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.draining
+}
+
+// JobsFilePath returns the path jobs are persisted to ("" if persistence is disabled)
+func (m *Manager) JobsFilePath() string {
+	if fs, ok := m.store.(*FileStore); ok {
+		return fs.Path
+	}
+	return ""
+}
+
+// GetAI returns the current AI provider, nil when none is configured. Its requests wait
+// for one of the AIMaxConcurrent slots shared by every caller.
 func (m *Manager) GetAI() ai.Provider {
-	return m.ai
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.aiLimit.limit(m.ai)
+}
+
+// TitleCleaner returns a cleaner for AI filename cleaning, nil unless premium with an AI
+// provider configured
+func (m *Manager) TitleCleaner() *meta.Cleaner {
+	cfg := m.config.Snapshot()
+	if aiProv := m.GetAI(); cfg.IsPremium && aiProv != nil {
+		return meta.NewCleanerWithPrompts(aiProv, cfg.MetaPrompts())
+	}
+	return nil
 }
 
 func (m *Manager) worker(id int) {
@@ -137,18 +336,54 @@ func (m *Manager) worker(id int) {
 		select {
 		case <-m.stopCh:
 			return
-		case job := <-m.queue:
-			m.processJob(job)
+		case <-m.queue:
+			if m.isDraining() {
+				// Leave it pending, it is persisted and requeued on next start
+				return
+			}
+			// Keep going until nothing is pending, so dropped wake-ups can't strand jobs
+			for job := m.claimNext(); job != nil; job = m.claimNext() {
+				m.processJob(job)
+				if m.isDraining() {
+					return
+				}
+			}
 		}
 	}
 }
 
-func (m *Manager) AddJob(job *Job) {
+// AddJob registers and enqueues a job. It fails fast with ErrQueueFull rather than
+// blocking when maxQueued jobs are already pending.
+func (m *Manager) AddJob(job *Job) error {
 	m.mu.Lock()
+	if pending := m.pendingCountLocked(); pending >= m.maxQueued {
+		m.mu.Unlock()
+		return fmt.Errorf("%w (%d jobs pending)", ErrQueueFull, pending)
+	}
+	// Two jobs writing the same output would corrupt each other's file
+	if job.DestinationPath != "" && m.outputActiveLocked(job.DestinationPath) {
+		original := job.DestinationPath
+		job.DestinationPath = m.availableOutputLocked(job)
+		warning := fmt.Sprintf("output %s is in use by another job, writing %s instead", original, filepath.Base(job.DestinationPath))
+		job.Warnings = append(job.Warnings, warning)
+		log.Printf("[Job %s] %s", job.ID, warning)
+	}
 	m.jobs[job.ID] = job
+	draining := m.draining
 	m.mu.Unlock()
-	m.Save() // Persist to disk
-	m.queue <- job
+	m.saveJob(job) // Persist to disk
+	m.wakeProbe()
+	m.Events.Append(events.Event{
+		Type:    events.JobCreated,
+		JobID:   job.ID,
+		Message: fmt.Sprintf("Created %s job for %s", job.Type, filepath.Base(job.SourcePath)),
+	})
+	if draining {
+		log.Printf("[Job %s] Shutting down, job will start on next launch", job.ID)
+		return nil
+	}
+	m.wake(job)
+	return nil
 }
 
 func (m *Manager) GetJob(id string) *Job {
@@ -157,6 +392,67 @@ func (m *Manager) GetJob(id string) *Job {
 	return m.jobs[id]
 }
 
+// ProcessingCount returns the number of jobs currently running
+func (m *Manager) ProcessingCount() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	count := 0
+	for _, job := range m.jobs {
+		if job.Status == StatusProcessing {
+			count++
+		}
+	}
+	return count
+}
+
+// ActiveJobFor returns the pending or running job for a source, if any
+func (m *Manager) ActiveJobFor(sourcePath string) *Job {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for _, job := range m.jobs {
+		if job.SourcePath == sourcePath && (job.Status == StatusPending || job.Status == StatusProcessing) {
+			return job
+		}
+	}
+	return nil
+}
+
+// IsOutputActive reports whether a pending or running job writes to path
+func (m *Manager) IsOutputActive(path string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.outputActiveLocked(path)
+}
+
+// outputActiveLocked is IsOutputActive for callers holding m.mu
+func (m *Manager) outputActiveLocked(path string) bool {
+	path = filepath.Clean(path)
+	for _, job := range m.jobs {
+		if (job.Status == StatusPending || job.Status == StatusProcessing) &&
+			job.DestinationPath != "" && filepath.Clean(job.DestinationPath) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// availableOutputLocked numbers the job's destination (Movie_2.mkv, Movie_3.mkv, ...)
+// until no active job writes to it. Extraction destinations are directories and are
+// numbered as a whole.
+func (m *Manager) availableOutputLocked(job *Job) string {
+	base, ext := filepath.Clean(job.DestinationPath), ""
+	if job.Type != JobTypeExtract {
+		ext = filepath.Ext(base)
+		base = strings.TrimSuffix(base, ext)
+	}
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, n, ext)
+		if !m.outputActiveLocked(candidate) {
+			return candidate
+		}
+	}
+}
+
 func (m *Manager) GetAllJobs() []*Job {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -173,11 +469,94 @@ func (m *Manager) CancelJob(id string) bool {
 	if job, ok := m.jobs[id]; ok && job.cancel != nil {
 		job.cancel()
 		job.Status = StatusCancelled
+		m.Events.Append(events.Event{
+			Type:    events.JobCancelled,
+			JobID:   job.ID,
+			Message: fmt.Sprintf("Cancelled %s", filepath.Base(job.SourcePath)),
+		})
 		return true
 	}
 	return false
 }
 
+// RetryJob clones a finished job into a new pending job with the given ID and enqueues it
+func (m *Manager) RetryJob(id, newID string) (*Job, error) {
+	m.mu.RLock()
+	prev, ok := m.jobs[id]
+	m.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("job %s not found", id)
+	}
+
+	switch prev.Status {
+	case StatusCompleted, StatusFailed, StatusCancelled:
+	default:
+		return nil, fmt.Errorf("job %s is %s and cannot be retried", id, prev.Status)
+	}
+
+	// Disc image jobs that failed mid-way still point at the intermediate rip
+	sourcePath := prev.SourcePath
+	if prev.OriginalSourcePath != "" {
+		sourcePath = prev.OriginalSourcePath
+	}
+
+	job := &Job{
+		ID:               newID,
+		Type:             prev.Type,
+		SourcePath:       sourcePath,
+		DestinationPath:  prev.DestinationPath,
+		Status:           StatusPending,
+		Priority:         prev.Priority,
+		CreateSubtitles:  prev.CreateSubtitles,
+		Upscale:          prev.Upscale,
+		Resolution:       prev.Resolution,
+		MaxResolution:    prev.MaxResolution,
+		KeepRip:          prev.KeepRip,
+		MinLength:        prev.MinLength,
+		MaxTitles:        prev.MaxTitles,
+		MakeMKVProfile:   prev.MakeMKVProfile,
+		EmbedSubtitles:   prev.EmbedSubtitles,
+		KeepSidecarSRT:   prev.KeepSidecarSRT,
+		SubtitleLanguage: prev.SubtitleLanguage,
+		NormalizeAudio:   prev.NormalizeAudio,
+		LoudnormTwoPass:  prev.LoudnormTwoPass,
+		CRF:              prev.CRF,
+		MaxBitrate:       prev.MaxBitrate,
+		BufSize:          prev.BufSize,
+		AudioCodec:       prev.AudioCodec,
+		AudioBitrate:     prev.AudioBitrate,
+		Container:        prev.Container,
+		StreamSelection:  prev.StreamSelection,
+		StreamLanguages:  append([]string(nil), prev.StreamLanguages...),
+		SubtitleLangs:    append([]string(nil), prev.SubtitleLangs...),
+		KeepForcedSubs:   prev.KeepForcedSubs,
+		SkipEfficient:    prev.SkipEfficient,
+		VideoCopy:        prev.VideoCopy,
+		GenerateChapters: prev.GenerateChapters,
+		ForceChapters:    prev.ForceChapters,
+		AllowNoDuration:  prev.AllowNoDuration,
+		PostCommand:      prev.PostCommand,
+		MaxDurationSec:   prev.MaxDurationSec,
+		AttachSubtitles:  prev.AttachSubtitles,
+		SubtitlePath:     prev.SubtitlePath,
+		Force:            prev.Force,
+		RemoteSource:     prev.RemoteSource,
+		WriteNFO:         prev.WriteNFO,
+		PreserveMTime:    prev.PreserveMTime,
+		Uploaded:         prev.Uploaded,
+		CreatedAt:        time.Now(),
+
+		CustomVideoFilters: prev.CustomVideoFilters,
+		CustomArgs:         append([]string(nil), prev.CustomArgs...),
+	}
+
+	if err := m.AddJob(job); err != nil {
+		return nil, err
+	}
+	log.Printf("[Job %s] Retrying as job %s", id, newID)
+	return job, nil
+}
+
 func (m *Manager) UpdateAIProvider(provider ai.Provider) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -185,10 +564,64 @@ func (m *Manager) UpdateAIProvider(provider ai.Provider) {
 	log.Printf("Job manager AI provider updated")
 }
 
+// ReloadConfig re-reads the shared config from the environment and disk and
+// re-initializes the AI provider. It returns the names of the settings that changed.
+func (m *Manager) ReloadConfig() []string {
+	changed := m.config.Reload()
+
+	m.config.RLock()
+	aiCfg := ai.AIConfig{
+		Provider: m.config.AIProvider,
+		APIKey:   m.config.AIApiKey,
+		Endpoint: m.config.AIEndpoint,
+		Model:    m.config.AIModel,
+
+		MaxAttempts: m.config.AIMaxAttempts,
+	}
+	m.config.RUnlock()
+
+	provider, err := ai.NewProvider(aiCfg)
+	if err != nil {
+		log.Printf("Error updating AI provider: %v", err)
+		return changed
+	}
+	m.UpdateAIProvider(provider)
+	return changed
+}
+
+// maxDuration is how long the job may run, its own limit taking precedence over the
+// config's. Zero means no limit.
+func (j *Job) maxDuration(cfg *config.Config) time.Duration {
+	seconds := cfg.MaxJobDurationSec
+	if j.MaxDurationSec > 0 {
+		seconds = j.MaxDurationSec
+	}
+	if seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
 func (m *Manager) processJob(job *Job) {
-	job.ctx, job.cancel = context.WithCancel(context.Background())
+	cfg := m.config.Snapshot()
+	timeout := job.maxDuration(cfg)
+	// interruptRunning and CancelJob read these under m.mu from other goroutines
+	m.mu.Lock()
+	if timeout > 0 {
+		job.ctx, job.cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		job.ctx, job.cancel = context.WithCancel(context.Background())
+	}
+	cancel := job.cancel
 	job.Status = StatusProcessing
 	job.StartedAt = time.Now()
+	m.mu.Unlock()
+	defer cancel()
+	m.Events.Append(events.Event{
+		Type:    events.JobStarted,
+		JobID:   job.ID,
+		Message: fmt.Sprintf("Started %s", filepath.Base(job.SourcePath)),
+	})
 
 	// Track input size
 	if info, err := os.Stat(job.SourcePath); err == nil {
@@ -196,12 +629,20 @@ func (m *Manager) processJob(job *Job) {
 	}
 
 	// Premium Feature: AI Metadata Cleanup
-	if m.config.IsPremium && m.ai != nil && job.Type == JobTypeOptimize {
-		cleaner := meta.NewCleaner(m.ai)
+	dropPremiumFeatures(job, cfg)
+	aiProv := m.GetAI()
+	if cfg.IsPremium && aiProv != nil && job.Type == JobTypeOptimize {
+		// Scanned jobs arrive with the title cleaned in a batch with the rest of the scan
+		cleanTitle := job.CleanTitle
 		filename := filepath.Base(job.SourcePath)
-		if cleanTitle, err := cleaner.CleanFilename(job.ctx, filename); err == nil {
+		if cleanTitle == "" {
+			cleaner := meta.NewCleanerWithPrompts(aiProv, cfg.MetaPrompts())
+			cleanTitle, _ = cleaner.CleanFilename(job.ctx, filename) // "" on failure
+		}
+		if cleanTitle != "" {
 			log.Printf("[Premium] AI cleaned filename: %s -> %s", filename, cleanTitle)
 			job.AICleaned = true
+			job.CleanTitle = cleanTitle
 			// Adjust destination path if needed
 			ext := filepath.Ext(job.DestinationPath)
 			dir := filepath.Dir(job.DestinationPath)
@@ -209,132 +650,514 @@ func (m *Manager) processJob(job *Job) {
 		}
 	}
 
-	var err error
-	switch job.Type {
-	case JobTypeExtract:
-		err = m.runExtraction(job)
-	case JobTypeOptimize:
-		cleanPath := strings.TrimSpace(job.SourcePath)
-		lowerPath := strings.ToLower(cleanPath)
-		ext := filepath.Ext(cleanPath)
-		log.Printf("[Job %s] Checking path for auto-extraction: '%s' (Ext: '%s')", job.ID, cleanPath, ext)
-
-		if strings.HasSuffix(lowerPath, ".iso") || strings.HasSuffix(lowerPath, ".img") || strings.HasSuffix(lowerPath, ".mdf") {
-			log.Printf("[Job %s] Detected disc image input. Starting auto-extraction...", job.ID)
-			job.StatusDetail = "Extracting"
-			m.Save()
-
-			// Ensure destination has a video extension, not a disc image extension
-			destExt := strings.ToLower(filepath.Ext(job.DestinationPath))
-			if destExt == ".iso" || destExt == ".img" || destExt == ".mdf" {
-				dir := filepath.Dir(job.DestinationPath)
-				base := strings.TrimSuffix(filepath.Base(job.DestinationPath), filepath.Ext(job.DestinationPath))
-				job.DestinationPath = filepath.Join(dir, base+".mkv")
-				log.Printf("[Job %s] Corrected destination extension: %s", job.ID, job.DestinationPath)
+	// Fail fast rather than let ffmpeg write a truncated file to a full disk
+	err := m.checkDiskSpace(job)
+	if err == nil {
+		switch job.Type {
+		case JobTypeExtract:
+			err = m.runExtraction(job)
+		case JobTypeOptimize:
+			cleanPath := strings.TrimSpace(job.SourcePath)
+			lowerPath := strings.ToLower(cleanPath)
+			ext := filepath.Ext(cleanPath)
+			log.Printf("[Job %s] Checking path for auto-extraction: '%s' (Ext: '%s')", job.ID, cleanPath, ext)
+
+			if media.IsDiscImage(lowerPath) && media.IsRemoteSource(cleanPath) {
+				err = fmt.Errorf("disc images must be local, MakeMKV can't read a URL")
+			} else if media.IsDiscImage(lowerPath) {
+				log.Printf("[Job %s] Detected disc image input. Starting auto-extraction...", job.ID)
+				job.StatusDetail = "Extracting"
+				m.saveJob(job)
+
+				// Ensure destination has a video extension, not a disc image extension
+				destExt := strings.ToLower(filepath.Ext(job.DestinationPath))
+				if media.IsDiscImage(destExt) {
+					dir := filepath.Dir(job.DestinationPath)
+					base := strings.TrimSuffix(filepath.Base(job.DestinationPath), filepath.Ext(job.DestinationPath))
+					job.DestinationPath = filepath.Join(dir, base+".mkv")
+					log.Printf("[Job %s] Corrected destination extension: %s", job.ID, job.DestinationPath)
+				}
+
+				if m.makemkv == nil {
+					err = fmt.Errorf("makemkv not installed")
+					break
+				}
+
+				// Scan disc
+				var info *media.DiscInfo
+				info, err = m.makemkv.ScanDisc(job.ctx, cleanPath)
+				if err != nil {
+					err = fmt.Errorf("scan failed: %v", err)
+					break
+				}
+				if len(info.Titles) == 0 {
+					err = fmt.Errorf("no titles found on disc")
+					break
+				}
+
+				mainTitleIdx := info.FindLargestTitle()
+				log.Printf("[Job %s] Identified main feature: Title %d (Total titles: %d)", job.ID, mainTitleIdx, len(info.Titles))
+
+				// Auto-extract first, into TEMP_DIR if configured, otherwise next to the output
+				extractBase := filepath.Dir(job.DestinationPath)
+				if cfg.TempDir != "" {
+					extractBase = cfg.TempDir
+				}
+				extractDir := filepath.Join(extractBase, "extract_"+job.ID)
+				if err = os.MkdirAll(extractDir, 0755); err != nil {
+					err = fmt.Errorf("failed to create extract dir: %v", err)
+					break
+				}
+
+				opts := media.ExtractOptions{
+					SourcePath: cleanPath,
+					OutputDir:  extractDir,
+					TitleIndex: mainTitleIdx,
+					Profile:    m.makemkvProfile(job),
+				}
+
+				err = m.makemkv.ExtractWithProgress(job.ctx, opts, func(p media.TranscodeProgress) {
+					job.Progress = p.Percentage / 2 // First 50%
+					m.saveProgress(job)
+				})
+
+				if err != nil {
+					err = fmt.Errorf("extraction failed: %v", err)
+					break
+				}
+
+				// Find the extracted file
+				files, _ := filepath.Glob(filepath.Join(extractDir, "*.mkv"))
+				if len(files) == 0 {
+					err = fmt.Errorf("extraction finished but no output file found")
+					break
+				}
+
+				// Update source path for the optimization step
+				originalSource := job.SourcePath
+				job.OriginalSourcePath = originalSource
+				job.SourcePath = files[0]
+				log.Printf("[Job %s] Extraction complete. Proceeding to optimize: %s", job.ID, job.SourcePath)
+
+				job.StatusDetail = "Optimizing"
+				m.saveJob(job)
+
+				// Now proceed to standard optimization
+				err = m.runOptimization(job)
+
+				// Cleanup
+				if err == nil {
+					job.SourcePath = originalSource
+					if cErr := m.cleanupExtraction(job, extractDir, files[0]); cErr != nil {
+						log.Printf("[Job %s] Warning: failed to clean up extraction: %v", job.ID, cErr)
+					}
+				}
+			} else {
+				log.Printf("[Job %s] Path does not require extraction. Proceeding directly.", job.ID)
+				job.StatusDetail = "Optimizing"
+				m.saveJob(job)
+				err = m.runOptimization(job)
 			}
+		case JobTypeTest:
+			err = m.runTest(job)
+		}
+	}
 
-			if m.makemkv == nil {
-				err = fmt.Errorf("makemkv not installed")
-				break
-			}
-
-			// Scan disc
-			var info *media.DiscInfo
-			info, err = m.makemkv.ScanDisc(job.ctx, cleanPath)
-			if err != nil {
-				err = fmt.Errorf("scan failed: %v", err)
-				break
-			}
-			if len(info.Titles) == 0 {
-				err = fmt.Errorf("no titles found on disc")
-				break
-			}
-
-			mainTitleIdx := info.FindLargestTitle()
-			log.Printf("[Job %s] Identified main feature: Title %d (Total titles: %d)", job.ID, mainTitleIdx, len(info.Titles))
-
-			// Auto-extract first
-			extractDir := filepath.Join(filepath.Dir(job.DestinationPath), "extract_"+job.ID)
-			if err = os.MkdirAll(extractDir, 0755); err != nil {
-				err = fmt.Errorf("failed to create extract dir: %v", err)
-				break
-			}
-
-			opts := media.ExtractOptions{
-				SourcePath: cleanPath,
-				OutputDir:  extractDir,
-				TitleIndex: mainTitleIdx,
-			}
-
-			err = m.makemkv.ExtractWithProgress(job.ctx, opts, func(p media.TranscodeProgress) {
-				job.Progress = p.Percentage / 2 // First 50%
-				m.Save()
-			})
-
-			if err != nil {
-				err = fmt.Errorf("extraction failed: %v", err)
-				break
-			}
-
-			// Find the extracted file
-			files, _ := filepath.Glob(filepath.Join(extractDir, "*.mkv"))
-			if len(files) == 0 {
-				err = fmt.Errorf("extraction finished but no output file found")
-				break
-			}
-
-			// Update source path for the optimization step
-			originalSource := job.SourcePath
-			job.SourcePath = files[0]
-			log.Printf("[Job %s] Extraction complete. Proceeding to optimize: %s", job.ID, job.SourcePath)
-
-			job.StatusDetail = "Optimizing"
-			m.Save()
+	m.mu.Lock()
+	interrupted := job.interrupted
+	if interrupted {
+		// Shutdown cut this job short, reset it so it runs again on next start
+		if job.OriginalSourcePath != "" {
+			job.SourcePath = job.OriginalSourcePath
+		}
+		job.Status = StatusPending
+		job.StatusDetail = ""
+		job.Progress = 0
+	}
+	m.mu.Unlock()
 
-			// Now proceed to standard optimization
-			err = m.runOptimization(job)
+	if interrupted {
+		m.saveJob(job)
+		log.Printf("[Job %s] Interrupted by shutdown, will resume on next start", job.ID)
+		return
+	}
 
-			// Cleanup
-			if err == nil {
-				os.RemoveAll(extractDir)
-				job.SourcePath = originalSource
-			}
-		} else {
-			log.Printf("[Job %s] Path does not require extraction. Proceeding directly.", job.ID)
-			job.StatusDetail = "Optimizing"
-			m.Save()
-			err = m.runOptimization(job)
-		}
-	case JobTypeTest:
-		err = m.runTest(job)
+	if err != nil && errors.Is(job.ctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timeout: still running after %v", timeout)
+		log.Printf("[Job %s] Killed after exceeding the maximum duration of %v", job.ID, timeout)
 	}
 
+	m.mu.Lock()
 	if err != nil {
 		job.Status = StatusFailed
 		job.Error = err.Error()
 	} else {
 		job.Status = StatusCompleted
 		job.Progress = 100
+	}
+	m.mu.Unlock()
 
+	if err == nil {
 		// Track output size
 		if info, err := os.Stat(job.DestinationPath); err == nil {
 			job.OutputSize = info.Size()
 		}
+		if job.SkipReason == "" {
+			m.writeNFO(job)
+			m.applyOutputPermissions(job)
+			m.preserveMTime(job)
+		}
 	}
 	job.CompletedAt = time.Now()
 
-	// Persist job state to disk
-	m.Save()
+	// Persist job state to disk, before the post command which may run for a while
+	m.saveJob(job)
+
+	if err == nil && job.SkipReason == "" {
+		m.runPostCommand(job)
+	}
+
+	if err != nil {
+		m.Events.Append(events.Event{
+			Type:    events.JobFailed,
+			JobID:   job.ID,
+			Message: fmt.Sprintf("Failed %s: %v", filepath.Base(job.SourcePath), err),
+		})
+	} else {
+		message := fmt.Sprintf("Completed %s", filepath.Base(job.SourcePath))
+		if job.SkipReason != "" {
+			message = fmt.Sprintf("Skipped %s: %s", filepath.Base(job.SourcePath), job.SkipReason)
+		}
+		m.Events.Append(events.Event{
+			Type:    events.JobCompleted,
+			JobID:   job.ID,
+			Message: message,
+		})
+	}
+
+	// Cancelled jobs say nothing about whether jobs can succeed
+	if err == nil || !errors.Is(job.ctx.Err(), context.Canceled) {
+		m.recordOutcome(err != nil)
+	}
 
 	if m.OnJobComplete != nil {
 		m.OnJobComplete(job)
 	}
 }
 
+// PreviewCommand returns the ffmpeg command an optimize job would run, built from its
+// options and the config without probing the source. A CRF suggested by the AI and a
+// two-pass loudness measurement depend on the source, so they aren't reflected.
+func (m *Manager) PreviewCommand(job *Job) ([]string, error) {
+	if job.Type != JobTypeOptimize {
+		return nil, fmt.Errorf("only optimize jobs run ffmpeg")
+	}
+	if m.ffmpeg == nil {
+		return nil, fmt.Errorf("ffmpeg wrapper not initialized")
+	}
+
+	crf := m.config.Snapshot().CRF
+	if job.CRF != nil {
+		crf = *job.CRF
+	}
+	return m.ffmpeg.CommandArgs(m.buildTranscodeOptions(job, 0, crf)), nil
+}
+
+// buildTranscodeOptions combines the job's settings with the configured defaults. When a
+// container is set, the destination extension is changed to match it, otherwise the
+// container follows the destination extension.
+func (m *Manager) buildTranscodeOptions(job *Job, duration float64, crf int) media.TranscodeOptions {
+	cfg := m.config.Snapshot()
+	audioCodec := cfg.AudioCodec
+	if job.AudioCodec != "" {
+		audioCodec = job.AudioCodec
+	}
+	audioBitrate := cfg.AudioBitrate
+	if job.AudioBitrate != "" {
+		audioBitrate = job.AudioBitrate
+	}
+	container := cfg.Container
+	if job.Container != "" {
+		container = job.Container
+	}
+	if container != "" {
+		job.DestinationPath = strings.TrimSuffix(job.DestinationPath, filepath.Ext(job.DestinationPath)) + "." + container
+	} else {
+		container = containerExtensions[strings.ToLower(filepath.Ext(job.DestinationPath))]
+	}
+
+	opts := media.TranscodeOptions{
+		InputPath:      job.SourcePath,
+		OutputPath:     job.DestinationPath,
+		GPUVendor:      media.GPUVendor(cfg.GPUVendor),
+		GPUDevice:      cfg.GPUDevice,
+		Preset:         media.QualityPreset(cfg.QualityPreset),
+		CRF:            crf,
+		AudioCodec:     audioCodec,
+		AudioBitrate:   audioBitrate,
+		Container:      container,
+		TotalDuration:  duration,
+		Upscale:        job.Upscale,
+		Resolution:     job.Resolution,
+		MaxBitrate:     cfg.MaxBitrate,
+		BufSize:        cfg.BufSize,
+		NormalizeAudio: job.NormalizeAudio,
+		HybridHWDecode: cfg.HybridHWDecode,
+		Tuning:         cfg.EncoderTuning(),
+
+		StreamSelection: media.StreamSelection(job.StreamSelection),
+		Languages:       job.StreamLanguages,
+
+		SubtitleLanguages:   cfg.SubtitleLanguageList(),
+		KeepForcedSubtitles: job.KeepForcedSubs || cfg.KeepForcedSubtitles,
+	}
+	if len(job.SubtitleLangs) > 0 {
+		opts.SubtitleLanguages = job.SubtitleLangs
+	}
+	opts.CustomVideoFilters = job.CustomVideoFilters
+	if len(job.CustomArgs) > 0 {
+		if cfg.CustomArgsEnabled {
+			opts.CustomArgs = job.CustomArgs
+		} else {
+			log.Printf("[Job %s] Warning: custom ffmpeg arguments ignored, CUSTOM_FFMPEG_ARGS_ENABLED is off", job.ID)
+		}
+	}
+	if job.MaxBitrate != "" {
+		opts.MaxBitrate, opts.BufSize = job.MaxBitrate, job.BufSize
+	}
+	if !job.Upscale {
+		// Validated when the job was created
+		opts.MaxHeight, _ = media.ParseMaxResolution(job.MaxResolution)
+	}
+	return opts
+}
+
+// prepareEncoding picks the CRF, asking the AI on premium, builds the transcode options
+// and records the effective settings on the job
+func (m *Manager) prepareEncoding(job *Job, info *media.MediaInfo, cfg *config.Config) media.TranscodeOptions {
+	crf := cfg.CRF
+	aiAdjusted := false
+	if job.CRF != nil {
+		crf = *job.CRF
+	} else if aiProv := m.GetAI(); cfg.IsPremium && aiProv != nil {
+		cleaner := meta.NewCleanerWithPrompts(aiProv, cfg.MetaPrompts())
+		log.Printf("[Premium] AI analyzing media for optimal encoding settings...")
+		if suggestedCRF, err := cleaner.AnalyzeEncoding(job.ctx, info.RawJSON); err == nil {
+			log.Printf("[Premium] AI suggested CRF: %d (System Default: %d)", suggestedCRF, crf)
+			crf = suggestedCRF
+			aiAdjusted = true
+		} else {
+			log.Printf("[Premium] AI analysis failed: %v", err)
+		}
+	}
+
+	opts := m.buildTranscodeOptions(job, info.Duration, crf)
+	opts.SourceHeight = info.Height
+	opts.AudioChannels = info.AudioChannels
+	opts.Subtitles = info.Subtitles
+	job.Encoding = &EncodingSettings{
+		VideoCodec:      targetVideoCodec,
+		GPUVendor:       string(opts.GPUVendor),
+		GPUDevice:       opts.GPUDevice,
+		Preset:          string(opts.Preset),
+		CRF:             opts.CRF,
+		AIAdjustedCRF:   aiAdjusted,
+		AudioCodec:      opts.AudioCodec,
+		AudioBitrate:    opts.AudioBitrate,
+		Container:       opts.Container,
+		MaxBitrate:      opts.MaxBitrate,
+		BufSize:         opts.BufSize,
+		NormalizeAudio:  opts.NormalizeAudio,
+		StreamSelection: string(opts.StreamSelection),
+		Languages:       opts.Languages,
+		HybridHWDecode:  opts.HybridHWDecode,
+	}
+	if opts.Upscale {
+		job.Encoding.Resolution = opts.Resolution
+	} else if exceedsMaxHeight(info, opts.MaxHeight) {
+		job.Encoding.MaxResolution = job.MaxResolution
+	}
+	if job.VideoCopy {
+		if ok, reason := videoCompliant(info, opts, cfg.EfficientMaxBitrateKbps); ok {
+			log.Printf("[Job %s] Copying video, source is %s", job.ID, reason)
+			opts.CopyVideo = true
+			job.Encoding.VideoCopied = true
+			job.Encoding.VideoCodec = info.VideoCodec
+		}
+	}
+	return opts
+}
+
+// exceedsMaxHeight reports whether the source is taller than a resolution cap. An unknown
+// height counts as exceeding it, ffmpeg then applies the cap itself.
+func exceedsMaxHeight(info *media.MediaInfo, maxHeight int) bool {
+	return maxHeight > 0 && (info.Height <= 0 || info.Height > maxHeight)
+}
+
+// checkSourceDuration rejects sources without a usable duration, usually corrupt or
+// truncated files, unless allowUnknown is set. Sources shorter than minSec are skipped
+// with the returned reason.
+func checkSourceDuration(info *media.MediaInfo, minSec int, allowUnknown bool) (string, error) {
+	if info.Duration <= 0 {
+		if allowUnknown {
+			return "", nil
+		}
+		return "", fmt.Errorf("source duration is unknown or zero, the file may be corrupt (set allowUnknownDuration to encode it anyway)")
+	}
+	if minSec > 0 && info.Duration < float64(minSec) {
+		return fmt.Sprintf("%.1fs long, under the %ds minimum", info.Duration, minSec), nil
+	}
+	return "", nil
+}
+
+// targetVideoCodec is the codec every encoder in buildFFmpegArgs produces
+const targetVideoCodec = "hevc"
+
+// alreadyEfficient reports whether a source is already in the target codec at or under
+// maxKbps, and if so the reason recorded on the skipped job. Without a bitrate from the
+// probe, it is derived from the file size and duration.
+func alreadyEfficient(info *media.MediaInfo, maxKbps int) (bool, string) {
+	if info == nil || info.VideoCodec != targetVideoCodec || maxKbps <= 0 {
+		return false, ""
+	}
+
+	kbps := sourceKbps(info)
+	if kbps == 0 || kbps > int64(maxKbps) {
+		return false, ""
+	}
+	return true, fmt.Sprintf("already %s at %d kb/s (threshold %d kb/s)", targetVideoCodec, kbps, maxKbps)
+}
+
+// sourceKbps is the overall bitrate of a source in kb/s, derived from the file size and
+// duration without one from the probe, 0 if unknown
+func sourceKbps(info *media.MediaInfo) int64 {
+	bitRate := info.BitRate
+	if bitRate == 0 && info.Size > 0 && info.Duration > 0 {
+		bitRate = int64(float64(info.Size*8) / info.Duration)
+	}
+	return bitRate / 1000
+}
+
+// copyableVideoCodecs are the source codecs good enough to keep as-is
+var copyableVideoCodecs = map[string]bool{"hevc": true, "av1": true}
+
+// containerExtensions maps source extensions to the container they are
+var containerExtensions = map[string]string{".mkv": "mkv", ".mp4": "mp4", ".m4v": "mp4"}
+
+// videoCompliant reports whether a source's video can be stream copied: HEVC or AV1, in
+// the output container, at or under maxKbps, and not resized. The reason is logged.
+func videoCompliant(info *media.MediaInfo, opts media.TranscodeOptions, maxKbps int) (bool, string) {
+	if info == nil || !copyableVideoCodecs[info.VideoCodec] || maxKbps <= 0 {
+		return false, ""
+	}
+	container := opts.Container
+	if container == "" {
+		container = containerExtensions[strings.ToLower(filepath.Ext(opts.OutputPath))]
+	}
+	if container == "" || containerExtensions[strings.ToLower(filepath.Ext(opts.InputPath))] != container {
+		return false, ""
+	}
+	if opts.Upscale || exceedsMaxHeight(info, opts.MaxHeight) || opts.CustomVideoFilters != "" {
+		return false, ""
+	}
+
+	kbps := sourceKbps(info)
+	if kbps == 0 || kbps > int64(maxKbps) {
+		return false, ""
+	}
+	return true, fmt.Sprintf("%s in %s at %d kb/s (threshold %d kb/s)", info.VideoCodec, container, kbps, maxKbps)
+}
+
+// diskFree reports free bytes at a path; swapped out in tests
+var diskFree = system.FreeSpace
+
+// checkDiskSpace verifies the destination has room for the job. The source size is
+// used as the output estimate, with MinFreeSpaceGB as the floor.
+func (m *Manager) checkDiskSpace(job *Job) error {
+	minFree := m.config.Snapshot().MinFreeSpaceGB
+	if minFree <= 0 || job.Type == JobTypeTest {
+		return nil
+	}
+
+	required := uint64(minFree) << 30
+	if job.InputSize > 0 && uint64(job.InputSize) > required {
+		required = uint64(job.InputSize)
+	}
+
+	dir := filepath.Dir(job.DestinationPath)
+	free, err := diskFree(dir)
+	if err != nil {
+		log.Printf("[Job %s] Warning: could not check free space: %v", job.ID, err)
+		return nil
+	}
+	if free < required {
+		return fmt.Errorf("insufficient disk space in %s: %.1f GB free, %.1f GB required",
+			dir, float64(free)/(1<<30), float64(required)/(1<<30))
+	}
+	return nil
+}
+
+// cleanupExtraction removes the intermediate extraction directory of a disc image job.
+// If the job or config asks to keep the rip, the MKV is moved out of the way first.
+func (m *Manager) cleanupExtraction(job *Job, extractDir, ripFile string) error {
+	cfg := m.config.Snapshot()
+	if job.KeepRip || cfg.KeepRip {
+		ripDir := cfg.RipDir
+		if ripDir == "" {
+			ripDir = filepath.Dir(job.DestinationPath)
+		}
+		if err := os.MkdirAll(ripDir, 0755); err != nil {
+			return fmt.Errorf("failed to create rip dir: %w", err)
+		}
+
+		base := strings.TrimSuffix(filepath.Base(job.SourcePath), filepath.Ext(job.SourcePath))
+		ripPath := filepath.Join(ripDir, base+"_rip.mkv")
+		if err := moveFile(ripFile, ripPath); err != nil {
+			return fmt.Errorf("failed to keep rip: %w", err)
+		}
+		job.RipPath = ripPath
+		log.Printf("[Job %s] Kept intermediate rip at %s", job.ID, ripPath)
+	}
+
+	return os.RemoveAll(extractDir)
+}
+
+// moveFile renames src to dst, falling back to copy+delete across filesystems
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+
+	return os.Remove(src)
+}
+
 func (m *Manager) runExtraction(job *Job) error {
 	if m.makemkv == nil {
 		return fmt.Errorf("makemkv wrapper not initialized")
 	}
+	if media.IsRemoteSource(job.SourcePath) {
+		return fmt.Errorf("extraction needs a local source, MakeMKV can't read a URL")
+	}
 
 	log.Printf("[Job %s] Starting disc extraction for %s", job.ID, job.SourcePath)
 
@@ -348,9 +1171,19 @@ func (m *Manager) runExtraction(job *Job) error {
 		return fmt.Errorf("no titles found on disc")
 	}
 
-	// 2. Find the main feature (largest title)
-	mainTitleIdx := info.FindLargestTitle()
-	log.Printf("[Job %s] Detected main feature: Title %d", job.ID, mainTitleIdx)
+	// Box sets: the longest titles above the minimum length, one episode each
+	if job.MaxTitles > 0 {
+		return m.extractEpisodes(job, info)
+	}
+
+	// 2. Find the main feature (largest title), or take every title above the minimum length
+	titleIdx := info.FindLargestTitle()
+	if job.MinLength > 0 {
+		titleIdx = -1
+		log.Printf("[Job %s] Extracting all titles of at least %ds", job.ID, job.MinLength)
+	} else {
+		log.Printf("[Job %s] Detected main feature: Title %d", job.ID, titleIdx)
+	}
 
 	// 3. Ensure destination directory exists
 	if err := os.MkdirAll(job.DestinationPath, 0755); err != nil {
@@ -361,7 +1194,9 @@ func (m *Manager) runExtraction(job *Job) error {
 	opts := media.ExtractOptions{
 		SourcePath: job.SourcePath,
 		OutputDir:  job.DestinationPath,
-		TitleIndex: mainTitleIdx,
+		TitleIndex: titleIdx,
+		MinLength:  job.MinLength,
+		Profile:    m.makemkvProfile(job),
 	}
 
 	err = m.makemkv.ExtractWithProgress(job.ctx, opts, func(p media.TranscodeProgress) {
@@ -371,6 +1206,123 @@ func (m *Manager) runExtraction(job *Job) error {
 		return fmt.Errorf("extraction failed: %v", err)
 	}
 
+	// 5. Give the output files readable names
+	files, err := m.makemkv.RenameExtractedTitles(job.DestinationPath, info.Name)
+	if err != nil {
+		return fmt.Errorf("failed to rename extracted titles: %v", err)
+	}
+	job.OutputFiles = files
+
+	log.Printf("[Job %s] Extraction complete", job.ID)
+	return nil
+}
+
+// makemkvProfile is the conversion profile for a job's extraction, the job's own or the
+// configured one
+func (m *Manager) makemkvProfile(job *Job) string {
+	if job.MakeMKVProfile != "" {
+		return job.MakeMKVProfile
+	}
+	return m.config.Snapshot().MakeMKVProfile
+}
+
+// extractEpisodes extracts the job's MaxTitles longest titles of at least MinLength
+// seconds, naming them as numbered episodes in disc order. Up to ExtractParallelTitles
+// titles are ripped at once from images and folders, one at a time from a drive. The
+// job's progress combines them weighted by duration. The first failure cancels the
+// other titles.
+func (m *Manager) extractEpisodes(job *Job, info *media.DiscInfo) error {
+	titles := info.FindTitlesOverDuration(job.MinLength, job.MaxTitles)
+	if len(titles) == 0 {
+		return fmt.Errorf("no titles of at least %ds found on disc", job.MinLength)
+	}
+
+	parallel := m.config.Snapshot().ExtractParallelTitles
+	if parallel < 1 {
+		parallel = 1
+	}
+	if parallel > len(titles) {
+		parallel = len(titles)
+	}
+	if parallel > 1 && media.IsOpticalDrive(job.SourcePath) {
+		// A drive would seek back and forth between the titles
+		parallel = 1
+	}
+	log.Printf("[Job %s] Extracting %d titles as episodes, %d at a time: %v", job.ID, len(titles), parallel, titles)
+
+	if err := os.MkdirAll(job.DestinationPath, 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %v", err)
+	}
+
+	seconds := make(map[int]int, len(info.Titles))
+	for _, title := range info.Titles {
+		seconds[title.Index] = title.Seconds()
+	}
+	durations := make([]int, len(titles))
+	for i, titleIdx := range titles {
+		durations[i] = seconds[titleIdx]
+	}
+	progress := newTitleProgress(durations)
+	job.StatusDetail = fmt.Sprintf("Extracted 0 of %d titles", len(titles))
+
+	ctx, cancel := context.WithCancel(job.ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	slots := make(chan struct{}, parallel)
+	for i, titleIdx := range titles {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i, titleIdx int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			opts := media.ExtractOptions{
+				SourcePath: job.SourcePath,
+				OutputDir:  job.DestinationPath,
+				TitleIndex: titleIdx,
+				Profile:    m.makemkvProfile(job),
+			}
+			err := m.makemkv.ExtractWithProgress(ctx, opts, func(p media.TranscodeProgress) {
+				progress.report(job, i, p.Percentage)
+			})
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = fmt.Errorf("extraction of title %d failed: %v", titleIdx, err)
+					cancel() // Stop the other titles
+				})
+				return
+			}
+			progress.finish(job, i)
+		}(i, titleIdx)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	if err := job.ctx.Err(); err != nil {
+		return fmt.Errorf("extraction cancelled: %w", err)
+	}
+	job.StatusDetail = ""
+
+	files, err := m.makemkv.RenameEpisodes(job.DestinationPath, info.Name, titles)
+	if err != nil {
+		return fmt.Errorf("failed to rename extracted titles: %v", err)
+	}
+	job.OutputFiles = files
+
 	log.Printf("[Job %s] Extraction complete", job.ID)
 	return nil
 }
@@ -389,64 +1341,200 @@ func (m *Manager) runOptimization(job *Job) error {
 		return fmt.Errorf("failed to get media info: %w", err)
 	}
 
-	log.Printf("[Job %s] Media duration: %.2f seconds", job.ID, info.Duration)
+	if info.DurationEstimated {
+		log.Printf("[Job %s] Container has no duration, estimated %.2f seconds", job.ID, info.Duration)
+	} else {
+		log.Printf("[Job %s] Media duration: %.2f seconds", job.ID, info.Duration)
+	}
+	job.Duration = info.Duration
+	job.ProgressUnknown = info.Duration <= 0
+
+	cfg := m.config.Snapshot()
+	if reason, err := checkSourceDuration(info, cfg.MinSourceDurationSec, job.AllowNoDuration); err != nil {
+		return err
+	} else if reason != "" {
+		log.Printf("[Job %s] Skipping, source is %s", job.ID, reason)
+		job.SkipReason = "Source is " + reason
+		return nil
+	}
+	maxHeight, _ := media.ParseMaxResolution(job.MaxResolution)
+	if (job.SkipEfficient || cfg.SkipIfAlreadyEfficient) && !job.Upscale && !job.Force && !exceedsMaxHeight(info, maxHeight) {
+		if ok, reason := alreadyEfficient(info, cfg.EfficientMaxBitrateKbps); ok {
+			log.Printf("[Job %s] Skipping, source is %s", job.ID, reason)
+			job.SkipReason = "Source is " + reason
+			return nil
+		}
+	}
 
 	// 2. Premium Feature: AI Adaptive Encoding
-	crf := m.config.CRF
-	if m.config.IsPremium && m.ai != nil {
-		cleaner := meta.NewCleaner(m.ai)
-		log.Printf("[Premium] AI analyzing media for optimal encoding settings...")
-		if suggestedCRF, err := cleaner.AnalyzeEncoding(job.ctx, info.RawJSON); err == nil {
-			log.Printf("[Premium] AI suggested CRF: %d (System Default: %d)", suggestedCRF, crf)
-			crf = suggestedCRF
+	aiProv := m.GetAI()
+	opts := m.prepareEncoding(job, info, cfg)
+	m.saveJob(job)
+
+	if job.NormalizeAudio && job.LoudnormTwoPass {
+		detail := job.StatusDetail
+		job.StatusDetail = "Measuring loudness"
+		m.saveJob(job)
+		if loudness, lErr := m.ffmpeg.MeasureLoudness(job.ctx, job.SourcePath); lErr != nil {
+			log.Printf("[Job %s] Loudness analysis failed, falling back to single-pass: %v", job.ID, lErr)
 		} else {
-			log.Printf("[Premium] AI analysis failed: %v", err)
+			opts.Loudness = loudness
 		}
+		job.StatusDetail = detail
 	}
 
-	opts := media.TranscodeOptions{
-		InputPath:     job.SourcePath,
-		OutputPath:    job.DestinationPath,
-		GPUVendor:     media.GPUVendor(m.config.GPUVendor),
-		Preset:        media.QualityPreset(m.config.QualityPreset),
-		CRF:           crf,
-		TotalDuration: info.Duration,
-		Upscale:       job.Upscale,
-		Resolution:    job.Resolution,
+	// ffmpeg would truncate the source it is reading, so the output is either refused
+	// or encoded beside it and renamed over it once complete
+	replacing := SamePath(job.SourcePath, opts.OutputPath)
+	if replacing {
+		if cfg.SameOutputAction != config.SameOutputReplace {
+			return fmt.Errorf("destination %s is the source file", opts.OutputPath)
+		}
+		opts.OutputPath = replacementPath(job.DestinationPath, job.ID)
+		log.Printf("[Job %s] Destination is the source, it will be replaced once encoded", job.ID)
 	}
 
 	log.Printf("[Job %s] Starting ffmpeg transcoding to: %s", job.ID, opts.OutputPath)
 
+	encodeStart := time.Now()
 	err = m.ffmpeg.TranscodeWithProgress(job.ctx, opts, func(p media.TranscodeProgress) {
 		job.Progress = p.Percentage
+		job.FramesEncoded = p.Frame
 		job.FPS = p.FPS
 		job.ETA = p.ETA
 	})
 	if err != nil {
 		log.Printf("[Job %s] FFmpeg failed: %v", job.ID, err)
+		if replacing {
+			os.Remove(opts.OutputPath)
+		}
 		return err
 	}
+	if replacing {
+		if err := os.Rename(opts.OutputPath, job.DestinationPath); err != nil {
+			os.Remove(opts.OutputPath)
+			return fmt.Errorf("failed to replace the source: %w", err)
+		}
+	}
 
 	log.Printf("[Job %s] Transcoding completed successfully", job.ID)
+	m.recordEncodeSpeed(info.Duration, time.Since(encodeStart))
+
+	// 3. Chapters for sources that have none
+	if job.GenerateChapters || cfg.GenerateChapters {
+		m.generateChapters(job, info)
+	}
 
-	// 3. Premium Feature: AI Whisper Subtitles
-	if m.config.IsPremium && job.CreateSubtitles && m.ai != nil {
+	// 4. Existing subtitles, which make generating new ones unnecessary
+	if job.AttachSubtitles || job.SubtitlePath != "" {
+		m.attachSubtitles(job)
+	}
+
+	// 5. Premium Feature: AI Whisper Subtitles
+	if cfg.IsPremium && job.CreateSubtitles && aiProv != nil && !job.ExternalSubs {
 		log.Printf("[Premium] Running Whisper subtitle generation...")
-		generator := whisper.NewGenerator(m.ai)
-		if srtPath, sErr := generator.GenerateSRT(job.ctx, job.DestinationPath); sErr != nil {
+		generator := whisper.NewGenerator(aiProv, cfg.GetTempDir())
+		if subs, sErr := generator.GenerateSRT(job.ctx, job.DestinationPath, job.SubtitleLanguage); sErr != nil {
 			log.Printf("Warning: Whisper subtitle generation failed: %v", sErr)
 			// Don't fail the whole job just because subtitles failed
 		} else {
-			log.Printf("[Premium] Subtitles generated: %s", srtPath)
+			log.Printf("[Premium] Subtitles generated: %s (language: %s)", subs.Path, subs.Language)
 			job.AISubtitles = true
+			job.SubtitleLanguage = subs.Language
+
+			if job.EmbedSubtitles {
+				if mErr := m.ffmpeg.EmbedSubtitles(job.ctx, job.DestinationPath, subs.Path, whisper.StreamLanguage(subs.Language)); mErr != nil {
+					log.Printf("Warning: Embedding subtitles failed, keeping sidecar: %v", mErr)
+				} else {
+					log.Printf("[Job %s] Subtitles embedded into %s", job.ID, job.DestinationPath)
+					if !job.KeepSidecarSRT {
+						os.Remove(subs.Path)
+					}
+				}
+			}
 		}
 	}
 
 	return nil
 }
 
+// generateChapters adds chapters at scene changes to the job's output. Sources that
+// already have chapters keep them unless the job forces new ones. Failures only log,
+// the encode itself succeeded.
+func (m *Manager) generateChapters(job *Job, info *media.MediaInfo) {
+	if info.Chapters > 0 && !job.ForceChapters {
+		log.Printf("[Job %s] Source has %d chapters, keeping them", job.ID, info.Chapters)
+		return
+	}
+
+	detail := job.StatusDetail
+	job.StatusDetail = "Detecting scenes"
+	m.saveJob(job)
+	defer func() { job.StatusDetail = detail }()
+
+	scenes, err := m.ffmpeg.DetectScenes(job.ctx, job.SourcePath)
+	if err != nil {
+		log.Printf("[Job %s] Scene detection failed, using fixed intervals: %v", job.ID, err)
+	}
+
+	starts := media.ChapterStarts(scenes, info.Duration)
+	if err := m.ffmpeg.AddChapters(job.ctx, job.DestinationPath, starts, info.Duration); err != nil {
+		log.Printf("[Job %s] Warning: adding chapters failed: %v", job.ID, err)
+		return
+	}
+	job.ChaptersAdded = len(starts)
+	log.Printf("[Job %s] Added %d chapters", job.ID, len(starts))
+}
+
+// externalSubtitle returns the subtitle to embed for a job and its stream language: the
+// job's SubtitlePath, or else a sibling of the source. The language comes from the
+// filename tag, falling back to the job's SubtitleLanguage.
+func externalSubtitle(job *Job) (string, string) {
+	path, tag := job.SubtitlePath, ""
+	if path == "" {
+		source := job.SourcePath
+		if job.OriginalSourcePath != "" {
+			source = job.OriginalSourcePath
+		}
+		path, tag = media.FindSiblingSubtitle(source)
+	}
+	if tag == "" {
+		tag = job.SubtitleLanguage
+	}
+	lang := whisper.StreamLanguage(tag)
+	if lang == whisper.UndeterminedLanguage && len(tag) == 3 {
+		// Already an ISO 639-2 code, just not one Whisper knows
+		lang = strings.ToLower(tag)
+	}
+	return path, lang
+}
+
+// attachSubtitles muxes an existing subtitle into the job's output. Failures only log,
+// Whisper can still generate subtitles instead.
+func (m *Manager) attachSubtitles(job *Job) {
+	path, lang := externalSubtitle(job)
+	if path == "" {
+		log.Printf("[Job %s] No subtitle found next to the source", job.ID)
+		return
+	}
+	if err := media.ValidateSubtitleFile(path); err != nil {
+		log.Printf("[Job %s] Warning: not embedding subtitle: %v", job.ID, err)
+		return
+	}
+
+	if err := m.ffmpeg.EmbedSubtitles(job.ctx, job.DestinationPath, path, lang); err != nil {
+		log.Printf("[Job %s] Warning: embedding subtitle %s failed: %v", job.ID, path, err)
+		return
+	}
+	job.ExternalSubs = true
+	log.Printf("[Job %s] Embedded subtitle %s (%s)", job.ID, filepath.Base(path), lang)
+}
+
+// testJobDuration is how long a JobTypeTest runs
+var testJobDuration = 10 * time.Second
+
 func (m *Manager) runTest(job *Job) error {
-	duration := 10 * time.Second
+	duration := testJobDuration
 	start := time.Now()
 	for {
 		select {
@@ -476,7 +1564,7 @@ func formatDuration(d time.Duration) string {
 
 // Save persists all jobs to disk
 func (m *Manager) Save() error {
-	if m.jobsFilePath == "" {
+	if m.store == nil {
 		return nil // No persistence configured
 	}
 
@@ -489,34 +1577,67 @@ func (m *Manager) Save() error {
 		jobList = append(jobList, job)
 	}
 
-	data, err := json.MarshalIndent(jobList, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal jobs: %w", err)
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+	if err := m.store.SaveJobs(jobList); err != nil {
+		return err
 	}
+	m.lastSave = time.Now()
+
+	return nil
+}
 
-	if err := os.WriteFile(m.jobsFilePath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write jobs file: %w", err)
+// saveJob persists an update to one job. Stores that can't write a single job, see
+// JobSaver, save them all.
+func (m *Manager) saveJob(job *Job) error {
+	saver, ok := m.store.(JobSaver)
+	if !ok {
+		return m.Save()
 	}
 
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	m.saveMu.Lock()
+	defer m.saveMu.Unlock()
+	if err := saver.SaveJob(job); err != nil {
+		return err
+	}
+	m.lastSave = time.Now()
 	return nil
 }
 
-// Load reads persisted jobs from disk
+// saveProgress persists a progress update to job unless the jobs were written within
+// ProgressSaveIntervalSec. Progress ticks fire many times a second, the in-memory job
+// stays current either way. It reports whether the job was saved.
+func (m *Manager) saveProgress(job *Job) bool {
+	m.config.RLock()
+	interval := time.Duration(m.config.ProgressSaveIntervalSec) * time.Second
+	m.config.RUnlock()
+
+	m.saveMu.Lock()
+	recent := time.Since(m.lastSave) < interval
+	m.saveMu.Unlock()
+	if recent {
+		return false
+	}
+
+	if err := m.saveJob(job); err != nil {
+		log.Printf("Warning: failed to save progress: %v", err)
+	}
+	return true
+}
+
+// Load reads persisted jobs from the store
 func (m *Manager) Load() error {
-	if m.jobsFilePath == "" {
+	if m.store == nil {
 		return nil // No persistence configured
 	}
 
-	data, err := os.ReadFile(m.jobsFilePath)
+	jobList, err := m.store.LoadJobs()
 	if err != nil {
 		return err
 	}
 
-	var jobList []*Job
-	if err := json.Unmarshal(data, &jobList); err != nil {
-		return fmt.Errorf("failed to unmarshal jobs: %w", err)
-	}
-
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -542,7 +1663,7 @@ func (m *Manager) RequeuePendingJobs() {
 	count := 0
 	for _, job := range m.jobs {
 		if job.Status == StatusPending {
-			m.queue <- job
+			m.wake(job)
 			count++
 		}
 	}
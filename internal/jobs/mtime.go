@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"log"
+	"os"
+)
+
+// preserveMTime gives a finished job's outputs the modification time of its source, the
+// original disc image for rips, so media servers sort them by when the source was added.
+// Failures are only logged, the output itself is still good.
+func (m *Manager) preserveMTime(job *Job) {
+	if (!job.PreserveMTime && !m.config.Snapshot().PreserveMTime) || job.RemoteSource {
+		return
+	}
+
+	source := job.SourcePath
+	if job.OriginalSourcePath != "" {
+		source = job.OriginalSourcePath
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		log.Printf("[Job %s] Warning: can't preserve the modification time: %v", job.ID, err)
+		return
+	}
+
+	files, dirs := jobOutputs(job)
+	for _, path := range append(files, dirs...) {
+		if err := os.Chtimes(path, info.ModTime(), info.ModTime()); err != nil {
+			log.Printf("[Job %s] Warning: failed to set the modification time of %s: %v", job.ID, path, err)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package jobs
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Vasteva/MediaConverter/internal/ai/meta"
+	"github.com/Vasteva/MediaConverter/internal/media"
+)
+
+// writeNFO writes a movie NFO next to an optimized output whose name was AI-cleaned.
+// Failures are only logged, the output itself is still good.
+func (m *Manager) writeNFO(job *Job) {
+	cfg := m.config.Snapshot()
+	if (!job.WriteNFO && !cfg.WriteNFO) || job.Type != JobTypeOptimize {
+		return
+	}
+	if !job.AICleaned || job.CleanTitle == "" {
+		log.Printf("[Job %s] Skipping NFO, the title wasn't AI-cleaned", job.ID)
+		return
+	}
+
+	tmpl := ""
+	if cfg.NFOTemplate != "" {
+		data, err := os.ReadFile(cfg.NFOTemplate)
+		if err != nil {
+			log.Printf("[Job %s] Warning: failed to read NFO template: %v", job.ID, err)
+			return
+		}
+		tmpl = string(data)
+	}
+
+	source := job.SourcePath
+	if job.OriginalSourcePath != "" {
+		source = job.OriginalSourcePath
+	}
+	original := filepath.Base(source)
+	if job.RemoteSource {
+		original = media.RemoteFileName(source)
+	}
+
+	title, year := meta.ParseTitleYear(job.CleanTitle)
+	nfo, err := meta.RenderNFO(tmpl, meta.NFOInfo{
+		Title:            title,
+		Year:             year,
+		OriginalFilename: original,
+		OutputFilename:   filepath.Base(job.DestinationPath),
+	})
+	if err != nil {
+		log.Printf("[Job %s] Warning: %v", job.ID, err)
+		return
+	}
+
+	path := strings.TrimSuffix(job.DestinationPath, filepath.Ext(job.DestinationPath)) + ".nfo"
+	if err := os.WriteFile(path, []byte(nfo), 0644); err != nil {
+		log.Printf("[Job %s] Warning: failed to write NFO: %v", job.ID, err)
+		return
+	}
+	job.NFOPath = path
+	log.Printf("[Job %s] Wrote %s", job.ID, path)
+}
@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"log"
+	"os"
+)
+
+// applyOutputPermissions sets the configured mode and owner on a finished job's outputs.
+// Failures are only logged, the output itself is still good.
+func (m *Manager) applyOutputPermissions(job *Job) {
+	cfg := m.config.Snapshot()
+	mode, err := cfg.OutputMode()
+	if err != nil {
+		log.Printf("[Job %s] Warning: %v", job.ID, err)
+		mode = 0
+	}
+	if mode == 0 && cfg.OutputUID == 0 && cfg.OutputGID == 0 {
+		return
+	}
+
+	files, dirs := jobOutputs(job)
+	for _, path := range files {
+		setOutputPermissions(job.ID, path, mode, cfg.OutputUID, cfg.OutputGID)
+	}
+	for _, path := range dirs {
+		setOutputPermissions(job.ID, path, dirMode(mode), cfg.OutputUID, cfg.OutputGID)
+	}
+}
+
+// jobOutputs lists the files and directories a finished job wrote
+func jobOutputs(job *Job) (files, dirs []string) {
+	switch job.Type {
+	case JobTypeExtract:
+		// Extraction writes its titles into a directory it creates
+		dirs = append(dirs, job.DestinationPath)
+		files = append(files, job.OutputFiles...)
+	case JobTypeOptimize:
+		files = append(files, job.DestinationPath)
+	}
+	if job.RipPath != "" {
+		files = append(files, job.RipPath)
+	}
+	if job.NFOPath != "" {
+		files = append(files, job.NFOPath)
+	}
+	return files, dirs
+}
+
+// setOutputPermissions applies mode (when non-zero) and uid/gid (when non-zero) to path
+func setOutputPermissions(jobID, path string, mode os.FileMode, uid, gid int) {
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			log.Printf("[Job %s] Warning: failed to set mode %o on %s: %v", jobID, mode, path, err)
+		}
+	}
+
+	if uid == 0 && gid == 0 {
+		return
+	}
+	// -1 leaves that side of the ownership unchanged
+	if uid == 0 {
+		uid = -1
+	}
+	if gid == 0 {
+		gid = -1
+	}
+	if err := os.Chown(path, uid, gid); err != nil {
+		log.Printf("[Job %s] Warning: failed to change owner of %s (insufficient privileges?): %v", jobID, path, err)
+	}
+}
+
+// dirMode derives a directory mode from a file mode, adding search permission wherever
+// read is granted so 0664 becomes 0775
+func dirMode(mode os.FileMode) os.FileMode {
+	if mode == 0 {
+		return 0
+	}
+	return mode | (mode&0444)>>2
+}
@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+)
+
+// runPostCommand runs the job's or the configured post command after a job succeeded,
+// through sh with the job's fields in VASTIVA_* environment variables. Its output is
+// logged, a failure or timeout is only logged as the job itself is done.
+func (m *Manager) runPostCommand(job *Job) {
+	cfg := m.config.Snapshot()
+	command := job.PostCommand
+	if command == "" {
+		command = cfg.PostCommand
+	}
+	if command == "" {
+		return
+	}
+	if !cfg.PostCommandEnabled {
+		log.Printf("[Job %s] Warning: post command not run, POST_COMMAND_ENABLED is off", job.ID)
+		return
+	}
+
+	timeout := time.Duration(cfg.PostCommandTimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = config.DefaultPostCommandTimeoutSec * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), postCommandEnv(job)...)
+	killProcessGroup(cmd)
+	cmd.WaitDelay = time.Second // Don't wait on pipes held open by a killed background process
+	start := time.Now()
+	output, err := cmd.CombinedOutput()
+	if out := strings.TrimSpace(string(output)); out != "" {
+		log.Printf("[Job %s] Post command output:\n%s", job.ID, out)
+	}
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		log.Printf("[Job %s] Warning: post command killed after %v", job.ID, timeout)
+	case err != nil:
+		log.Printf("[Job %s] Warning: post command failed: %v", job.ID, err)
+	default:
+		log.Printf("[Job %s] Post command finished in %v", job.ID, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// postCommandEnv describes a job to the post command
+func postCommandEnv(job *Job) []string {
+	env := map[string]string{
+		"VASTIVA_JOB_ID":       job.ID,
+		"VASTIVA_JOB_TYPE":     string(job.Type),
+		"VASTIVA_INPUT":        job.SourcePath,
+		"VASTIVA_OUTPUT":       job.DestinationPath,
+		"VASTIVA_OUTPUT_FILES": strings.Join(job.OutputFiles, "\n"), // Extract: one title per line
+		"VASTIVA_INPUT_SIZE":   strconv.FormatInt(job.InputSize, 10),
+		"VASTIVA_OUTPUT_SIZE":  strconv.FormatInt(job.OutputSize, 10),
+		"VASTIVA_CLEAN_TITLE":  job.CleanTitle,
+		"VASTIVA_NFO":          job.NFOPath,
+		"VASTIVA_RIP":          job.RipPath,
+		"VASTIVA_DURATION":     fmt.Sprintf("%.0f", job.Duration),
+	}
+	vars := make([]string, 0, len(env))
+	for name, value := range env {
+		vars = append(vars, name+"="+value)
+	}
+	return vars
+}
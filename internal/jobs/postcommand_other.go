@@ -0,0 +1,8 @@
+//go:build !unix
+
+package jobs
+
+import "os/exec"
+
+// killProcessGroup leaves cmd as is, process groups are only used on unix platforms
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,35 @@
+package jobs
+
+import (
+	"log"
+	"strings"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+)
+
+// PremiumFeatures names the premium options requested on the job
+func (j *Job) PremiumFeatures() []string {
+	var features []string
+	if j.Upscale {
+		features = append(features, "upscaling")
+	}
+	if j.CreateSubtitles {
+		features = append(features, "AI subtitles")
+	}
+	return features
+}
+
+// dropPremiumFeatures clears premium options the license doesn't cover. The API refuses
+// them when a job is created, this catches scanner jobs and a license that lapsed while
+// the job was queued.
+func dropPremiumFeatures(job *Job, cfg *config.Config) {
+	features := job.PremiumFeatures()
+	if len(features) == 0 {
+		return
+	}
+	if err := cfg.RequirePremium(strings.Join(features, " and ")); err != nil {
+		log.Printf("[Job %s] Warning: ignoring options, %v", job.ID, err)
+		job.Upscale = false
+		job.CreateSubtitles = false
+	}
+}
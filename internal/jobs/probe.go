@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"context"
+	"os"
+)
+
+// probeLoop probes the sources of pending optimize jobs in the background, for their
+// duration and size, so queue estimates never probe in the request path. Each job is
+// probed once.
+func (m *Manager) probeLoop() {
+	defer m.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-m.stopCh
+		cancel()
+	}()
+
+	for {
+		m.probePending(ctx)
+		select {
+		case <-m.stopCh:
+			return
+		case <-m.probeWake:
+		}
+	}
+}
+
+// wakeProbe asks probeLoop to look for jobs it hasn't probed yet
+func (m *Manager) wakeProbe() {
+	select {
+	case m.probeWake <- struct{}{}:
+	default:
+	}
+}
+
+// probePending probes the pending optimize jobs not probed yet
+func (m *Manager) probePending(ctx context.Context) {
+	for _, job := range m.unprobedJobs() {
+		if ctx.Err() != nil {
+			return
+		}
+		stat, err := os.Stat(job.SourcePath)
+		if err != nil {
+			continue
+		}
+
+		m.mu.RLock()
+		duration := job.Duration
+		m.mu.RUnlock()
+		if duration == 0 && m.ffmpeg != nil {
+			if info, err := m.ffmpeg.GetMediaInfo(ctx, job.SourcePath); err == nil {
+				duration = info.Duration
+			}
+		}
+		if duration <= 0 {
+			continue
+		}
+
+		m.mu.Lock()
+		if job.Duration == 0 {
+			job.Duration = duration
+		}
+		if job.Status == StatusPending {
+			if m.probes == nil {
+				m.probes = make(map[string]sourceProbe)
+			}
+			m.probes[job.SourcePath] = sourceProbe{inputSize: stat.Size(), duration: duration}
+		}
+		m.mu.Unlock()
+	}
+}
+
+// unprobedJobs returns the pending optimize jobs still to be probed, marking them probed
+func (m *Manager) unprobedJobs() []*Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []*Job
+	for _, job := range m.jobs {
+		if job.Status == StatusPending && job.Type == JobTypeOptimize && !job.probed {
+			job.probed = true
+			result = append(result, job)
+		}
+	}
+	return result
+}
@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// DefaultMaxQueuedJobs is the pending job limit when the config doesn't set one
+const DefaultMaxQueuedJobs = 1000
+
+// ErrQueueFull is returned by AddJob when the pending job limit is reached
+var ErrQueueFull = errors.New("job queue is full")
+
+// Queue move positions accepted by MoveJob
+const (
+	MoveTop    = "top"
+	MoveBottom = "bottom"
+)
+
+// sortPending orders pending jobs by priority (highest first), then creation time, then ID
+func sortPending(pending []*Job) {
+	sort.Slice(pending, func(i, j int) bool {
+		if pending[i].Priority != pending[j].Priority {
+			return pending[i].Priority > pending[j].Priority
+		}
+		if !pending[i].CreatedAt.Equal(pending[j].CreatedAt) {
+			return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+		}
+		return pending[i].ID < pending[j].ID
+	})
+}
+
+// pendingLocked returns all pending jobs in queue order. Caller must hold m.mu.
+func (m *Manager) pendingLocked() []*Job {
+	var pending []*Job
+	for _, job := range m.jobs {
+		if job.Status == StatusPending {
+			pending = append(pending, job)
+		}
+	}
+	sortPending(pending)
+	return pending
+}
+
+// QueuePositions returns the 1-based position of every pending job, ordered by priority
+// (highest first) and then by creation time. Positions are computed on each call rather
+// than stored, so they stay correct as jobs start, finish or are cancelled.
+func (m *Manager) QueuePositions() map[string]int {
+	m.mu.RLock()
+	pending := m.pendingLocked()
+	m.mu.RUnlock()
+
+	positions := make(map[string]int, len(pending))
+	for i, job := range pending {
+		positions[job.ID] = i + 1
+	}
+	return positions
+}
+
+// pendingCountLocked returns the number of pending jobs. Caller must hold m.mu.
+func (m *Manager) pendingCountLocked() int {
+	count := 0
+	for _, job := range m.jobs {
+		if job.Status == StatusPending {
+			count++
+		}
+	}
+	return count
+}
+
+// wake signals a worker that a job is pending without blocking. A full channel already
+// has signals waiting, and workers claim every pending job once woken.
+func (m *Manager) wake(job *Job) {
+	select {
+	case m.queue <- job:
+	default:
+	}
+}
+
+// claimNext marks the first pending job in queue order as processing and returns it,
+// or nil if nothing is pending. Entries on m.queue only wake a worker, the job it runs
+// is picked here so priority changes after enqueueing are honoured.
+func (m *Manager) claimNext() *Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending := m.pendingLocked()
+	if len(pending) == 0 {
+		return nil
+	}
+	job := pending[0]
+	job.Status = StatusProcessing
+	return job
+}
+
+// MoveJob sends a pending job to the top or bottom of the queue by giving it a priority
+// above the highest or below the lowest of the other pending jobs
+func (m *Manager) MoveJob(id, position string) (*Job, error) {
+	if position != MoveTop && position != MoveBottom {
+		return nil, fmt.Errorf("invalid position %q (must be %s or %s)", position, MoveTop, MoveBottom)
+	}
+
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("job %s not found", id)
+	}
+	if job.Status != StatusPending {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("job %s is %s and cannot be moved", id, job.Status)
+	}
+
+	var others []*Job
+	for _, other := range m.pendingLocked() {
+		if other != job {
+			others = append(others, other)
+		}
+	}
+	// others is sorted highest priority first
+	if len(others) > 0 {
+		if position == MoveTop {
+			job.Priority = others[0].Priority + 1
+		} else {
+			job.Priority = others[len(others)-1].Priority - 1
+		}
+	}
+	m.mu.Unlock()
+
+	m.saveJob(job)
+	return job, nil
+}
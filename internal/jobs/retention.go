@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// retentionInterval is how often finished jobs are pruned
+const retentionInterval = time.Hour
+
+// retentionLoop prunes finished jobs on start and then periodically until Stop
+func (m *Manager) retentionLoop() {
+	defer m.wg.Done()
+
+	m.PruneJobs(time.Now())
+
+	ticker := time.NewTicker(retentionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case now := <-ticker.C:
+			m.PruneJobs(now)
+		}
+	}
+}
+
+// PruneJobs applies the retention policy: finished jobs older than JobRetentionDays
+// are removed, then the oldest finished jobs until at most MaxStoredJobs remain.
+// Pending and processing jobs are never pruned. Returns the number of jobs removed.
+func (m *Manager) PruneJobs(now time.Time) int {
+	cfg := m.config.Snapshot()
+	days, limit := cfg.JobRetentionDays, cfg.MaxStoredJobs
+	if days <= 0 && limit <= 0 {
+		return 0
+	}
+
+	m.mu.Lock()
+	var finished []*Job
+	for _, job := range m.jobs {
+		if job.Status == StatusPending || job.Status == StatusProcessing {
+			continue
+		}
+		finished = append(finished, job)
+	}
+
+	// Oldest first
+	sort.Slice(finished, func(i, j int) bool {
+		return finishedAt(finished[i]).Before(finishedAt(finished[j]))
+	})
+
+	removed := 0
+	if days > 0 {
+		cutoff := now.AddDate(0, 0, -days)
+		for _, job := range finished {
+			if !finishedAt(job).Before(cutoff) {
+				break
+			}
+			delete(m.jobs, job.ID)
+			removed++
+		}
+		finished = finished[removed:]
+	}
+	if limit > 0 {
+		for _, job := range finished {
+			if len(m.jobs) <= limit {
+				break
+			}
+			delete(m.jobs, job.ID)
+			removed++
+		}
+	}
+	m.mu.Unlock()
+
+	if removed > 0 {
+		log.Printf("Pruned %d finished jobs by retention policy", removed)
+		if err := m.Save(); err != nil {
+			log.Printf("Warning: Failed to persist jobs after pruning: %v", err)
+		}
+	}
+	return removed
+}
+
+// finishedAt is when a job ended, falling back to its creation for jobs
+// cancelled before they started
+func finishedAt(job *Job) time.Time {
+	if !job.CompletedAt.IsZero() {
+		return job.CompletedAt
+	}
+	return job.CreatedAt
+}
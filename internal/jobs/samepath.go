@@ -0,0 +1,45 @@
+package jobs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SamePath reports whether two paths name the same file: equal once cleaned and
+// resolved through symlinks, or existing files that are hard links of each other
+func SamePath(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	if resolvePath(a) == resolvePath(b) {
+		return true
+	}
+	aInfo, aErr := os.Stat(a)
+	bInfo, bErr := os.Stat(b)
+	return aErr == nil && bErr == nil && os.SameFile(aInfo, bInfo)
+}
+
+// resolvePath returns the absolute path with symlinks resolved. A file that doesn't
+// exist yet is resolved through its directory.
+func resolvePath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(path)); err == nil {
+		return filepath.Join(dir, filepath.Base(path))
+	}
+	return path
+}
+
+// replacementPath is where an output that replaces its source is encoded before being
+// renamed over it: a hidden file in the same directory, keeping the extension so ffmpeg
+// picks the same muxer
+func replacementPath(path, jobID string) string {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(filepath.Base(path), ext)
+	return filepath.Join(filepath.Dir(path), "."+stem+".replacing-"+jobID+ext)
+}
@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"github.com/Vasteva/MediaConverter/internal/media"
+)
+
+// sourceProbe is what probeLoop learned about a pending job's source, cached by path
+type sourceProbe struct {
+	inputSize int64
+	duration  float64
+}
+
+// EstimateOutputSize estimates the size of a source once encoded: its duration at
+// targetKbps, capped at the source size so sources already under the target are expected
+// to stay the same size. 0 if the duration or target is unknown.
+func EstimateOutputSize(info *media.MediaInfo, targetKbps int) int64 {
+	if info == nil || info.Duration <= 0 || targetKbps <= 0 {
+		return 0
+	}
+	size := int64(info.Duration * float64(targetKbps) * 1000 / 8)
+	if info.Size > 0 && size > info.Size {
+		size = info.Size
+	}
+	return size
+}
+
+// PendingSavings returns the number of pending optimize jobs and the bytes encoding them
+// is estimated to save, at the EfficientMaxBitrateKbps target. Only sources probeLoop has
+// already probed are estimated, probes of jobs that left the queue are dropped.
+func (m *Manager) PendingSavings() (int, int64) {
+	targetKbps := m.config.Snapshot().EfficientMaxBitrateKbps
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	files := 0
+	var total int64
+	pending := make(map[string]bool)
+	for _, job := range m.jobs {
+		if job.Status != StatusPending || job.Type != JobTypeOptimize {
+			continue
+		}
+		files++
+		pending[job.SourcePath] = true
+		probe, ok := m.probes[job.SourcePath]
+		if !ok {
+			continue
+		}
+		output := EstimateOutputSize(&media.MediaInfo{Duration: probe.duration, Size: probe.inputSize}, targetKbps)
+		// Sources expected to grow save nothing
+		if saved := probe.inputSize - output; output > 0 && saved > 0 {
+			total += saved
+		}
+	}
+	for path := range m.probes {
+		if !pending[path] {
+			delete(m.probes, path)
+		}
+	}
+	return files, total
+}
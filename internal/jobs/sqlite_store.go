@@ -0,0 +1,179 @@
+package jobs
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// SQLiteStore keeps jobs in a SQLite table, one row per job. An update to one job is
+// saved with SaveJob, which encodes and writes only that job. Full saves only write the
+// jobs that changed since the last save and delete the ones that are gone.
+type SQLiteStore struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	saved map[string]string // Encoded job last written, by ID
+}
+
+const jobsSchema = `
+CREATE TABLE IF NOT EXISTS jobs (
+	id           TEXT PRIMARY KEY,
+	type         TEXT NOT NULL,
+	status       TEXT NOT NULL,
+	source_path  TEXT NOT NULL,
+	created_at   INTEGER NOT NULL,
+	completed_at INTEGER NOT NULL,
+	version      INTEGER NOT NULL,
+	data         TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS jobs_status ON jobs (status, created_at);
+CREATE INDEX IF NOT EXISTS jobs_source ON jobs (source_path);
+CREATE INDEX IF NOT EXISTS jobs_completed ON jobs (completed_at);
+`
+
+// NewSQLiteStore creates the jobs table in db if needed
+func NewSQLiteStore(db *sql.DB) (*SQLiteStore, error) {
+	if _, err := db.Exec(jobsSchema); err != nil {
+		return nil, fmt.Errorf("failed to create jobs table: %w", err)
+	}
+	return &SQLiteStore{db: db, saved: make(map[string]string)}, nil
+}
+
+// LoadJobs reads every job, oldest first. Rows are migrated from the version they were
+// written with like the jobs file, a row that fails to decode is skipped with a warning.
+func (s *SQLiteStore) LoadJobs() ([]*Job, error) {
+	jobList, saved, err := s.queryJobs(`SELECT id, version, data FROM jobs ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.saved = saved
+	s.mu.Unlock()
+	return jobList, nil
+}
+
+// queryJobs decodes the (id, version, data) rows of query, and returns the raw data by ID
+func (s *SQLiteStore) queryJobs(query string, args ...interface{}) ([]*Job, map[string]string, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobList []*Job
+	data := make(map[string]string)
+	for rows.Next() {
+		var id, raw string
+		var version int
+		if err := rows.Scan(&id, &version, &raw); err != nil {
+			return nil, nil, err
+		}
+		job, err := decodeJob([]byte(raw), version)
+		if err != nil {
+			log.Printf("[Jobs] Warning: skipping stored job %s: %v", id, err)
+			continue
+		}
+		jobList = append(jobList, job)
+		data[id] = raw
+	}
+	return jobList, data, rows.Err()
+}
+
+// SaveJobs writes the jobs that changed since the last save and deletes the stored jobs
+// missing from jobList, in one transaction
+func (s *SQLiteStore) SaveJobs(jobList []*Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := make(map[string]string, len(jobList))
+	var changed []*Job
+	for _, job := range jobList {
+		raw, err := encodeJob(job)
+		if err != nil {
+			return fmt.Errorf("failed to marshal job %s: %w", job.ID, err)
+		}
+		current[job.ID] = string(raw)
+		if s.saved[job.ID] != string(raw) {
+			changed = append(changed, job)
+		}
+	}
+	var removed []string
+	for id := range s.saved {
+		if _, ok := current[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	upsert, err := tx.Prepare(upsertJob)
+	if err != nil {
+		return err
+	}
+	defer upsert.Close()
+	for _, job := range changed {
+		if _, err := upsert.Exec(jobRow(job, current[job.ID])...); err != nil {
+			return fmt.Errorf("failed to save job %s: %w", job.ID, err)
+		}
+	}
+	for _, id := range removed {
+		if _, err := tx.Exec(`DELETE FROM jobs WHERE id = ?`, id); err != nil {
+			return fmt.Errorf("failed to delete job %s: %w", id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.saved = current
+	return nil
+}
+
+// SaveJob writes one job if it changed since the last save
+func (s *SQLiteStore) SaveJob(job *Job) error {
+	raw, err := encodeJob(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job %s: %w", job.ID, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saved[job.ID] == string(raw) {
+		return nil
+	}
+	if _, err := s.db.Exec(upsertJob, jobRow(job, string(raw))...); err != nil {
+		return fmt.Errorf("failed to save job %s: %w", job.ID, err)
+	}
+	s.saved[job.ID] = string(raw)
+	return nil
+}
+
+const upsertJob = `INSERT INTO jobs (id, type, status, source_path, created_at, completed_at, version, data)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT (id) DO UPDATE SET type = excluded.type, status = excluded.status,
+		source_path = excluded.source_path, created_at = excluded.created_at,
+		completed_at = excluded.completed_at, version = excluded.version, data = excluded.data`
+
+// jobRow returns the upsertJob arguments for a job encoded as raw
+func jobRow(job *Job, raw string) []interface{} {
+	return []interface{}{job.ID, job.Type, job.Status, job.SourcePath,
+		unixNano(job.CreatedAt), unixNano(job.CompletedAt), jobsFileVersion, raw}
+}
+
+// unixNano stores a time as nanoseconds, 0 for the zero time
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
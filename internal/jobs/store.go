@@ -0,0 +1,186 @@
+package jobs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/Vasteva/MediaConverter/internal/system"
+)
+
+// Store persists jobs. The Manager keeps every job in memory and hands the store the
+// full set on each save, LoadJobs returns what was last saved.
+type Store interface {
+	LoadJobs() ([]*Job, error)
+	SaveJobs(jobList []*Job) error
+}
+
+// JobSaver is implemented by stores that can write a single job, so an update to one
+// job doesn't encode every other job
+type JobSaver interface {
+	SaveJob(job *Job) error
+}
+
+// FileStore keeps jobs in a versioned JSON file, written atomically with a backup
+type FileStore struct {
+	Path string
+}
+
+func (s *FileStore) LoadJobs() ([]*Job, error) {
+	return readJobsFile(s.Path)
+}
+
+func (s *FileStore) SaveJobs(jobList []*Job) error {
+	data, err := encodeJobsFile(jobList)
+	if err != nil {
+		return fmt.Errorf("failed to marshal jobs: %w", err)
+	}
+	if err := system.WriteFileAtomic(s.Path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write jobs file: %w", err)
+	}
+	return nil
+}
+
+// jobsFileVersion is the current format of the jobs file. Version 0 is the original
+// bare array of jobs, from 1 on the jobs are wrapped in a jobsFile envelope.
+const jobsFileVersion = 1
+
+// jobsFile is the on-disk envelope of persisted jobs
+type jobsFile struct {
+	Version int               `json:"version"`
+	Jobs    []json.RawMessage `json:"jobs"`
+}
+
+// jobMigrations upgrade one persisted job, as its raw fields, from version i to i+1.
+// Add a step here whenever a Job field is renamed or changes meaning.
+var jobMigrations = []func(fields map[string]json.RawMessage) error{
+	// 0 -> 1: only the envelope was added
+	func(fields map[string]json.RawMessage) error { return nil },
+}
+
+// jobFieldNames are the JSON names of the persisted Job fields
+var jobFieldNames = func() map[string]bool {
+	names := make(map[string]bool)
+	t := reflect.TypeOf(Job{})
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("json")
+		if name, _, _ := strings.Cut(tag, ","); name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}()
+
+// decodeJobsFile reads jobs in any known format, migrating them to the current one.
+// A job that fails to migrate or decode is skipped with a warning, the rest still load.
+// Fields this version doesn't know are kept on the job so saving doesn't drop them.
+func decodeJobsFile(data []byte) ([]*Job, error) {
+	file := jobsFile{}
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &file.Jobs); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal jobs: %w", err)
+		}
+	} else if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal jobs file: %w", err)
+	}
+
+	if file.Version > jobsFileVersion {
+		log.Printf("[Jobs] Warning: jobs file version %d is newer than supported version %d, loading what is understood",
+			file.Version, jobsFileVersion)
+	}
+
+	jobList := make([]*Job, 0, len(file.Jobs))
+	for i, raw := range file.Jobs {
+		job, err := decodeJob(raw, file.Version)
+		if err != nil {
+			log.Printf("[Jobs] Warning: skipping persisted job %d: %v", i, err)
+			continue
+		}
+		jobList = append(jobList, job)
+	}
+	return jobList, nil
+}
+
+// decodeJob migrates one raw job from version to the current format and decodes it
+func decodeJob(raw json.RawMessage, version int) (*Job, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	for v := version; v < jobsFileVersion; v++ {
+		if err := jobMigrations[v](fields); err != nil {
+			return nil, fmt.Errorf("migration from version %d failed: %w", v, err)
+		}
+	}
+
+	migrated, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{}
+	if err := json.Unmarshal(migrated, job); err != nil {
+		return nil, err
+	}
+	if job.ID == "" {
+		return nil, fmt.Errorf("job has no id")
+	}
+
+	for name, value := range fields {
+		if !jobFieldNames[name] {
+			if job.unknownFields == nil {
+				job.unknownFields = make(map[string]json.RawMessage)
+			}
+			job.unknownFields[name] = value
+		}
+	}
+	return job, nil
+}
+
+// encodeJobsFile writes jobs in the current format, including any fields kept from
+// a newer version
+func encodeJobsFile(jobList []*Job) ([]byte, error) {
+	file := jobsFile{Version: jobsFileVersion, Jobs: make([]json.RawMessage, 0, len(jobList))}
+	for _, job := range jobList {
+		raw, err := encodeJob(job)
+		if err != nil {
+			return nil, err
+		}
+		file.Jobs = append(file.Jobs, raw)
+	}
+	return json.MarshalIndent(file, "", "  ")
+}
+
+// encodeJob marshals one job in the current format, including any fields kept from a
+// newer version
+func encodeJob(job *Job) (json.RawMessage, error) {
+	raw, err := json.Marshal(job)
+	if err != nil || len(job.unknownFields) == 0 {
+		return raw, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range job.unknownFields {
+		if _, ok := fields[name]; !ok {
+			fields[name] = value
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// readJobsFile loads the jobs file at path, falling back to its backup when the file
+// is missing or corrupt
+func readJobsFile(path string) ([]*Job, error) {
+	var jobList []*Job
+	err := system.LoadWithBackup(path, func(data []byte) (err error) {
+		jobList, err = decodeJobsFile(data)
+		return err
+	})
+	return jobList, err
+}
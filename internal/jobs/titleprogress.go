@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"fmt"
+	"sync"
+)
+
+// titleProgress combines the progress of the titles of one extraction into the job's
+// percentage, each title weighted by its duration. Titles may report from several
+// goroutines at once.
+type titleProgress struct {
+	mu       sync.Mutex
+	weights  []float64
+	percents []int
+	done     int
+}
+
+// newTitleProgress weights titles by their durations in seconds. If any duration is
+// unknown (0) every title counts the same.
+func newTitleProgress(durations []int) *titleProgress {
+	weights := make([]float64, len(durations))
+	for i, d := range durations {
+		if d <= 0 {
+			weights = nil
+			break
+		}
+		weights[i] = float64(d)
+	}
+	if weights == nil {
+		weights = make([]float64, len(durations))
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	return &titleProgress{weights: weights, percents: make([]int, len(durations))}
+}
+
+// total is the weighted percentage, with mu held
+func (p *titleProgress) total() int {
+	var sum, done float64
+	for i, w := range p.weights {
+		sum += w
+		done += w * float64(p.percents[i])
+	}
+	if sum == 0 {
+		return 0
+	}
+	return int(done / sum)
+}
+
+// report records a title's percentage on the job. Writes from different titles are
+// serialized so the job never goes back to an older total.
+func (p *titleProgress) report(job *Job, title, percent int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.percents[title] = percent
+	job.Progress = p.total()
+}
+
+// finish marks a title extracted and updates the job's status detail
+func (p *titleProgress) finish(job *Job, title int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.percents[title] = 100
+	p.done++
+	job.Progress = p.total()
+	job.StatusDetail = fmt.Sprintf("Extracted %d of %d titles", p.done, len(p.percents))
+}
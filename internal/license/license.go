@@ -6,32 +6,48 @@ import (
 	"strings"
 )
 
+// LicenseInfo is what a license key encodes
+type LicenseInfo struct {
+	UserID   string
+	Plan     string
+	Checksum string
+}
+
 // Validate checks if the provided license key is valid for a premium subscription.
 // For the purpose of this demonstration, any key starting with "VASTIVA-PRO-"
 // that ends with a correct checksum is considered valid.
 func Validate(key string) bool {
+	_, err := Parse(key)
+	return err == nil
+}
+
+// Parse decodes a license key into its parts, failing when it is malformed or its
+// checksum doesn't match
+func Parse(key string) (LicenseInfo, error) {
 	key = strings.TrimSpace(key)
 	if key == "" {
-		return false
+		return LicenseInfo{}, fmt.Errorf("license key is empty")
 	}
 
 	// Simple check: start with prefix
 	if !strings.HasPrefix(key, "VASTIVA-PRO-") {
-		return false
+		return LicenseInfo{}, fmt.Errorf("license key doesn't start with VASTIVA-PRO-")
 	}
 
 	parts := strings.Split(key, "-")
 	if len(parts) != 4 {
-		return false
+		return LicenseInfo{}, fmt.Errorf("license key has %d parts, expected VASTIVA-PRO-USERID-CHECKSUM", len(parts))
 	}
+	info := LicenseInfo{UserID: parts[2], Plan: "Vastiva Pro", Checksum: parts[3]}
 
 	// Example: VASTIVA-PRO-USERID-CHECKSUM
 	// In a real app, this would check a remote server or use asymmetric signatures.
 	// Here we just check if the last part is the first 4 chars of a hash of the previous parts.
 	payload := parts[0] + parts[1] + parts[2]
-	expected := generateChecksum(payload)
-
-	return strings.EqualFold(parts[3], expected)
+	if expected := generateChecksum(payload); !strings.EqualFold(parts[3], expected) {
+		return info, fmt.Errorf("license key checksum %s doesn't match", parts[3])
+	}
+	return info, nil
 }
 
 // Generate creates a valid license key for a given user ID
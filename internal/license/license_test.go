@@ -51,3 +51,30 @@ func TestGetPlanName(t *testing.T) {
 		t.Error("expected Standard for invalid key")
 	}
 }
+
+func TestParse(t *testing.T) {
+	info, err := Parse(" VASTIVA-PRO-USER1-2328 ")
+	if err != nil {
+		t.Fatalf("expected a valid key, got %v", err)
+	}
+	if info != (LicenseInfo{UserID: "USER1", Plan: "Vastiva Pro", Checksum: "2328"}) {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	// Generated keys parse back to their user
+	if info, err := Parse(Generate("support desk")); err != nil || info.UserID != "SUPPORT DESK" {
+		t.Errorf("expected the generated key to parse, got %+v, %v", info, err)
+	}
+
+	for _, key := range []string{"", "WRONG-PRO-USER1-2328", "VASTIVA-PRO-USER1", "VASTIVA-PRO-USER-1-2328"} {
+		if _, err := Parse(key); err == nil {
+			t.Errorf("expected %q to be rejected as malformed", key)
+		}
+	}
+
+	// A bad checksum still reports what the key claims
+	info, err = Parse("VASTIVA-PRO-USER1-0000")
+	if err == nil || info.UserID != "USER1" {
+		t.Errorf("expected a checksum error with the user ID, got %+v, %v", info, err)
+	}
+}
@@ -0,0 +1,134 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Chapter generation settings
+const (
+	SceneThreshold     = 0.4  // Scene change score (0-1) that counts as a cut
+	MinChapterSeconds  = 180  // Shortest chapter kept from scene detection
+	ChapterIntervalSec = 600  // Chapter length when no usable cuts are found
+	chapterTimeBase    = 1000 // Chapter times are written in milliseconds
+)
+
+// DetectScenes returns the timestamps in seconds of scene changes in the video
+func (f *FFmpegWrapper) DetectScenes(ctx context.Context, inputPath string) ([]float64, error) {
+	args := []string{
+		"-hide_banner",
+		"-nostats",
+		"-i", inputPath,
+		"-map", "0:v:0",
+		"-vf", fmt.Sprintf("select='gt(scene,%.2f)',showinfo", SceneThreshold),
+		"-f", "null", "-",
+	}
+
+	cmd := exec.CommandContext(ctx, f.ffmpegPath, args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("scene detection failed: %w", err)
+	}
+
+	return parseSceneTimes(string(output)), nil
+}
+
+var showinfoPtsRegex = regexp.MustCompile(`Parsed_showinfo.*\bpts_time:\s*([\d.]+)`)
+
+// parseSceneTimes extracts the frame times showinfo prints for each selected frame
+func parseSceneTimes(output string) []float64 {
+	var times []float64
+	for _, line := range strings.Split(output, "\n") {
+		if m := showinfoPtsRegex.FindStringSubmatch(line); m != nil {
+			if t, err := strconv.ParseFloat(m[1], 64); err == nil {
+				times = append(times, t)
+			}
+		}
+	}
+	return times
+}
+
+// ChapterStarts picks chapter start times from scene cuts, dropping cuts that would
+// leave a chapter shorter than MinChapterSeconds. Without usable cuts, chapters fall
+// back to every ChapterIntervalSec. The first chapter always starts at 0.
+func ChapterStarts(scenes []float64, duration float64) []float64 {
+	starts := []float64{0}
+	for _, t := range scenes {
+		if t-starts[len(starts)-1] >= MinChapterSeconds && duration-t >= MinChapterSeconds {
+			starts = append(starts, t)
+		}
+	}
+	if len(starts) > 1 {
+		return starts
+	}
+
+	for t := float64(ChapterIntervalSec); duration-t >= MinChapterSeconds; t += ChapterIntervalSec {
+		starts = append(starts, t)
+	}
+	return starts
+}
+
+// ChapterMetadata renders chapter start times as an FFMETADATA1 file, each chapter
+// ending where the next begins and the last at duration
+func ChapterMetadata(starts []float64, duration float64) string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for i, start := range starts {
+		end := duration
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		fmt.Fprintf(&b, "\n[CHAPTER]\nTIMEBASE=1/%d\nSTART=%d\nEND=%d\ntitle=Chapter %d\n",
+			chapterTimeBase, int64(start*chapterTimeBase), int64(end*chapterTimeBase), i+1)
+	}
+	return b.String()
+}
+
+// AddChapters muxes chapters starting at the given times into videoPath without
+// re-encoding, replacing any chapters it already has
+func (f *FFmpegWrapper) AddChapters(ctx context.Context, videoPath string, starts []float64, duration float64) error {
+	ext := filepath.Ext(videoPath)
+	base := strings.TrimSuffix(videoPath, ext)
+	metaPath := base + ".chapters.txt"
+	tmpPath := base + ".muxing" + ext
+
+	if err := os.WriteFile(metaPath, []byte(ChapterMetadata(starts, duration)), 0644); err != nil {
+		return fmt.Errorf("failed to write chapter metadata: %w", err)
+	}
+	defer os.Remove(metaPath)
+
+	args := f.buildChapterMuxArgs(videoPath, metaPath, tmpPath)
+	cmd := exec.CommandContext(ctx, f.ffmpegPath, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("chapter mux failed: %w\nOutput: %s", err, string(output))
+	}
+
+	if err := os.Rename(tmpPath, videoPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace output: %w", err)
+	}
+	return nil
+}
+
+// buildChapterMuxArgs constructs the FFmpeg arguments to take the chapters from a
+// metadata file and everything else from the video
+func (f *FFmpegWrapper) buildChapterMuxArgs(videoPath, metaPath, outputPath string) []string {
+	return []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-i", videoPath,
+		"-f", "ffmetadata", "-i", metaPath,
+		"-map", "0",
+		"-map_metadata", "0",
+		"-map_chapters", "1",
+		"-c", "copy",
+		"-y", outputPath,
+	}
+}
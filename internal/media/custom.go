@@ -0,0 +1,95 @@
+package media
+
+import (
+	"fmt"
+	"strings"
+)
+
+// allowedFilters are the video filters custom filters may use. Filters that read or
+// write files, load plugins or listen on the network, such as movie, subtitles,
+// drawtext, lut3d, psnr, frei0r and zmq, are left out.
+var allowedFilters = map[string]bool{
+	// Denoise and sharpen
+	"hqdn3d": true, "nlmeans": true, "atadenoise": true, "bm3d": true, "removegrain": true,
+	"unsharp": true, "cas": true, "smartblur": true, "gblur": true, "boxblur": true,
+	"deband": true, "gradfun": true, "deblock": true, "dedot": true,
+	// Deinterlace and telecine
+	"yadif": true, "bwdif": true, "w3fdif": true, "kerndeint": true, "fieldmatch": true,
+	"decimate": true, "pullup": true, "mpdecimate": true, "dejudder": true, "fieldorder": true,
+	// Geometry
+	"crop": true, "pad": true, "scale": true, "setsar": true, "setdar": true,
+	"hflip": true, "vflip": true, "transpose": true, "rotate": true, "delogo": true,
+	// Color
+	"eq": true, "hue": true, "colorbalance": true, "colorlevels": true, "colorspace": true,
+	"colormatrix": true, "zscale": true, "tonemap": true, "format": true, "normalize": true,
+	"histeq": true, "vibrance": true, "selectivecolor": true,
+	// Timing and grain
+	"fps": true, "framerate": true, "setpts": true, "noise": true, "null": true,
+}
+
+// ValidateVideoFilters checks custom video filters, a comma-separated chain such as
+// "hqdn3d=4,unsharp". The chain is appended to the generated one, so it may not add
+// graph labels or further chains, and may only use allowedFilters. Empty is no filters.
+func ValidateVideoFilters(filters string) error {
+	filters = strings.TrimSpace(filters)
+	if filters == "" {
+		return nil
+	}
+	if strings.ContainsAny(filters, ";[]\n\r") {
+		return fmt.Errorf("invalid custom video filters %q: labels and multiple chains aren't allowed", filters)
+	}
+	for _, filter := range splitFilterChain(filters) {
+		name, _, _ := strings.Cut(strings.TrimSpace(filter), "=")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return fmt.Errorf("invalid custom video filters %q: empty filter", filters)
+		}
+		if !allowedFilters[strings.ToLower(name)] {
+			return fmt.Errorf("invalid custom video filters %q: %s isn't an allowed filter", filters, name)
+		}
+	}
+	return nil
+}
+
+// splitFilterChain splits a filter chain at the commas between filters, leaving commas
+// escaped with a backslash inside filter options
+func splitFilterChain(chain string) []string {
+	var filters []string
+	start := 0
+	for i := 0; i < len(chain); i++ {
+		switch chain[i] {
+		case '\\':
+			i++
+		case ',':
+			filters = append(filters, chain[start:i])
+			start = i + 1
+		}
+	}
+	return append(filters, chain[start:])
+}
+
+// appendCustomFilters adds the custom video filters of opts to a generated chain. The
+// filters run on the CPU, frames still in GPU memory are downloaded for them and, for
+// NVIDIA, uploaded again. The VAAPI chains end with their own upload.
+func appendCustomFilters(filters []string, opts TranscodeOptions) []string {
+	custom := strings.TrimSpace(opts.CustomVideoFilters)
+	if custom == "" {
+		return filters
+	}
+	if hybridDecode(opts) {
+		// Already downloaded for the CPU encoder
+		return append(filters, custom)
+	}
+	switch opts.GPUVendor {
+	case GPUVendorNvidia:
+		upload := "hwupload_cuda"
+		if opts.GPUDevice != "" {
+			upload += "=device=" + opts.GPUDevice
+		}
+		return append(filters, "hwdownload", "format="+hwDownloadFormats, custom, upload)
+	case GPUVendorIntel, GPUVendorAMD:
+		return append(filters, "hwdownload", "format="+hwDownloadFormats, custom)
+	default:
+		return append(filters, custom)
+	}
+}
@@ -0,0 +1,129 @@
+package media
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// DiscImageExtensions are the disc image formats that can be extracted with MakeMKV
+var DiscImageExtensions = []string{".iso", ".img", ".mdf", ".cue", ".bin"}
+
+// IsDiscImage reports whether path has a disc image extension
+func IsDiscImage(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range DiscImageExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// IsOpticalDrive reports whether a disc source is read from a drive, a /dev node or a
+// MakeMKV dev: or disc: source, rather than from an image or folder
+func IsOpticalDrive(path string) bool {
+	if strings.HasPrefix(path, "dev:") || strings.HasPrefix(path, "disc:") {
+		return true
+	}
+	source, err := DiscSource(path)
+	return err == nil && strings.HasPrefix(source, "dev:")
+}
+
+// DiscSource returns the makemkvcon source argument for a disc image, disc folder or
+// device. Image files are opened with iso:, which reads 2048-byte sectors. A bin/cue
+// pair is resolved to its data file and rejected if the cue sheet describes raw
+// 2352-byte sectors, which MakeMKV can't read.
+//
+// The result is a single argv element. makemkvcon splits it at the first colon only, so
+// the path needs no quoting, but it is made absolute since makemkvcon resolves relative
+// paths against its own idea of the working directory.
+func DiscSource(path string) (string, error) {
+	path, err := makemkvPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".iso", ".img", ".mdf":
+		return "iso:" + path, nil
+	case ".cue":
+		bin, err := resolveCueSheet(path)
+		if err != nil {
+			return "", err
+		}
+		return "iso:" + bin, nil
+	case ".bin":
+		// Prefer the cue sheet when there is one, it tells us the sector format
+		cue := strings.TrimSuffix(path, filepath.Ext(path)) + ".cue"
+		if _, err := os.Stat(cue); err == nil {
+			return DiscSource(cue)
+		}
+		return "iso:" + path, nil
+	}
+
+	if strings.HasPrefix(path, "/dev/") {
+		return "dev:" + path, nil
+	}
+	// VIDEO_TS/BDMV folders and anything else MakeMKV can open as files
+	return "file:" + path, nil
+}
+
+// makemkvPath cleans path into an absolute path for a makemkvcon argument. Control
+// characters are rejected, a newline would also break the line-based robot output.
+func makemkvPath(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path is empty")
+	}
+	if strings.IndexFunc(path, unicode.IsControl) >= 0 {
+		return "", fmt.Errorf("path %q contains control characters", path)
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	return abs, nil
+}
+
+// resolveCueSheet returns the data file of a single-file cue sheet
+func resolveCueSheet(cuePath string) (string, error) {
+	f, err := os.Open(cuePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open cue sheet: %w", err)
+	}
+	defer f.Close()
+
+	var dataFile string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "FILE":
+			if dataFile != "" {
+				return "", fmt.Errorf("multi-file cue sheets are not supported")
+			}
+			// FILE "name with spaces.bin" BINARY
+			line := strings.TrimSpace(scanner.Text())[len(fields[0]):]
+			name := strings.TrimSpace(line[:strings.LastIndex(line, " ")])
+			dataFile = filepath.Join(filepath.Dir(cuePath), strings.Trim(name, `"`))
+		case "TRACK":
+			if len(fields) >= 3 && !strings.HasSuffix(fields[2], "/2048") {
+				return "", fmt.Errorf("cue sheet track mode %s uses raw sectors, convert the image to ISO first", fields[2])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read cue sheet: %w", err)
+	}
+	if dataFile == "" {
+		return "", fmt.Errorf("cue sheet %s references no data file", cuePath)
+	}
+	return dataFile, nil
+}
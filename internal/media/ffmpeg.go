@@ -1,13 +1,19 @@
 package media
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/Vasteva/MediaConverter/internal/system"
 )
 
 // GPUVendor represents the hardware acceleration type
@@ -29,33 +35,105 @@ const (
 	PresetSlow   QualityPreset = "slow"
 )
 
+// Presets are the accepted quality presets, fastest first
+var Presets = []QualityPreset{PresetFast, PresetMedium, PresetSlow}
+
+// UpscaleResolutions are the target resolutions accepted for AI upscaling
+var UpscaleResolutions = []string{"1080p", "4k"}
+
+// VideoEncoders are the ffmpeg encoders used for each GPU vendor
+var VideoEncoders = map[GPUVendor]string{
+	GPUVendorNvidia: "hevc_nvenc",
+	GPUVendorIntel:  "hevc_vaapi",
+	GPUVendorAMD:    "hevc_vaapi",
+	GPUVendorCPU:    "libx265",
+}
+
+// AudioEncoders are the ffmpeg encoders used for each re-encoding audio codec
+var AudioEncoders = map[string]string{
+	"aac":  "aac",
+	"ac3":  "ac3",
+	"opus": "libopus",
+}
+
 // TranscodeOptions contains all parameters for FFmpeg transcoding
 type TranscodeOptions struct {
 	InputPath     string
 	OutputPath    string
 	GPUVendor     GPUVendor
+	GPUDevice     string // VAAPI render node or NVIDIA device index, empty for the default
 	Preset        QualityPreset
 	CRF           int
 	AudioCodec    string // "copy", "aac", "ac3"
+	AudioBitrate  string // Bitrate when re-encoding audio, e.g. "192k", empty for the codec default
 	Container     string // "mkv", "mp4"
 	TotalDuration float64
 	Upscale       bool   // Premium feature: AI Super Resolution
 	Resolution    string // "1080p", "4k"
+	MaxHeight     int    // Downscale sources taller than this, 0 for no cap
+	SourceHeight  int    // Height of the source video, 0 if unknown
+
+	HybridHWDecode bool // Decode with the GPU but encode with libx265 for better quality
+	CopyVideo      bool // Stream copy the video, audio and stream options still apply
+
+	// GPU encoder option overrides by name, see ParseEncoderTuning. Unset options keep
+	// the built-in values.
+	Tuning map[string]string
+
+	MaxBitrate string // Peak video bitrate cap, e.g. "8M" (empty = uncapped)
+	BufSize    string // VBV buffer size, defaults to MaxBitrate
+
+	NormalizeAudio bool                 // Apply EBU R128 loudnorm, re-encoding audio
+	Loudness       *LoudnessMeasurement // First-pass measurement for two-pass loudnorm
+
+	// Channels of the widest source audio track, 0 if unknown. Surround sources get a
+	// higher default opus bitrate.
+	AudioChannels int
+
+	StreamSelection StreamSelection // Which streams to keep, defaults to StreamsKeepAll
+	Languages       []string        // ISO 639-2 codes for StreamsKeepByLanguage
+
+	// Keep only the subtitle tracks in these languages (ISO 639-2), plus forced tracks in
+	// any language with KeepForcedSubtitles. Tracks are picked from Subtitles, the
+	// probed source tracks. Empty keeps the subtitles of StreamSelection.
+	SubtitleLanguages   []string
+	KeepForcedSubtitles bool
+	Subtitles           []SubtitleStream
+
+	// Filters appended to the generated video filter chain, after scaling and before any
+	// GPU upload, see ValidateVideoFilters. GPU decoded frames are still in GPU memory
+	// unless HybridHWDecode is set, so software filters need it or the CPU encoder.
+	CustomVideoFilters string
+	// Extra ffmpeg arguments placed just before the output path
+	CustomArgs []string
 }
 
 // FFmpegWrapper handles FFmpeg command execution
 type FFmpegWrapper struct {
-	ffmpegPath string
+	ffmpegPath  string
+	ffprobePath string
+	ffprobeErr  error // Why ffprobe couldn't be resolved, reported when probing
+
+	// ProbeTimeout bounds one ffprobe run of GetMediaInfo, so a corrupt or stalled
+	// source fails on its own instead of hanging the job (0 = DefaultProbeTimeout)
+	ProbeTimeout time.Duration
 }
 
-// NewFFmpegWrapper creates a new FFmpeg wrapper
-func NewFFmpegWrapper() (*FFmpegWrapper, error) {
-	// Check if ffmpeg is available
-	path, err := exec.LookPath("ffmpeg")
+// DefaultProbeTimeout is how long GetMediaInfo waits for ffprobe by default
+const DefaultProbeTimeout = 60 * time.Second
+
+// probeStderrLines is how many lines of ffprobe's stderr a probe error includes
+const probeStderrLines = 5
+
+// NewFFmpegWrapper creates a new FFmpeg wrapper. Empty paths are looked up in PATH.
+func NewFFmpegWrapper(ffmpegPath, ffprobePath string) (*FFmpegWrapper, error) {
+	path, err := system.ResolveTool("ffmpeg", ffmpegPath)
 	if err != nil {
-		return nil, fmt.Errorf("ffmpeg not found in PATH: %w", err)
+		return nil, err
 	}
-	return &FFmpegWrapper{ffmpegPath: path}, nil
+	f := &FFmpegWrapper{ffmpegPath: path}
+	f.ffprobePath, f.ffprobeErr = system.ResolveTool("ffprobe", ffprobePath)
+	return f, nil
 }
 
 // Transcode executes FFmpeg transcoding with the given options
@@ -81,40 +159,63 @@ func (f *FFmpegWrapper) buildFFmpegArgs(opts TranscodeOptions) []string {
 		"-stats",
 	}
 
-	// Hardware acceleration input
-	args = append(args, f.getHWAccelInputArgs(opts.GPUVendor)...)
+	// Hardware acceleration input, copied video isn't decoded
+	if !opts.CopyVideo {
+		args = append(args, f.getHWAccelInputArgs(opts.GPUVendor, opts.GPUDevice)...)
+	}
 
-	// Input file
+	// Input file, or URL for remote sources
+	args = append(args, remoteInputArgs(opts.InputPath)...)
 	args = append(args, "-i", opts.InputPath)
 
 	// Video encoding
-	args = append(args, f.getVideoEncoderArgs(opts)...)
-
-	// Audio encoding
-	args = append(args, f.getAudioEncoderArgs(opts.AudioCodec)...)
+	if opts.CopyVideo {
+		args = append(args, "-c:v", "copy")
+	} else {
+		args = append(args, f.getVideoEncoderArgs(opts)...)
+	}
 
-	// Subtitle handling (copy all)
-	args = append(args, "-c:s", "copy")
+	// Audio encoding, filtered audio can't be stream copied
+	audioCodec := opts.AudioCodec
+	if opts.NormalizeAudio {
+		args = append(args, "-af", loudnormFilter(opts.Loudness))
+		if audioCodec == "" || audioCodec == "copy" {
+			audioCodec = "aac"
+		}
+	}
+	args = append(args, f.getAudioEncoderArgs(audioCodec, opts.AudioBitrate, opts.AudioChannels)...)
 
-	// Map all streams
-	args = append(args, "-map", "0")
+	// Stream mapping and subtitle handling
+	args = append(args, getStreamArgs(opts)...)
+	if opts.Container == "mp4" {
+		args = append(args, "-movflags", "+faststart")
+	}
 
 	// Output file
+	args = append(args, opts.CustomArgs...)
 	args = append(args, "-y", opts.OutputPath)
 
 	return args
 }
 
-// getHWAccelInputArgs returns hardware acceleration input arguments
-func (f *FFmpegWrapper) getHWAccelInputArgs(vendor GPUVendor) []string {
+// DefaultRenderNode is the VAAPI device used when no GPU device is configured
+const DefaultRenderNode = "/dev/dri/renderD128"
+
+// getHWAccelInputArgs returns hardware acceleration input arguments. device selects the
+// GPU on multi-GPU hosts: a render node for VAAPI, a device index for CUDA.
+func (f *FFmpegWrapper) getHWAccelInputArgs(vendor GPUVendor, device string) []string {
 	switch vendor {
 	case GPUVendorNvidia:
+		if device != "" {
+			return []string{"-hwaccel", "cuda", "-hwaccel_device", device, "-hwaccel_output_format", "cuda"}
+		}
 		return []string{"-hwaccel", "cuda", "-hwaccel_output_format", "cuda"}
-	case GPUVendorIntel:
+	case GPUVendorIntel, GPUVendorAMD:
 		// Use VAAPI for Intel on Linux/Docker as it's more reliable than QSV in containers
-		return []string{"-hwaccel", "vaapi", "-hwaccel_device", "/dev/dri/renderD128", "-hwaccel_output_format", "vaapi"}
-	case GPUVendorAMD:
-		return []string{"-hwaccel", "vaapi", "-hwaccel_device", "/dev/dri/renderD128", "-hwaccel_output_format", "vaapi"}
+		if device == "" {
+			device = DefaultRenderNode
+		}
+		return []string{"-hwaccel", "vaapi", "-hwaccel_device", device, "-hwaccel_output_format", "vaapi"}
 	default:
 		return []string{}
 	}
@@ -134,24 +235,92 @@ func (f *FFmpegWrapper) getUpscaleFilter(opts TranscodeOptions) string {
 	// For maximum premium "WOW", we use high-quality Lanczos scaling
 	filter := fmt.Sprintf("scale=%d:%d:flags=lanczos", targetW, targetH)
 
-	// If the user has a GPU, we can try hardware accelerated scaling
-	if opts.GPUVendor == GPUVendorNvidia {
+	// If the user has a GPU, we can try hardware accelerated scaling. Hybrid decode
+	// downloads frames first, so they're scaled in software.
+	if opts.GPUVendor == GPUVendorNvidia && !hybridDecode(opts) {
 		filter = fmt.Sprintf("scale_cuda=%d:%d", targetW, targetH)
 	}
 
 	return filter
 }
 
+// getScaleFilter returns the upscale filter when upscaling, otherwise the resolution cap
+func (f *FFmpegWrapper) getScaleFilter(opts TranscodeOptions) string {
+	if opts.Upscale {
+		return f.getUpscaleFilter(opts)
+	}
+	return f.getDownscaleFilter(opts)
+}
+
+// getDownscaleFilter returns the filter capping the output height at MaxHeight while
+// keeping the aspect ratio. Sources within the cap are left alone, when the source height
+// is unknown ffmpeg compares it instead.
+func (f *FFmpegWrapper) getDownscaleFilter(opts TranscodeOptions) string {
+	if opts.MaxHeight <= 0 || (opts.SourceHeight > 0 && opts.SourceHeight <= opts.MaxHeight) {
+		return ""
+	}
+	height := strconv.Itoa(opts.MaxHeight)
+	if opts.SourceHeight <= 0 {
+		height = fmt.Sprintf("min(ih\\,%d)", opts.MaxHeight)
+	}
+
+	// Frames decoded on the GPU are scaled there, hybrid decode downloads them first
+	if !hybridDecode(opts) {
+		switch opts.GPUVendor {
+		case GPUVendorNvidia:
+			return "scale_cuda=-2:" + height
+		case GPUVendorIntel, GPUVendorAMD:
+			return "scale_vaapi=w=-2:h=" + height
+		}
+	}
+	return "scale=-2:" + height
+}
+
+// hwDownloadFormats are the software pixel formats decoded GPU frames can be downloaded
+// as, 8-bit and 10-bit
+const hwDownloadFormats = "nv12|p010le"
+
+// hybridDecode reports whether opts decode on a GPU but encode on the CPU
+func hybridDecode(opts TranscodeOptions) bool {
+	switch opts.GPUVendor {
+	case GPUVendorNvidia, GPUVendorIntel, GPUVendorAMD:
+		return opts.HybridHWDecode
+	default:
+		return false
+	}
+}
+
 // getVideoEncoderArgs returns video encoder arguments based on GPU vendor
 func (f *FFmpegWrapper) getVideoEncoderArgs(opts TranscodeOptions) []string {
 	args := []string{}
 
-	// Video Filter (for scaling/upscaling)
-	upscaleFilter := f.getUpscaleFilter(opts)
-	if upscaleFilter != "" {
-		args = append(args, "-vf", upscaleFilter)
+	scaleFilter := f.getScaleFilter(opts)
+	if hybridDecode(opts) {
+		// Decoded frames stay in GPU memory, bring them back for libx265 before any
+		// software filtering
+		filters := []string{"hwdownload", "format=" + hwDownloadFormats}
+		if scaleFilter != "" {
+			filters = append(filters, scaleFilter)
+		}
+		filters = appendCustomFilters(filters, opts)
+		args = append(args, "-vf", strings.Join(filters, ","))
+		return append(args, f.getX265Args(opts)...)
+	}
+
+	// Video filters (scaling, custom filters, then the VAAPI upload) as a single chain
+	var filters []string
+	if scaleFilter != "" {
+		filters = append(filters, scaleFilter)
+	}
+	filters = appendCustomFilters(filters, opts)
+	if opts.GPUVendor == GPUVendorIntel || opts.GPUVendor == GPUVendorAMD {
+		filters = append(filters, "hwupload")
+	}
+	if len(filters) > 0 {
+		args = append(args, "-vf", strings.Join(filters, ","))
 	}
 
+	encoder := len(args)
 	switch opts.GPUVendor {
 	case GPUVendorNvidia:
 		args = append(args,
@@ -163,29 +332,76 @@ func (f *FFmpegWrapper) getVideoEncoderArgs(opts TranscodeOptions) []string {
 			"-profile:v", "main10",
 			"-tier", "high",
 		)
-	case GPUVendorIntel:
-		args = append(args,
-			"-c:v", "hevc_vaapi",
-			"-qp", fmt.Sprintf("%d", opts.CRF),
-			"-vf", "hwupload",
-		)
-	case GPUVendorAMD:
-		args = append(args,
-			"-c:v", "hevc_vaapi",
-			"-qp", fmt.Sprintf("%d", opts.CRF),
-			"-vf", "hwupload",
-		)
+		if opts.GPUDevice != "" {
+			args = append(args, "-gpu", opts.GPUDevice)
+		}
+		args = append(args, f.getVBVArgs(opts)...)
+	case GPUVendorIntel, GPUVendorAMD:
+		args = append(args, "-c:v", "hevc_vaapi")
+		if opts.MaxBitrate != "" {
+			// CQP ignores maxrate, QVBR keeps the quality target under the cap
+			args = append(args,
+				"-rc_mode", "QVBR",
+				"-global_quality", fmt.Sprintf("%d", opts.CRF),
+				"-b:v", opts.MaxBitrate,
+			)
+			args = append(args, f.getVBVArgs(opts)...)
+		} else {
+			args = append(args, "-qp", fmt.Sprintf("%d", opts.CRF))
+		}
 	default: // CPU
-		args = append(args,
-			"-c:v", "libx265",
-			"-preset", string(opts.Preset),
-			"-crf", fmt.Sprintf("%d", opts.CRF),
-			"-pix_fmt", "yuv420p10le",
-			"-x265-params", "profile=main10",
-		)
+		return append(args, f.getX265Args(opts)...)
 	}
 
-	return args
+	return append(args[:encoder], applyTuning(args[encoder:], opts.Tuning)...)
+}
+
+// getX265Args returns the software libx265 encoder arguments
+func (f *FFmpegWrapper) getX265Args(opts TranscodeOptions) []string {
+	args := []string{
+		"-c:v", "libx265",
+		"-preset", string(opts.Preset),
+		"-crf", fmt.Sprintf("%d", opts.CRF),
+		"-pix_fmt", "yuv420p10le",
+		"-x265-params", "profile=main10",
+	}
+	return append(args, f.getVBVArgs(opts)...)
+}
+
+// getVBVArgs returns the peak bitrate constraint, if one is set
+func (f *FFmpegWrapper) getVBVArgs(opts TranscodeOptions) []string {
+	if opts.MaxBitrate == "" {
+		return nil
+	}
+	bufSize := opts.BufSize
+	if bufSize == "" {
+		bufSize = opts.MaxBitrate
+	}
+	return []string{"-maxrate", opts.MaxBitrate, "-bufsize", bufSize}
+}
+
+var bitratePattern = regexp.MustCompile(`^\d+(\.\d+)?[kKmM]?$`)
+
+// ValidBitrate reports whether s is an ffmpeg bitrate such as "8000k" or "8M"
+func ValidBitrate(s string) bool {
+	return bitratePattern.MatchString(s)
+}
+
+// maxResolutionHeights are the accepted resolution caps
+var maxResolutionHeights = map[string]int{
+	"480p": 480, "720p": 720, "1080p": 1080, "1440p": 1440, "2160p": 2160, "4k": 2160,
+}
+
+// ParseMaxResolution returns the height of a resolution cap such as "1080p", 0 when empty
+func ParseMaxResolution(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	height, ok := maxResolutionHeights[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("invalid max resolution %q (expected 480p, 720p, 1080p, 1440p or 2160p)", s)
+	}
+	return height, nil
 }
 
 // mapPresetToNvenc maps generic preset to NVENC-specific preset
@@ -202,75 +418,250 @@ func (f *FFmpegWrapper) mapPresetToNvenc(preset QualityPreset) string {
 	}
 }
 
-// getAudioEncoderArgs returns audio encoder arguments
-func (f *FFmpegWrapper) getAudioEncoderArgs(codec string) []string {
+// getAudioEncoderArgs returns audio encoder arguments. bitrate overrides the codec's
+// default bitrate, it has no effect when audio is copied. channels is the most channels of
+// any source audio track, 0 if unknown.
+func (f *FFmpegWrapper) getAudioEncoderArgs(codec, bitrate string, channels int) []string {
 	if codec == "" || codec == "copy" {
 		return []string{"-c:a", "copy"}
 	}
 
+	var encoder, defaultBitrate string
+	var extra []string
 	switch strings.ToLower(codec) {
 	case "aac":
-		return []string{"-c:a", "aac", "-b:a", "256k"}
+		encoder, defaultBitrate = "aac", "256k"
 	case "ac3":
-		return []string{"-c:a", "ac3", "-b:a", "640k"}
+		encoder, defaultBitrate = "ac3", "640k"
+	case "opus":
+		// Transparent for stereo at well under AAC's bitrate
+		encoder, defaultBitrate = "libopus", "160k"
+		if channels > 2 {
+			// 5.1 and 7.1 need the surround mapping family and more bits for the extra
+			// channels, e.g. 384k for 5.1
+			extra = []string{"-mapping_family", "1"}
+			defaultBitrate = fmt.Sprintf("%dk", 64*channels)
+		}
 	default:
 		return []string{"-c:a", "copy"}
 	}
+	if bitrate == "" {
+		bitrate = defaultBitrate
+	}
+	return append([]string{"-c:a", encoder, "-b:a", bitrate}, extra...)
 }
 
-// GetMediaInfo retrieves basic media information using ffprobe
+// EmbedSubtitles remuxes an SRT file into videoPath as an additional subtitle track
+// tagged with the given ISO 639-2 language, replacing the original file
+func (f *FFmpegWrapper) EmbedSubtitles(ctx context.Context, videoPath, srtPath, language string) error {
+	ext := filepath.Ext(videoPath)
+	tmpPath := strings.TrimSuffix(videoPath, ext) + ".muxing" + ext
+
+	// The new track comes after any existing subtitle streams
+	existingSubs := 0
+	if info, err := f.GetMediaInfo(ctx, videoPath); err == nil {
+		existingSubs = info.SubtitleStreams
+	}
+
+	args := f.buildSubtitleMuxArgs(videoPath, srtPath, tmpPath, language, existingSubs)
+	cmd := exec.CommandContext(ctx, f.ffmpegPath, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("subtitle mux failed: %w\nOutput: %s", err, string(output))
+	}
+
+	if err := os.Rename(tmpPath, videoPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to replace output: %w", err)
+	}
+	return nil
+}
+
+// buildSubtitleMuxArgs constructs the FFmpeg arguments to add an SRT track without re-encoding.
+// subIndex is the output index of the new subtitle stream. Only that stream gets a subtitle
+// codec, existing tracks are copied since bitmap formats (PGS, VobSub) can't convert to text.
+func (f *FFmpegWrapper) buildSubtitleMuxArgs(videoPath, srtPath, outputPath, language string, subIndex int) []string {
+	// MP4 containers can't hold SRT, they need mov_text
+	subCodec := "srt"
+	switch strings.ToLower(filepath.Ext(outputPath)) {
+	case ".mp4", ".m4v", ".mov":
+		subCodec = "mov_text"
+	}
+
+	return []string{
+		"-hide_banner",
+		"-loglevel", "error",
+		"-i", videoPath,
+		"-i", srtPath,
+		"-map", "0",
+		"-map", "1",
+		"-c", "copy",
+		fmt.Sprintf("-c:s:%d", subIndex), subCodec,
+		fmt.Sprintf("-metadata:s:s:%d", subIndex), "language=" + language,
+		"-y", outputPath,
+	}
+}
+
+// GetMediaInfo retrieves basic media information using ffprobe, within ProbeTimeout.
+// A failed probe's error includes the start of ffprobe's stderr, e.g. "moov atom not found".
 func (f *FFmpegWrapper) GetMediaInfo(ctx context.Context, path string) (*MediaInfo, error) {
-	ffprobePath, err := exec.LookPath("ffprobe")
-	if err != nil {
-		return nil, fmt.Errorf("ffprobe not found: %w", err)
+	if f.ffprobeErr != nil {
+		return nil, f.ffprobeErr
+	}
+
+	timeout := f.ProbeTimeout
+	if timeout <= 0 {
+		timeout = DefaultProbeTimeout
 	}
+	probeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
 	args := []string{
-		"-v", "quiet",
+		"-v", "error",
 		"-print_format", "json",
 		"-show_format",
 		"-show_streams",
+		"-show_chapters",
 		path,
 	}
 
-	cmd := exec.CommandContext(ctx, ffprobePath, args...)
+	cmd := exec.CommandContext(probeCtx, f.ffprobePath, args...)
+	cmd.WaitDelay = time.Second // Don't wait on pipes held open by a killed probe
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
 	output, err := cmd.Output()
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("ffprobe cancelled: %w", ctx.Err())
+		}
+		if probeCtx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %v", timeout)
+		}
+		if msg := firstLines(stderr.String(), probeStderrLines); msg != "" {
+			return nil, fmt.Errorf("ffprobe failed: %v: %s", err, msg)
+		}
 		return nil, fmt.Errorf("ffprobe failed: %w", err)
 	}
 
-	// Parse basic info from JSON
+	return parseProbeOutput(path, output), nil
+}
+
+// firstLines returns up to n non-empty lines of s, joined with "; "
+func firstLines(s string, n int) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+			if len(lines) == n {
+				break
+			}
+		}
+	}
+	return strings.Join(lines, "; ")
+}
+
+// parseProbeOutput reads ffprobe's JSON output. When the container has no duration it
+// is estimated from the longest stream, or else from the overall bitrate and size.
+func parseProbeOutput(path string, output []byte) *MediaInfo {
 	var probeData struct {
 		Format struct {
 			Duration string `json:"duration"`
 			Size     string `json:"size"`
+			BitRate  string `json:"bit_rate"`
 		} `json:"format"`
+		Streams []struct {
+			CodecType   string `json:"codec_type"`
+			CodecName   string `json:"codec_name"`
+			Height      int    `json:"height"`
+			Channels    int    `json:"channels"`
+			Duration    string `json:"duration"`
+			Disposition struct {
+				AttachedPic int `json:"attached_pic"`
+				Forced      int `json:"forced"`
+			} `json:"disposition"`
+			Tags struct {
+				Language string `json:"language"`
+			} `json:"tags"`
+		} `json:"streams"`
+		Chapters []struct{} `json:"chapters"`
 	}
 
-	if err := json.Unmarshal(output, &probeData); err == nil {
-		duration, _ := strconv.ParseFloat(probeData.Format.Duration, 64)
-		size, _ := strconv.ParseInt(probeData.Format.Size, 10, 64)
+	if err := json.Unmarshal(output, &probeData); err != nil {
 		return &MediaInfo{
 			Path:     path,
 			Filename: filepath.Base(path),
-			Duration: duration,
-			Size:     size,
 			RawJSON:  string(output),
-		}, nil
+		}
+	}
+
+	duration, _ := strconv.ParseFloat(probeData.Format.Duration, 64)
+	size, _ := strconv.ParseInt(probeData.Format.Size, 10, 64)
+	bitRate, _ := strconv.ParseInt(probeData.Format.BitRate, 10, 64)
+	var subtitles []SubtitleStream
+	videoCodec := ""
+	height := 0
+	streamDuration := 0.0
+	audioChannels := 0
+	for _, stream := range probeData.Streams {
+		switch {
+		case stream.CodecType == "subtitle":
+			subtitles = append(subtitles, SubtitleStream{
+				Index:    len(subtitles),
+				Language: strings.ToLower(stream.Tags.Language),
+				Forced:   stream.Disposition.Forced == 1,
+				Codec:    stream.CodecName,
+			})
+		case stream.CodecType == "audio" && stream.Channels > audioChannels:
+			audioChannels = stream.Channels
+		case stream.CodecType == "video" && videoCodec == "" && stream.Disposition.AttachedPic == 0:
+			videoCodec = stream.CodecName
+			height = stream.Height
+		}
+		if d, err := strconv.ParseFloat(stream.Duration, 64); err == nil && d > streamDuration {
+			streamDuration = d
+		}
+	}
+
+	estimated := false
+	if duration <= 0 {
+		switch {
+		case streamDuration > 0:
+			duration, estimated = streamDuration, true
+		case bitRate > 0 && size > 0:
+			duration, estimated = float64(size)*8/float64(bitRate), true
+		}
 	}
 
 	return &MediaInfo{
-		Path:     path,
-		Filename: filepath.Base(path),
-		RawJSON:  string(output),
-	}, nil
+		Path:              path,
+		Filename:          filepath.Base(path),
+		Duration:          duration,
+		DurationEstimated: estimated,
+		Size:              size,
+		BitRate:           bitRate,
+		VideoCodec:        videoCodec,
+		Height:            height,
+		AudioChannels:     audioChannels,
+		SubtitleStreams:   len(subtitles),
+		Subtitles:         subtitles,
+		Chapters:          len(probeData.Chapters),
+		RawJSON:           string(output),
+	}
 }
 
 // MediaInfo contains metadata about a media file
 type MediaInfo struct {
-	Path     string
-	Filename string
-	Duration float64
-	Size     int64
-	RawJSON  string
+	Path              string
+	Filename          string
+	Duration          float64
+	DurationEstimated bool // Duration came from a stream or the bitrate, the container had none
+	Size              int64
+	BitRate           int64  // Overall bitrate in bits per second, 0 if unknown
+	VideoCodec        string // Codec of the main video stream, e.g. "hevc"
+	Height            int    // Height of the main video stream, 0 if unknown
+	AudioChannels     int    // Channels of the widest audio track, 0 if unknown
+	SubtitleStreams   int
+	Subtitles         []SubtitleStream // The subtitle tracks, in stream order
+	Chapters          int              // Number of chapter markers
+	RawJSON           string
 }
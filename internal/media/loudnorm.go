@@ -0,0 +1,75 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// EBU R128 loudness targets used for normalization
+const (
+	LoudnormIntegrated = -23.0 // Integrated loudness (LUFS)
+	LoudnormTruePeak   = -2.0  // Maximum true peak (dBTP)
+	LoudnormRange      = 7.0   // Loudness range (LU)
+)
+
+// LoudnessMeasurement holds the values reported by a loudnorm analysis pass
+type LoudnessMeasurement struct {
+	InputI       string `json:"input_i"`
+	InputTP      string `json:"input_tp"`
+	InputLRA     string `json:"input_lra"`
+	InputThresh  string `json:"input_thresh"`
+	TargetOffset string `json:"target_offset"`
+}
+
+// loudnormFilter returns the loudnorm audio filter. With a measurement from a first
+// pass the filter runs in linear mode, otherwise it normalizes dynamically in one pass.
+func loudnormFilter(m *LoudnessMeasurement) string {
+	filter := fmt.Sprintf("loudnorm=I=%.1f:TP=%.1f:LRA=%.1f", LoudnormIntegrated, LoudnormTruePeak, LoudnormRange)
+	if m == nil {
+		return filter
+	}
+	return fmt.Sprintf("%s:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+		filter, m.InputI, m.InputTP, m.InputLRA, m.InputThresh, m.TargetOffset)
+}
+
+// MeasureLoudness runs the analysis pass of two-pass loudnorm on the first audio stream
+func (f *FFmpegWrapper) MeasureLoudness(ctx context.Context, inputPath string) (*LoudnessMeasurement, error) {
+	args := []string{
+		"-hide_banner",
+		"-nostats",
+		"-i", inputPath,
+		"-map", "0:a:0",
+		"-af", loudnormFilter(nil) + ":print_format=json",
+		"-f", "null", "-",
+	}
+
+	cmd := exec.CommandContext(ctx, f.ffmpegPath, args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("loudness analysis failed: %w", err)
+	}
+
+	return parseLoudnessMeasurement(output)
+}
+
+// parseLoudnessMeasurement extracts the JSON block loudnorm prints at the end of its output
+func parseLoudnessMeasurement(output []byte) (*LoudnessMeasurement, error) {
+	start := bytes.LastIndexByte(output, '{')
+	end := bytes.LastIndexByte(output, '}')
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no loudness measurement in ffmpeg output")
+	}
+
+	var m LoudnessMeasurement
+	if err := json.Unmarshal(output[start:end+1], &m); err != nil {
+		return nil, fmt.Errorf("failed to parse loudness measurement: %w", err)
+	}
+	if strings.TrimSpace(m.InputI) == "" || strings.Contains(m.InputI, "inf") {
+		return nil, fmt.Errorf("audio is silent or could not be measured")
+	}
+	return &m, nil
+}
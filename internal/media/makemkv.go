@@ -3,24 +3,34 @@ package media
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/Vasteva/MediaConverter/internal/system"
 )
 
 // MakeMKVWrapper handles MakeMKV disc extraction
 type MakeMKVWrapper struct {
 	makemkvconPath string
+
+	scanMu    sync.Mutex
+	scanCache map[string]discScan // Disc image scans by makemkvcon source
 }
 
-// NewMakeMKVWrapper creates a new MakeMKV wrapper
-func NewMakeMKVWrapper() (*MakeMKVWrapper, error) {
-	path, err := exec.LookPath("makemkvcon")
+// NewMakeMKVWrapper creates a new MakeMKV wrapper. An empty path is looked up in PATH.
+func NewMakeMKVWrapper(makemkvconPath string) (*MakeMKVWrapper, error) {
+	path, err := system.ResolveTool("makemkvcon", makemkvconPath)
 	if err != nil {
-		return nil, fmt.Errorf("makemkvcon not found in PATH: %w", err)
+		return nil, err
 	}
 	return &MakeMKVWrapper{makemkvconPath: path}, nil
 }
@@ -39,22 +49,68 @@ type TitleInfo struct {
 	ChapterCount int
 	Size         int64
 	Description  string
+	Segments     string // Segment map, e.g. "1-3,5", empty if unknown
 }
 
 // ExtractOptions contains parameters for disc extraction
 type ExtractOptions struct {
-	SourcePath string // Path to disc device or ISO file
+	SourcePath string // Path to disc device, disc folder or image file, see DiscSource
 	OutputDir  string
-	MinLength  int // Minimum title length in seconds (0 = all titles)
-	TitleIndex int // Specific title to extract (0 = all)
+	MinLength  int    // Minimum title length in seconds (0 = all titles)
+	TitleIndex int    // Specific title to extract (-1 = all)
+	Profile    string // Conversion profile choosing the tracks kept, see ResolveMakeMKVProfile
+}
+
+// makemkvProfileExt is the extension of MakeMKV conversion profiles
+const makemkvProfileExt = ".mmcp.xml"
+
+// ResolveMakeMKVProfile returns the absolute path of a MakeMKV conversion profile, given
+// as the path of an .mmcp.xml file or the name of one in ~/.MakeMKV, e.g. "flac". The
+// file must exist.
+func ResolveMakeMKVProfile(profile string) (string, error) {
+	path := profile
+	if !strings.ContainsRune(profile, filepath.Separator) && !strings.HasSuffix(strings.ToLower(profile), ".xml") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find MakeMKV profile %q: %w", profile, err)
+		}
+		path = filepath.Join(home, ".MakeMKV", profile+makemkvProfileExt)
+	}
+	path, err := makemkvPath(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid MakeMKV profile: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("MakeMKV profile %q not found: %w", profile, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("MakeMKV profile %s is a directory", path)
+	}
+	return path, nil
 }
 
-// ScanDisc scans a disc or ISO and returns available titles
+// ScanDisc scans a disc or ISO and returns available titles. Image scans are cached
+// until the image file changes, a cancelled or failed scan is not.
 func (m *MakeMKVWrapper) ScanDisc(ctx context.Context, sourcePath string) (*DiscInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	source, err := DiscSource(sourcePath)
+	if err != nil {
+		return nil, err
+	}
+	image, cacheable := imageFileInfo(source)
+	if cacheable {
+		if info := m.cachedScan(source, image); info != nil {
+			return info, nil
+		}
+	}
+
 	args := []string{
 		"-r",
 		"info",
-		fmt.Sprintf("file:%s", sourcePath),
+		source,
 	}
 
 	cmd := exec.CommandContext(ctx, m.makemkvconPath, args...)
@@ -63,7 +119,11 @@ func (m *MakeMKVWrapper) ScanDisc(ctx context.Context, sourcePath string) (*Disc
 		return nil, fmt.Errorf("makemkvcon scan failed: %w\nOutput: %s", err, string(output))
 	}
 
-	return m.parseDiscInfo(string(output)), nil
+	info := m.parseDiscInfo(string(output))
+	if cacheable {
+		m.storeScan(source, image, info)
+	}
+	return info, nil
 }
 
 // Extract extracts titles from a disc or ISO
@@ -73,23 +133,9 @@ func (m *MakeMKVWrapper) Extract(ctx context.Context, opts ExtractOptions) error
 
 // ExtractWithProgress extracts titles from a disc or ISO with real-time progress monitoring
 func (m *MakeMKVWrapper) ExtractWithProgress(ctx context.Context, opts ExtractOptions, callback ProgressCallback) error {
-	// Determine what to extract
-	titleArg := "all"
-	if opts.TitleIndex >= 0 {
-		titleArg = strconv.Itoa(opts.TitleIndex)
-	}
-
-	args := []string{
-		"-r", // Robot mode for parsable output
-		"mkv",
-		fmt.Sprintf("file:%s", opts.SourcePath),
-		titleArg,
-		opts.OutputDir,
-	}
-
-	// Add minimum length filter if specified
-	if opts.MinLength > 0 {
-		args = append(args, "--minlength", strconv.Itoa(opts.MinLength))
+	args, err := m.buildExtractArgs(opts)
+	if err != nil {
+		return err
 	}
 
 	cmd := exec.CommandContext(ctx, m.makemkvconPath, args...)
@@ -104,37 +150,127 @@ func (m *MakeMKVWrapper) ExtractWithProgress(ctx context.Context, opts ExtractOp
 		return fmt.Errorf("failed to start makemkvcon: %w", err)
 	}
 
-	// Parse progress in a goroutine
-	if callback != nil {
-		go m.parseExtractProgress(stdout, callback)
-	} else {
-		// If no callback, we still need to consume stdout
-		go func() {
-			buf := make([]byte, 1024)
-			for {
-				if _, err := stdout.Read(buf); err != nil {
-					break
-				}
-			}
-		}()
-	}
+	// Parse progress and drive errors until makemkvcon closes its output, Wait must not
+	// close the pipe before it has been read
+	parsed := make(chan error, 1)
+	go func() { parsed <- m.parseExtractProgress(stdout, callback) }()
+	discErr := <-parsed
 
 	// Wait for completion
 	if err := cmd.Wait(); err != nil {
+		if discErr != nil && ctx.Err() == nil {
+			return discErr
+		}
 		return fmt.Errorf("makemkvcon extraction failed: %w", err)
 	}
 
 	return nil
 }
 
-// parseExtractProgress parses MakeMKV robot mode output for progress
-func (m *MakeMKVWrapper) parseExtractProgress(reader io.Reader, callback ProgressCallback) {
+// buildExtractArgs constructs the makemkvcon arguments for an extraction
+func (m *MakeMKVWrapper) buildExtractArgs(opts ExtractOptions) ([]string, error) {
+	source, err := DiscSource(opts.SourcePath)
+	if err != nil {
+		return nil, err
+	}
+	outputDir, err := makemkvPath(opts.OutputDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output directory: %w", err)
+	}
+
+	// Determine what to extract
+	titleArg := "all"
+	if opts.TitleIndex >= 0 {
+		titleArg = strconv.Itoa(opts.TitleIndex)
+	}
+
+	args := []string{
+		"-r", // Robot mode for parsable output
+	}
+
+	// Options must come before the command
+	if opts.MinLength > 0 {
+		args = append(args, fmt.Sprintf("--minlength=%d", opts.MinLength))
+	}
+	if opts.Profile != "" {
+		profile, err := ResolveMakeMKVProfile(opts.Profile)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, "--profile="+profile)
+	}
+
+	args = append(args,
+		"mkv",
+		source,
+		titleArg,
+		outputDir,
+	)
+
+	return args, nil
+}
+
+// ErrNoDisc and ErrDiscRead are the job errors for makemkvcon failing on the drive or
+// disc, instead of its exit status
+var (
+	ErrNoDisc   = errors.New("no disc in the drive — insert a disc and retry")
+	ErrDiscRead = errors.New("disc read failed — check the drive/disc")
+)
+
+// discMessages map makemkvcon messages, matched case-insensitively in order, to errors.
+// Drives report SCSI sense text such as "NOT READY:MEDIUM NOT PRESENT - TRAY OPEN".
+var discMessages = []struct {
+	text string
+	err  error
+}{
+	{"medium not present", ErrNoDisc},
+	{"tray open", ErrNoDisc},
+	{"no disc", ErrNoDisc},
+	{"medium error", ErrDiscRead},
+	{"not ready", ErrDiscRead},
+	{"read error", ErrDiscRead},
+	{"occurred while reading", ErrDiscRead},
+	{"failed to open disc", ErrDiscRead},
+}
+
+// discMessageError returns the error for a robot mode MSG line reporting a drive or disc
+// failure, wrapping ErrNoDisc or ErrDiscRead with makemkvcon's message. Other lines
+// return nil.
+func discMessageError(line string) error {
+	kind, fields := robotFields(strings.TrimRight(line, "\r"))
+	// MSG:code,flags,count,"message","format",params...
+	if kind != "MSG" || len(fields) < 4 {
+		return nil
+	}
+	message := strings.ToLower(fields[3])
+	for _, m := range discMessages {
+		if strings.Contains(message, m.text) {
+			return fmt.Errorf("%w: %s", m.err, fields[3])
+		}
+	}
+	return nil
+}
+
+// parseExtractProgress parses MakeMKV robot mode output for progress, calling callback
+// at most every progressInterval and always with the last progress parsed. It reads
+// until the output ends and returns the first drive or disc failure reported.
+func (m *MakeMKVWrapper) parseExtractProgress(reader io.Reader, callback ProgressCallback) error {
 	scanner := bufio.NewScanner(reader)
 	progress := TranscodeProgress{}
+	var limiter *progressLimiter
+	if callback != nil {
+		limiter = newProgressLimiter(callback, progressInterval)
+		defer limiter.flush()
+	}
 
+	var discErr error
 	for scanner.Scan() {
 		line := scanner.Text()
 
+		if discErr == nil {
+			discErr = discMessageError(line)
+		}
+
 		// PRGV:current,total,max
 		if strings.HasPrefix(line, "PRGV:") {
 			parts := strings.Split(strings.TrimPrefix(line, "PRGV:"), ",")
@@ -143,13 +279,16 @@ func (m *MakeMKVWrapper) parseExtractProgress(reader io.Reader, callback Progres
 				max, _ := strconv.ParseFloat(parts[2], 64)
 				if max > 0 {
 					progress.Percentage = int((total / max) * 100)
-					if callback != nil {
-						callback(progress)
+					if limiter != nil {
+						limiter.update(progress)
 					}
 				}
 			}
 		}
 	}
+	// Keep draining so makemkvcon never blocks on a full pipe
+	io.Copy(io.Discard, reader)
+	return discErr
 }
 
 // parseDiscInfo parses MakeMKV output to extract disc information
@@ -160,48 +299,39 @@ func (m *MakeMKVWrapper) parseDiscInfo(output string) *DiscInfo {
 
 	lines := strings.Split(output, "\n")
 
-	// Regular expressions for parsing
-	titleRegex := regexp.MustCompile(`TINFO:(\d+),\d+,\d+,"([^"]*)"`)
-	durationRegex := regexp.MustCompile(`TINFO:(\d+),9,0,"([^"]*)"`)
-	chaptersRegex := regexp.MustCompile(`TINFO:(\d+),8,0,"(\d+)"`)
-
 	titleMap := make(map[int]*TitleInfo)
 
 	for _, line := range lines {
-		// Parse disc name
-		if strings.Contains(line, "CINFO:2,0") {
-			matches := regexp.MustCompile(`CINFO:2,0,"([^"]*)"`).FindStringSubmatch(line)
-			if len(matches) > 1 {
-				info.Name = matches[1]
+		kind, fields := robotFields(strings.TrimRight(line, "\r"))
+		switch kind {
+		case "CINFO":
+			// CINFO:id,code,"value", id 2 is the disc name
+			if len(fields) >= 3 && fields[0] == "2" {
+				info.Name = fields[2]
 			}
-		}
-
-		// Parse title information
-		if matches := titleRegex.FindStringSubmatch(line); len(matches) > 2 {
-			titleIdx, _ := strconv.Atoi(matches[1])
-			if _, exists := titleMap[titleIdx]; !exists {
-				titleMap[titleIdx] = &TitleInfo{Index: titleIdx}
+		case "TINFO":
+			// TINFO:title,id,code,"value"
+			if len(fields) < 4 {
+				continue
 			}
-			titleMap[titleIdx].Description = matches[2]
-		}
-
-		// Parse duration
-		if matches := durationRegex.FindStringSubmatch(line); len(matches) > 2 {
-			titleIdx, _ := strconv.Atoi(matches[1])
-			if _, exists := titleMap[titleIdx]; !exists {
-				titleMap[titleIdx] = &TitleInfo{Index: titleIdx}
+			titleIdx, err := strconv.Atoi(fields[0])
+			if err != nil {
+				continue
 			}
-			titleMap[titleIdx].Duration = matches[2]
-		}
-
-		// Parse chapter count
-		if matches := chaptersRegex.FindStringSubmatch(line); len(matches) > 2 {
-			titleIdx, _ := strconv.Atoi(matches[1])
-			chapterCount, _ := strconv.Atoi(matches[2])
 			if _, exists := titleMap[titleIdx]; !exists {
 				titleMap[titleIdx] = &TitleInfo{Index: titleIdx}
 			}
-			titleMap[titleIdx].ChapterCount = chapterCount
+			title := titleMap[titleIdx]
+			title.Description = fields[3]
+
+			switch fields[1] {
+			case "8":
+				title.ChapterCount, _ = strconv.Atoi(fields[3])
+			case "9":
+				title.Duration = fields[3]
+			case "26":
+				title.Segments = fields[3]
+			}
 		}
 	}
 
@@ -213,6 +343,37 @@ func (m *MakeMKVWrapper) parseDiscInfo(output string) *DiscInfo {
 	return info
 }
 
+// robotFields splits a robot-mode line such as `TINFO:0,2,0,"Name, \"Quoted\""` into
+// its kind and values. Quoted values may contain commas, and backslash escapes a quote
+// or backslash inside them.
+func robotFields(line string) (string, []string) {
+	kind, rest, ok := strings.Cut(line, ":")
+	if !ok {
+		return "", nil
+	}
+
+	var fields []string
+	var field strings.Builder
+	inQuotes := false
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case inQuotes && c == '\\' && i+1 < len(rest):
+			i++
+			field.WriteByte(rest[i])
+		case c == '"':
+			inQuotes = !inQuotes
+		case c == ',' && !inQuotes:
+			fields = append(fields, field.String())
+			field.Reset()
+		default:
+			field.WriteByte(c)
+		}
+	}
+	fields = append(fields, field.String())
+	return kind, fields
+}
+
 // GetOutputFilename generates the expected output filename for a title
 func (m *MakeMKVWrapper) GetOutputFilename(discName string, titleIndex int) string {
 	// MakeMKV typically outputs as: title_t00.mkv
@@ -222,6 +383,89 @@ func (m *MakeMKVWrapper) GetOutputFilename(discName string, titleIndex int) stri
 	return fmt.Sprintf("title_t%02d.mkv", titleIndex)
 }
 
+// GetEpisodeFilename returns the name of the nth (1-based) title extracted as an episode
+func (m *MakeMKVWrapper) GetEpisodeFilename(discName string, n int) string {
+	if discName != "" {
+		return fmt.Sprintf("%s_e%02d.mkv", sanitizeFilename(discName), n)
+	}
+	return fmt.Sprintf("title_e%02d.mkv", n)
+}
+
+// RenameExtractedTitles renames MakeMKV's output files in dir to the names produced by
+// GetOutputFilename for the given disc name, and returns the final paths
+func (m *MakeMKVWrapper) RenameExtractedTitles(dir, discName string) ([]string, error) {
+	return m.renameTitles(dir, func(titleIdx int) string {
+		return m.GetOutputFilename(discName, titleIdx)
+	})
+}
+
+// RenameEpisodes renames the extracted titles in dir to numbered episode names in the
+// order of titles, titles[0] becoming episode 1, and returns the final paths
+func (m *MakeMKVWrapper) RenameEpisodes(dir, discName string, titles []int) ([]string, error) {
+	episodes := make(map[int]int, len(titles))
+	for i, titleIdx := range titles {
+		episodes[titleIdx] = i + 1
+	}
+	return m.renameTitles(dir, func(titleIdx int) string {
+		if n, ok := episodes[titleIdx]; ok {
+			return m.GetEpisodeFilename(discName, n)
+		}
+		return m.GetOutputFilename(discName, titleIdx)
+	})
+}
+
+// makemkvTitleRegex matches the files makemkvcon writes, not names given by renameTitles,
+// so titles left in a shared output directory by earlier discs are not renamed again
+var makemkvTitleRegex = regexp.MustCompile(`^title_t(\d+)\.mkv$`)
+
+// renameTitles renames each "title_tNN.mkv" output in dir to name(NN) and returns every
+// .mkv in dir. Files MakeMKV named otherwise are kept as they are. An existing file is
+// never overwritten, the new name gets a number suffix instead.
+func (m *MakeMKVWrapper) renameTitles(dir string, name func(titleIdx int) string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.mkv"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	result := make([]string, 0, len(files))
+	for _, file := range files {
+		matches := makemkvTitleRegex.FindStringSubmatch(filepath.Base(file))
+		if len(matches) < 2 {
+			result = append(result, file)
+			continue
+		}
+
+		titleIdx, _ := strconv.Atoi(matches[1])
+		target := filepath.Join(dir, name(titleIdx))
+		if target != file {
+			target = availableFilename(target)
+			if err := os.Rename(file, target); err != nil {
+				return nil, fmt.Errorf("failed to rename %s: %w", filepath.Base(file), err)
+			}
+		}
+		result = append(result, target)
+	}
+
+	return result, nil
+}
+
+// availableFilename returns path, or path numbered (Name_2.mkv, Name_3.mkv, ...) when a
+// file by that name already exists
+func availableFilename(path string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for n := 2; ; n++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, n, ext)
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
 // sanitizeFilename removes invalid characters from filenames
 func sanitizeFilename(name string) string {
 	// Replace invalid characters with underscores
@@ -235,6 +479,11 @@ func sanitizeFilename(name string) string {
 	return sanitized
 }
 
+// Seconds returns the title's duration in seconds, 0 if unknown
+func (t TitleInfo) Seconds() int {
+	return parseDurationToSeconds(t.Duration)
+}
+
 // FindLargestTitle returns the index of the title with the longest duration
 func (d *DiscInfo) FindLargestTitle() int {
 	if len(d.Titles) == 0 {
@@ -255,6 +504,108 @@ func (d *DiscInfo) FindLargestTitle() int {
 	return largestIdx
 }
 
+// FindTitlesOverDuration returns the indexes of the titles at least minSeconds long, in
+// disc order, which for box sets is episode order. Play-all titles, which repeat the
+// episodes, are left out. When maxTitles is set only that many of the longest are kept.
+func (d *DiscInfo) FindTitlesOverDuration(minSeconds, maxTitles int) []int {
+	var candidates []TitleInfo
+	for _, title := range d.Titles {
+		if parseDurationToSeconds(title.Duration) >= minSeconds {
+			candidates = append(candidates, title)
+		}
+	}
+	var titles []TitleInfo
+	for _, title := range candidates {
+		if !isPlayAll(title, candidates) {
+			titles = append(titles, title)
+		}
+	}
+
+	if maxTitles > 0 && len(titles) > maxTitles {
+		// Ties go to the earlier title
+		sort.Slice(titles, func(i, j int) bool { return titles[i].Index < titles[j].Index })
+		sort.SliceStable(titles, func(i, j int) bool {
+			return parseDurationToSeconds(titles[i].Duration) > parseDurationToSeconds(titles[j].Duration)
+		})
+		titles = titles[:maxTitles]
+	}
+
+	indexes := make([]int, len(titles))
+	for i, title := range titles {
+		indexes[i] = title.Index
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// isPlayAll reports whether title plays two or more of the other titles back to back.
+// With a segment map it must contain all their segments, without one its duration must be
+// within 2% of the sum of similarly long shorter titles, longest first.
+func isPlayAll(title TitleInfo, titles []TitleInfo) bool {
+	if segments := segmentSet(title.Segments); len(segments) > 0 {
+		spanned := 0
+		for _, other := range titles {
+			others := segmentSet(other.Segments)
+			if other.Index == title.Index || len(others) == 0 || len(others) >= len(segments) {
+				continue
+			}
+			contained := true
+			for segment := range others {
+				contained = contained && segments[segment]
+			}
+			if contained {
+				spanned++
+			}
+		}
+		return spanned >= 2
+	}
+
+	duration := title.Seconds()
+	var shorter []int
+	for _, other := range titles {
+		if d := other.Seconds(); other.Index != title.Index && d > 0 && d < duration {
+			shorter = append(shorter, d)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(shorter)))
+
+	// Episodes are of similar length, extras that happen to fill the gap don't count
+	limit := duration + duration/50
+	sum, used := 0, 0
+	for _, d := range shorter {
+		if used > 0 && d < shorter[0]/2 {
+			break
+		}
+		if sum+d <= limit {
+			sum += d
+			used++
+		}
+	}
+	return used >= 2 && sum >= duration-duration/50
+}
+
+// segmentSet parses a segment map such as "1-3,5" into its segment numbers
+func segmentSet(segments string) map[int]bool {
+	set := make(map[int]bool)
+	for _, part := range strings.Split(segments, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			continue
+		}
+		to := from
+		if isRange {
+			if to, err = strconv.Atoi(last); err != nil || to < from {
+				continue
+			}
+		}
+		for segment := from; segment <= to; segment++ {
+			set[segment] = true
+		}
+	}
+	return set
+}
+
 // parseDurationToSeconds converts duration string (HH:MM:SS) to seconds
 func parseDurationToSeconds(duration string) int {
 	parts := strings.Split(duration, ":")
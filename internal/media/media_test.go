@@ -2,12 +2,17 @@ package media
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
 
 func TestFFmpegWrapper_BuildArgs(t *testing.T) {
-	wrapper, err := NewFFmpegWrapper()
+	wrapper, err := NewFFmpegWrapper("", "")
 	if err != nil {
 		t.Skip("FFmpeg not available, skipping test")
 	}
@@ -149,8 +154,559 @@ func TestMakeMKVSanitizeFilename(t *testing.T) {
 	}
 }
 
+func TestBuildSubtitleMuxArgs(t *testing.T) {
+	f := &FFmpegWrapper{}
+
+	args := f.buildSubtitleMuxArgs("/output/movie.mkv", "/output/movie.en.srt", "/output/movie.muxing.mkv", "eng", 2)
+	expected := []string{
+		"-i", "/output/movie.mkv",
+		"-i", "/output/movie.en.srt",
+		"-map", "0",
+		"-map", "1",
+		"-c", "copy",
+		"-c:s:2", "srt",
+		"-metadata:s:s:2", "language=eng",
+		"-y", "/output/movie.muxing.mkv",
+	}
+	if got := joinArgs(args[len(args)-len(expected):]); got != joinArgs(expected) {
+		t.Errorf("Expected args to end with %v, got: %v", expected, args)
+	}
+
+	args = f.buildSubtitleMuxArgs("/output/movie.mp4", "/output/movie.und.srt", "/output/movie.muxing.mp4", "und", 0)
+	if !contains(joinArgs(args), "-c:s:0 mov_text") {
+		t.Errorf("Expected mov_text subtitles for MP4, got: %v", args)
+	}
+
+	// Existing tracks may be PGS or VobSub, only the added one may be converted
+	args = f.buildSubtitleMuxArgs("/output/rip.mkv", "/output/rip.eng.srt", "/output/rip.muxing.mkv", "eng", 3)
+	got := joinArgs(args)
+	if contains(got, "-c:s srt") || !contains(got, "-c copy -c:s:3 srt") {
+		t.Errorf("Expected a codec only for the new subtitle stream, got: %v", args)
+	}
+}
+
+func TestBuildArgsNormalizeAudio(t *testing.T) {
+	f := &FFmpegWrapper{}
+	opts := TranscodeOptions{
+		InputPath:  "/input/movie.mkv",
+		OutputPath: "/output/movie.mkv",
+		GPUVendor:  GPUVendorCPU,
+		Preset:     PresetMedium,
+		CRF:        23,
+	}
+
+	if args := joinArgs(f.buildFFmpegArgs(opts)); contains(args, "loudnorm") {
+		t.Errorf("Expected no loudnorm filter by default, got: %s", args)
+	}
+
+	opts.NormalizeAudio = true
+	args := joinArgs(f.buildFFmpegArgs(opts))
+	if !contains(args, "-af loudnorm=I=-23.0:TP=-2.0:LRA=7.0") {
+		t.Errorf("Expected loudnorm filter, got: %s", args)
+	}
+	if !contains(args, "-c:a aac") || contains(args, "-c:a copy") {
+		t.Errorf("Expected audio to be re-encoded to aac, got: %s", args)
+	}
+
+	opts.AudioCodec = "ac3"
+	if args := joinArgs(f.buildFFmpegArgs(opts)); !contains(args, "-c:a ac3") {
+		t.Errorf("Expected explicit audio codec to be kept, got: %s", args)
+	}
+
+	opts.Loudness = &LoudnessMeasurement{InputI: "-30.12", InputTP: "-5.01", InputLRA: "9.80", InputThresh: "-40.50", TargetOffset: "0.35"}
+	args = joinArgs(f.buildFFmpegArgs(opts))
+	if !contains(args, "measured_I=-30.12:measured_TP=-5.01:measured_LRA=9.80:measured_thresh=-40.50:offset=0.35:linear=true") {
+		t.Errorf("Expected two-pass loudnorm parameters, got: %s", args)
+	}
+}
+
+func TestBuildArgsMaxBitrate(t *testing.T) {
+	f := &FFmpegWrapper{}
+
+	tests := []struct {
+		vendor   GPUVendor
+		expected string
+	}{
+		{GPUVendorCPU, "-crf 23 -pix_fmt yuv420p10le -x265-params profile=main10 -maxrate 8M -bufsize 16M"},
+		{GPUVendorNvidia, "-rc vbr -cq 23 -b:v 0 -profile:v main10 -tier high -maxrate 8M -bufsize 16M"},
+		{GPUVendorIntel, "-rc_mode QVBR -global_quality 23 -b:v 8M -maxrate 8M -bufsize 16M"},
+		{GPUVendorAMD, "-rc_mode QVBR -global_quality 23 -b:v 8M -maxrate 8M -bufsize 16M"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.vendor), func(t *testing.T) {
+			opts := TranscodeOptions{GPUVendor: tt.vendor, Preset: PresetMedium, CRF: 23}
+			if args := joinArgs(f.getVideoEncoderArgs(opts)); contains(args, "-maxrate") {
+				t.Errorf("Expected no maxrate without a cap, got: %s", args)
+			}
+
+			opts.MaxBitrate, opts.BufSize = "8M", "16M"
+			args := joinArgs(f.getVideoEncoderArgs(opts))
+			if !contains(args, tt.expected) {
+				t.Errorf("Expected args to contain %q, got: %s", tt.expected, args)
+			}
+			if contains(args, "-qp") {
+				t.Errorf("Expected constant QP to be replaced when capped, got: %s", args)
+			}
+		})
+	}
+
+	// Buffer size defaults to the cap
+	opts := TranscodeOptions{GPUVendor: GPUVendorCPU, Preset: PresetMedium, CRF: 23, MaxBitrate: "6000k"}
+	if args := joinArgs(f.getVideoEncoderArgs(opts)); !contains(args, "-maxrate 6000k -bufsize 6000k") {
+		t.Errorf("Expected bufsize to default to maxrate, got: %s", args)
+	}
+}
+
+func TestBuildArgsHybridHWDecode(t *testing.T) {
+	f := &FFmpegWrapper{}
+
+	tests := []struct {
+		vendor GPUVendor
+		hwargs string
+	}{
+		{GPUVendorNvidia, "-hwaccel cuda -hwaccel_output_format cuda"},
+		{GPUVendorIntel, "-hwaccel vaapi -hwaccel_device /dev/dri/renderD128 -hwaccel_output_format vaapi"},
+		{GPUVendorAMD, "-hwaccel vaapi -hwaccel_device /dev/dri/renderD128 -hwaccel_output_format vaapi"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.vendor), func(t *testing.T) {
+			opts := TranscodeOptions{
+				InputPath:      "in.mkv",
+				OutputPath:     "out.mkv",
+				GPUVendor:      tt.vendor,
+				Preset:         PresetSlow,
+				CRF:            20,
+				HybridHWDecode: true,
+			}
+			args := joinArgs(f.buildFFmpegArgs(opts))
+			if !contains(args, tt.hwargs+" -i in.mkv") {
+				t.Errorf("Expected hardware decode flags %q, got: %s", tt.hwargs, args)
+			}
+			if !contains(args, "-vf hwdownload,format=nv12|p010le -c:v libx265 -preset slow -crf 20") {
+				t.Errorf("Expected hwdownload feeding libx265, got: %s", args)
+			}
+			for _, hw := range []string{"hevc_nvenc", "hevc_vaapi", "hwupload"} {
+				if contains(args, hw) {
+					t.Errorf("Expected no hardware encode (%s), got: %s", hw, args)
+				}
+			}
+
+			// Upscaling runs in software after the download, in the same filter chain
+			opts.Upscale, opts.Resolution = true, "4k"
+			args = joinArgs(f.buildFFmpegArgs(opts))
+			if !contains(args, "-vf hwdownload,format=nv12|p010le,scale=3840:2160:flags=lanczos -c:v libx265") {
+				t.Errorf("Expected upscale after hwdownload, got: %s", args)
+			}
+			if strings.Count(args, "-vf ") != 1 {
+				t.Errorf("Expected a single filter chain, got: %s", args)
+			}
+		})
+	}
+
+	// Without a GPU the option has nothing to decode with
+	opts := TranscodeOptions{InputPath: "in.mkv", OutputPath: "out.mkv", GPUVendor: GPUVendorCPU, Preset: PresetMedium, CRF: 23, HybridHWDecode: true}
+	if args := joinArgs(f.buildFFmpegArgs(opts)); contains(args, "hwdownload") || contains(args, "-hwaccel") {
+		t.Errorf("Expected plain software encode on CPU, got: %s", args)
+	}
+}
+
+func TestBuildArgsCustomFilters(t *testing.T) {
+	f := &FFmpegWrapper{}
+
+	tests := []struct {
+		name string
+		opts TranscodeOptions
+		want string
+	}{
+		{"alone", TranscodeOptions{GPUVendor: GPUVendorCPU}, "-vf hqdn3d=4,unsharp -c:v libx265"},
+		{"after the downscale", TranscodeOptions{GPUVendor: GPUVendorCPU, MaxHeight: 720, SourceHeight: 1080}, "-vf scale=-2:720,hqdn3d=4,unsharp -c:v libx265"},
+		{"downloaded before the VAAPI upload", TranscodeOptions{GPUVendor: GPUVendorIntel, MaxHeight: 720, SourceHeight: 1080},
+			"-vf scale_vaapi=w=-2:h=720,hwdownload,format=nv12|p010le,hqdn3d=4,unsharp,hwupload -c:v hevc_vaapi"},
+		{"downloaded and uploaded on NVIDIA", TranscodeOptions{GPUVendor: GPUVendorNvidia, GPUDevice: "1"},
+			"-vf hwdownload,format=nv12|p010le,hqdn3d=4,unsharp,hwupload_cuda=device=1 -c:v hevc_nvenc"},
+		{"after the hybrid download", TranscodeOptions{GPUVendor: GPUVendorNvidia, HybridHWDecode: true}, "-vf hwdownload,format=nv12|p010le,hqdn3d=4,unsharp -c:v libx265"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.InputPath, opts.OutputPath, opts.Preset, opts.CRF = "in.mkv", "out.mkv", PresetMedium, 23
+			opts.CustomVideoFilters = " hqdn3d=4,unsharp "
+			args := joinArgs(f.buildFFmpegArgs(opts))
+			if !contains(args, tt.want) {
+				t.Errorf("Expected %q, got: %s", tt.want, args)
+			}
+			if strings.Count(args, "-vf ") != 1 {
+				t.Errorf("Expected a single filter chain, got: %s", args)
+			}
+		})
+	}
+
+	// Custom arguments go just before the output
+	opts := TranscodeOptions{InputPath: "in.mkv", OutputPath: "out.mkv", GPUVendor: GPUVendorCPU, Preset: PresetMedium, CRF: 23,
+		CustomArgs: []string{"-metadata", "title=Movie"}}
+	if args := joinArgs(f.buildFFmpegArgs(opts)); !contains(args, "-c:s copy -metadata title=Movie -y out.mkv") {
+		t.Errorf("Expected custom arguments before the output, got: %s", args)
+	}
+}
+
+func TestValidateVideoFilters(t *testing.T) {
+	valid := []string{"", "hqdn3d", "hqdn3d=4,unsharp=5:5:1.0", `scale=w='min(iw\,1280)':h=-2`, "YADIF"}
+	for _, filters := range valid {
+		if err := ValidateVideoFilters(filters); err != nil {
+			t.Errorf("ValidateVideoFilters(%q): unexpected error %v", filters, err)
+		}
+	}
+	invalid := []string{"hqdn3d;[in]null", "[0:v]scale=1:1", "hqdn3d,,unsharp", "hqdn3d,", "movie=/etc/passwd", "unsharp,subtitles=/tmp/x.srt",
+		"drawtext=textfile=/etc/passwd", "psnr=stats_file=/tmp/x", "lut3d=/tmp/x.cube", "frei0r=distort0r", "zmq", "signature=filename=/tmp/x"}
+	for _, filters := range invalid {
+		if err := ValidateVideoFilters(filters); err == nil {
+			t.Errorf("ValidateVideoFilters(%q): expected an error", filters)
+		}
+	}
+}
+
+func TestBuildArgsGPUDevice(t *testing.T) {
+	f := &FFmpegWrapper{}
+
+	tests := []struct {
+		vendor   GPUVendor
+		device   string
+		expected []string
+	}{
+		{GPUVendorIntel, "", []string{"-hwaccel_device /dev/dri/renderD128"}},
+		{GPUVendorIntel, "/dev/dri/renderD129", []string{"-hwaccel vaapi -hwaccel_device /dev/dri/renderD129"}},
+		{GPUVendorAMD, "/dev/dri/renderD130", []string{"-hwaccel vaapi -hwaccel_device /dev/dri/renderD130"}},
+		{GPUVendorNvidia, "1", []string{"-hwaccel cuda -hwaccel_device 1 -hwaccel_output_format cuda", "-c:v hevc_nvenc", "-gpu 1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.vendor)+tt.device, func(t *testing.T) {
+			opts := TranscodeOptions{InputPath: "in.mkv", OutputPath: "out.mkv", GPUVendor: tt.vendor, GPUDevice: tt.device, Preset: PresetMedium, CRF: 23}
+			args := joinArgs(f.buildFFmpegArgs(opts))
+			for _, want := range tt.expected {
+				if !contains(args, want) {
+					t.Errorf("Expected args to contain %q, got: %s", want, args)
+				}
+			}
+		})
+	}
+
+	// The default NVIDIA device adds neither a decode nor an encode selection
+	opts := TranscodeOptions{InputPath: "in.mkv", OutputPath: "out.mkv", GPUVendor: GPUVendorNvidia, Preset: PresetMedium, CRF: 23}
+	if args := joinArgs(f.buildFFmpegArgs(opts)); contains(args, "-gpu") || contains(args, "-hwaccel_device") {
+		t.Errorf("Expected no device selection by default, got: %s", args)
+	}
+}
+
+func TestValidBitrate(t *testing.T) {
+	for _, s := range []string{"8M", "8000k", "2.5M", "500000"} {
+		if !ValidBitrate(s) {
+			t.Errorf("Expected %q to be valid", s)
+		}
+	}
+	for _, s := range []string{"", "fast", "8 M", "-1M", "8G"} {
+		if ValidBitrate(s) {
+			t.Errorf("Expected %q to be invalid", s)
+		}
+	}
+}
+
+func TestParseLoudnessMeasurement(t *testing.T) {
+	output := []byte(`size=N/A time=00:01:00.00 bitrate=N/A speed= 120x
+[Parsed_loudnorm_0 @ 0x55d0] 
+{
+	"input_i" : "-30.12",
+	"input_tp" : "-5.01",
+	"input_lra" : "9.80",
+	"input_thresh" : "-40.50",
+	"output_i" : "-23.01",
+	"output_tp" : "-2.00",
+	"output_lra" : "7.00",
+	"output_thresh" : "-33.40",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.35"
+}
+`)
+	m, err := parseLoudnessMeasurement(output)
+	if err != nil {
+		t.Fatalf("Failed to parse measurement: %v", err)
+	}
+	if m.InputI != "-30.12" || m.TargetOffset != "0.35" {
+		t.Errorf("Unexpected measurement: %+v", m)
+	}
+
+	if _, err := parseLoudnessMeasurement([]byte("no json here")); err == nil {
+		t.Error("Expected error for output without measurement")
+	}
+	if _, err := parseLoudnessMeasurement([]byte(`{"input_i" : "-inf"}`)); err == nil {
+		t.Error("Expected error for silent audio")
+	}
+}
+
+func TestMakeMKVBuildExtractArgs(t *testing.T) {
+	m := &MakeMKVWrapper{}
+
+	args, err := m.buildExtractArgs(ExtractOptions{
+		SourcePath: "/input/movie.iso",
+		OutputDir:  "/output/movie",
+		TitleIndex: -1,
+		MinLength:  600,
+	})
+	if err != nil {
+		t.Fatalf("Failed to build args: %v", err)
+	}
+	argsStr := joinArgs(args)
+	for _, exp := range []string{"--minlength=600", "iso:/input/movie.iso", "all", "/output/movie"} {
+		if !contains(argsStr, exp) {
+			t.Errorf("Expected args to contain '%s', got: %v", exp, args)
+		}
+	}
+	if args[1] != "--minlength=600" {
+		t.Errorf("Expected minlength option before the command, got: %v", args)
+	}
+
+	args, _ = m.buildExtractArgs(ExtractOptions{SourcePath: "/input/movie.iso", OutputDir: "/output", TitleIndex: 3})
+	if contains(joinArgs(args), "--minlength") {
+		t.Errorf("Expected no minlength option, got: %v", args)
+	}
+	if args[3] != "3" {
+		t.Errorf("Expected title index 3, got: %v", args)
+	}
+}
+
+func TestMakeMKVBuildExtractArgsProfile(t *testing.T) {
+	m := &MakeMKVWrapper{}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	os.MkdirAll(filepath.Join(home, ".MakeMKV"), 0755)
+	named := filepath.Join(home, ".MakeMKV", "flac.mmcp.xml")
+	file := filepath.Join(t.TempDir(), "english only.mmcp.xml")
+	for _, path := range []string{named, file} {
+		if err := os.WriteFile(path, []byte("<profile/>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for profile, want := range map[string]string{"flac": named, file: file} {
+		args, err := m.buildExtractArgs(ExtractOptions{SourcePath: "/input/movie.iso", OutputDir: "/output", TitleIndex: -1, Profile: profile})
+		if err != nil {
+			t.Fatalf("Failed to build args with profile %s: %v", profile, err)
+		}
+		if args[1] != "--profile="+want {
+			t.Errorf("Expected --profile=%s before the command, got: %q", want, args)
+		}
+	}
+
+	args, _ := m.buildExtractArgs(ExtractOptions{SourcePath: "/input/movie.iso", OutputDir: "/output", TitleIndex: -1})
+	if contains(joinArgs(args), "--profile") {
+		t.Errorf("Expected no profile option, got: %v", args)
+	}
+	for _, missing := range []string{"missing", filepath.Join(home, "missing.mmcp.xml")} {
+		if _, err := m.buildExtractArgs(ExtractOptions{SourcePath: "/input/movie.iso", OutputDir: "/output", Profile: missing}); err == nil {
+			t.Errorf("Expected error for missing profile %s", missing)
+		}
+	}
+}
+
+func TestMakeMKVArgsSpecialCharacters(t *testing.T) {
+	m := &MakeMKVWrapper{}
+
+	sources := []string{
+		"/input/My Movie (2001)/movie disc.iso",
+		"/input/Movie: Director's Cut/disc.iso",
+		"/input/Amélie, \"Le Fabuleux\" [Disc 1]/VIDEO_TS",
+		"/input/100% $HOME & more;rm -rf/disc.img",
+	}
+	for _, source := range sources {
+		args, err := m.buildExtractArgs(ExtractOptions{SourcePath: source, OutputDir: "/output/My Movie: Extras", TitleIndex: -1})
+		if err != nil {
+			t.Fatalf("Failed to build args for %s: %v", source, err)
+		}
+		if len(args) != 5 {
+			t.Fatalf("Expected 5 arguments for %s, got %d: %q", source, len(args), args)
+		}
+
+		// The whole path stays one argument behind its type prefix
+		want := "iso:" + source
+		if strings.HasSuffix(source, "VIDEO_TS") {
+			want = "file:" + source
+		}
+		if args[2] != want {
+			t.Errorf("Expected source argument %q, got %q", want, args[2])
+		}
+		if args[4] != "/output/My Movie: Extras" {
+			t.Errorf("Expected output directory as one argument, got %q", args[4])
+		}
+	}
+
+	// Relative and unclean paths are made absolute
+	wd, _ := os.Getwd()
+	if got, _ := DiscSource("discs/../movie disc.iso"); got != "iso:"+filepath.Join(wd, "movie disc.iso") {
+		t.Errorf("Expected absolute source, got %q", got)
+	}
+
+	// A newline would split robot-mode output and can't be passed safely
+	if _, err := DiscSource("/input/bad\nname.iso"); err == nil {
+		t.Error("Expected error for a path containing a newline")
+	}
+	if _, err := m.buildExtractArgs(ExtractOptions{SourcePath: "/input/movie.iso", OutputDir: "/output/bad\tdir"}); err == nil {
+		t.Error("Expected error for an output directory containing a control character")
+	}
+}
+
+func TestMakeMKVParseDiscInfoQuoting(t *testing.T) {
+	m := &MakeMKVWrapper{}
+	output := "CINFO:1,6209,\"Blu-ray disc\"\r\n" +
+		"CINFO:2,0,\"Movie, \\\"The Sequel\\\"\"\r\n" +
+		"TINFO:0,8,0,\"24\"\r\n" +
+		"TINFO:0,9,0,\"2:01:33\"\r\n" +
+		"TINFO:0,26,0,\"1-3,5\"\r\n" +
+		"TINFO:1,9,0,\"0:05:12\"\r\n"
+
+	info := m.parseDiscInfo(output)
+	if info.Name != `Movie, "The Sequel"` {
+		t.Errorf("Expected escaped disc name to be unquoted, got %q", info.Name)
+	}
+	if len(info.Titles) != 2 {
+		t.Fatalf("Expected 2 titles, got %+v", info.Titles)
+	}
+	for _, title := range info.Titles {
+		if title.Index == 0 && (title.Duration != "2:01:33" || title.ChapterCount != 24 || title.Segments != "1-3,5") {
+			t.Errorf("Unexpected title 0: %+v", title)
+		}
+	}
+
+	kind, fields := robotFields(`MSG:5010,0,1,"Failed to open disc","%1","a, b"`)
+	if kind != "MSG" || len(fields) != 6 || fields[5] != "a, b" {
+		t.Errorf("Unexpected robot fields: %s %q", kind, fields)
+	}
+}
+
+func TestDiscSource(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	write("Movie Disc.bin", "data")
+	cue := write("Movie Disc.cue", "FILE \"Movie Disc.bin\" BINARY\n  TRACK 01 MODE1/2048\n    INDEX 01 00:00:00\n")
+	write("raw.bin", "data")
+	rawCue := write("raw.cue", "FILE \"raw.bin\" BINARY\n  TRACK 01 MODE2/2352\n    INDEX 01 00:00:00\n")
+	loneBin := write("lone.bin", "data")
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/input/movie.iso", "iso:/input/movie.iso"},
+		{"/input/MOVIE.IMG", "iso:/input/MOVIE.IMG"},
+		{"/input/movie.mdf", "iso:/input/movie.mdf"},
+		{cue, "iso:" + filepath.Join(dir, "Movie Disc.bin")},
+		{filepath.Join(dir, "Movie Disc.bin"), "iso:" + filepath.Join(dir, "Movie Disc.bin")},
+		{loneBin, "iso:" + loneBin},
+		{"/dev/sr0", "dev:/dev/sr0"},
+		{"/input/MOVIE/VIDEO_TS", "file:/input/MOVIE/VIDEO_TS"},
+	}
+	for _, tt := range tests {
+		got, err := DiscSource(tt.path)
+		if err != nil {
+			t.Errorf("DiscSource(%s) failed: %v", tt.path, err)
+		} else if got != tt.want {
+			t.Errorf("DiscSource(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+
+	for _, path := range []string{rawCue, filepath.Join(dir, "raw.bin"), filepath.Join(dir, "missing.cue")} {
+		if _, err := DiscSource(path); err == nil {
+			t.Errorf("Expected DiscSource(%s) to fail", path)
+		}
+	}
+
+	if !IsDiscImage("/input/disc.CUE") || IsDiscImage("/input/movie.mkv") {
+		t.Error("Unexpected IsDiscImage result")
+	}
+	for path, want := range map[string]bool{"/dev/sr0": true, "disc:0": true, "dev:/dev/sr1": true, "/input/movie.iso": false, "/input/MOVIE/VIDEO_TS": false} {
+		if got := IsOpticalDrive(path); got != want {
+			t.Errorf("IsOpticalDrive(%s) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestMakeMKVRenameExtractedTitles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"title_t00.mkv", "title_t03.mkv", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &MakeMKVWrapper{}
+	files, err := m.RenameExtractedTitles(dir, "Movie: Name")
+	if err != nil {
+		t.Fatalf("RenameExtractedTitles failed: %v", err)
+	}
+
+	expected := []string{
+		filepath.Join(dir, "Movie_ Name_t00.mkv"),
+		filepath.Join(dir, "Movie_ Name_t03.mkv"),
+	}
+	if len(files) != len(expected) {
+		t.Fatalf("Expected %d files, got %v", len(expected), files)
+	}
+	for i, exp := range expected {
+		if files[i] != exp {
+			t.Errorf("Expected '%s', got '%s'", exp, files[i])
+		}
+		if _, err := os.Stat(exp); err != nil {
+			t.Errorf("Expected %s to exist: %v", exp, err)
+		}
+	}
+
+	// A shared output dir: an earlier disc's renamed titles are left alone, and a clash
+	// with one of them gets a suffix instead of overwriting it
+	if err := os.WriteFile(filepath.Join(dir, "title_t00.mkv"), []byte("second"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files, err = m.RenameExtractedTitles(dir, "Movie: Name")
+	if err != nil {
+		t.Fatalf("RenameExtractedTitles failed: %v", err)
+	}
+	if want := filepath.Join(dir, "Movie_ Name_t00_2.mkv"); len(files) != 3 || files[2] != want {
+		t.Errorf("Expected the new title renamed to %s, got %v", want, files)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "Movie_ Name_t00.mkv")); string(data) != "x" {
+		t.Errorf("Expected the earlier disc's title to be kept, got %q", data)
+	}
+
+	// Without a disc name MakeMKV's default naming is kept
+	files, err = m.RenameExtractedTitles(t.TempDir(), "")
+	if err != nil || len(files) != 0 {
+		t.Errorf("Expected no files for empty dir, got %v (%v)", files, err)
+	}
+
+	// Outputs MakeMKV named after the volume aren't renamed but are still returned
+	dir = t.TempDir()
+	for _, name := range []string{"MOVIE_DISC_t01.mkv", "title_t02.mkv"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err = m.RenameExtractedTitles(dir, "")
+	expected = []string{filepath.Join(dir, "MOVIE_DISC_t01.mkv"), filepath.Join(dir, "title_t02.mkv")}
+	if err != nil || fmt.Sprint(files) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v (%v)", expected, files, err)
+	}
+}
+
 func TestTranscodeWithProgressCallback(t *testing.T) {
-	wrapper, err := NewFFmpegWrapper()
+	wrapper, err := NewFFmpegWrapper("", "")
 	if err != nil {
 		t.Skip("FFmpeg not available, skipping test")
 	}
@@ -181,6 +737,123 @@ func TestTranscodeWithProgressCallback(t *testing.T) {
 	t.Log("Callback mechanism tested (file not found is expected)")
 }
 
+func TestProgressRateLimit(t *testing.T) {
+	// Lines arrive far faster than the interval, only the first and final updates pass
+	var ffmpegOut, makemkvOut strings.Builder
+	for i := 1; i <= 1000; i++ {
+		fmt.Fprintf(&ffmpegOut, "frame=%d\nfps=24.0\nout_time=00:00:%02d.00\nspeed=2.0x\nprogress=continue\n", i, i%60)
+		fmt.Fprintf(&makemkvOut, "PRGV:0,%d,1000\n", i)
+	}
+
+	var ffmpegCalls []TranscodeProgress
+	f := &FFmpegWrapper{}
+	f.parseProgress(strings.NewReader(ffmpegOut.String()), 0, func(p TranscodeProgress) {
+		ffmpegCalls = append(ffmpegCalls, p)
+	})
+	if len(ffmpegCalls) < 1 || len(ffmpegCalls) > 2 {
+		t.Fatalf("ffmpeg progress: expected 1-2 callbacks, got %d", len(ffmpegCalls))
+	}
+	if last := ffmpegCalls[len(ffmpegCalls)-1]; last.Frame != 1000 {
+		t.Errorf("ffmpeg progress: expected the final update for frame 1000, got %d", last.Frame)
+	}
+
+	var makemkvCalls []TranscodeProgress
+	m := &MakeMKVWrapper{}
+	m.parseExtractProgress(strings.NewReader(makemkvOut.String()), func(p TranscodeProgress) {
+		makemkvCalls = append(makemkvCalls, p)
+	})
+	if len(makemkvCalls) < 1 || len(makemkvCalls) > 2 {
+		t.Fatalf("makemkv progress: expected 1-2 callbacks, got %d", len(makemkvCalls))
+	}
+	if last := makemkvCalls[len(makemkvCalls)-1]; last.Percentage != 100 {
+		t.Errorf("makemkv progress: expected the final update at 100%%, got %d%%", last.Percentage)
+	}
+
+	// Paced updates are passed on once per interval
+	defer func(interval time.Duration) { progressInterval = interval }(progressInterval)
+	progressInterval = 20 * time.Millisecond
+	calls := 0
+	limiter := newProgressLimiter(func(TranscodeProgress) { calls++ }, progressInterval)
+	start := time.Now()
+	for time.Since(start) < 200*time.Millisecond {
+		limiter.update(TranscodeProgress{Frame: 1})
+		time.Sleep(time.Millisecond)
+	}
+	limiter.flush()
+	if calls < 2 || calls > 12 {
+		t.Errorf("expected about one callback per 20ms over 200ms, got %d", calls)
+	}
+}
+
+func TestDiscMessageError(t *testing.T) {
+	tests := []struct {
+		line string
+		want error
+	}{
+		{`MSG:2003,0,3,"Error 'Scsi error - MEDIUM ERROR:L-EC UNCORRECTABLE ERROR' occurred while reading '/BDMV/STREAM/00800.m2ts' at offset '1048576'","Error '%1' occurred while reading '%2' at offset '%3'","Scsi error - MEDIUM ERROR:L-EC UNCORRECTABLE ERROR","/BDMV/STREAM/00800.m2ts","1048576"`, ErrDiscRead},
+		{`MSG:2003,0,3,"Error 'Scsi error - NOT READY:MEDIUM NOT PRESENT - TRAY OPEN' occurred while reading '/dev/sr0' at offset '0'","Error '%1' occurred while reading '%2' at offset '%3'","Scsi error - NOT READY:MEDIUM NOT PRESENT - TRAY OPEN","/dev/sr0","0"`, ErrNoDisc},
+		{`MSG:2003,0,3,"Error 'Scsi error - NOT READY:LOGICAL UNIT IS IN PROCESS OF BECOMING READY' occurred while reading '/dev/sr0' at offset '0'","","","",""`, ErrDiscRead},
+		{`MSG:5010,0,0,"Failed to open disc","Failed to open disc"`, ErrDiscRead},
+		{`MSG:1005,0,1,"MakeMKV v1.17.7 linux(x64-release) started","%1 started","MakeMKV v1.17.7 linux(x64-release)"`, nil},
+		{`PRGV:100,200,65536`, nil},
+	}
+
+	for _, tt := range tests {
+		err := discMessageError(tt.line)
+		if tt.want == nil {
+			if err != nil {
+				t.Errorf("discMessageError(%q) = %v, want nil", tt.line, err)
+			}
+			continue
+		}
+		if !errors.Is(err, tt.want) {
+			t.Errorf("discMessageError(%q) = %v, want %v", tt.line, err, tt.want)
+		}
+	}
+
+	// The first failure in the output is returned once it has been read
+	m := &MakeMKVWrapper{}
+	output := "PRGV:0,100,65536\n" +
+		`MSG:2003,0,3,"Error 'Scsi error - MEDIUM ERROR:L-EC UNCORRECTABLE ERROR' occurred while reading '/VIDEO_TS/VTS_01_1.VOB' at offset '0'","","","",""` + "\n" +
+		`MSG:5010,0,0,"Failed to open disc","Failed to open disc"` + "\n"
+	err := m.parseExtractProgress(strings.NewReader(output), nil)
+	if !errors.Is(err, ErrDiscRead) || !strings.Contains(err.Error(), "VTS_01_1.VOB") {
+		t.Errorf("expected the read error for VTS_01_1.VOB, got %v", err)
+	}
+}
+
+func TestGetMediaInfoErrors(t *testing.T) {
+	dir := t.TempDir()
+	script := func(name, body string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	// ffprobe's own explanation ends up in the error
+	f := &FFmpegWrapper{ffprobePath: script("corrupt", `echo "[mov,mp4,m4a,3gp,3g2,mj2 @ 0x55d5] moov atom not found" >&2
+echo "/media/broken.mp4: Invalid data found when processing input" >&2
+exit 1`)}
+	_, err := f.GetMediaInfo(context.Background(), "/media/broken.mp4")
+	if err == nil || !strings.Contains(err.Error(), "moov atom not found") || !strings.Contains(err.Error(), "Invalid data found") {
+		t.Errorf("expected ffprobe's stderr in the error, got %v", err)
+	}
+
+	// A stalled probe is killed after the timeout
+	f = &FFmpegWrapper{ffprobePath: script("stalled", `echo "reading from network" >&2
+exec sleep 10`), ProbeTimeout: 100 * time.Millisecond}
+	start := time.Now()
+	_, err = f.GetMediaInfo(context.Background(), "/media/stalled.mkv")
+	if err == nil || !strings.Contains(err.Error(), "timed out after 100ms") {
+		t.Errorf("expected a probe timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("expected the probe to be stopped quickly, took %v", elapsed)
+	}
+}
+
 // Helper functions
 func contains(s, substr string) bool {
 	return len(s) > 0 && len(substr) > 0 &&
@@ -205,3 +878,649 @@ func joinArgs(args []string) string {
 	}
 	return result
 }
+
+func TestBuildArgsContainer(t *testing.T) {
+	f := &FFmpegWrapper{}
+	opts := TranscodeOptions{InputPath: "/input/a.mkv", OutputPath: "/output/a.mp4", Container: "mp4", AudioCodec: "aac"}
+
+	args := joinArgs(f.buildFFmpegArgs(opts))
+	if !contains(args, "-c:s mov_text -movflags +faststart") || !contains(args, "-c:a aac") {
+		t.Errorf("Expected MP4 subtitle and audio args, got: %s", args)
+	}
+
+	opts.Container = "mkv"
+	if args := joinArgs(f.buildFFmpegArgs(opts)); !contains(args, "-c:s copy") {
+		t.Errorf("Expected subtitles to be copied into MKV, got: %s", args)
+	}
+
+	opts.AudioCodec = "opus"
+	if args := joinArgs(f.buildFFmpegArgs(opts)); !contains(args, "-c:a libopus -b:a 160k") {
+		t.Errorf("Expected libopus audio args, got: %s", args)
+	}
+}
+
+func TestBuildArgsAudioBitrate(t *testing.T) {
+	f := &FFmpegWrapper{}
+	tests := []struct {
+		codec, bitrate string
+		channels       int
+		want           string
+	}{
+		{"aac", "", 2, "-c:a aac -b:a 256k"},
+		{"aac", "128k", 2, "-c:a aac -b:a 128k"},
+		{"ac3", "", 6, "-c:a ac3 -b:a 640k"},
+		{"ac3", "448k", 6, "-c:a ac3 -b:a 448k"},
+		{"opus", "", 0, "-c:a libopus -b:a 160k"},
+		{"opus", "", 2, "-c:a libopus -b:a 160k"},
+		{"opus", "96k", 2, "-c:a libopus -b:a 96k"},
+		// Surround needs the surround mapping family and scales the bitrate
+		{"opus", "", 6, "-c:a libopus -b:a 384k -mapping_family 1"},
+		{"opus", "", 8, "-c:a libopus -b:a 512k -mapping_family 1"},
+		{"opus", "256k", 6, "-c:a libopus -b:a 256k -mapping_family 1"},
+	}
+	for _, tt := range tests {
+		opts := TranscodeOptions{InputPath: "/input/a.mkv", OutputPath: "/output/a.mkv", AudioCodec: tt.codec, AudioBitrate: tt.bitrate, AudioChannels: tt.channels}
+		args := joinArgs(f.buildFFmpegArgs(opts))
+		if !contains(args, tt.want) {
+			t.Errorf("%s at %q with %d channels: expected %q, got: %s", tt.codec, tt.bitrate, tt.channels, tt.want, args)
+		}
+		if tt.channels <= 2 && contains(args, "-mapping_family") {
+			t.Errorf("%s with %d channels: expected no mapping family, got: %s", tt.codec, tt.channels, args)
+		}
+	}
+
+	// The widest audio track sets the channel count
+	probe := `{"format":{},"streams":[{"codec_type":"audio","channels":2},{"codec_type":"audio","channels":6}]}`
+	if info := parseProbeOutput("/input/a.mkv", []byte(probe)); info.AudioChannels != 6 {
+		t.Errorf("Expected 6 audio channels, got %d", info.AudioChannels)
+	}
+
+	// Copied audio has no bitrate
+	opts := TranscodeOptions{InputPath: "/input/a.mkv", OutputPath: "/output/a.mkv", AudioCodec: "copy", AudioBitrate: "192k"}
+	if args := joinArgs(f.buildFFmpegArgs(opts)); contains(args, "-b:a") {
+		t.Errorf("Expected no audio bitrate when copying, got: %s", args)
+	}
+}
+
+func TestBuildArgsCopyVideo(t *testing.T) {
+	f := &FFmpegWrapper{}
+	opts := TranscodeOptions{
+		InputPath: "/input/a.mkv", OutputPath: "/output/a.mkv", GPUVendor: GPUVendorNvidia,
+		AudioCodec: "aac", CopyVideo: true, StreamSelection: StreamsKeepVideoAudio,
+	}
+
+	args := joinArgs(f.buildFFmpegArgs(opts))
+	if !contains(args, "-c:v copy") || !contains(args, "-c:a aac -b:a 256k") {
+		t.Errorf("Expected copied video with the audio encoder applied, got: %s", args)
+	}
+	if contains(args, "hevc_nvenc") || contains(args, "-hwaccel") {
+		t.Errorf("Expected no video encoder or hardware decode when copying, got: %s", args)
+	}
+	if !contains(args, "-map 0:v") {
+		t.Errorf("Expected stream selection to still apply, got: %s", args)
+	}
+}
+
+func TestCommandArgs(t *testing.T) {
+	f := &FFmpegWrapper{ffmpegPath: "/usr/bin/ffmpeg"}
+	opts := TranscodeOptions{
+		InputPath: "/input/My Movie's Cut.mkv", OutputPath: "/output/a.mkv",
+		GPUVendor: GPUVendorIntel, Preset: PresetMedium, CRF: 22, AudioCodec: "aac",
+	}
+
+	argv := f.CommandArgs(opts)
+	want := append([]string{"/usr/bin/ffmpeg", "-progress", "pipe:2"}, f.buildFFmpegArgs(opts)...)
+	if joinArgs(argv) != joinArgs(want) {
+		t.Errorf("Expected the command to match the transcode args, got: %v", argv)
+	}
+	if !contains(joinArgs(argv), "-hwaccel vaapi") {
+		t.Errorf("Expected the hwaccel flags in the command, got: %v", argv)
+	}
+
+	command := ShellJoin(argv)
+	if !strings.HasPrefix(command, "/usr/bin/ffmpeg -progress pipe:2 ") || !strings.Contains(command, `'/input/My Movie'\''s Cut.mkv'`) {
+		t.Errorf("Expected a shell-quoted command, got: %s", command)
+	}
+}
+
+func TestBuildArgsStreamSelection(t *testing.T) {
+	f := &FFmpegWrapper{}
+	tests := []struct {
+		name     string
+		opts     TranscodeOptions
+		want     string
+		unwanted []string
+	}{
+		{
+			name:     "default keeps all",
+			opts:     TranscodeOptions{Container: "mkv"},
+			want:     "-map 0 -c:s copy ",
+			unwanted: []string{"-sn", "0:v"},
+		},
+		{
+			name: "keep all mp4 maps text subtitles only",
+			opts: TranscodeOptions{Container: "mp4", StreamSelection: StreamsKeepAll, Subtitles: []SubtitleStream{
+				{Index: 0, Codec: "hdmv_pgs_subtitle"}, {Index: 1, Codec: "subrip"},
+			}},
+			want:     "-map 0 -map -0:s -map -0:t -map -0:d -map 0:s:1 -c:s mov_text ",
+			unwanted: []string{"-sn", "0:s:0"},
+		},
+		{
+			name: "by language mp4 maps text subtitles only",
+			opts: TranscodeOptions{Container: "mp4", StreamSelection: StreamsKeepByLanguage, Languages: []string{"eng"}, Subtitles: []SubtitleStream{
+				{Index: 0, Language: "eng", Codec: "dvd_subtitle"}, {Index: 1, Language: "eng", Codec: "ass"}, {Index: 2, Language: "fre", Codec: "subrip"},
+			}},
+			want:     "-map 0:v -map 0:a:m:language:eng? -map 0:s:1 -c:s mov_text ",
+			unwanted: []string{"0:s:m:language", "0:s:0", "0:s:2"},
+		},
+		{
+			name:     "video and audio only",
+			opts:     TranscodeOptions{Container: "mp4", StreamSelection: StreamsKeepVideoAudio},
+			want:     "-map 0:v -map 0:a? -sn ",
+			unwanted: []string{"-map 0 ", "-c:s"},
+		},
+		{
+			name: "by language",
+			opts: TranscodeOptions{Container: "mkv", StreamSelection: StreamsKeepByLanguage, Languages: []string{"eng", "jpn"}},
+			want: "-map 0:v -map 0:a:m:language:eng? -map 0:a:m:language:jpn? " +
+				"-map 0:s:m:language:eng? -map 0:s:m:language:jpn? -c:s copy ",
+			unwanted: []string{"-map 0 ", "-sn"},
+		},
+		{
+			name:     "by language without languages keeps all",
+			opts:     TranscodeOptions{Container: "mkv", StreamSelection: StreamsKeepByLanguage},
+			want:     "-map 0 -c:s copy ",
+			unwanted: []string{"0:v"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.InputPath, tt.opts.OutputPath = "/input/a.mkv", "/output/a."+tt.opts.Container
+			args := joinArgs(f.buildFFmpegArgs(tt.opts))
+			if !contains(args, tt.want) {
+				t.Errorf("expected %q in args, got: %s", tt.want, args)
+			}
+			for _, u := range tt.unwanted {
+				if contains(args, u) {
+					t.Errorf("unexpected %q in args: %s", u, args)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildArgsSubtitleLanguages(t *testing.T) {
+	probe := `{"format":{"duration":"10"},"streams":[
+		{"codec_type":"video","codec_name":"h264"},
+		{"codec_type":"audio","tags":{"language":"eng"}},
+		{"codec_type":"subtitle","tags":{"language":"eng"}},
+		{"codec_type":"subtitle","tags":{"language":"fre"}},
+		{"codec_type":"subtitle","tags":{"language":"ger"},"disposition":{"forced":1}},
+		{"codec_type":"subtitle","tags":{"language":"ENG"},"disposition":{"forced":1}},
+		{"codec_type":"subtitle"}]}`
+	info := parseProbeOutput("/input/a.mkv", []byte(probe))
+	if info.SubtitleStreams != 5 || len(info.Subtitles) != 5 {
+		t.Fatalf("expected 5 subtitle tracks, got %d %v", info.SubtitleStreams, info.Subtitles)
+	}
+	if sub := info.Subtitles[3]; sub.Index != 3 || sub.Language != "eng" || !sub.Forced {
+		t.Errorf("expected the 4th track to be forced English, got %+v", sub)
+	}
+
+	f := &FFmpegWrapper{}
+	tests := []struct {
+		name     string
+		opts     TranscodeOptions
+		want     string
+		unwanted []string
+	}{
+		{
+			name:     "keep all narrows subtitles",
+			opts:     TranscodeOptions{SubtitleLanguages: []string{"eng"}},
+			want:     "-map 0 -map -0:s -map 0:s:0 -map 0:s:3 -c:s copy ",
+			unwanted: []string{"0:s:1", "0:s:2", "0:s:4"},
+		},
+		{
+			name:     "forced tracks in any language",
+			opts:     TranscodeOptions{SubtitleLanguages: []string{"eng"}, KeepForcedSubtitles: true},
+			want:     "-map 0 -map -0:s -map 0:s:0 -map 0:s:2 -map 0:s:3 -c:s copy ",
+			unwanted: []string{"0:s:1", "0:s:4"},
+		},
+		{
+			name:     "by language picks its own subtitles",
+			opts:     TranscodeOptions{StreamSelection: StreamsKeepByLanguage, Languages: []string{"eng"}, SubtitleLanguages: []string{"fre"}},
+			want:     "-map 0:v -map 0:a:m:language:eng? -map 0:s:1 -c:s copy ",
+			unwanted: []string{"0:s:m:language", "0:s:0"},
+		},
+		{
+			name:     "forced alone keeps every track",
+			opts:     TranscodeOptions{KeepForcedSubtitles: true},
+			want:     "-map 0 -c:s copy ",
+			unwanted: []string{"-0:s"},
+		},
+		{
+			name:     "video and audio only still drops subtitles",
+			opts:     TranscodeOptions{StreamSelection: StreamsKeepVideoAudio, SubtitleLanguages: []string{"eng"}},
+			want:     "-map 0:v -map 0:a? -sn ",
+			unwanted: []string{"0:s"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.InputPath, tt.opts.OutputPath, tt.opts.Container = "/input/a.mkv", "/output/a.mkv", "mkv"
+			tt.opts.Subtitles = info.Subtitles
+			args := joinArgs(f.buildFFmpegArgs(tt.opts))
+			if !contains(args, tt.want) {
+				t.Errorf("expected %q in args, got: %s", tt.want, args)
+			}
+			for _, u := range tt.unwanted {
+				if contains(args, u) {
+					t.Errorf("unexpected %q in args: %s", u, args)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateStreamSelection(t *testing.T) {
+	tests := []struct {
+		selection StreamSelection
+		languages []string
+		wantErr   bool
+	}{
+		{"", nil, false},
+		{StreamsKeepAll, nil, false},
+		{StreamsKeepVideoAudio, nil, false},
+		{StreamsKeepByLanguage, []string{"eng", "fre"}, false},
+		{StreamsKeepByLanguage, nil, true},
+		{StreamsKeepByLanguage, []string{"en"}, true},
+		{"keep-some", nil, true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateStreamSelection(tt.selection, tt.languages)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateStreamSelection(%q, %v) error = %v, wantErr %v", tt.selection, tt.languages, err, tt.wantErr)
+		}
+	}
+}
+
+func TestChapterMetadata(t *testing.T) {
+	output := `[Parsed_showinfo_1 @ 0x5581] n:   0 pts:  12012 pts_time:200.2   duration:   1001 fmt:yuv420p
+[Parsed_showinfo_1 @ 0x5581] n:   1 pts:  14014 pts_time:260.5   duration:   1001 fmt:yuv420p
+frame=    2 fps=0.0 q=-0.0 Lsize=N/A time=00:04:20.50
+[Parsed_showinfo_1 @ 0x5581] n:   2 pts:  30030 pts_time:615.75  duration:   1001 fmt:yuv420p
+`
+	scenes := parseSceneTimes(output)
+	if len(scenes) != 3 || scenes[0] != 200.2 || scenes[2] != 615.75 {
+		t.Fatalf("Unexpected scene times: %v", scenes)
+	}
+
+	// The cut at 260.5 would leave a chapter shorter than MinChapterSeconds
+	starts := ChapterStarts(scenes, 1000)
+	if len(starts) != 3 || starts[0] != 0 || starts[1] != 200.2 || starts[2] != 615.75 {
+		t.Fatalf("Unexpected chapter starts: %v", starts)
+	}
+
+	want := ";FFMETADATA1\n" +
+		"\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=200200\ntitle=Chapter 1\n" +
+		"\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=200200\nEND=615750\ntitle=Chapter 2\n" +
+		"\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=615750\nEND=1000000\ntitle=Chapter 3\n"
+	if got := ChapterMetadata(starts, 1000); got != want {
+		t.Errorf("Unexpected chapter metadata:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Without cuts, chapters fall back to fixed intervals
+	starts = ChapterStarts(nil, 2000)
+	if len(starts) != 4 || starts[1] != ChapterIntervalSec || starts[3] != 3*ChapterIntervalSec {
+		t.Errorf("Unexpected interval chapters: %v", starts)
+	}
+	if starts := ChapterStarts(nil, 300); len(starts) != 1 {
+		t.Errorf("Expected a single chapter for a short video, got %v", starts)
+	}
+}
+
+func TestBuildChapterMuxArgs(t *testing.T) {
+	f := &FFmpegWrapper{}
+	args := joinArgs(f.buildChapterMuxArgs("/out/movie.mkv", "/out/movie.chapters.txt", "/out/movie.muxing.mkv"))
+	for _, exp := range []string{"-f ffmetadata -i /out/movie.chapters.txt", "-map 0 -map_metadata 0 -map_chapters 1 -c copy", "-y /out/movie.muxing.mkv"} {
+		if !contains(args, exp) {
+			t.Errorf("Expected args to contain %q, got: %s", exp, args)
+		}
+	}
+}
+
+func TestFindSiblingSubtitle(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("1\n00:00:01,000 --> 00:00:02,000\nHello\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	video := filepath.Join(dir, "Movie [2001].mkv")
+	if path, _ := FindSiblingSubtitle(video); path != "" {
+		t.Errorf("Expected no subtitle yet, got %s", path)
+	}
+
+	write("Movie [2001].notes.srt") // Not a language tag
+	write("Other Movie.en.srt")
+	tagged := write("Movie [2001].en.srt")
+	if path, lang := FindSiblingSubtitle(video); path != tagged || lang != "en" {
+		t.Errorf("Expected tagged sibling %s (en), got %s (%s)", tagged, path, lang)
+	}
+
+	untagged := write("Movie [2001].srt")
+	if path, lang := FindSiblingSubtitle(video); path != untagged || lang != "" {
+		t.Errorf("Expected untagged sibling %s to win, got %s (%s)", untagged, path, lang)
+	}
+
+	if err := ValidateSubtitleFile(untagged); err != nil {
+		t.Errorf("Expected valid subtitle, got %v", err)
+	}
+	empty := filepath.Join(dir, "empty.srt")
+	os.WriteFile(empty, nil, 0644)
+	if err := ValidateSubtitleFile(empty); err == nil {
+		t.Error("Expected error for a subtitle without cues")
+	}
+	if err := ValidateSubtitleFile(video); err == nil {
+		t.Error("Expected error for a non-srt file")
+	}
+
+	// The found subtitle is muxed in after the output's existing subtitle streams
+	f := &FFmpegWrapper{}
+	args := joinArgs(f.buildSubtitleMuxArgs("/out/Movie [2001].mkv", tagged, "/out/Movie [2001].muxing.mkv", "eng", 1))
+	for _, exp := range []string{"-i " + tagged, "-map 0 -map 1 -c copy -c:s:1 srt", "-metadata:s:s:1 language=eng"} {
+		if !contains(args, exp) {
+			t.Errorf("Expected args to contain %q, got: %s", exp, args)
+		}
+	}
+}
+
+func TestBuildArgsRemoteSource(t *testing.T) {
+	f := &FFmpegWrapper{}
+	url := "https://media.example.com/library/Movie%20(2020).mkv?token=abc"
+
+	opts := TranscodeOptions{InputPath: url, OutputPath: "/output/Movie (2020)_optimized.mkv", GPUVendor: GPUVendorCPU, Preset: PresetMedium, CRF: 23}
+	args := joinArgs(f.buildFFmpegArgs(opts))
+	if !contains(args, "-reconnect 1 -reconnect_streamed 1 -reconnect_delay_max 10 -i "+url) {
+		t.Errorf("Expected the URL as input with reconnect options, got: %s", args)
+	}
+
+	opts.InputPath = "/storage/movie.mkv"
+	if args := joinArgs(f.buildFFmpegArgs(opts)); contains(args, "-reconnect") {
+		t.Errorf("Expected no reconnect options for a local file, got: %s", args)
+	}
+
+	if !IsRemoteSource(url) || IsRemoteSource("/storage/movie.mkv") || IsRemoteSource("C:movie.mkv") {
+		t.Error("IsRemoteSource misclassified a source")
+	}
+	if name := RemoteFileName(url); name != "Movie (2020).mkv" {
+		t.Errorf("RemoteFileName = %q, want %q", name, "Movie (2020).mkv")
+	}
+	if name := RemoteFileName("https://media.example.com/"); name != "" {
+		t.Errorf("RemoteFileName of a bare host = %q, want empty", name)
+	}
+}
+
+func TestBuildArgsMaxResolution(t *testing.T) {
+	f := &FFmpegWrapper{}
+	base := TranscodeOptions{InputPath: "in.mkv", OutputPath: "out.mkv", Preset: PresetMedium, CRF: 23, MaxHeight: 1080}
+
+	tests := []struct {
+		name     string
+		vendor   GPUVendor
+		hybrid   bool
+		height   int
+		expected string
+	}{
+		{"4k on cpu", GPUVendorCPU, false, 2160, "-vf scale=-2:1080 -c:v libx265"},
+		{"4k on nvidia", GPUVendorNvidia, false, 2160, "-vf scale_cuda=-2:1080 -c:v hevc_nvenc"},
+		{"4k on vaapi", GPUVendorIntel, false, 2160, "-vf scale_vaapi=w=-2:h=1080,hwupload -c:v hevc_vaapi"},
+		{"4k hybrid", GPUVendorNvidia, true, 2160, "-vf hwdownload,format=nv12|p010le,scale=-2:1080 -c:v libx265"},
+		{"unknown height", GPUVendorCPU, false, 0, `-vf scale=-2:min(ih\,1080) -c:v libx265`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := base
+			opts.GPUVendor, opts.HybridHWDecode, opts.SourceHeight = tt.vendor, tt.hybrid, tt.height
+			args := joinArgs(f.buildFFmpegArgs(opts))
+			if !contains(args, tt.expected) {
+				t.Errorf("Expected %q, got: %s", tt.expected, args)
+			}
+			if strings.Count(args, "-vf ") != 1 {
+				t.Errorf("Expected a single filter chain, got: %s", args)
+			}
+		})
+	}
+
+	// Sources within the cap, or being upscaled, are not downscaled
+	opts := base
+	opts.SourceHeight = 720
+	if args := joinArgs(f.buildFFmpegArgs(opts)); contains(args, "scale") {
+		t.Errorf("Expected no scaling for a 720p source, got: %s", args)
+	}
+	opts.Upscale, opts.Resolution = true, "4k"
+	if args := joinArgs(f.buildFFmpegArgs(opts)); !contains(args, "scale=3840:2160:flags=lanczos") || contains(args, "scale=-2") {
+		t.Errorf("Expected only the upscale filter, got: %s", args)
+	}
+
+	if height, err := ParseMaxResolution("1080p"); err != nil || height != 1080 {
+		t.Errorf("Expected 1080, got %d %v", height, err)
+	}
+	if _, err := ParseMaxResolution("1080"); err == nil {
+		t.Error("Expected an error for an unknown resolution")
+	}
+}
+
+func TestMakeMKVScanDiscCache(t *testing.T) {
+	dir := t.TempDir()
+	countFile := filepath.Join(dir, "scans")
+	script := filepath.Join(dir, "makemkvcon")
+	body := "#!/bin/sh\necho scan >> " + countFile + "\necho 'TINFO:0,9,0,\"2:01:33\"'\n"
+	if err := os.WriteFile(script, []byte(body), 0755); err != nil {
+		t.Fatal(err)
+	}
+	image := filepath.Join(dir, "movie.iso")
+	if err := os.WriteFile(image, []byte("disc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &MakeMKVWrapper{makemkvconPath: script}
+	scans := func() int {
+		data, _ := os.ReadFile(countFile)
+		return strings.Count(string(data), "scan")
+	}
+
+	for i := 0; i < 2; i++ {
+		info, err := m.ScanDisc(context.Background(), image)
+		if err != nil || len(info.Titles) != 1 {
+			t.Fatalf("scan %d: unexpected result %+v %v", i, info, err)
+		}
+	}
+	if n := scans(); n != 1 {
+		t.Errorf("Expected the second scan to hit the cache, makemkvcon ran %d times", n)
+	}
+
+	// A changed image is scanned again
+	if err := os.WriteFile(image, []byte("remastered disc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.ScanDisc(context.Background(), image); err != nil {
+		t.Fatal(err)
+	}
+	if n := scans(); n != 2 {
+		t.Errorf("Expected a changed image to be rescanned, makemkvcon ran %d times", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.ScanDisc(ctx, image); err == nil {
+		t.Error("Expected a cancelled scan to fail")
+	}
+}
+
+func TestFindTitlesOverDuration(t *testing.T) {
+	// A box set disc: four episodes, a play-all title and some extras, in map order
+	info := &DiscInfo{Titles: []TitleInfo{
+		{Index: 4, Duration: "0:44:10"},
+		{Index: 0, Duration: "2:56:40"},
+		{Index: 1, Duration: "0:43:55"},
+		{Index: 5, Duration: "0:02:30"},
+		{Index: 2, Duration: "0:45:02"},
+		{Index: 3, Duration: "0:44:10"},
+		{Index: 6, Duration: "0:08:00"},
+	}}
+
+	tests := []struct {
+		name       string
+		minSeconds int
+		maxTitles  int
+		expected   []int
+	}{
+		{"over 40 minutes", 2400, 0, []int{1, 2, 3, 4}},
+		{"longest three", 0, 3, []int{2, 3, 4}},
+		{"longest two over 40 minutes", 2400, 2, []int{2, 3}},
+		{"play-all alone", 3 * 3600 / 2, 0, []int{0}},
+		{"none long enough", 4 * 3600, 0, []int{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := info.FindTitlesOverDuration(tt.minSeconds, tt.maxTitles)
+			if fmt.Sprint(got) != fmt.Sprint(tt.expected) {
+				t.Errorf("Expected titles %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	// Segment maps find a play-all whose duration doesn't add up, e.g. without the
+	// recaps, and keep a movie whose extras happen to sum to its length
+	info = &DiscInfo{Titles: []TitleInfo{
+		{Index: 0, Duration: "1:50:00", Segments: "1-3"},
+		{Index: 1, Duration: "0:45:00", Segments: "1"},
+		{Index: 2, Duration: "0:45:00", Segments: "2"},
+		{Index: 3, Duration: "0:45:00", Segments: "3"},
+	}}
+	if got := info.FindTitlesOverDuration(2400, 0); fmt.Sprint(got) != "[1 2 3]" {
+		t.Errorf("Expected the play-all left out by its segments, got %v", got)
+	}
+	info = &DiscInfo{Titles: []TitleInfo{
+		{Index: 0, Duration: "2:00:00", Segments: "1"},
+		{Index: 1, Duration: "1:00:00", Segments: "2"},
+		{Index: 2, Duration: "0:31:00", Segments: "3"},
+		{Index: 3, Duration: "0:29:00", Segments: "4"},
+	}}
+	if got := info.FindTitlesOverDuration(0, 1); fmt.Sprint(got) != "[0]" {
+		t.Errorf("Expected the movie kept, got %v", got)
+	}
+}
+
+func TestMakeMKVRenameEpisodes(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"title_t01.mkv", "title_t02.mkv", "title_t04.mkv"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &MakeMKVWrapper{}
+	files, err := m.RenameEpisodes(dir, "Show: Season 1", []int{1, 2, 4})
+	if err != nil {
+		t.Fatalf("RenameEpisodes failed: %v", err)
+	}
+	for i, name := range []string{"Show_ Season 1_e01.mkv", "Show_ Season 1_e02.mkv", "Show_ Season 1_e03.mkv"} {
+		if i >= len(files) || files[i] != filepath.Join(dir, name) {
+			t.Errorf("Expected %s at position %d, got %v", name, i, files)
+		}
+	}
+}
+
+func TestParseProbeOutputMissingDuration(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    string
+		duration  float64
+		estimated bool
+	}{
+		{
+			name:     "container duration",
+			output:   `{"format":{"duration":"5400.5","size":"1000"},"streams":[{"codec_type":"video","codec_name":"h264","duration":"5300"}]}`,
+			duration: 5400.5,
+		},
+		{
+			name:      "longest stream",
+			output:    `{"format":{"size":"1000"},"streams":[{"codec_type":"video","codec_name":"h264","height":1080,"duration":"5399.9"},{"codec_type":"audio","duration":"5400.2"}]}`,
+			duration:  5400.2,
+			estimated: true,
+		},
+		{
+			name:      "bitrate and size",
+			output:    `{"format":{"size":"1000000","bit_rate":"8000"},"streams":[{"codec_type":"video","codec_name":"h264"}]}`,
+			duration:  1000,
+			estimated: true,
+		},
+		{
+			name:   "unknown",
+			output: `{"format":{},"streams":[{"codec_type":"video","codec_name":"h264"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := parseProbeOutput("/input/movie.ts", []byte(tt.output))
+			if info.Duration != tt.duration || info.DurationEstimated != tt.estimated {
+				t.Errorf("Expected duration %.1f (estimated %v), got %.1f (estimated %v)", tt.duration, tt.estimated, info.Duration, info.DurationEstimated)
+			}
+			if info.VideoCodec != "h264" {
+				t.Errorf("Expected the rest of the probe to be parsed, got %+v", info)
+			}
+		})
+	}
+}
+
+func TestEncoderTuning(t *testing.T) {
+	f := &FFmpegWrapper{}
+
+	tuning, err := ParseEncoderTuning(GPUVendorNvidia, "rc=constqp, spatial-aq=1,rc-lookahead=32")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := TranscodeOptions{GPUVendor: GPUVendorNvidia, Preset: PresetMedium, CRF: 23, Tuning: tuning}
+	args := joinArgs(f.getVideoEncoderArgs(opts))
+	// Overrides replace the built-in value in place, new options are appended
+	if want := "-rc constqp -cq 23 -b:v 0 -profile:v main10 -tier high -rc-lookahead 32 -spatial-aq 1"; !contains(args, want) {
+		t.Errorf("Expected args to contain %q, got: %s", want, args)
+	}
+
+	tuning, _ = ParseEncoderTuning(GPUVendorIntel, "rc_mode=ICQ,low_power=1")
+	opts = TranscodeOptions{GPUVendor: GPUVendorIntel, Preset: PresetMedium, CRF: 23, MaxBitrate: "8M", Tuning: tuning}
+	args = joinArgs(f.getVideoEncoderArgs(opts))
+	if want := "-rc_mode ICQ -global_quality 23 -b:v 8M -maxrate 8M -bufsize 8M -low_power 1"; !contains(args, want) {
+		t.Errorf("Expected args to contain %q, got: %s", want, args)
+	}
+
+	// Tuning doesn't reach libx265
+	opts = TranscodeOptions{GPUVendor: GPUVendorCPU, Preset: PresetMedium, CRF: 23, Tuning: map[string]string{"rc": "cbr"}}
+	if args := joinArgs(f.getVideoEncoderArgs(opts)); contains(args, "-rc ") {
+		t.Errorf("Expected no tuning for the CPU encoder, got: %s", args)
+	}
+
+	for _, tt := range []struct {
+		vendor GPUVendor
+		tuning string
+	}{
+		{GPUVendorNvidia, "rc_mode=CQP"}, // A VAAPI option
+		{GPUVendorIntel, "spatial-aq=1"},
+		{GPUVendorAMD, "rc_mode"},
+		{GPUVendorCPU, "preset=slow"},
+	} {
+		if _, err := ParseEncoderTuning(tt.vendor, tt.tuning); err == nil {
+			t.Errorf("Expected %s tuning %q to be rejected", tt.vendor, tt.tuning)
+		}
+	}
+	if tuning, err := ParseEncoderTuning(GPUVendorAMD, " "); err != nil || tuning != nil {
+		t.Errorf("Expected no tuning, got %v, %v", tuning, err)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // ProgressCallback is called periodically with transcoding progress
@@ -27,14 +29,56 @@ type TranscodeProgress struct {
 	ETA             string  // Estimated time remaining
 }
 
-// TranscodeWithProgress executes FFmpeg with real-time progress monitoring
-func (f *FFmpegWrapper) TranscodeWithProgress(ctx context.Context, opts TranscodeOptions, callback ProgressCallback) error {
-	args := f.buildFFmpegArgs(opts)
+// progressInterval is the least time between progress callbacks. ffmpeg and makemkvcon
+// report progress many times a second, and each callback mutates and saves a job.
+var progressInterval = 500 * time.Millisecond
+
+// progressLimiter passes progress to a callback at most once per interval. The latest
+// update it held back is delivered by flush, so the final progress is never dropped.
+type progressLimiter struct {
+	callback ProgressCallback
+	interval time.Duration
+
+	mu      sync.Mutex
+	last    time.Time
+	pending *TranscodeProgress
+}
+
+func newProgressLimiter(callback ProgressCallback, interval time.Duration) *progressLimiter {
+	return &progressLimiter{callback: callback, interval: interval}
+}
 
-	// Add progress output
-	args = append([]string{"-progress", "pipe:2"}, args...)
+// update delivers progress now if the interval has passed since the last callback,
+// otherwise keeps it for the next one
+func (l *progressLimiter) update(progress TranscodeProgress) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.last.IsZero() && time.Since(l.last) < l.interval {
+		l.pending = &progress
+		return
+	}
+	l.deliver(progress)
+}
+
+// flush delivers the update held back, if any
+func (l *progressLimiter) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pending != nil {
+		l.deliver(*l.pending)
+	}
+}
+
+// deliver calls the callback with the lock held, so updates arrive in order
+func (l *progressLimiter) deliver(progress TranscodeProgress) {
+	l.last = time.Now()
+	l.pending = nil
+	l.callback(progress)
+}
 
-	cmd := exec.CommandContext(ctx, f.ffmpegPath, args...)
+// TranscodeWithProgress executes FFmpeg with real-time progress monitoring
+func (f *FFmpegWrapper) TranscodeWithProgress(ctx context.Context, opts TranscodeOptions, callback ProgressCallback) error {
+	cmd := exec.CommandContext(ctx, f.ffmpegPath, f.progressArgs(opts)...)
 
 	// Capture stderr for progress
 	stderr, err := cmd.StderrPipe()
@@ -58,10 +102,42 @@ func (f *FFmpegWrapper) TranscodeWithProgress(ctx context.Context, opts Transcod
 	return nil
 }
 
-// parseProgress parses FFmpeg progress output
+// CommandArgs returns the command TranscodeWithProgress runs for opts, the ffmpeg binary
+// followed by its arguments, without running it
+func (f *FFmpegWrapper) CommandArgs(opts TranscodeOptions) []string {
+	return append([]string{f.ffmpegPath}, f.progressArgs(opts)...)
+}
+
+// progressArgs are the transcode arguments with progress reported on stderr
+func (f *FFmpegWrapper) progressArgs(opts TranscodeOptions) []string {
+	return append([]string{"-progress", "pipe:2"}, f.buildFFmpegArgs(opts)...)
+}
+
+var shellSafePattern = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// ShellJoin quotes a command for a POSIX shell, so it can be copied and run by hand
+func ShellJoin(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		if shellSafePattern.MatchString(arg) {
+			quoted[i] = arg
+		} else {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// parseProgress parses FFmpeg progress output, calling callback at most every
+// progressInterval and always with the last progress parsed
 func (f *FFmpegWrapper) parseProgress(reader io.Reader, totalDuration float64, callback ProgressCallback) {
 	scanner := bufio.NewScanner(reader)
 	progress := TranscodeProgress{}
+	var limiter *progressLimiter
+	if callback != nil {
+		limiter = newProgressLimiter(callback, progressInterval)
+		defer limiter.flush()
+	}
 
 	// Regex patterns for parsing
 	frameRegex := regexp.MustCompile(`frame=\s*(\d+)`)
@@ -103,8 +179,8 @@ func (f *FFmpegWrapper) parseProgress(reader io.Reader, totalDuration float64, c
 		}
 
 		// Call the callback with updated progress
-		if callback != nil && progress.Frame > 0 {
-			callback(progress)
+		if limiter != nil && progress.Frame > 0 {
+			limiter.update(progress)
 		}
 	}
 }
@@ -124,6 +200,11 @@ func CalculatePercentage(currentTime string, totalDuration float64) int {
 	return percentage
 }
 
+// ParseTimestamp converts an HH:MM:SS time, such as an ETA, to seconds
+func ParseTimestamp(timeStr string) float64 {
+	return parseTimeToSeconds(timeStr)
+}
+
 // parseTimeToSeconds converts FFmpeg time format (HH:MM:SS.ms) to seconds
 func parseTimeToSeconds(timeStr string) float64 {
 	parts := strings.Split(timeStr, ":")
@@ -0,0 +1,38 @@
+package media
+
+import (
+	"net/url"
+	"path"
+	"strings"
+)
+
+// IsRemoteSource reports whether a source is a URL for ffmpeg to stream rather than a
+// local path
+func IsRemoteSource(source string) bool {
+	u, err := url.Parse(source)
+	return err == nil && u.Scheme != "" && u.Host != "" && strings.Contains(source, "://")
+}
+
+// RemoteFileName returns the file name at the end of a remote source's path, empty if
+// the URL doesn't name a file
+func RemoteFileName(source string) string {
+	u, err := url.Parse(source)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return ""
+	}
+	return name
+}
+
+// remoteInputArgs returns the input options for a source: HTTP streams reconnect
+// after dropped connections instead of ending the encode early
+func remoteInputArgs(source string) []string {
+	lower := strings.ToLower(source)
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		return nil
+	}
+	return []string{"-reconnect", "1", "-reconnect_streamed", "1", "-reconnect_delay_max", "10"}
+}
@@ -0,0 +1,69 @@
+package media
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// discScanCacheSize bounds how many disc image scans are kept
+const discScanCacheSize = 32
+
+// discScan is a cached ScanDisc result, valid while the image keeps its size and mtime
+type discScan struct {
+	size    int64
+	modTime time.Time
+	info    *DiscInfo
+}
+
+// imageFileInfo stats the image file behind an "iso:" makemkvcon source. Devices and
+// disc folders have no reliable change marker and are never cached.
+func imageFileInfo(source string) (os.FileInfo, bool) {
+	path, ok := strings.CutPrefix(source, "iso:")
+	if !ok {
+		return nil, false
+	}
+	fi, err := os.Stat(path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return nil, false
+	}
+	return fi, true
+}
+
+// cachedScan returns a copy of the cached scan of source, nil when there is none or the
+// image changed since
+func (m *MakeMKVWrapper) cachedScan(source string, fi os.FileInfo) *DiscInfo {
+	m.scanMu.Lock()
+	defer m.scanMu.Unlock()
+
+	scan, ok := m.scanCache[source]
+	if !ok {
+		return nil
+	}
+	if scan.size != fi.Size() || !scan.modTime.Equal(fi.ModTime()) {
+		delete(m.scanCache, source)
+		return nil
+	}
+	info := *scan.info
+	info.Titles = append([]TitleInfo(nil), scan.info.Titles...)
+	return &info
+}
+
+// storeScan caches the scan of source, evicting an arbitrary entry when full
+func (m *MakeMKVWrapper) storeScan(source string, fi os.FileInfo, info *DiscInfo) {
+	m.scanMu.Lock()
+	defer m.scanMu.Unlock()
+
+	if m.scanCache == nil {
+		m.scanCache = make(map[string]discScan)
+	}
+	if _, exists := m.scanCache[source]; !exists && len(m.scanCache) >= discScanCacheSize {
+		for key := range m.scanCache {
+			delete(m.scanCache, key)
+			break
+		}
+	}
+	stored := *info
+	stored.Titles = append([]TitleInfo(nil), info.Titles...)
+	m.scanCache[source] = discScan{size: fi.Size(), modTime: fi.ModTime(), info: &stored}
+}
@@ -0,0 +1,145 @@
+package media
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// StreamSelection controls which input streams are carried into the output
+type StreamSelection string
+
+const (
+	// StreamsKeepAll maps every stream: video, audio, subtitles, attachments and data
+	StreamsKeepAll StreamSelection = "keep-all"
+	// StreamsKeepVideoAudio drops subtitles, attachments and data streams
+	StreamsKeepVideoAudio StreamSelection = "keep-video-audio"
+	// StreamsKeepByLanguage keeps video plus the audio and subtitle tracks in the given languages
+	StreamsKeepByLanguage StreamSelection = "keep-by-language"
+)
+
+var languageCodeRegex = regexp.MustCompile(`^[a-z]{3}$`)
+
+// ValidateStreamSelection checks a selection and its languages, as ISO 639-2 codes
+func ValidateStreamSelection(selection StreamSelection, languages []string) error {
+	switch selection {
+	case "", StreamsKeepAll, StreamsKeepVideoAudio:
+		return nil
+	case StreamsKeepByLanguage:
+		if len(languages) == 0 {
+			return fmt.Errorf("stream selection %s needs at least one language", selection)
+		}
+		return ValidateLanguages(languages)
+	default:
+		return fmt.Errorf("invalid stream selection %q", selection)
+	}
+}
+
+// SubtitleStream is a subtitle track of a source
+type SubtitleStream struct {
+	Index    int    // Among the subtitle tracks, as in the 0:s:N stream specifier
+	Language string // ISO 639-2 language tag, empty when untagged
+	Forced   bool   // Forced disposition, shown for foreign dialogue only
+	Codec    string // ffprobe codec name, e.g. "subrip" or "hdmv_pgs_subtitle"
+}
+
+// textSubtitleCodecs are the subtitle codecs that can be converted to mov_text for MP4,
+// image subtitles such as PGS and VobSub can't
+var textSubtitleCodecs = map[string]bool{
+	"subrip": true, "srt": true, "ass": true, "ssa": true, "mov_text": true, "webvtt": true, "text": true,
+}
+
+// textSubtitles returns the subtitle tracks in a text codec
+func textSubtitles(subtitles []SubtitleStream) []SubtitleStream {
+	var text []SubtitleStream
+	for _, sub := range subtitles {
+		if textSubtitleCodecs[sub.Codec] {
+			text = append(text, sub)
+		}
+	}
+	return text
+}
+
+// ValidateLanguages checks languages are ISO 639-2 codes
+func ValidateLanguages(languages []string) error {
+	for _, lang := range languages {
+		if !languageCodeRegex.MatchString(lang) {
+			return fmt.Errorf("invalid language %q, expected an ISO 639-2 code like eng", lang)
+		}
+	}
+	return nil
+}
+
+// selectSubtitles returns the 0:s:N maps of the subtitle tracks in the wanted languages,
+// plus the forced tracks when keepForced is set
+func selectSubtitles(subtitles []SubtitleStream, languages []string, keepForced bool) []string {
+	var args []string
+	for _, sub := range subtitles {
+		keep := keepForced && sub.Forced
+		for _, lang := range languages {
+			keep = keep || strings.EqualFold(sub.Language, lang)
+		}
+		if keep {
+			args = append(args, "-map", fmt.Sprintf("0:s:%d", sub.Index))
+		}
+	}
+	return args
+}
+
+// getStreamArgs returns the -map arguments and subtitle codec for the selected streams.
+// Without a selection every stream is kept. MP4 can't hold image subtitles, attachments
+// or data streams, so only the probed text subtitles are mapped there. SubtitleLanguages
+// narrows the subtitles of the other selections to the matching tracks.
+func getStreamArgs(opts TranscodeOptions) []string {
+	selection := opts.StreamSelection
+	if selection == StreamsKeepByLanguage && len(opts.Languages) == 0 {
+		selection = StreamsKeepAll
+	}
+
+	// MP4 only holds text subtitles as mov_text
+	subtitleCodec := "copy"
+	mp4 := opts.Container == "mp4"
+	subtitles := opts.Subtitles
+	if mp4 {
+		subtitleCodec = "mov_text"
+		subtitles = textSubtitles(subtitles)
+	}
+
+	pickSubtitles := len(opts.SubtitleLanguages) > 0
+	switch selection {
+	case StreamsKeepVideoAudio:
+		return []string{"-map", "0:v", "-map", "0:a?", "-sn"}
+	case StreamsKeepByLanguage:
+		args := []string{"-map", "0:v"}
+		for _, lang := range opts.Languages {
+			args = append(args, "-map", "0:a:m:language:"+strings.ToLower(lang)+"?")
+		}
+		if pickSubtitles {
+			args = append(args, selectSubtitles(subtitles, opts.SubtitleLanguages, opts.KeepForcedSubtitles)...)
+		} else if mp4 {
+			args = append(args, selectSubtitles(subtitles, opts.Languages, false)...)
+		} else {
+			for _, lang := range opts.Languages {
+				args = append(args, "-map", "0:s:m:language:"+strings.ToLower(lang)+"?")
+			}
+		}
+		return append(args, "-c:s", subtitleCodec)
+	default:
+		args := []string{"-map", "0"}
+		switch {
+		case pickSubtitles:
+			// Drop every subtitle track, then map back the wanted ones
+			args = append(args, "-map", "-0:s")
+			if mp4 {
+				args = append(args, "-map", "-0:t", "-map", "-0:d")
+			}
+			args = append(args, selectSubtitles(subtitles, opts.SubtitleLanguages, opts.KeepForcedSubtitles)...)
+		case mp4:
+			args = append(args, "-map", "-0:s", "-map", "-0:t", "-map", "-0:d")
+			for _, sub := range subtitles {
+				args = append(args, "-map", fmt.Sprintf("0:s:%d", sub.Index))
+			}
+		}
+		return append(args, "-c:s", subtitleCodec)
+	}
+}
@@ -0,0 +1,75 @@
+package media
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// FindSiblingSubtitle looks for an SRT next to videoPath with the same basename, either
+// untagged (movie.srt) or tagged with a language (movie.en.srt, movie.eng.srt). An
+// untagged file wins. lang is the tag from the filename, empty if there is none.
+func FindSiblingSubtitle(videoPath string) (path, lang string) {
+	dir := filepath.Dir(videoPath)
+	base := strings.TrimSuffix(filepath.Base(videoPath), filepath.Ext(videoPath))
+
+	// Read the directory rather than glob, media names often contain [brackets]
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", ""
+	}
+
+	var tagged []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(name), ".srt") {
+			continue
+		}
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		if stem == base {
+			return filepath.Join(dir, name), ""
+		}
+		if tag, ok := strings.CutPrefix(stem, base+"."); ok && isLanguageTag(tag) {
+			tagged = append(tagged, name)
+		}
+	}
+	if len(tagged) == 0 {
+		return "", ""
+	}
+
+	sort.Strings(tagged)
+	name := tagged[0]
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	return filepath.Join(dir, name), strings.TrimPrefix(stem, base+".")
+}
+
+// isLanguageTag reports whether tag looks like an ISO 639-1 or 639-2 code
+func isLanguageTag(tag string) bool {
+	if len(tag) != 2 && len(tag) != 3 {
+		return false
+	}
+	for _, r := range tag {
+		if !unicode.IsLetter(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateSubtitleFile checks path is a non-empty SRT file with at least one cue
+func ValidateSubtitleFile(path string) error {
+	if !strings.EqualFold(filepath.Ext(path), ".srt") {
+		return fmt.Errorf("subtitle %s is not an .srt file", filepath.Base(path))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read subtitle: %w", err)
+	}
+	if !strings.Contains(string(data), "-->") {
+		return fmt.Errorf("subtitle %s has no timed cues", filepath.Base(path))
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package media
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TuningKeys are the encoder options each GPU vendor's tuning may override, as ffmpeg
+// option names without the leading dash
+var TuningKeys = map[GPUVendor][]string{
+	GPUVendorNvidia: {"rc", "spatial-aq", "temporal-aq", "aq-strength", "rc-lookahead", "multipass", "b_ref_mode", "bf", "profile:v", "tier"},
+	GPUVendorIntel:  {"rc_mode", "compression_level", "async_depth", "low_power", "bf"},
+	GPUVendorAMD:    {"rc_mode", "compression_level", "async_depth", "bf"},
+}
+
+// ParseEncoderTuning parses comma-separated key=value encoder options for a vendor, e.g.
+// "spatial-aq=1,rc-lookahead=32". Keys must be in TuningKeys. Empty input is no tuning.
+func ParseEncoderTuning(vendor GPUVendor, s string) (map[string]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	tuning := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid %s encoder tuning %q (expected key=value)", vendor, pair)
+		}
+		if !isTuningKey(vendor, key) {
+			return nil, fmt.Errorf("unknown %s encoder tuning option %q (supported: %s)", vendor, key, strings.Join(TuningKeys[vendor], ", "))
+		}
+		tuning[key] = value
+	}
+	return tuning, nil
+}
+
+func isTuningKey(vendor GPUVendor, key string) bool {
+	for _, k := range TuningKeys[vendor] {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// applyTuning overrides the values of encoder options in args that tuning sets, and
+// appends the tuned options args doesn't have, sorted by name
+func applyTuning(args []string, tuning map[string]string) []string {
+	if len(tuning) == 0 {
+		return args
+	}
+	tuned := append([]string(nil), args...)
+	used := make(map[string]bool, len(tuning))
+	for i := 0; i+1 < len(tuned); i++ {
+		if value, ok := tuning[strings.TrimPrefix(tuned[i], "-")]; ok && strings.HasPrefix(tuned[i], "-") {
+			tuned[i+1] = value
+			used[tuned[i][1:]] = true
+			i++
+		}
+	}
+
+	var extra []string
+	for key := range tuning {
+		if !used[key] {
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+	for _, key := range extra {
+		tuned = append(tuned, "-"+key, tuning[key])
+	}
+	return tuned
+}
@@ -11,20 +11,17 @@ import (
 // LoadScannerConfig loads scanner configuration from file and environment
 func LoadScannerConfig(cfg *config.Config, watchDirsFile string) (*ScannerConfig, error) {
 	scannerCfg := &ScannerConfig{
-		Mode:              ScanMode(cfg.ScannerMode),
-		Enabled:           cfg.ScannerEnabled,
-		ScanIntervalSec:   cfg.ScannerIntervalSec,
-		AutoCreateJobs:    cfg.ScannerAutoCreate,
-		ProcessedFilePath: cfg.ScannerProcessedFile,
-		DefaultPriority:   5,
-		OutputDirectory:   cfg.DestDir,
+		Mode:               ScanMode(cfg.ScannerMode),
+		Enabled:            cfg.ScannerEnabled,
+		ScanIntervalSec:    cfg.ScannerIntervalSec,
+		AutoCreateJobs:     cfg.ScannerAutoCreate,
+		ProcessedFilePath:  cfg.ScannerProcessedFile,
+		DefaultPriority:    5,
+		OutputDirectory:    cfg.DestDir,
+		MaxJobsPerScan:     cfg.ScannerMaxJobsPerScan,
+		PauseWhileEncoding: cfg.ScannerPauseWhileEncoding,
 
-		// Default file extensions
-		ExtractExtensions: []string{".iso"},
-		OptimizeExtensions: []string{
-			".mkv", ".mp4", ".avi", ".mov", ".m4v",
-			".mpg", ".mpeg", ".wmv", ".flv", ".webm",
-		},
+		ExtensionJobTypes: DefaultExtensionJobTypes(),
 	}
 
 	// Load watch directories from file if it exists
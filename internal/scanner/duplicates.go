@@ -0,0 +1,222 @@
+package scanner
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Vasteva/MediaConverter/internal/ai/meta"
+)
+
+// titleBatchSize is how many filenames are sent to the AI in one cleaning request
+const titleBatchSize = 50
+
+// DuplicateFile is one copy of a title in the library
+type DuplicateFile struct {
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	Processed bool   `json:"processed"`
+}
+
+// DuplicateCluster groups the copies of a title found in the library
+type DuplicateCluster struct {
+	Title       string          `json:"title"`
+	Files       []DuplicateFile `json:"files"`
+	TotalSize   int64           `json:"totalSize"`
+	Reclaimable int64           `json:"reclaimable"` // Size of everything but the largest copy
+}
+
+// FindDuplicates groups processed and scanned files by title and returns the titles
+// with more than one copy. With a cleaner, titles come from the AI (cached per
+// filename), otherwise from NormalizeTitle.
+func (s *Scanner) FindDuplicates(ctx context.Context, cleaner *meta.Cleaner) ([]DuplicateCluster, error) {
+	files := make(map[string]DuplicateFile)
+	for _, f := range s.processedDB.GetAll() {
+		size := f.InputSize
+		if info, err := os.Stat(f.Path); err == nil {
+			size = info.Size()
+		} else if os.IsNotExist(err) {
+			continue
+		}
+		files[f.Path] = DuplicateFile{Path: f.Path, Size: size, Processed: true}
+	}
+
+	s.mu.RLock()
+	cfg := *s.config
+	s.mu.RUnlock()
+
+	for _, watchDir := range cfg.WatchDirectories {
+		err := s.walkSources(watchDir, &cfg, func(path string) {
+			if _, ok := files[path]; ok {
+				return
+			}
+			f := DuplicateFile{Path: path}
+			if info, err := os.Stat(path); err == nil {
+				f.Size = info.Size()
+			}
+			files[path] = f
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	list := make([]DuplicateFile, 0, len(files))
+	for _, f := range files {
+		list = append(list, f)
+	}
+
+	titles := make(map[string]string, len(list))
+	if cleaner != nil {
+		titles = s.cleanTitles(ctx, cleaner, list)
+	}
+	for _, f := range list {
+		if titles[f.Path] == "" {
+			titles[f.Path] = NormalizeTitle(filepath.Base(f.Path))
+		}
+	}
+
+	return GroupDuplicates(list, titles), nil
+}
+
+// cleanTitles returns AI-cleaned titles by path, "" where cleaning failed so the caller
+// falls back to NormalizeTitle
+func (s *Scanner) cleanTitles(ctx context.Context, cleaner *meta.Cleaner, files []DuplicateFile) map[string]string {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = filepath.Base(f.Path)
+	}
+	cached := s.cacheTitles(ctx, cleaner, names)
+
+	titles := make(map[string]string, len(files))
+	for _, f := range files {
+		titles[f.Path] = cached[filepath.Base(f.Path)]
+	}
+	return titles
+}
+
+// cacheTitles returns the AI-cleaned title of each filename, "" where cleaning failed.
+// Filenames missing from the cache are cleaned in batches of titleBatchSize, one
+// request per batch, and cached for later scans.
+func (s *Scanner) cacheTitles(ctx context.Context, cleaner *meta.Cleaner, names []string) map[string]string {
+	s.titleMu.Lock()
+	defer s.titleMu.Unlock()
+	if s.titleCache == nil {
+		s.titleCache = make(map[string]string)
+	}
+
+	var uncached []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if _, ok := s.titleCache[name]; !ok && !seen[name] {
+			uncached = append(uncached, name)
+			seen[name] = true
+		}
+	}
+
+	for start := 0; start < len(uncached); start += titleBatchSize {
+		end := start + titleBatchSize
+		if end > len(uncached) {
+			end = len(uncached)
+		}
+		cleaned, err := cleaner.CleanFilenames(ctx, uncached[start:end])
+		if err != nil {
+			log.Printf("[Scanner] AI title cleaning failed, using filenames: %v", err)
+			break
+		}
+		for i, title := range cleaned {
+			if title != "" {
+				s.titleCache[uncached[start+i]] = title
+			}
+		}
+	}
+
+	titles := make(map[string]string, len(names))
+	for _, name := range names {
+		titles[name] = s.titleCache[name]
+	}
+	return titles
+}
+
+// GroupDuplicates clusters files by title, ignoring case and spacing. Only titles with
+// more than one file are returned, most reclaimable space first.
+func GroupDuplicates(files []DuplicateFile, titles map[string]string) []DuplicateCluster {
+	byKey := make(map[string]*DuplicateCluster)
+	var keys []string
+	for _, f := range files {
+		title := titles[f.Path]
+		key := strings.Join(strings.Fields(strings.ToLower(title)), " ")
+		if key == "" {
+			continue
+		}
+
+		cluster, ok := byKey[key]
+		if !ok {
+			cluster = &DuplicateCluster{Title: title}
+			byKey[key] = cluster
+			keys = append(keys, key)
+		}
+		cluster.Files = append(cluster.Files, f)
+		cluster.TotalSize += f.Size
+	}
+
+	clusters := []DuplicateCluster{}
+	for _, key := range keys {
+		cluster := byKey[key]
+		if len(cluster.Files) < 2 {
+			continue
+		}
+
+		// Largest copy first, it's the one worth keeping
+		sort.Slice(cluster.Files, func(i, j int) bool {
+			if cluster.Files[i].Size != cluster.Files[j].Size {
+				return cluster.Files[i].Size > cluster.Files[j].Size
+			}
+			return cluster.Files[i].Path < cluster.Files[j].Path
+		})
+		cluster.Reclaimable = cluster.TotalSize - cluster.Files[0].Size
+		clusters = append(clusters, *cluster)
+	}
+
+	sort.Slice(clusters, func(i, j int) bool {
+		if clusters[i].Reclaimable != clusters[j].Reclaimable {
+			return clusters[i].Reclaimable > clusters[j].Reclaimable
+		}
+		return clusters[i].Title < clusters[j].Title
+	})
+	return clusters
+}
+
+var (
+	titleYearRegex      = regexp.MustCompile(`^(.*?)[\s(\[]*((?:19|20)\d{2})(?:[\s)\]]|$)`)
+	releaseTagRegex     = regexp.MustCompile(`(?i)\b(2160p|1080p|720p|576p|480p|4k|uhd|bluray|blu-ray|bdrip|brrip|remux|web-?dl|webrip|hdtv|dvdrip|x264|x265|h\.?264|h\.?265|hevc|avc|hdr|10bit|proper|repack|extended|unrated)\b`)
+	titleSeparatorRegex = regexp.MustCompile(`[._]+`)
+)
+
+// NormalizeTitle derives a "title (year)" grouping key from a filename without AI, by
+// dropping the extension, release tags and everything after the year
+func NormalizeTitle(filename string) string {
+	name := strings.TrimSuffix(filename, filepath.Ext(filename))
+	name = strings.TrimSuffix(name, optimizedSuffix)
+	name = titleSeparatorRegex.ReplaceAllString(name, " ")
+
+	if loc := releaseTagRegex.FindStringIndex(name); loc != nil {
+		name = name[:loc[0]]
+	}
+
+	year := ""
+	if m := titleYearRegex.FindStringSubmatch(name); m != nil && strings.TrimSpace(m[1]) != "" {
+		name, year = m[1], m[2]
+	}
+
+	name = strings.Trim(name, " -([")
+	name = strings.Join(strings.Fields(strings.ToLower(name)), " ")
+	if year != "" {
+		return name + " (" + year + ")"
+	}
+	return name
+}
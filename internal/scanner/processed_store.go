@@ -0,0 +1,255 @@
+package scanner
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Vasteva/MediaConverter/internal/system"
+)
+
+// ProcessedStore persists the processed files database. ProcessedDB keeps every entry in
+// memory and hands the store the full set on each save, LoadProcessed returns what was
+// last saved.
+type ProcessedStore interface {
+	LoadProcessed() (map[string]ProcessedFile, error)
+	SaveProcessed(processed map[string]ProcessedFile) error
+}
+
+// ProcessedQuery selects a page of processed files for the library view, newest first
+type ProcessedQuery struct {
+	JobType string // Empty matches every type
+	Offset  int
+	Limit   int // 0 is unlimited
+}
+
+// processedQuerier is implemented by stores that answer a ProcessedQuery themselves
+// instead of ProcessedDB filtering its in-memory entries
+type processedQuerier interface {
+	QueryProcessed(q ProcessedQuery) ([]ProcessedFile, int, error)
+}
+
+// FileProcessedStore keeps processed files in a JSON file, written atomically with a backup
+type FileProcessedStore struct {
+	Path string
+}
+
+func (s *FileProcessedStore) LoadProcessed() (map[string]ProcessedFile, error) {
+	var processed map[string]ProcessedFile
+	err := system.LoadWithBackup(s.Path, func(data []byte) error {
+		processed = make(map[string]ProcessedFile)
+		return json.Unmarshal(data, &processed)
+	})
+	return processed, err
+}
+
+func (s *FileProcessedStore) SaveProcessed(processed map[string]ProcessedFile) error {
+	data, err := json.Marshal(processed)
+	if err != nil {
+		return err
+	}
+	return system.WriteFileAtomic(s.Path, data, 0644)
+}
+
+// SQLiteProcessedStore keeps processed files in a SQLite table, one row per file. Saves
+// only write the entries that changed since the last save.
+type SQLiteProcessedStore struct {
+	db *sql.DB
+
+	mu    sync.Mutex
+	saved map[string]ProcessedFile // Entries last written, by path
+}
+
+const processedSchema = `
+CREATE TABLE IF NOT EXISTS processed_files (
+	path         TEXT PRIMARY KEY,
+	hash         TEXT NOT NULL,
+	processed_at INTEGER NOT NULL,
+	job_id       TEXT NOT NULL,
+	job_type     TEXT NOT NULL,
+	input_size   INTEGER NOT NULL,
+	output_size  INTEGER NOT NULL,
+	ai_subtitles INTEGER NOT NULL,
+	ai_upscale   INTEGER NOT NULL,
+	ai_cleaned   INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS processed_files_recent ON processed_files (processed_at DESC, path);
+CREATE INDEX IF NOT EXISTS processed_files_type ON processed_files (job_type, processed_at DESC, path);
+`
+
+const processedColumns = `path, hash, processed_at, job_id, job_type, input_size, output_size, ai_subtitles, ai_upscale, ai_cleaned`
+
+// NewSQLiteProcessedStore creates the processed files table in db if needed
+func NewSQLiteProcessedStore(db *sql.DB) (*SQLiteProcessedStore, error) {
+	if _, err := db.Exec(processedSchema); err != nil {
+		return nil, fmt.Errorf("failed to create processed files table: %w", err)
+	}
+	return &SQLiteProcessedStore{db: db, saved: make(map[string]ProcessedFile)}, nil
+}
+
+func (s *SQLiteProcessedStore) LoadProcessed() (map[string]ProcessedFile, error) {
+	files, err := s.query(`SELECT ` + processedColumns + ` FROM processed_files`)
+	if err != nil {
+		return nil, err
+	}
+
+	processed := make(map[string]ProcessedFile, len(files))
+	saved := make(map[string]ProcessedFile, len(files))
+	for _, f := range files {
+		processed[f.Path] = f
+		saved[f.Path] = f
+	}
+	s.mu.Lock()
+	s.saved = saved
+	s.mu.Unlock()
+	return processed, nil
+}
+
+// SaveProcessed writes the entries that changed since the last save and deletes the
+// stored entries missing from processed, in one transaction
+func (s *SQLiteProcessedStore) SaveProcessed(processed map[string]ProcessedFile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var changed []ProcessedFile
+	for path, f := range processed {
+		if saved, ok := s.saved[path]; !ok || !sameProcessedFile(saved, f) {
+			changed = append(changed, f)
+		}
+	}
+	var removed []string
+	for path := range s.saved {
+		if _, ok := processed[path]; !ok {
+			removed = append(removed, path)
+		}
+	}
+	if len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	upsert, err := tx.Prepare(`INSERT OR REPLACE INTO processed_files (` + processedColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer upsert.Close()
+	for _, f := range changed {
+		if _, err := upsert.Exec(f.Path, f.Hash, unixNano(f.ProcessedAt), f.JobID, f.JobType,
+			f.InputSize, f.OutputSize, f.AISubtitles, f.AIUpscale, f.AICleaned); err != nil {
+			return fmt.Errorf("failed to save %s: %w", f.Path, err)
+		}
+	}
+	for _, path := range removed {
+		if _, err := tx.Exec(`DELETE FROM processed_files WHERE path = ?`, path); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", path, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	saved := make(map[string]ProcessedFile, len(processed))
+	for path, f := range processed {
+		saved[path] = f
+	}
+	s.saved = saved
+	return nil
+}
+
+// QueryProcessed returns one page of processed files and the number matching q, using
+// the processed_at and job_type indexes
+func (s *SQLiteProcessedStore) QueryProcessed(q ProcessedQuery) ([]ProcessedFile, int, error) {
+	where, args := "", []interface{}{}
+	if q.JobType != "" {
+		where, args = ` WHERE job_type = ?`, append(args, q.JobType)
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM processed_files`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count processed files: %w", err)
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = -1 // No limit
+	}
+	files, err := s.query(`SELECT `+processedColumns+` FROM processed_files`+where+
+		` ORDER BY processed_at DESC, path LIMIT ? OFFSET ?`, append(args, limit, q.Offset)...)
+	return files, total, err
+}
+
+func (s *SQLiteProcessedStore) query(query string, args ...interface{}) ([]ProcessedFile, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query processed files: %w", err)
+	}
+	defer rows.Close()
+
+	files := []ProcessedFile{}
+	for rows.Next() {
+		var f ProcessedFile
+		var processedAt int64
+		if err := rows.Scan(&f.Path, &f.Hash, &processedAt, &f.JobID, &f.JobType,
+			&f.InputSize, &f.OutputSize, &f.AISubtitles, &f.AIUpscale, &f.AICleaned); err != nil {
+			return nil, err
+		}
+		if processedAt != 0 {
+			f.ProcessedAt = time.Unix(0, processedAt)
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// unixNano stores a time as nanoseconds, 0 for the zero time
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// sameProcessedFile compares entries by value, times by instant rather than location
+func sameProcessedFile(a, b ProcessedFile) bool {
+	at, bt := a.ProcessedAt, b.ProcessedAt
+	a.ProcessedAt, b.ProcessedAt = time.Time{}, time.Time{}
+	return a == b && at.Equal(bt)
+}
+
+// queryProcessed answers q from the in-memory entries, in the order QueryProcessed uses
+func queryProcessed(files []ProcessedFile, q ProcessedQuery) ([]ProcessedFile, int) {
+	matched := make([]ProcessedFile, 0, len(files))
+	for _, f := range files {
+		if q.JobType == "" || f.JobType == q.JobType {
+			matched = append(matched, f)
+		}
+	}
+
+	// Newest first so pagination is stable across requests
+	sort.Slice(matched, func(i, j int) bool {
+		if !matched[i].ProcessedAt.Equal(matched[j].ProcessedAt) {
+			return matched[i].ProcessedAt.After(matched[j].ProcessedAt)
+		}
+		return matched[i].Path < matched[j].Path
+	})
+
+	total := len(matched)
+	start := q.Offset
+	if start > total {
+		start = total
+	}
+	end := total
+	if q.Limit > 0 && start+q.Limit < total {
+		end = start + q.Limit
+	}
+	return matched[start:end], total
+}
@@ -0,0 +1,253 @@
+package scanner
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Vasteva/MediaConverter/internal/jobs"
+	"github.com/Vasteva/MediaConverter/internal/media"
+)
+
+// optimizedSuffix marks optimize outputs, see generateOutputPath
+const optimizedSuffix = "_optimized"
+
+// ReconcileResult summarizes the changes made to the processed database
+type ReconcileResult struct {
+	Added   int `json:"added"`
+	Updated int `json:"updated"`
+	Removed int `json:"removed"`
+}
+
+// Reconcile rebuilds processed entries from outputs that already exist on disk, so files
+// done before a migration aren't processed again. Optimize outputs are matched to sources
+// by their _optimized name, or on premium by the AI-cleaned title jobs rename them to,
+// extract outputs by their per-disc directory. Entries whose source no longer exists
+// are removed, but only under watch directories that could be read in full, so an
+// offline share doesn't empty the database. Directories that fail are logged and skipped.
+func (s *Scanner) Reconcile() (ReconcileResult, error) {
+	s.createMu.Lock()
+	defer s.createMu.Unlock()
+
+	s.mu.RLock()
+	cfg := *s.config
+	s.mu.RUnlock()
+
+	var result ReconcileResult
+
+	// Index candidate sources by file name without extension
+	sources := make(map[string][]string)
+	var optimizable []string
+	var readable []string
+	for _, watchDir := range cfg.WatchDirectories {
+		err := s.walkSources(watchDir, &cfg, func(path string) {
+			stem := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			sources[stem] = append(sources[stem], path)
+			if cfg.ExtensionJobTypes[strings.ToLower(filepath.Ext(path))] == jobs.JobTypeOptimize {
+				optimizable = append(optimizable, path)
+			}
+		})
+		if err != nil {
+			log.Printf("[Scanner] Reconcile skipping watch directory %s: %v", watchDir.Path, err)
+			continue
+		}
+		readable = append(readable, watchDir.Path)
+	}
+
+	// And by AI-cleaned title, cleaned in batches
+	byTitle := make(map[string][]string)
+	if cleaner := s.titleCleaner(); cleaner != nil && len(optimizable) > 0 {
+		names := make([]string, len(optimizable))
+		for i, path := range optimizable {
+			names[i] = filepath.Base(path)
+		}
+		titles := s.cacheTitles(s.context(), cleaner, names)
+		for _, path := range optimizable {
+			if title := titles[filepath.Base(path)]; title != "" {
+				byTitle[title] = append(byTitle[title], path)
+			}
+		}
+	}
+
+	outputDirs := []string{cfg.OutputDirectory}
+	if cfg.OutputDirectory == "" {
+		// Outputs are written next to their sources
+		outputDirs = outputDirs[:0]
+		for _, watchDir := range cfg.WatchDirectories {
+			outputDirs = append(outputDirs, watchDir.Path)
+		}
+	}
+
+	found := make(map[string]ProcessedFile)
+	for _, dir := range outputDirs {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			var jobType jobs.JobType
+			var candidates []string
+			name := d.Name()
+			if d.IsDir() {
+				if path == dir {
+					return nil
+				}
+				jobType, candidates = jobs.JobTypeExtract, sources[name]
+			} else {
+				base := strings.TrimSuffix(name, filepath.Ext(name))
+				jobType = jobs.JobTypeOptimize
+				if strings.HasSuffix(base, optimizedSuffix) {
+					candidates = sources[strings.TrimSuffix(base, optimizedSuffix)]
+				} else {
+					// A source already named by its title would be its own output
+					for _, c := range byTitle[base] {
+						if c != path {
+							candidates = append(candidates, c)
+						}
+					}
+				}
+				if len(candidates) == 0 {
+					return nil
+				}
+			}
+
+			source := s.matchSource(candidates, filepath.Dir(path), jobType, &cfg)
+			if source == "" {
+				return nil
+			}
+			if _, ok := found[source]; ok {
+				return nil
+			}
+
+			f := ProcessedFile{Path: source, JobType: string(jobType)}
+			if info, err := d.Info(); err == nil {
+				f.ProcessedAt = info.ModTime()
+				if !d.IsDir() {
+					f.OutputSize = info.Size()
+				}
+			}
+			found[source] = f
+			return nil
+		})
+		if err != nil {
+			log.Printf("[Scanner] Reconcile skipping output directory %s: %v", dir, err)
+		}
+	}
+
+	var upserts []ProcessedFile
+	for source, f := range found {
+		existing, ok := s.processedDB.Get(source)
+		if !ok {
+			if info, err := os.Stat(source); err == nil {
+				f.InputSize = info.Size()
+			}
+			f.Hash, _ = calculateFileHash(source)
+			if f.ProcessedAt.IsZero() {
+				f.ProcessedAt = time.Now()
+			}
+			upserts = append(upserts, f)
+			result.Added++
+			continue
+		}
+
+		// Keep what the job recorded, only fill in what's missing
+		changed := false
+		if existing.Hash == "" {
+			if hash, err := calculateFileHash(source); err == nil {
+				existing.Hash, changed = hash, true
+			}
+		}
+		if existing.InputSize == 0 {
+			if info, err := os.Stat(source); err == nil && info.Size() != 0 {
+				existing.InputSize, changed = info.Size(), true
+			}
+		}
+		if existing.OutputSize == 0 && f.OutputSize != 0 {
+			existing.OutputSize, changed = f.OutputSize, true
+		}
+		if changed {
+			upserts = append(upserts, existing)
+			result.Updated++
+		}
+	}
+
+	var removals []string
+	for _, f := range s.processedDB.GetAll() {
+		if media.IsRemoteSource(f.Path) || !s.inAnyDirectory(f.Path, readable) {
+			continue
+		}
+		if _, err := os.Stat(f.Path); os.IsNotExist(err) {
+			removals = append(removals, f.Path)
+		}
+	}
+	result.Removed = len(removals)
+
+	if err := s.processedDB.Apply(upserts, removals); err != nil {
+		return result, err
+	}
+
+	log.Printf("[Scanner] Reconciled processed DB: %d added, %d updated, %d removed",
+		result.Added, result.Updated, result.Removed)
+	return result, nil
+}
+
+// inAnyDirectory reports whether path is within one of dirs
+func (s *Scanner) inAnyDirectory(path string, dirs []string) bool {
+	for _, dir := range dirs {
+		if s.isInDirectory(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkSources calls fn for every file in a watch directory that the scanner would process
+func (s *Scanner) walkSources(watchDir WatchDirectory, cfg *ScannerConfig, fn func(string)) error {
+	return filepath.WalkDir(watchDir.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if !watchDir.Recursive && path != watchDir.Path {
+				return filepath.SkipDir
+			}
+			if skipHiddenDir(path, watchDir) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		base := strings.TrimSuffix(d.Name(), filepath.Ext(path))
+		if strings.HasSuffix(base, optimizedSuffix) || hasCueSheet(path) || !s.matchesPatterns(path, watchDir) {
+			return nil
+		}
+		if _, ok := cfg.ExtensionJobTypes[ext]; ok {
+			fn(path)
+		}
+		return nil
+	})
+}
+
+// matchSource picks the probable source of an output among candidates with the same
+// name. A source in the output's own directory wins, otherwise the match must be unique.
+func (s *Scanner) matchSource(candidates []string, outputDir string, jobType jobs.JobType, cfg *ScannerConfig) string {
+	var matches []string
+	for _, c := range candidates {
+		// Disc images can be optimized directly, but only extract-mapped files are extracted
+		if jobType == jobs.JobTypeExtract && cfg.ExtensionJobTypes[strings.ToLower(filepath.Ext(c))] != jobs.JobTypeExtract {
+			continue
+		}
+		if filepath.Dir(c) == outputDir {
+			return c
+		}
+		matches = append(matches, c)
+	}
+	if len(matches) == 1 {
+		return matches[0]
+	}
+	return ""
+}
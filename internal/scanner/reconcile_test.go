@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/jobs"
+)
+
+func TestReconcile(t *testing.T) {
+	watchDir := t.TempDir()
+	outputDir := t.TempDir()
+
+	write := func(path, data string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Sources
+	write(filepath.Join(watchDir, "film.mkv"), "film source")
+	write(filepath.Join(watchDir, "movie.mp4"), "movie source")
+	write(filepath.Join(watchDir, "disc.iso"), "disc image")
+	write(filepath.Join(watchDir, "pending.mkv"), "not processed yet")
+
+	// Outputs from before the migration
+	write(filepath.Join(outputDir, "film_optimized.mkv"), "film out")
+	write(filepath.Join(outputDir, "movie_optimized.mkv"), "movie output")
+	write(filepath.Join(outputDir, "disc", "Disc_t00.mkv"), "title")
+	write(filepath.Join(outputDir, "orphan_optimized.mkv"), "no source")
+
+	jm, _ := jobs.NewManager(&config.Config{MaxConcurrentJobs: 1}, nil, "")
+	cfg := &ScannerConfig{
+		ProcessedFilePath: filepath.Join(t.TempDir(), "processed.json"),
+		OutputDirectory:   outputDir,
+		WatchDirectories:  []WatchDirectory{{Path: watchDir}},
+	}
+	cfg.Validate()
+	s, err := NewScanner(cfg, jm)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+
+	// A job-recorded entry missing its hash, and one whose source is gone. Entries for
+	// remote sources and unreadable watch directories are left alone.
+	offlineDir := filepath.Join(t.TempDir(), "offline")
+	s.config.WatchDirectories = append(s.config.WatchDirectories, WatchDirectory{Path: offlineDir})
+	moviePath := filepath.Join(watchDir, "movie.mp4")
+	s.processedDB.Apply([]ProcessedFile{
+		{Path: moviePath, JobID: "job-1", JobType: "optimize", OutputSize: 12},
+		{Path: filepath.Join(watchDir, "deleted.mkv"), JobID: "job-2", JobType: "optimize"},
+		{Path: filepath.Join(offlineDir, "share.mkv"), JobID: "job-3", JobType: "optimize"},
+		{Path: "https://example.com/stream.mkv", JobID: "job-4", JobType: "optimize"},
+	}, nil)
+
+	result, err := s.Reconcile()
+	if err != nil {
+		t.Fatalf("reconcile failed: %v", err)
+	}
+	if result != (ReconcileResult{Added: 2, Updated: 1, Removed: 1}) {
+		t.Errorf("unexpected result: %+v", result)
+	}
+
+	film, ok := s.processedDB.Get(filepath.Join(watchDir, "film.mkv"))
+	if !ok {
+		t.Fatal("expected film.mkv to be added")
+	}
+	if film.JobType != "optimize" || film.Hash == "" || film.InputSize != 11 || film.OutputSize != 8 {
+		t.Errorf("unexpected film entry: %+v", film)
+	}
+
+	disc, ok := s.processedDB.Get(filepath.Join(watchDir, "disc.iso"))
+	if !ok || disc.JobType != "extract" {
+		t.Errorf("expected disc.iso extract entry, got %+v (found %v)", disc, ok)
+	}
+
+	movie, _ := s.processedDB.Get(moviePath)
+	if movie.JobID != "job-1" || movie.Hash == "" || movie.OutputSize != 12 {
+		t.Errorf("expected movie entry to keep job data and gain a hash, got %+v", movie)
+	}
+
+	if s.processedDB.IsProcessed(filepath.Join(watchDir, "pending.mkv")) {
+		t.Error("expected file without output to stay unprocessed")
+	}
+	if s.processedDB.IsProcessed(filepath.Join(watchDir, "deleted.mkv")) {
+		t.Error("expected entry for missing source to be removed")
+	}
+	if !s.processedDB.IsProcessed(filepath.Join(offlineDir, "share.mkv")) || !s.processedDB.IsProcessed("https://example.com/stream.mkv") {
+		t.Error("expected entries for offline and remote sources to be kept")
+	}
+
+	// Reconciled state is persisted and a second run is a no-op
+	reloaded, err := NewProcessedDB(cfg.ProcessedFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.GetAll()) != 5 {
+		t.Errorf("expected 5 persisted entries, got %d", len(reloaded.GetAll()))
+	}
+	if again, _ := s.Reconcile(); again != (ReconcileResult{}) {
+		t.Errorf("expected second reconcile to change nothing, got %+v", again)
+	}
+}
@@ -5,17 +5,24 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"math/big"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/Vasteva/MediaConverter/internal/ai/meta"
+	"github.com/Vasteva/MediaConverter/internal/events"
 	"github.com/Vasteva/MediaConverter/internal/jobs"
+	"github.com/Vasteva/MediaConverter/internal/media"
 	"github.com/fsnotify/fsnotify"
 )
 
@@ -38,6 +45,10 @@ type WatchDirectory struct {
 	ExcludePatterns   []string `json:"excludePatterns"` // e.g., ["*_optimized.mkv"]
 	MinFileSizeMB     int64    `json:"minFileSizeMB"`
 	MinFileAgeMinutes int      `json:"minFileAgeMinutes"` // Wait before processing new files
+
+	// Scan dot-prefixed files and directories, which are skipped by default. The default
+	// ".*" exclude pattern is ignored when set.
+	IncludeHidden bool `json:"includeHidden"`
 }
 
 // ScannerConfig holds all scanner configuration
@@ -50,27 +61,123 @@ type ScannerConfig struct {
 	AutoCreateSubtitles bool             `json:"autoCreateSubtitles"`
 	AutoUpscale         bool             `json:"autoUpscale"`
 	AutoResolution      string           `json:"autoResolution"`
+	MaxResolution       string           `json:"maxResolution"`     // Downscale cap for created jobs, e.g. "1080p"
 	ProcessedFilePath   string           `json:"processedFilePath"` // Track processed files
 
 	// Job creation settings
 	DefaultPriority int    `json:"defaultPriority"`
 	OutputDirectory string `json:"outputDirectory"`
+	MaxJobsPerScan  int    `json:"maxJobsPerScan"` // Cap on jobs one scan creates, the rest wait for the next scan (0 = unlimited)
+
+	// Hold periodic scans while a job is processing and run them once the jobs are
+	// idle, so hashing doesn't compete with encodes for disk I/O
+	PauseWhileEncoding bool `json:"pauseWhileEncoding"`
+
+	// File type handling: the job created for each extension, e.g. {".iso": "extract"}.
+	// Files with extensions that aren't mapped are ignored.
+	ExtensionJobTypes map[string]jobs.JobType `json:"extensionJobTypes"`
+
+	// Split disc image sets: a regexp matched against the image name without its extension,
+	// capturing the part number. Only the first part of a set is extracted, empty uses
+	// DefaultSplitPartPattern.
+	SplitPartPattern string `json:"splitPartPattern,omitempty"`
+
+	// Deprecated: the lists ExtensionJobTypes replaced, converted by Validate
+	ExtractExtensions  []string `json:"extractExtensions,omitempty"`
+	OptimizeExtensions []string `json:"optimizeExtensions,omitempty"`
+}
+
+// DefaultExtensionJobTypes extracts disc images and optimizes common video files
+func DefaultExtensionJobTypes() map[string]jobs.JobType {
+	types := make(map[string]jobs.JobType)
+	for _, ext := range media.DiscImageExtensions {
+		types[ext] = jobs.JobTypeExtract
+	}
+	for _, ext := range []string{".mkv", ".mp4", ".avi", ".mov", ".m4v", ".mpg", ".mpeg", ".wmv", ".flv", ".webm"} {
+		types[ext] = jobs.JobTypeOptimize
+	}
+	return types
+}
+
+// DefaultSplitPartPattern matches split image names such as movie.part2 or movie_part02
+const DefaultSplitPartPattern = `(?i)[._ -]part[._ -]?(\d+)$`
+
+// compileSplitPartPattern compiles a SplitPartPattern, which must capture the part number
+func compileSplitPartPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		pattern = DefaultSplitPartPattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid splitPartPattern: %w", err)
+	}
+	if re.NumSubexp() < 1 {
+		return nil, fmt.Errorf("invalid splitPartPattern %q: no group captures the part number", pattern)
+	}
+	return re, nil
+}
+
+// laterSplitPart reports whether path is a part of a split disc image set other than the
+// first, and returns the part number
+func (c *ScannerConfig) laterSplitPart(path string) (int, bool) {
+	re, err := compileSplitPartPattern(c.SplitPartPattern)
+	if err != nil {
+		return 0, false
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	match := re.FindStringSubmatch(name)
+	if match == nil {
+		return 0, false
+	}
+	part, err := strconv.Atoi(match[1])
+	return part, err == nil && part != 1
+}
 
-	// File type handling
-	ExtractExtensions  []string `json:"extractExtensions"`  // e.g., [".iso"]
-	OptimizeExtensions []string `json:"optimizeExtensions"` // e.g., [".mkv", ".mp4", ".avi"]
+// scannableJobTypes are the job types an extension can map to
+var scannableJobTypes = map[jobs.JobType]bool{jobs.JobTypeExtract: true, jobs.JobTypeOptimize: true}
+
+// normalizeExtension lowercases an extension and adds the leading dot
+func normalizeExtension(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
 }
 
 func (c *ScannerConfig) Validate() {
-	if len(c.ExtractExtensions) == 0 {
-		c.ExtractExtensions = []string{".iso"}
+	// Configs saved before the extension map list the extensions by job type
+	if len(c.ExtensionJobTypes) == 0 && (len(c.ExtractExtensions) > 0 || len(c.OptimizeExtensions) > 0) {
+		c.ExtensionJobTypes = make(map[string]jobs.JobType)
+		for _, ext := range c.OptimizeExtensions {
+			c.ExtensionJobTypes[ext] = jobs.JobTypeOptimize
+		}
+		for _, ext := range c.ExtractExtensions {
+			c.ExtensionJobTypes[ext] = jobs.JobTypeExtract
+		}
 	}
-	if len(c.OptimizeExtensions) == 0 {
-		c.OptimizeExtensions = []string{
-			".mkv", ".mp4", ".avi", ".mov", ".m4v",
-			".mpg", ".mpeg", ".wmv", ".flv", ".webm",
+	c.ExtractExtensions, c.OptimizeExtensions = nil, nil
+
+	types := make(map[string]jobs.JobType, len(c.ExtensionJobTypes))
+	for ext, jobType := range c.ExtensionJobTypes {
+		if !scannableJobTypes[jobType] {
+			log.Printf("[Scanner] Ignoring extension %s: unknown job type %q", ext, jobType)
+			continue
 		}
+		if ext = normalizeExtension(ext); ext != "" {
+			types[ext] = jobType
+		}
+	}
+	if len(types) == 0 {
+		types = DefaultExtensionJobTypes()
+	}
+	c.ExtensionJobTypes = types
+
+	if _, err := compileSplitPartPattern(c.SplitPartPattern); err != nil {
+		log.Printf("[Scanner] %v, using the default", err)
+		c.SplitPartPattern = ""
 	}
+
 	if c.ProcessedFilePath == "" {
 		c.ProcessedFilePath = "/data/processed.json"
 	}
@@ -87,10 +194,42 @@ type ScanStatus struct {
 	LastResult   string    `json:"lastResult"`
 	LastError    string    `json:"lastError"`
 	Duration     string    `json:"duration"`
+
+	// PendingCreation counts eligible files left over when the last scan hit MaxJobsPerScan
+	PendingCreation int `json:"pendingCreation"`
+
+	// DirectoryErrors are the watch directories the last scan couldn't read
+	DirectoryErrors []DirectoryError `json:"directoryErrors,omitempty"`
+}
+
+// DirectoryError is a watch directory a scan failed to read and why
+type DirectoryError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// ScanError is returned by ScanAll when watch directories failed, the others were
+// still scanned
+type ScanError struct {
+	Directories []DirectoryError
+}
+
+func (e *ScanError) Error() string {
+	failed := make([]string, len(e.Directories))
+	for i, d := range e.Directories {
+		failed[i] = d.Path + ": " + d.Error
+	}
+	return fmt.Sprintf("scan completed with %d errors: %s", len(e.Directories), strings.Join(failed, "; "))
 }
 
 const ScannerConfigFile = "/data/scanner_config.json"
 
+// ErrNotInWatchDirectory is returned by Notify for paths outside every watch directory
+var ErrNotInWatchDirectory = errors.New("path is not in a watch directory")
+
+// ErrScanInProgress is returned when ScanAll is triggered while another scan is running
+var ErrScanInProgress = errors.New("scan already in progress")
+
 // Scanner manages automatic file discovery and job creation
 type Scanner struct {
 	config      *ScannerConfig
@@ -98,6 +237,20 @@ type Scanner struct {
 	watcher     *fsnotify.Watcher
 	processedDB *ProcessedDB
 	mu          sync.RWMutex
+	createMu    sync.Mutex  // Serializes the processed check and job creation for a file
+	Events      *events.Log // Activity feed, nil disables events
+
+	// Directories never scanned besides the output directory, such as the temp dir
+	ExcludeDirs []string
+
+	// Where watch directories added or removed one at a time are also saved, see
+	// SaveWatchDirectories. Empty only saves them with the scanner config.
+	WatchDirsFile string
+
+	// AI-cleaned titles by filename, for duplicate detection
+	titleCache map[string]string
+	titleMu    sync.Mutex
+
 	// Status
 	status   ScanStatus
 	statusMu sync.RWMutex
@@ -106,12 +259,16 @@ type Scanner struct {
 	wg     sync.WaitGroup
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	// Serializes Start, Stop and UpdateConfig so a restart can't interleave with another
+	lifecycleMu sync.Mutex
 }
 
 // ProcessedDB tracks files that have been processed
 type ProcessedDB struct {
 	mu        sync.RWMutex
-	filePath  string
+	saveMu    sync.Mutex // Serializes writes to the store
+	store     ProcessedStore
 	processed map[string]ProcessedFile
 }
 
@@ -129,16 +286,24 @@ type ProcessedFile struct {
 	AICleaned   bool      `json:"aiCleaned"`
 }
 
-// NewScanner creates a new file scanner
+// NewScanner creates a new file scanner keeping processed files in the config's JSON file
 func NewScanner(config *ScannerConfig, jobManager *jobs.Manager) (*Scanner, error) {
 	if config == nil {
 		return nil, fmt.Errorf("scanner config is required")
 	}
+	return NewScannerWithStore(config, jobManager, &FileProcessedStore{Path: config.ProcessedFilePath})
+}
+
+// NewScannerWithStore creates a new file scanner keeping processed files in store
+func NewScannerWithStore(config *ScannerConfig, jobManager *jobs.Manager, store ProcessedStore) (*Scanner, error) {
+	if config == nil {
+		return nil, fmt.Errorf("scanner config is required")
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
 	// Initialize processed file database
-	processedDB, err := NewProcessedDB(config.ProcessedFilePath)
+	processedDB, err := NewProcessedDBWithStore(store)
 	if err != nil {
 		cancel()
 		return nil, fmt.Errorf("failed to initialize processed DB: %w", err)
@@ -175,57 +340,80 @@ func NewScanner(config *ScannerConfig, jobManager *jobs.Manager) (*Scanner, erro
 
 // Start begins the scanner based on configured mode
 func (s *Scanner) Start() error {
-	if !s.config.Enabled {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	return s.start()
+}
+
+// start runs Start with lifecycleMu held. The goroutines it launches get the stop channel,
+// watcher and context of this run, so a restart replacing the fields doesn't race with
+// them. The initial scan runs in the background, Stop cancels it rather than waiting.
+func (s *Scanner) start() error {
+	s.mu.RLock()
+	cfg, stopCh, watcher, ctx := s.config, s.stopCh, s.watcher, s.ctx
+	s.mu.RUnlock()
+
+	if !cfg.Enabled {
 		log.Println("[Scanner] Disabled, not starting")
 		return nil
 	}
+	if stopCh == nil {
+		return fmt.Errorf("scanner is stopped")
+	}
 
-	log.Printf("[Scanner] Starting in %s mode", s.config.Mode)
+	log.Printf("[Scanner] Starting in %s mode", cfg.Mode)
 
-	switch s.config.Mode {
+	switch cfg.Mode {
 	case ScanModeManual:
 		// Do nothing, manual scans only
 		return nil
 
 	case ScanModeStartup:
 		// Single scan on startup
-		return s.ScanAll()
+		s.wg.Add(1)
+		go s.initialScan(ctx)
+		return nil
 
 	case ScanModePeriodic:
 		// Periodic scanning
 		s.wg.Add(1)
-		go s.periodicScan()
+		go s.periodicScan(stopCh, cfg.ScanIntervalSec)
 		return nil
 
 	case ScanModeWatch:
 		// Real-time watching
-		if err := s.setupWatchers(); err != nil {
+		if err := s.setupWatchers(watcher, cfg.WatchDirectories); err != nil {
 			return err
 		}
 		s.wg.Add(1)
-		go s.watchFiles()
+		go s.watchFiles(watcher, stopCh)
 		return nil
 
 	case ScanModeHybrid:
 		// Initial scan + watching + periodic backup
-		if err := s.ScanAll(); err != nil {
-			log.Printf("[Scanner] Initial scan failed: %v", err)
-		}
-		if err := s.setupWatchers(); err != nil {
+		if err := s.setupWatchers(watcher, cfg.WatchDirectories); err != nil {
 			return err
 		}
-		s.wg.Add(2)
-		go s.watchFiles()
-		go s.periodicScan()
+		s.wg.Add(3)
+		go s.initialScan(ctx)
+		go s.watchFiles(watcher, stopCh)
+		go s.periodicScan(stopCh, cfg.ScanIntervalSec)
 		return nil
 
 	default:
-		return fmt.Errorf("unknown scan mode: %s", s.config.Mode)
+		return fmt.Errorf("unknown scan mode: %s", cfg.Mode)
 	}
 }
 
-// Stop gracefully stops the scanner
+// Stop gracefully stops the scanner. Stopping a stopped scanner does nothing.
 func (s *Scanner) Stop() {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	s.stop()
+}
+
+// stop runs Stop with lifecycleMu held
+func (s *Scanner) stop() {
 	s.mu.Lock()
 	if s.stopCh == nil {
 		s.mu.Unlock()
@@ -236,10 +424,12 @@ func (s *Scanner) Stop() {
 	close(s.stopCh)
 	s.stopCh = nil // Mark as stopped
 	s.cancel()
+	watcher := s.watcher
+	s.watcher = nil
 	s.mu.Unlock()
 
-	if s.watcher != nil {
-		s.watcher.Close()
+	if watcher != nil {
+		watcher.Close()
 	}
 
 	s.wg.Wait()
@@ -252,6 +442,13 @@ func (s *Scanner) Stop() {
 	log.Println("[Scanner] Stopped")
 }
 
+// context returns the context of the current run, cancelled when the scanner stops
+func (s *Scanner) context() context.Context {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ctx
+}
+
 // GetConfig returns the current scanner configuration
 func (s *Scanner) GetConfig() *ScannerConfig {
 	s.mu.RLock()
@@ -259,11 +456,23 @@ func (s *Scanner) GetConfig() *ScannerConfig {
 	return s.config
 }
 
-// GetProcessedFiles returns all files processed by the scanner
+// IsProcessed reports whether a file is in the processed DB
+func (s *Scanner) IsProcessed(path string) bool {
+	return s.processedDB.IsProcessed(path)
+}
+
+// GetProcessedFiles returns a snapshot of all files processed by the scanner.
+// It is safe to call while a scan is running.
 func (s *Scanner) GetProcessedFiles() []ProcessedFile {
 	return s.processedDB.GetAll()
 }
 
+// QueryProcessed returns one page of processed files, newest first, and the number matching q
+func (s *Scanner) QueryProcessed(q ProcessedQuery) ([]ProcessedFile, int, error) {
+	return s.processedDB.Query(q)
+}
+
+// GetStatus returns a copy of the current scan status
 func (s *Scanner) GetStatus() ScanStatus {
 	s.statusMu.RLock()
 	defer s.statusMu.RUnlock()
@@ -272,7 +481,7 @@ func (s *Scanner) GetStatus() ScanStatus {
 
 // CompleteProcessed updates a processed file entry with final stats from a job
 func (s *Scanner) CompleteProcessed(job *jobs.Job) {
-	s.processedDB.MarkProcessed(ProcessedFile{
+	f := ProcessedFile{
 		Path:        job.SourcePath,
 		JobID:       job.ID,
 		JobType:     string(job.Type),
@@ -282,12 +491,28 @@ func (s *Scanner) CompleteProcessed(job *jobs.Job) {
 		AISubtitles: job.AISubtitles,
 		AIUpscale:   job.Upscale,
 		AICleaned:   job.AICleaned,
-	})
+	}
+
+	// Keep the hash recorded when the job was created instead of re-reading the source
+	if existing, ok := s.processedDB.Get(job.SourcePath); ok {
+		f.Hash = existing.Hash
+	}
+
+	s.processedDB.MarkProcessed(f)
 }
 
-// UpdateConfig updates the scanner configuration and restarts if necessary
+// UpdateConfig updates the scanner configuration and restarts if necessary. It is safe
+// to call concurrently, restarts run one at a time.
 func (s *Scanner) UpdateConfig(newCfg *ScannerConfig) error {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+	return s.updateConfig(newCfg)
+}
+
+// updateConfig runs UpdateConfig with lifecycleMu held
+func (s *Scanner) updateConfig(newCfg *ScannerConfig) error {
 	newCfg.Validate()
+
 	s.mu.Lock()
 	wasEnabled := s.config.Enabled
 	s.config = newCfg
@@ -301,28 +526,27 @@ func (s *Scanner) UpdateConfig(newCfg *ScannerConfig) error {
 	log.Println("[Scanner] Configuration updated, restarting scanner...")
 
 	// Stop the scanner if it's running
-	s.Stop()
-
-	// Re-initialize context and stop channel
-	s.mu.Lock()
-	s.ctx, s.cancel = context.WithCancel(context.Background())
-	s.stopCh = make(chan struct{})
-	s.mu.Unlock()
+	s.stop()
 
 	// Re-initialize watcher if mode changed to watch or hybrid
+	var watcher *fsnotify.Watcher
 	if newCfg.Mode == ScanModeWatch || newCfg.Mode == ScanModeHybrid {
-		watcher, err := fsnotify.NewWatcher()
-		if err != nil {
+		var err error
+		if watcher, err = fsnotify.NewWatcher(); err != nil {
 			return fmt.Errorf("failed to create file watcher: %w", err)
 		}
-		s.watcher = watcher
-	} else {
-		s.watcher = nil
 	}
 
+	// Re-initialize context, stop channel and watcher together
+	s.mu.Lock()
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.stopCh = make(chan struct{})
+	s.watcher = watcher
+	s.mu.Unlock()
+
 	// Start if enabled
 	if newCfg.Enabled {
-		return s.Start()
+		return s.start()
 	} else if wasEnabled {
 		log.Println("[Scanner] Scanner disabled")
 	}
@@ -330,12 +554,51 @@ func (s *Scanner) UpdateConfig(newCfg *ScannerConfig) error {
 	return nil
 }
 
+// Reload re-reads the persisted scanner config and applies it if it changed.
+// It reports whether the config changed.
+func (s *Scanner) Reload() (bool, error) {
+	data, err := os.ReadFile(ScannerConfigFile)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var newCfg ScannerConfig
+	if err := json.Unmarshal(data, &newCfg); err != nil {
+		return false, fmt.Errorf("failed to parse scanner config: %w", err)
+	}
+	newCfg.Validate()
+
+	s.mu.RLock()
+	unchanged := reflect.DeepEqual(*s.config, newCfg)
+	s.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	return true, s.UpdateConfig(&newCfg)
+}
+
+// initialScan runs the startup scan of a run, until ctx is cancelled
+func (s *Scanner) initialScan(ctx context.Context) {
+	defer s.wg.Done()
+	if err := s.scanAll(ctx); err != nil && ctx.Err() == nil {
+		log.Printf("[Scanner] Initial scan failed: %v", err)
+	}
+}
+
 // ScanAll scans all configured directories
 func (s *Scanner) ScanAll() error {
+	return s.scanAll(s.context())
+}
+
+// scanAll runs ScanAll, stopping early with ctx's error once it's cancelled
+func (s *Scanner) scanAll(ctx context.Context) error {
 	s.statusMu.Lock()
 	if s.status.IsScanning {
 		s.statusMu.Unlock()
-		return fmt.Errorf("scan already in progress")
+		return ErrScanInProgress
 	}
 	s.status.IsScanning = true
 	s.status.FilesScanned = 0
@@ -355,26 +618,55 @@ func (s *Scanner) ScanAll() error {
 
 	log.Println("[Scanner] Starting full scan of all directories")
 
-	var allErrors []error
+	var dirErrors []DirectoryError
 	filesFound := 0
 	jobsCreated := 0
-
-	for _, watchDir := range s.config.WatchDirectories {
-		files, err := s.scanDirectory(watchDir)
+	pending := 0
+	cfg := s.GetConfig()
+	maxJobs := cfg.MaxJobsPerScan
+	queueFull := false
+
+	for _, watchDir := range cfg.WatchDirectories {
+		files, err := s.scanDirectory(ctx, watchDir)
+		if ctx.Err() != nil {
+			log.Println("[Scanner] Scan stopped")
+			return ctx.Err()
+		}
 		if err != nil {
-			allErrors = append(allErrors, err)
+			log.Printf("[Scanner] Failed to scan %s: %v", watchDir.Path, err)
+			dirErrors = append(dirErrors, DirectoryError{Path: watchDir.Path, Error: err.Error()})
 			continue
 		}
 
 		filesFound += len(files)
 
+		if cleaner := s.titleCleaner(); cleaner != nil && !queueFull && (maxJobs <= 0 || jobsCreated < maxJobs) {
+			limit := 0
+			if maxJobs > 0 {
+				limit = maxJobs - jobsCreated
+			}
+			s.cleanScanTitles(ctx, cleaner, files, watchDir, limit)
+		}
+
 		for _, file := range files {
-			if s.shouldProcessFile(file, watchDir) {
-				if err := s.createJobForFile(file); err != nil {
-					log.Printf("[Scanner] Failed to create job for %s: %v", file, err)
-				} else {
-					jobsCreated++
+			if ctx.Err() != nil {
+				log.Println("[Scanner] Scan stopped")
+				return ctx.Err()
+			}
+			if (maxJobs > 0 && jobsCreated >= maxJobs) || queueFull {
+				// Over the cap: files with jobs are marked processed, so the next scan
+				// continues with the ones counted here
+				if s.shouldProcessFile(file, watchDir) {
+					pending++
 				}
+			} else if created, err := s.processFile(file, watchDir); errors.Is(err, jobs.ErrQueueFull) {
+				log.Printf("[Scanner] %v, leaving the remaining files for the next scan", err)
+				queueFull = true
+				pending++
+			} else if err != nil {
+				log.Printf("[Scanner] Failed to create job for %s: %v", file, err)
+			} else if created {
+				jobsCreated++
 			}
 
 			s.statusMu.Lock()
@@ -384,28 +676,46 @@ func (s *Scanner) ScanAll() error {
 	}
 
 	s.statusMu.Lock()
+	s.status.PendingCreation = pending
 	s.status.LastResult = fmt.Sprintf("Scan complete: %d files found, %d jobs created", filesFound, jobsCreated)
-	if len(allErrors) > 0 {
-		s.status.LastError = fmt.Sprintf("Completed with %d errors", len(allErrors))
+	if pending > 0 {
+		s.status.LastResult += fmt.Sprintf(", %d files pending creation", pending)
+	}
+	s.status.DirectoryErrors = dirErrors
+	if len(dirErrors) > 0 {
+		scanErr := &ScanError{Directories: dirErrors}
+		s.status.LastError = scanErr.Error()
 		s.statusMu.Unlock()
-		return fmt.Errorf("scan completed with %d errors", len(allErrors))
+		s.Events.Append(events.Event{
+			Type:    events.ScanFailed,
+			Message: fmt.Sprintf("Scan found %d files, created %d jobs, %d errors", filesFound, jobsCreated, len(dirErrors)),
+		})
+		return scanErr
 	}
 	s.status.LastError = "" // clear previous errors
 	s.statusMu.Unlock()
 
+	s.Events.Append(events.Event{
+		Type:    events.ScanCompleted,
+		Message: fmt.Sprintf("Scan found %d files, created %d jobs", filesFound, jobsCreated),
+	})
+
 	log.Printf("[Scanner] %s", s.status.LastResult)
 
 	return nil
 }
 
-// scanDirectory scans a single directory
-func (s *Scanner) scanDirectory(watchDir WatchDirectory) ([]string, error) {
+// scanDirectory scans a single directory, until ctx is cancelled
+func (s *Scanner) scanDirectory(ctx context.Context, watchDir WatchDirectory) ([]string, error) {
 	var files []string
 
 	walkFunc := func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 
 		// Skip directories
 		if info.IsDir() {
@@ -413,6 +723,9 @@ func (s *Scanner) scanDirectory(watchDir WatchDirectory) ([]string, error) {
 			if !watchDir.Recursive && path != watchDir.Path {
 				return filepath.SkipDir
 			}
+			if skipHiddenDir(path, watchDir) || s.inExcludedDir(path, watchDir) {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 
@@ -430,8 +743,9 @@ func (s *Scanner) scanDirectory(watchDir WatchDirectory) ([]string, error) {
 		return nil
 	}
 
+	// The error names the failing path, ScanAll reports it by watch directory
 	if err := filepath.Walk(watchDir.Path, walkFunc); err != nil {
-		return nil, fmt.Errorf("failed to walk directory %s: %w", watchDir.Path, err)
+		return nil, err
 	}
 
 	return files, nil
@@ -441,8 +755,20 @@ func (s *Scanner) scanDirectory(watchDir WatchDirectory) ([]string, error) {
 func (s *Scanner) matchesPatterns(path string, watchDir WatchDirectory) bool {
 	filename := filepath.Base(path)
 
+	if !watchDir.IncludeHidden && isHiddenPath(path, watchDir.Path) {
+		return false
+	}
+
+	// Never pick up our own outputs or intermediate files, whatever they are named
+	if s.inExcludedDir(path, watchDir) {
+		return false
+	}
+
 	// Check exclude patterns first
 	for _, pattern := range watchDir.ExcludePatterns {
+		if watchDir.IncludeHidden && pattern == hiddenPattern {
+			continue
+		}
 		if matched, _ := filepath.Match(pattern, filename); matched {
 			return false
 		}
@@ -463,6 +789,66 @@ func (s *Scanner) matchesPatterns(path string, watchDir WatchDirectory) bool {
 	return false
 }
 
+// inExcludedDir reports whether path is in the output directory or one of ExcludeDirs.
+// Only directories nested in the watch directory count, excluding the watch directory
+// itself would skip every source when outputs are written next to them.
+func (s *Scanner) inExcludedDir(path string, watchDir WatchDirectory) bool {
+	dirs := s.ExcludeDirs
+	if cfg := s.GetConfig(); cfg != nil && cfg.OutputDirectory != "" {
+		dirs = append([]string{cfg.OutputDirectory}, dirs...)
+	}
+
+	root := filepath.Clean(watchDir.Path)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		dir = filepath.Clean(dir)
+		if dir != root && s.isInDirectory(dir, root) && s.isInDirectory(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// hiddenPattern is the exclude pattern for dotfiles, ignored with IncludeHidden
+const hiddenPattern = ".*"
+
+// isHiddenPath reports whether path, or any directory between root and path, is
+// dot-prefixed
+func isHiddenPath(path, root string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if strings.HasPrefix(part, ".") && part != ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// skipHiddenDir reports whether a walk of watchDir should skip the directory at path
+func skipHiddenDir(path string, watchDir WatchDirectory) bool {
+	return !watchDir.IncludeHidden && path != watchDir.Path && strings.HasPrefix(filepath.Base(path), ".")
+}
+
+// processFile creates a job for a file if it still needs processing. The check and the
+// creation happen under one lock so a scan and a watcher event can't both create a job.
+func (s *Scanner) processFile(path string, watchDir WatchDirectory) (bool, error) {
+	s.createMu.Lock()
+	defer s.createMu.Unlock()
+
+	if !s.shouldProcessFile(path, watchDir) {
+		return false, nil
+	}
+	if err := s.createJobForFile(path); err != nil {
+		return false, err
+	}
+	return s.processedDB.IsProcessed(path), nil
+}
+
 // shouldProcessFile determines if a file should be processed
 func (s *Scanner) shouldProcessFile(path string, watchDir WatchDirectory) bool {
 	// Check if already processed
@@ -501,21 +887,14 @@ func (s *Scanner) shouldProcessFile(path string, watchDir WatchDirectory) bool {
 
 // createJobForFile creates an appropriate job for a file
 func (s *Scanner) createJobForFile(path string) error {
-	if !s.config.AutoCreateJobs {
+	cfg := s.GetConfig()
+	if !cfg.AutoCreateJobs {
 		log.Printf("[Scanner] Found file %s (auto-create disabled)", path)
 		return nil
 	}
 
-	ext := strings.ToLower(filepath.Ext(path))
-	var jobType jobs.JobType
-
-	// Determine job type based on extension
-	if s.containsExtension(s.config.ExtractExtensions, ext) {
-		jobType = jobs.JobTypeExtract
-	} else if s.containsExtension(s.config.OptimizeExtensions, ext) {
-		jobType = jobs.JobTypeOptimize
-	} else {
-		log.Printf("[Scanner] Skipping %s: unknown extension %s", path, ext)
+	jobType, ok := s.jobTypeFor(path)
+	if !ok {
 		return nil
 	}
 
@@ -529,14 +908,20 @@ func (s *Scanner) createJobForFile(path string) error {
 		SourcePath:      path,
 		DestinationPath: outputPath,
 		Status:          jobs.StatusPending,
-		Priority:        s.config.DefaultPriority,
-		CreateSubtitles: s.config.AutoCreateSubtitles,
-		Upscale:         s.config.AutoUpscale,
-		Resolution:      s.config.AutoResolution,
+		Priority:        cfg.DefaultPriority,
+		CreateSubtitles: cfg.AutoCreateSubtitles,
+		Upscale:         cfg.AutoUpscale,
+		Resolution:      cfg.AutoResolution,
+		MaxResolution:   cfg.MaxResolution,
 		CreatedAt:       time.Now(),
 	}
+	if jobType == jobs.JobTypeOptimize {
+		job.CleanTitle = s.cachedTitle(filepath.Base(path))
+	}
 
-	s.jobManager.AddJob(job)
+	if err := s.jobManager.AddJob(job); err != nil {
+		return err
+	}
 
 	// Mark as processed (initial entry)
 	s.processedDB.MarkProcessed(ProcessedFile{
@@ -550,13 +935,84 @@ func (s *Scanner) createJobForFile(path string) error {
 	return nil
 }
 
+// titleCleaner returns the job manager's cleaner for AI filename cleaning, nil without one
+func (s *Scanner) titleCleaner() *meta.Cleaner {
+	if s.jobManager == nil {
+		return nil
+	}
+	return s.jobManager.TitleCleaner()
+}
+
+// cleanScanTitles cleans the filenames of the optimize jobs a scan is about to create in
+// batches, so each job starts with its title instead of asking the AI on its own. At
+// most limit files are cleaned, 0 is unlimited.
+func (s *Scanner) cleanScanTitles(ctx context.Context, cleaner *meta.Cleaner, files []string, watchDir WatchDirectory, limit int) {
+	cfg := s.GetConfig()
+	if !cfg.AutoCreateJobs {
+		return
+	}
+	var names []string
+	for _, file := range files {
+		if limit > 0 && len(names) >= limit {
+			break
+		}
+		ext := strings.ToLower(filepath.Ext(file))
+		if cfg.ExtensionJobTypes[ext] == jobs.JobTypeOptimize && s.shouldProcessFile(file, watchDir) {
+			names = append(names, filepath.Base(file))
+		}
+	}
+	if len(names) > 0 {
+		s.cacheTitles(ctx, cleaner, names)
+	}
+}
+
+// cachedTitle returns the AI-cleaned title cached for a filename, "" if there is none
+func (s *Scanner) cachedTitle(name string) string {
+	s.titleMu.Lock()
+	defer s.titleMu.Unlock()
+	return s.titleCache[name]
+}
+
+// jobTypeFor determines the job type of a file from its extension
+func (s *Scanner) jobTypeFor(path string) (jobs.JobType, bool) {
+	ext := strings.ToLower(filepath.Ext(path))
+
+	cfg := s.GetConfig()
+	jobType, ok := cfg.ExtensionJobTypes[ext]
+	if !ok {
+		log.Printf("[Scanner] Skipping %s: unmapped extension %s", path, ext)
+		return "", false
+	}
+	if jobType == jobs.JobTypeExtract {
+		// The cue sheet's job covers its data file
+		if hasCueSheet(path) {
+			return "", false
+		}
+		// The first part's job covers the rest of a split image set
+		if part, later := cfg.laterSplitPart(path); later {
+			log.Printf("[Scanner] Skipping %s: part %d of a split image, only the first part is queued", path, part)
+			return "", false
+		}
+	}
+	return jobType, true
+}
+
+// hasCueSheet reports whether path is a .bin image with a cue sheet next to it
+func hasCueSheet(path string) bool {
+	if !strings.EqualFold(filepath.Ext(path), ".bin") {
+		return false
+	}
+	_, err := os.Stat(strings.TrimSuffix(path, filepath.Ext(path)) + ".cue")
+	return err == nil
+}
+
 // generateOutputPath creates an output path for a file
 func (s *Scanner) generateOutputPath(inputPath string, jobType jobs.JobType) string {
 	filename := filepath.Base(inputPath)
 	ext := filepath.Ext(filename)
 	nameWithoutExt := strings.TrimSuffix(filename, ext)
 
-	outputDir := s.config.OutputDirectory
+	outputDir := s.GetConfig().OutputDirectory
 	if outputDir == "" {
 		outputDir = filepath.Dir(inputPath)
 	}
@@ -573,20 +1029,10 @@ func (s *Scanner) generateOutputPath(inputPath string, jobType jobs.JobType) str
 	}
 }
 
-// containsExtension checks if an extension is in the list
-func (s *Scanner) containsExtension(extensions []string, ext string) bool {
-	for _, e := range extensions {
-		if strings.EqualFold(e, ext) {
-			return true
-		}
-	}
-	return false
-}
-
 // setupWatchers configures file system watchers for all directories
-func (s *Scanner) setupWatchers() error {
-	for _, watchDir := range s.config.WatchDirectories {
-		if err := s.addWatcher(watchDir); err != nil {
+func (s *Scanner) setupWatchers(watcher *fsnotify.Watcher, watchDirs []WatchDirectory) error {
+	for _, watchDir := range watchDirs {
+		if err := s.addWatcher(watcher, watchDir); err != nil {
 			return err
 		}
 	}
@@ -594,7 +1040,7 @@ func (s *Scanner) setupWatchers() error {
 }
 
 // addWatcher adds a watcher for a directory
-func (s *Scanner) addWatcher(watchDir WatchDirectory) error {
+func (s *Scanner) addWatcher(watcher *fsnotify.Watcher, watchDir WatchDirectory) error {
 	if watchDir.Recursive {
 		// Add watchers for all subdirectories
 		return filepath.Walk(watchDir.Path, func(path string, info os.FileInfo, err error) error {
@@ -602,7 +1048,10 @@ func (s *Scanner) addWatcher(watchDir WatchDirectory) error {
 				return err
 			}
 			if info.IsDir() {
-				if err := s.watcher.Add(path); err != nil {
+				if skipHiddenDir(path, watchDir) || s.inExcludedDir(path, watchDir) {
+					return filepath.SkipDir
+				}
+				if err := watcher.Add(path); err != nil {
 					return err
 				}
 				log.Printf("[Scanner] Watching directory: %s", path)
@@ -611,7 +1060,7 @@ func (s *Scanner) addWatcher(watchDir WatchDirectory) error {
 		})
 	} else {
 		// Just watch the root directory
-		if err := s.watcher.Add(watchDir.Path); err != nil {
+		if err := watcher.Add(watchDir.Path); err != nil {
 			return err
 		}
 		log.Printf("[Scanner] Watching directory: %s", watchDir.Path)
@@ -620,26 +1069,26 @@ func (s *Scanner) addWatcher(watchDir WatchDirectory) error {
 }
 
 // watchFiles monitors file system events
-func (s *Scanner) watchFiles() {
+func (s *Scanner) watchFiles(watcher *fsnotify.Watcher, stopCh <-chan struct{}) {
 	defer s.wg.Done()
 
 	log.Println("[Scanner] File watcher started")
 
 	for {
 		select {
-		case <-s.stopCh:
+		case <-stopCh:
 			return
 
-		case event, ok := <-s.watcher.Events:
+		case event, ok := <-watcher.Events:
 			if !ok {
 				return
 			}
 
 			if event.Op&fsnotify.Create == fsnotify.Create {
-				s.handleNewFile(event.Name)
+				s.handleNewFile(event.Name, stopCh)
 			}
 
-		case err, ok := <-s.watcher.Errors:
+		case err, ok := <-watcher.Errors:
 			if !ok {
 				return
 			}
@@ -649,61 +1098,113 @@ func (s *Scanner) watchFiles() {
 }
 
 // handleNewFile processes a newly created file
-func (s *Scanner) handleNewFile(path string) {
+func (s *Scanner) handleNewFile(path string, stopCh <-chan struct{}) {
 	// Find matching watch directory
-	for _, watchDir := range s.config.WatchDirectories {
+	for _, watchDir := range s.GetConfig().WatchDirectories {
 		if s.isInDirectory(path, watchDir.Path) && s.matchesPatterns(path, watchDir) {
 			// Wait for file age requirement if configured
 			if watchDir.MinFileAgeMinutes > 0 {
-				go s.delayedProcess(path, watchDir)
-			} else {
-				if s.shouldProcessFile(path, watchDir) {
-					s.createJobForFile(path)
-				}
+				go s.delayedProcess(path, watchDir, stopCh)
+			} else if _, err := s.processFile(path, watchDir); err != nil {
+				log.Printf("[Scanner] Failed to create job for %s: %v", path, err)
 			}
 			break
 		}
 	}
 }
 
+// Notify processes a file an external tool reports as complete, such as a download
+// client's post-processing script. The file age wait is skipped, the other checks apply.
+// It reports whether a job was created.
+func (s *Scanner) Notify(path string) (bool, error) {
+	path = filepath.Clean(path)
+
+	s.mu.RLock()
+	watchDirs := s.config.WatchDirectories
+	s.mu.RUnlock()
+
+	for _, watchDir := range watchDirs {
+		if !s.isInDirectory(path, watchDir.Path) || !s.matchesPatterns(path, watchDir) {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil {
+			return false, err
+		} else if info.IsDir() {
+			return false, fmt.Errorf("%s is a directory", path)
+		}
+
+		log.Printf("[Scanner] Notified of completed file %s", path)
+		watchDir.MinFileAgeMinutes = 0
+		return s.processFile(path, watchDir)
+	}
+	return false, ErrNotInWatchDirectory
+}
+
 // delayedProcess waits before processing a file
-func (s *Scanner) delayedProcess(path string, watchDir WatchDirectory) {
+func (s *Scanner) delayedProcess(path string, watchDir WatchDirectory, stopCh <-chan struct{}) {
 	delay := time.Duration(watchDir.MinFileAgeMinutes) * time.Minute
 	log.Printf("[Scanner] Delaying processing of %s for %v", path, delay)
 
 	select {
 	case <-time.After(delay):
-		if s.shouldProcessFile(path, watchDir) {
-			s.createJobForFile(path)
+		if _, err := s.processFile(path, watchDir); err != nil {
+			log.Printf("[Scanner] Failed to create job for %s: %v", path, err)
 		}
-	case <-s.stopCh:
+	case <-stopCh:
 		return
 	}
 }
 
 // periodicScan runs periodic scans
-func (s *Scanner) periodicScan() {
+func (s *Scanner) periodicScan(stopCh <-chan struct{}, intervalSec int) {
 	defer s.wg.Done()
 
-	interval := time.Duration(s.config.ScanIntervalSec) * time.Second
+	interval := time.Duration(intervalSec) * time.Second
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	log.Printf("[Scanner] Periodic scan started (interval: %v)", interval)
 
+	// Set while a scan is held for running jobs, to retry sooner than the next tick
+	var idleCheck <-chan time.Time
 	for {
 		select {
-		case <-s.stopCh:
+		case <-stopCh:
 			return
 		case <-ticker.C:
-			log.Println("[Scanner] Running periodic scan...")
-			if err := s.ScanAll(); err != nil {
-				log.Printf("[Scanner] Periodic scan error: %v", err)
-			}
+		case <-idleCheck:
+		}
+
+		idleCheck = nil
+		if !s.runPeriodicScan() {
+			idleCheck = time.After(idleCheckInterval)
 		}
 	}
 }
 
+// idleCheckInterval is how often a scan held by PauseWhileEncoding checks for idle jobs
+const idleCheckInterval = 30 * time.Second
+
+// runPeriodicScan runs one periodic scan. It reports false when the scan was held
+// because jobs are encoding and PauseWhileEncoding is set.
+func (s *Scanner) runPeriodicScan() bool {
+	s.mu.RLock()
+	pause := s.config.PauseWhileEncoding
+	s.mu.RUnlock()
+	if pause && s.jobManager != nil && s.jobManager.ProcessingCount() > 0 {
+		log.Println("[Scanner] Jobs are encoding, holding periodic scan until they finish")
+		return false
+	}
+
+	log.Println("[Scanner] Running periodic scan...")
+	if err := s.ScanAll(); errors.Is(err, ErrScanInProgress) {
+		log.Println("[Scanner] Previous scan still running, skipping periodic scan")
+	} else if err != nil {
+		log.Printf("[Scanner] Periodic scan error: %v", err)
+	}
+	return true
+}
+
 // isInDirectory checks if a path is within a directory
 func (s *Scanner) isInDirectory(path, dir string) bool {
 	rel, err := filepath.Rel(dir, path)
@@ -733,10 +1234,15 @@ func randomString(n int) string {
 	return string(b)
 }
 
-// NewProcessedDB creates a new processed file database
+// NewProcessedDB creates a new processed file database kept in a JSON file
 func NewProcessedDB(filePath string) (*ProcessedDB, error) {
+	return NewProcessedDBWithStore(&FileProcessedStore{Path: filePath})
+}
+
+// NewProcessedDBWithStore creates a new processed file database kept in store
+func NewProcessedDBWithStore(store ProcessedStore) (*ProcessedDB, error) {
 	db := &ProcessedDB{
-		filePath:  filePath,
+		store:     store,
 		processed: make(map[string]ProcessedFile),
 	}
 
@@ -748,30 +1254,38 @@ func NewProcessedDB(filePath string) (*ProcessedDB, error) {
 	return db, nil
 }
 
-// Load reads the processed files database from disk
+// Load reads the processed files database from the store. A JSON file falls back to its
+// backup when the file is missing or corrupt.
 func (db *ProcessedDB) Load() error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-
-	data, err := os.ReadFile(db.filePath)
+	processed, err := db.store.LoadProcessed()
 	if err != nil {
 		return err
 	}
 
-	return json.Unmarshal(data, &db.processed)
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.processed = processed
+	return nil
 }
 
-// Save writes the processed files database to disk
+// Save writes the processed files database to the store
 func (db *ProcessedDB) Save() error {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
-	data, err := json.Marshal(db.processed)
-	if err != nil {
-		return err
-	}
+	db.saveMu.Lock()
+	defer db.saveMu.Unlock()
+	return db.store.SaveProcessed(db.processed)
+}
 
-	return os.WriteFile(db.filePath, data, 0644)
+// Query returns one page of processed files, newest first, and the number matching q.
+// A store that can query itself answers it, otherwise the in-memory entries are filtered.
+func (db *ProcessedDB) Query(q ProcessedQuery) ([]ProcessedFile, int, error) {
+	if querier, ok := db.store.(processedQuerier); ok {
+		return querier.QueryProcessed(q)
+	}
+	files, total := queryProcessed(db.GetAll(), q)
+	return files, total, nil
 }
 
 // IsProcessed checks if a file has been processed
@@ -783,6 +1297,15 @@ func (db *ProcessedDB) IsProcessed(path string) bool {
 	return exists
 }
 
+// Get returns the entry for a processed file, if any
+func (db *ProcessedDB) Get(path string) (ProcessedFile, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	f, ok := db.processed[path]
+	return f, ok
+}
+
 // GetAll returns all processed files
 func (db *ProcessedDB) GetAll() []ProcessedFile {
 	db.mu.RLock()
@@ -814,6 +1337,20 @@ func (db *ProcessedDB) MarkProcessed(f ProcessedFile) {
 	db.Save()
 }
 
+// Apply upserts and removes entries in one update and saves the database
+func (db *ProcessedDB) Apply(upserts []ProcessedFile, removals []string) error {
+	db.mu.Lock()
+	for _, f := range upserts {
+		db.processed[f.Path] = f
+	}
+	for _, path := range removals {
+		delete(db.processed, path)
+	}
+	db.mu.Unlock()
+
+	return db.Save()
+}
+
 // calculateFileHash computes SHA256 hash of first 1MB of file
 func calculateFileHash(path string) (string, error) {
 	file, err := os.Open(path)
@@ -1,9 +1,21 @@
 package scanner
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/Vasteva/MediaConverter/internal/config"
+	"github.com/Vasteva/MediaConverter/internal/database"
+	"github.com/Vasteva/MediaConverter/internal/jobs"
 )
 
 func TestIsInDirectory(t *testing.T) {
@@ -49,10 +61,90 @@ func TestMatchesPatterns(t *testing.T) {
 	}
 }
 
+func TestScanDirectoryIncludeHidden(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"movie.mkv", ".partial.mkv", ".hidden/extra.mkv", "shows/.cache/episode.mkv"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &Scanner{}
+	watchDir := WatchDirectory{
+		Path:            root,
+		Recursive:       true,
+		IncludePatterns: []string{"*.mkv"},
+		ExcludePatterns: []string{"*_optimized.mkv", ".*"},
+	}
+
+	files, err := s.scanDirectory(context.Background(), watchDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != filepath.Join(root, "movie.mkv") {
+		t.Errorf("expected only movie.mkv without includeHidden, got %v", files)
+	}
+	if s.matchesPatterns(filepath.Join(root, ".hidden", "new.mkv"), watchDir) {
+		t.Error("expected watcher events in hidden directories to be ignored")
+	}
+
+	watchDir.IncludeHidden = true
+	files, err = s.scanDirectory(context.Background(), watchDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 4 {
+		t.Errorf("expected all 4 files with includeHidden, got %v", files)
+	}
+	if !s.matchesPatterns(filepath.Join(root, ".hidden", "new.mkv"), watchDir) {
+		t.Error("expected watcher events in hidden directories to match with includeHidden")
+	}
+}
+
+func TestScanExcludesOutputAndTempDirs(t *testing.T) {
+	root := t.TempDir()
+	outDir := filepath.Join(root, "converted")
+	tempDir := filepath.Join(root, "tmp")
+	for _, name := range []string{"movie.mkv", "converted/movie.mkv", "converted/shows/episode.mkv", "tmp/movie_temp_remux.mkv"} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &Scanner{config: &ScannerConfig{OutputDirectory: outDir}, ExcludeDirs: []string{tempDir}}
+	watchDir := WatchDirectory{Path: root, Recursive: true, IncludePatterns: []string{"*.mkv"}}
+
+	files, err := s.scanDirectory(context.Background(), watchDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != filepath.Join(root, "movie.mkv") {
+		t.Errorf("expected outputs and temp files to be skipped, got %v", files)
+	}
+	if s.matchesPatterns(filepath.Join(outDir, "new.mkv"), watchDir) {
+		t.Error("expected watcher events for new outputs to be ignored")
+	}
+
+	// Outputs written into the watch directory itself are left to the exclude patterns
+	s.config.OutputDirectory = root
+	s.ExcludeDirs = nil
+	if files, _ := s.scanDirectory(context.Background(), watchDir); len(files) != 4 {
+		t.Errorf("expected the whole watch directory to be scanned, got %v", files)
+	}
+}
+
 func TestProcessedDB(t *testing.T) {
 	tmpFile := filepath.Join(t.TempDir(), "processed.json")
 	db := &ProcessedDB{
-		filePath:  tmpFile,
+		store:     &FileProcessedStore{Path: tmpFile},
 		processed: make(map[string]ProcessedFile),
 	}
 
@@ -69,7 +161,7 @@ func TestProcessedDB(t *testing.T) {
 
 	// Test persistence
 	db2 := &ProcessedDB{
-		filePath:  tmpFile,
+		store:     &FileProcessedStore{Path: tmpFile},
 		processed: make(map[string]ProcessedFile),
 	}
 	if err := db2.Load(); err != nil {
@@ -81,6 +173,29 @@ func TestProcessedDB(t *testing.T) {
 	}
 }
 
+func TestProcessedDBRecoversFromBackup(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "processed.json")
+	db, err := NewProcessedDB(tmpFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.MarkProcessed(ProcessedFile{Path: "/test/first.mkv", Hash: "abc"})
+	db.MarkProcessed(ProcessedFile{Path: "/test/second.mkv", Hash: "def"})
+
+	// The second save was cut short, the backup still has the first
+	if err := os.WriteFile(tmpFile, []byte(`{"/test/first.mkv": {"path": "/te`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewProcessedDB(tmpFile)
+	if err != nil {
+		t.Fatalf("expected recovery from backup, got %v", err)
+	}
+	if !reloaded.IsProcessed("/test/first.mkv") || reloaded.IsProcessed("/test/second.mkv") {
+		t.Errorf("expected the backup's entries, got %d", len(reloaded.GetAll()))
+	}
+}
+
 func TestCalculateHash(t *testing.T) {
 	tmpFile := filepath.Join(t.TempDir(), "hash_test.txt")
 	os.WriteFile(tmpFile, []byte("hello world"), 0644)
@@ -100,3 +215,706 @@ func TestCalculateHash(t *testing.T) {
 		t.Error("expected consistent hash")
 	}
 }
+
+func TestCompleteProcessedRecordsJobStats(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "processed.json")
+	s, err := NewScanner(&ScannerConfig{ProcessedFilePath: tmpFile}, nil)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+
+	s.CompleteProcessed(&jobs.Job{
+		ID:          "job-1",
+		Type:        jobs.JobTypeOptimize,
+		SourcePath:  "/test/movie.mkv",
+		InputSize:   2048,
+		OutputSize:  1024,
+		AISubtitles: true,
+		Upscale:     true,
+		AICleaned:   true,
+	})
+
+	// Reload from disk to verify the new fields round-trip
+	db, err := NewProcessedDB(tmpFile)
+	if err != nil {
+		t.Fatalf("failed to load DB: %v", err)
+	}
+	files := db.GetAll()
+	if len(files) != 1 {
+		t.Fatalf("expected 1 processed file, got %d", len(files))
+	}
+
+	f := files[0]
+	if f.JobID != "job-1" || f.JobType != string(jobs.JobTypeOptimize) {
+		t.Errorf("unexpected job reference: %s/%s", f.JobID, f.JobType)
+	}
+	if f.InputSize != 2048 || f.OutputSize != 1024 {
+		t.Errorf("expected sizes 2048/1024, got %d/%d", f.InputSize, f.OutputSize)
+	}
+	if !f.AISubtitles || !f.AIUpscale || !f.AICleaned {
+		t.Errorf("expected all AI flags set, got subtitles=%v upscale=%v cleaned=%v", f.AISubtitles, f.AIUpscale, f.AICleaned)
+	}
+}
+
+func TestCompleteProcessedKeepsInitialHash(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "processed.json")
+	s, err := NewScanner(&ScannerConfig{ProcessedFilePath: tmpFile}, nil)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+
+	// Initial entry as written by createJobForFile
+	s.processedDB.MarkProcessed(ProcessedFile{
+		Path:    "/test/movie.mkv",
+		Hash:    "initial-hash",
+		JobID:   "job-1",
+		JobType: string(jobs.JobTypeOptimize),
+	})
+
+	s.CompleteProcessed(&jobs.Job{
+		ID:         "job-1",
+		Type:       jobs.JobTypeOptimize,
+		SourcePath: "/test/movie.mkv",
+		OutputSize: 512,
+	})
+
+	f, ok := s.processedDB.Get("/test/movie.mkv")
+	if !ok {
+		t.Fatal("expected processed entry to exist")
+	}
+	if f.Hash != "initial-hash" {
+		t.Errorf("expected hash to be preserved, got %q", f.Hash)
+	}
+	if f.OutputSize != 512 {
+		t.Errorf("expected output size 512, got %d", f.OutputSize)
+	}
+	if len(s.GetProcessedFiles()) != 1 {
+		t.Errorf("expected completion to update the existing entry, got %d entries", len(s.GetProcessedFiles()))
+	}
+}
+
+func TestGetProcessedFilesSnapshot(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "processed.json")
+	s, err := NewScanner(&ScannerConfig{ProcessedFilePath: tmpFile}, nil)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+
+	s.processedDB.MarkProcessed(ProcessedFile{Path: "/test/a.mkv", Hash: "a", JobID: "job-a"})
+	s.processedDB.MarkProcessed(ProcessedFile{Path: "/test/b.mkv", Hash: "b", JobID: "job-b"})
+
+	files := s.GetProcessedFiles()
+	if len(files) != 2 {
+		t.Fatalf("expected 2 processed files, got %d", len(files))
+	}
+
+	// Mutating the snapshot must not leak into the DB
+	for i := range files {
+		files[i].JobID = "mutated"
+	}
+	files[0] = ProcessedFile{Path: "/test/c.mkv"}
+
+	for _, f := range s.GetProcessedFiles() {
+		if f.JobID == "mutated" {
+			t.Errorf("internal entry for %s was modified through the snapshot", f.Path)
+		}
+	}
+	if s.processedDB.IsProcessed("/test/c.mkv") {
+		t.Error("replacing a snapshot element should not add entries")
+	}
+	if len(s.GetProcessedFiles()) != 2 {
+		t.Errorf("expected DB to still hold 2 entries, got %d", len(s.GetProcessedFiles()))
+	}
+}
+
+func TestGetProcessedFilesConcurrent(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "processed.json")
+	s, err := NewScanner(&ScannerConfig{ProcessedFilePath: tmpFile}, nil)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				s.processedDB.MarkProcessed(ProcessedFile{Path: fmt.Sprintf("/test/%d-%d.mkv", i, j), Hash: "x"})
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_ = s.GetProcessedFiles()
+				_ = s.GetStatus()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := len(s.GetProcessedFiles()); got != 40 {
+		t.Errorf("expected 40 processed files, got %d", got)
+	}
+}
+
+func TestUpdateConfigConcurrent(t *testing.T) {
+	watchDir := t.TempDir()
+	s, err := NewScanner(&ScannerConfig{ProcessedFilePath: filepath.Join(t.TempDir(), "processed.json")}, nil)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+
+	modes := []ScanMode{ScanModePeriodic, ScanModeWatch, ScanModeManual}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				err := s.UpdateConfig(&ScannerConfig{
+					Mode:              modes[(i+j)%len(modes)],
+					Enabled:           j%4 != 3,
+					ScanIntervalSec:   3600,
+					ProcessedFilePath: s.GetConfig().ProcessedFilePath,
+					WatchDirectories:  []WatchDirectory{{Path: watchDir}},
+				})
+				if err != nil {
+					t.Errorf("unexpected update error: %v", err)
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_ = s.GetStatus()
+				_ = s.GetConfig()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Stopping twice must not close the stop channel twice
+	s.Stop()
+	s.Stop()
+}
+
+func TestScanAllSingleFlight(t *testing.T) {
+	watchDir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		name := filepath.Join(watchDir, fmt.Sprintf("movie%02d.mkv", i))
+		if err := os.WriteFile(name, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jm, _ := jobs.NewManager(&config.Config{MaxConcurrentJobs: 1}, nil, "")
+	s, err := NewScanner(&ScannerConfig{
+		AutoCreateJobs:    true,
+		ExtensionJobTypes: map[string]jobs.JobType{".mkv": jobs.JobTypeOptimize},
+		OutputDirectory:   t.TempDir(),
+		ProcessedFilePath: filepath.Join(t.TempDir(), "processed.json"),
+		WatchDirectories:  []WatchDirectory{{Path: watchDir}},
+	}, jm)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.ScanAll(); err != nil && err != ErrScanInProgress {
+				t.Errorf("unexpected scan error: %v", err)
+			}
+		}()
+	}
+	// A watcher event racing the scans must not create a second job either
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		s.processFile(filepath.Join(watchDir, "movie00.mkv"), WatchDirectory{Path: watchDir})
+	}()
+	wg.Wait()
+
+	if s.GetStatus().IsScanning {
+		t.Error("expected scanning flag to be cleared")
+	}
+
+	seen := make(map[string]bool)
+	for _, job := range jm.GetAllJobs() {
+		if seen[job.SourcePath] {
+			t.Errorf("duplicate job for %s", job.SourcePath)
+		}
+		seen[job.SourcePath] = true
+	}
+	if len(seen) != 20 {
+		t.Errorf("expected 20 jobs, got %d", len(seen))
+	}
+}
+
+func TestStartupScanInBackground(t *testing.T) {
+	watchDir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		name := filepath.Join(watchDir, fmt.Sprintf("movie%02d.mkv", i))
+		if err := os.WriteFile(name, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jm, _ := jobs.NewManager(&config.Config{MaxConcurrentJobs: 1}, nil, "")
+	s, err := NewScanner(&ScannerConfig{
+		Enabled:           true,
+		Mode:              ScanModeStartup,
+		AutoCreateJobs:    true,
+		ExtensionJobTypes: map[string]jobs.JobType{".mkv": jobs.JobTypeOptimize},
+		OutputDirectory:   t.TempDir(),
+		ProcessedFilePath: filepath.Join(t.TempDir(), "processed.json"),
+		WatchDirectories:  []WatchDirectory{{Path: watchDir}},
+	}, jm)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+
+	// A cancelled run stops the scan before any job is created
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.scanAll(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a cancelled scan to stop, got %v", err)
+	}
+	if len(jm.GetAllJobs()) != 0 || s.GetStatus().IsScanning {
+		t.Errorf("expected no jobs and the scan finished, got %d jobs", len(jm.GetAllJobs()))
+	}
+
+	if err := s.Start(); err != nil {
+		t.Fatalf("failed to start: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(jm.GetAllJobs()) < 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.Stop()
+	if n := len(jm.GetAllJobs()); n != 5 {
+		t.Errorf("expected the startup scan to create 5 jobs, got %d", n)
+	}
+}
+
+func TestScanAllMaxJobsPerScan(t *testing.T) {
+	watchDir := t.TempDir()
+	for i := 0; i < 5; i++ {
+		name := filepath.Join(watchDir, fmt.Sprintf("movie%02d.mkv", i))
+		if err := os.WriteFile(name, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jm, _ := jobs.NewManager(&config.Config{MaxConcurrentJobs: 1}, nil, "")
+	s, err := NewScanner(&ScannerConfig{
+		AutoCreateJobs:    true,
+		MaxJobsPerScan:    3,
+		ExtensionJobTypes: map[string]jobs.JobType{".mkv": jobs.JobTypeOptimize},
+		OutputDirectory:   t.TempDir(),
+		ProcessedFilePath: filepath.Join(t.TempDir(), "processed.json"),
+		WatchDirectories:  []WatchDirectory{{Path: watchDir}},
+	}, jm)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+
+	if err := s.ScanAll(); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if n := len(jm.GetAllJobs()); n != 3 {
+		t.Errorf("expected 3 jobs after first scan, got %d", n)
+	}
+	if p := s.GetStatus().PendingCreation; p != 2 {
+		t.Errorf("expected 2 files pending creation, got %d", p)
+	}
+
+	// The next scan picks up where the cap left off
+	if err := s.ScanAll(); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if n := len(jm.GetAllJobs()); n != 5 {
+		t.Errorf("expected 5 jobs after second scan, got %d", n)
+	}
+	if p := s.GetStatus().PendingCreation; p != 0 {
+		t.Errorf("expected nothing pending, got %d", p)
+	}
+}
+
+func TestScanAllDirectoryErrors(t *testing.T) {
+	goodDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(goodDir, "movie.mkv"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	badDir := filepath.Join(t.TempDir(), "unmounted")
+
+	jm, _ := jobs.NewManager(&config.Config{MaxConcurrentJobs: 1}, nil, "")
+	s, err := NewScanner(&ScannerConfig{
+		AutoCreateJobs:    true,
+		ExtensionJobTypes: map[string]jobs.JobType{".mkv": jobs.JobTypeOptimize},
+		OutputDirectory:   t.TempDir(),
+		ProcessedFilePath: filepath.Join(t.TempDir(), "processed.json"),
+		WatchDirectories:  []WatchDirectory{{Path: badDir}, {Path: goodDir}},
+	}, jm)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+
+	err = s.ScanAll()
+	var scanErr *ScanError
+	if !errors.As(err, &scanErr) || len(scanErr.Directories) != 1 || scanErr.Directories[0].Path != badDir {
+		t.Fatalf("expected a scan error for %s only, got %v", badDir, err)
+	}
+	if !strings.Contains(scanErr.Directories[0].Error, "no such file or directory") {
+		t.Errorf("expected the cause to be reported, got %q", scanErr.Directories[0].Error)
+	}
+	if n := len(jm.GetAllJobs()); n != 1 {
+		t.Errorf("expected the readable directory to still be scanned, got %d jobs", n)
+	}
+
+	status := s.GetStatus()
+	if len(status.DirectoryErrors) != 1 || status.DirectoryErrors[0].Path != badDir || !strings.Contains(status.LastError, badDir) {
+		t.Errorf("expected the failed directory in the status, got %+v", status)
+	}
+
+	// A clean scan clears the errors
+	s.config.WatchDirectories = []WatchDirectory{{Path: goodDir}}
+	if err := s.ScanAll(); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+	if status := s.GetStatus(); len(status.DirectoryErrors) != 0 || status.LastError != "" {
+		t.Errorf("expected errors cleared after a clean scan, got %+v", status)
+	}
+}
+
+func TestPeriodicScanPausedWhileEncoding(t *testing.T) {
+	watchDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(watchDir, "movie.mkv"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	jm, _ := jobs.NewManager(&config.Config{MaxConcurrentJobs: 1}, nil, "")
+	running := &jobs.Job{ID: "running", Type: jobs.JobTypeTest, SourcePath: "/other/source.mkv", Status: jobs.StatusPending}
+	jm.AddJob(running)
+	running.Status = jobs.StatusProcessing
+
+	s, err := NewScanner(&ScannerConfig{
+		AutoCreateJobs:     true,
+		PauseWhileEncoding: true,
+		ExtensionJobTypes:  map[string]jobs.JobType{".mkv": jobs.JobTypeOptimize},
+		OutputDirectory:    t.TempDir(),
+		ProcessedFilePath:  filepath.Join(t.TempDir(), "processed.json"),
+		WatchDirectories:   []WatchDirectory{{Path: watchDir}},
+	}, jm)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+
+	if s.runPeriodicScan() {
+		t.Error("expected the periodic scan to be held while a job is processing")
+	}
+	if n := len(jm.GetAllJobs()); n != 1 || !s.GetStatus().LastScan.IsZero() {
+		t.Errorf("expected no scan to have run, got %d jobs", n)
+	}
+
+	// Resumes once the jobs are idle
+	running.Status = jobs.StatusCompleted
+	if !s.runPeriodicScan() {
+		t.Error("expected the periodic scan to run once idle")
+	}
+	if n := len(jm.GetAllJobs()); n != 2 {
+		t.Errorf("expected the scan to create a job, got %d jobs", n)
+	}
+}
+
+func TestJobTypeFor(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"paired.bin", "paired.cue", "lone.bin"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cfg := &ScannerConfig{}
+	cfg.Validate()
+	s := &Scanner{config: cfg}
+
+	tests := []struct {
+		path string
+		want jobs.JobType
+		ok   bool
+	}{
+		{"/media/disc.iso", jobs.JobTypeExtract, true},
+		{"/media/disc.IMG", jobs.JobTypeExtract, true},
+		{"/media/disc.mdf", jobs.JobTypeExtract, true},
+		{filepath.Join(dir, "paired.cue"), jobs.JobTypeExtract, true},
+		{filepath.Join(dir, "paired.bin"), "", false}, // covered by the cue sheet
+		{filepath.Join(dir, "lone.bin"), jobs.JobTypeExtract, true},
+		{"/media/movie.mkv", jobs.JobTypeOptimize, true},
+		{"/media/notes.txt", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := s.jobTypeFor(tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("jobTypeFor(%s) = %q, %v; want %q, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestExtensionJobTypes(t *testing.T) {
+	// .iso is mounted and encoded here, .avi isn't processed at all
+	cfg := &ScannerConfig{ExtensionJobTypes: map[string]jobs.JobType{
+		".ISO": jobs.JobTypeOptimize,
+		"mkv":  jobs.JobTypeOptimize,
+		".img": jobs.JobTypeExtract,
+		".ts":  "transcode",
+	}}
+	cfg.Validate()
+	s := &Scanner{config: cfg}
+
+	tests := []struct {
+		path string
+		want jobs.JobType
+		ok   bool
+	}{
+		{"/media/disc.iso", jobs.JobTypeOptimize, true},
+		{"/media/movie.MKV", jobs.JobTypeOptimize, true},
+		{"/media/disc.img", jobs.JobTypeExtract, true},
+		{"/media/movie.avi", "", false}, // Unmapped
+		{"/media/recording.ts", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := s.jobTypeFor(tt.path)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("jobTypeFor(%s) = %q, %v; want %q, %v", tt.path, got, ok, tt.want, tt.ok)
+		}
+	}
+
+	// Configs with the old extension lists keep their routing
+	legacy := &ScannerConfig{ExtractExtensions: []string{".iso"}, OptimizeExtensions: []string{".mkv"}}
+	legacy.Validate()
+	if len(legacy.ExtensionJobTypes) != 2 || legacy.ExtensionJobTypes[".iso"] != jobs.JobTypeExtract ||
+		legacy.ExtensionJobTypes[".mkv"] != jobs.JobTypeOptimize || legacy.ExtractExtensions != nil {
+		t.Errorf("expected the legacy lists converted to a map, got %+v", legacy)
+	}
+
+	bad := ScannerConfig{ExtensionJobTypes: map[string]jobs.JobType{".ts": "transcode", ".mkv": jobs.JobTypeOptimize}}
+	if problems := bad.Check(); len(problems) != 1 || !strings.Contains(problems[0], ".ts") {
+		t.Errorf("expected the unknown job type to be reported, got %v", problems)
+	}
+}
+
+func TestScanSplitImageSets(t *testing.T) {
+	watchDir := t.TempDir()
+	for _, name := range []string{"movie.part1.iso", "movie.part2.iso", "movie.part3.iso", "show_part01.iso", "show_part02.iso", "concert.iso"} {
+		if err := os.WriteFile(filepath.Join(watchDir, name), []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	jm, _ := jobs.NewManager(&config.Config{MaxConcurrentJobs: 1}, nil, "")
+	s, err := NewScanner(&ScannerConfig{
+		AutoCreateJobs:    true,
+		ExtensionJobTypes: map[string]jobs.JobType{".iso": jobs.JobTypeExtract},
+		OutputDirectory:   t.TempDir(),
+		ProcessedFilePath: filepath.Join(t.TempDir(), "processed.json"),
+		WatchDirectories:  []WatchDirectory{{Path: watchDir}},
+	}, jm)
+	if err != nil {
+		t.Fatalf("failed to create scanner: %v", err)
+	}
+	if err := s.ScanAll(); err != nil {
+		t.Fatalf("scan failed: %v", err)
+	}
+
+	var sources []string
+	for _, job := range jm.GetAllJobs() {
+		sources = append(sources, filepath.Base(job.SourcePath))
+	}
+	sort.Strings(sources)
+	if want := []string{"concert.iso", "movie.part1.iso", "show_part01.iso"}; !reflect.DeepEqual(sources, want) {
+		t.Errorf("expected jobs for %v, got %v", want, sources)
+	}
+
+	// A custom pattern recognizes other naming schemes
+	cfg := &ScannerConfig{SplitPartPattern: `(?i)-cd(\d)$`}
+	cfg.Validate()
+	if _, later := cfg.laterSplitPart("/media/film-cd2.iso"); !later {
+		t.Error("expected film-cd2.iso to be a later part with the custom pattern")
+	}
+	if _, later := cfg.laterSplitPart("/media/film.part2.iso"); later {
+		t.Error("expected the custom pattern to replace the default")
+	}
+
+	bad := ScannerConfig{SplitPartPattern: `part\d+`}
+	if problems := bad.Check(); len(problems) != 1 {
+		t.Errorf("expected a pattern without a capture group to be reported, got %v", problems)
+	}
+	bad.Validate()
+	if bad.SplitPartPattern != "" {
+		t.Errorf("expected the invalid pattern to be replaced by the default, got %q", bad.SplitPartPattern)
+	}
+}
+
+func TestScannerConfigCheck(t *testing.T) {
+	dir := WatchDirectory{Path: "/storage/movies"}
+
+	tests := []struct {
+		name     string
+		cfg      ScannerConfig
+		problems int
+	}{
+		{"manual without directories", ScannerConfig{Mode: ScanModeManual}, 0},
+		{"unknown mode", ScannerConfig{Mode: "sometimes", WatchDirectories: []WatchDirectory{dir}}, 1},
+		{"periodic without interval", ScannerConfig{Mode: ScanModePeriodic, WatchDirectories: []WatchDirectory{dir}}, 1},
+		{"periodic with interval", ScannerConfig{Mode: ScanModePeriodic, ScanIntervalSec: 300, WatchDirectories: []WatchDirectory{dir}}, 0},
+		{"hybrid without interval", ScannerConfig{Mode: ScanModeHybrid, WatchDirectories: []WatchDirectory{dir}}, 1},
+		{"watch without directories", ScannerConfig{Mode: ScanModeWatch}, 1},
+		{"empty directory path", ScannerConfig{Mode: ScanModeWatch, WatchDirectories: []WatchDirectory{{}}}, 1},
+		{"bad include pattern", ScannerConfig{Mode: ScanModeWatch, WatchDirectories: []WatchDirectory{{Path: "/storage", IncludePatterns: []string{"*.mkv", "[.iso"}}}}, 1},
+		{"bad exclude pattern", ScannerConfig{Mode: ScanModeWatch, WatchDirectories: []WatchDirectory{{Path: "/storage", ExcludePatterns: []string{"\\"}}}}, 1},
+		{"negative limits", ScannerConfig{Mode: ScanModeWatch, WatchDirectories: []WatchDirectory{{Path: "/storage", MinFileSizeMB: -1, MinFileAgeMinutes: -5}}}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if problems := tt.cfg.Check(); len(problems) != tt.problems {
+				t.Errorf("expected %d problems, got %v", tt.problems, problems)
+			}
+		})
+	}
+}
+
+func TestGroupDuplicates(t *testing.T) {
+	files := []DuplicateFile{
+		{Path: "/movies/The.Matrix.1999.1080p.mkv", Size: 8000},
+		{Path: "/old/matrix-dvd.avi", Size: 1500},
+		{Path: "/movies/The.Matrix.1999.2160p.mkv", Size: 20000, Processed: true},
+		{Path: "/movies/Heat.1995.mkv", Size: 5000},
+		{Path: "/movies/Alien.1979.mkv", Size: 4000},
+		{Path: "/backup/Alien.mkv", Size: 3000},
+	}
+	titles := map[string]string{
+		"/movies/The.Matrix.1999.1080p.mkv": "The Matrix (1999)",
+		"/old/matrix-dvd.avi":               "the matrix  (1999)",
+		"/movies/The.Matrix.1999.2160p.mkv": "The Matrix (1999)",
+		"/movies/Heat.1995.mkv":             "Heat (1995)",
+		"/movies/Alien.1979.mkv":            "Alien (1979)",
+		"/backup/Alien.mkv":                 "Alien (1979)",
+	}
+
+	clusters := GroupDuplicates(files, titles)
+	if len(clusters) != 2 {
+		t.Fatalf("expected 2 clusters, got %d: %+v", len(clusters), clusters)
+	}
+
+	matrix := clusters[0]
+	if matrix.Title != "The Matrix (1999)" || len(matrix.Files) != 3 {
+		t.Errorf("unexpected first cluster: %+v", matrix)
+	}
+	if matrix.Files[0].Path != "/movies/The.Matrix.1999.2160p.mkv" {
+		t.Errorf("expected largest copy first, got %s", matrix.Files[0].Path)
+	}
+	if matrix.TotalSize != 29500 || matrix.Reclaimable != 9500 {
+		t.Errorf("expected total 29500 and reclaimable 9500, got %d and %d", matrix.TotalSize, matrix.Reclaimable)
+	}
+
+	if clusters[1].Title != "Alien (1979)" || clusters[1].Reclaimable != 3000 {
+		t.Errorf("unexpected second cluster: %+v", clusters[1])
+	}
+}
+
+func TestNormalizeTitle(t *testing.T) {
+	tests := map[string]string{
+		"The.Matrix.1999.1080p.BluRay.x264.mkv": "the matrix (1999)",
+		"The Matrix (1999) [2160p].mkv":         "the matrix (1999)",
+		"the_matrix_1999_optimized.mkv":         "the matrix (1999)",
+		"Heat.BluRay.Remux.mkv":                 "heat",
+		"Alien - 1979.iso":                      "alien (1979)",
+	}
+	for input, want := range tests {
+		if got := NormalizeTitle(input); got != want {
+			t.Errorf("NormalizeTitle(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestSQLiteProcessedStore(t *testing.T) {
+	db, err := database.OpenSQLite(":memory:")
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	store, err := NewSQLiteProcessedStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	processed, err := NewProcessedDBWithStore(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, jobType := range []string{"optimize", "extract", "optimize", "optimize"} {
+		processed.MarkProcessed(ProcessedFile{
+			Path:        fmt.Sprintf("/media/%d.mkv", i),
+			Hash:        "hash",
+			JobType:     jobType,
+			ProcessedAt: base.Add(time.Duration(i) * time.Hour),
+			InputSize:   1000,
+			OutputSize:  400,
+			AICleaned:   i == 0,
+		})
+	}
+	// An entry without a time is stored as 0, not the zero time's overflowing UnixNano
+	if err := processed.Apply([]ProcessedFile{{Path: "/media/1.mkv", Hash: "new", JobType: "extract", ProcessedAt: base},
+		{Path: "/media/undated.mkv", JobType: "optimize"}}, []string{"/media/3.mkv"}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	// A fresh store reads back what was written
+	reopened, err := NewSQLiteProcessedStore(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := NewProcessedDBWithStore(reopened)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.GetAll()) != 4 || reloaded.IsProcessed("/media/3.mkv") {
+		t.Fatalf("expected 4 entries without the removed one, got %v", reloaded.GetAll())
+	}
+	if f, _ := reloaded.Get("/media/undated.mkv"); !f.ProcessedAt.IsZero() {
+		t.Errorf("expected the zero time to round-trip, got %v", f.ProcessedAt)
+	}
+	if f, _ := reloaded.Get("/media/0.mkv"); !f.AICleaned || f.OutputSize != 400 || !f.ProcessedAt.Equal(base) {
+		t.Errorf("expected fields to round-trip, got %+v", f)
+	}
+	if f, _ := reloaded.Get("/media/1.mkv"); f.Hash != "new" {
+		t.Errorf("expected the upserted entry, got %+v", f)
+	}
+
+	// Queries agree with filtering the in-memory entries
+	for _, q := range []ProcessedQuery{{}, {JobType: "optimize"}, {Limit: 1, Offset: 1}, {JobType: "extract", Offset: 5}} {
+		files, total, err := reloaded.Query(q)
+		if err != nil {
+			t.Fatalf("Query(%+v) failed: %v", q, err)
+		}
+		want, wantTotal := queryProcessed(reloaded.GetAll(), q)
+		if total != wantTotal || len(files) != len(want) {
+			t.Errorf("Query(%+v) = %d of %d, want %d of %d", q, len(files), total, len(want), wantTotal)
+			continue
+		}
+		for i := range want {
+			if files[i].Path != want[i].Path {
+				t.Errorf("Query(%+v)[%d] = %s, want %s", q, i, files[i].Path, want[i].Path)
+			}
+		}
+	}
+	if files, total, _ := reloaded.Query(ProcessedQuery{JobType: "optimize"}); total != 3 || files[0].Path != "/media/2.mkv" {
+		t.Errorf("expected the newest optimize entry first of 3, got %v (total %d)", files, total)
+	}
+}
@@ -0,0 +1,65 @@
+package scanner
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/Vasteva/MediaConverter/internal/media"
+)
+
+// Check returns the problems with a configuration that don't depend on the file system.
+// Directory existence and access are checked by the caller.
+func (c *ScannerConfig) Check() []string {
+	var problems []string
+
+	switch c.Mode {
+	case "", ScanModeManual, ScanModeStartup, ScanModePeriodic, ScanModeWatch, ScanModeHybrid:
+	default:
+		problems = append(problems, fmt.Sprintf("unknown mode %q", c.Mode))
+	}
+
+	if (c.Mode == ScanModePeriodic || c.Mode == ScanModeHybrid) && c.ScanIntervalSec <= 0 {
+		problems = append(problems, fmt.Sprintf("%s mode requires scanIntervalSec greater than 0", c.Mode))
+	}
+	if c.Mode != "" && c.Mode != ScanModeManual && len(c.WatchDirectories) == 0 {
+		problems = append(problems, fmt.Sprintf("%s mode requires at least one watch directory", c.Mode))
+	}
+
+	for i, dir := range c.WatchDirectories {
+		if dir.Path == "" {
+			problems = append(problems, fmt.Sprintf("watch directory %d: path is empty", i))
+		}
+		for _, pattern := range append(append([]string{}, dir.IncludePatterns...), dir.ExcludePatterns...) {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				problems = append(problems, fmt.Sprintf("watch directory %d: invalid pattern %q", i, pattern))
+			}
+		}
+		if dir.MinFileSizeMB < 0 {
+			problems = append(problems, fmt.Sprintf("watch directory %d: minFileSizeMB must not be negative", i))
+		}
+		if dir.MinFileAgeMinutes < 0 {
+			problems = append(problems, fmt.Sprintf("watch directory %d: minFileAgeMinutes must not be negative", i))
+		}
+	}
+
+	for ext, jobType := range c.ExtensionJobTypes {
+		if normalizeExtension(ext) == "" {
+			problems = append(problems, "extensionJobTypes: empty extension")
+		} else if !scannableJobTypes[jobType] {
+			problems = append(problems, fmt.Sprintf("extensionJobTypes: %s maps to unknown job type %q (allowed: extract, optimize)", ext, jobType))
+		}
+	}
+
+	if _, err := compileSplitPartPattern(c.SplitPartPattern); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if c.MaxJobsPerScan < 0 {
+		problems = append(problems, "maxJobsPerScan must not be negative")
+	}
+	if _, err := media.ParseMaxResolution(c.MaxResolution); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	return problems
+}
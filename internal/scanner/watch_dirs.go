@@ -0,0 +1,65 @@
+package scanner
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// ErrWatchDirectoryExists is returned by AddWatchDirectory for a path already watched
+var ErrWatchDirectoryExists = errors.New("directory is already watched")
+
+// ErrWatchDirectoryNotFound is returned by RemoveWatchDirectory for a path not watched
+var ErrWatchDirectoryNotFound = errors.New("directory is not watched")
+
+// AddWatchDirectory adds a watch directory to the config and restarts the scanner with it
+func (s *Scanner) AddWatchDirectory(dir WatchDirectory) error {
+	dir.Path = filepath.Clean(dir.Path)
+	return s.editWatchDirectories(func(dirs []WatchDirectory) ([]WatchDirectory, error) {
+		for _, d := range dirs {
+			if filepath.Clean(d.Path) == dir.Path {
+				return nil, ErrWatchDirectoryExists
+			}
+		}
+		return append(dirs, dir), nil
+	})
+}
+
+// RemoveWatchDirectory removes the watch directory with path from the config and restarts
+// the scanner without it
+func (s *Scanner) RemoveWatchDirectory(path string) error {
+	path = filepath.Clean(path)
+	return s.editWatchDirectories(func(dirs []WatchDirectory) ([]WatchDirectory, error) {
+		for i, d := range dirs {
+			if filepath.Clean(d.Path) == path {
+				return append(dirs[:i], dirs[i+1:]...), nil
+			}
+		}
+		return nil, ErrWatchDirectoryNotFound
+	})
+}
+
+// editWatchDirectories applies edit to a copy of the watch directories, saves the result
+// to WatchDirsFile and applies it like UpdateConfig. The read, edit and restart happen
+// under lifecycleMu so concurrent edits don't lose each other's changes.
+func (s *Scanner) editWatchDirectories(edit func([]WatchDirectory) ([]WatchDirectory, error)) error {
+	s.lifecycleMu.Lock()
+	defer s.lifecycleMu.Unlock()
+
+	s.mu.RLock()
+	newCfg := *s.config
+	s.mu.RUnlock()
+
+	dirs, err := edit(append([]WatchDirectory(nil), newCfg.WatchDirectories...))
+	if err != nil {
+		return err
+	}
+	newCfg.WatchDirectories = dirs
+
+	if s.WatchDirsFile != "" {
+		if err := SaveWatchDirectories(s.WatchDirsFile, dirs); err != nil {
+			return fmt.Errorf("failed to save watch directories: %w", err)
+		}
+	}
+	return s.updateConfig(&newCfg)
+}
@@ -2,6 +2,7 @@ package security
 
 import (
 	"fmt"
+	"net/url"
 	"path/filepath"
 	"strings"
 )
@@ -46,6 +47,28 @@ func ValidatePath(path string, allowedBases ...string) (string, error) {
 	return "", fmt.Errorf("access denied: path %s is outside allowed directories", path)
 }
 
+// ValidateSourceURL parses a remote source URL and ensures its scheme is one of
+// allowedSchemes, so ffmpeg can't be pointed at local files or other protocols
+func ValidateSourceURL(source string, allowedSchemes []string) (*url.URL, error) {
+	u, err := url.Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source URL: %w", err)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid source URL %s: missing host", u.Redacted())
+	}
+	if len(allowedSchemes) == 0 {
+		return nil, fmt.Errorf("access denied: remote sources are disabled, set REMOTE_SOURCE_SCHEMES to allow them")
+	}
+	scheme := strings.ToLower(u.Scheme)
+	for _, allowed := range allowedSchemes {
+		if scheme == allowed {
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("access denied: URL scheme %q is not allowed (allowed: %v)", u.Scheme, allowedSchemes)
+}
+
 // MaskKey hides most segments of a sensitive key
 func MaskKey(key string) string {
 	if len(key) <= 8 {
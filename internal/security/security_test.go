@@ -117,3 +117,32 @@ func TestMaskKey(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateSourceURL(t *testing.T) {
+	allowed := []string{"http", "https"}
+	tests := []struct {
+		source  string
+		wantErr bool
+	}{
+		{"https://media.example.com/movie.mkv", false},
+		{"HTTP://media.example.com/movie.mkv", false},
+		{"file:///etc/passwd", true},
+		{"smb://nas/share/movie.mkv", true},
+		{"ftp://media.example.com/movie.mkv", true},
+		{"https:///movie.mkv", true},
+		{"https://media.example.com/%zz", true},
+	}
+	for _, tt := range tests {
+		_, err := ValidateSourceURL(tt.source, allowed)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateSourceURL(%q) error = %v, wantErr %v", tt.source, err, tt.wantErr)
+		}
+	}
+
+	if _, err := ValidateSourceURL("smb://nas/share/movie.mkv", []string{"smb"}); err != nil {
+		t.Errorf("expected an allowlisted scheme to pass, got %v", err)
+	}
+	if _, err := ValidateSourceURL("https://media.example.com/movie.mkv", nil); err == nil {
+		t.Error("expected remote sources to be rejected with an empty allowlist")
+	}
+}
@@ -1,9 +1,14 @@
 package system
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
 )
 
 // DetectGPU attempts to automatically identify the available GPU vendor
@@ -33,8 +38,8 @@ func DetectGPU() string {
 	// Also check if ffmpeg reports QSV support
 	if fileExists("/dev/dri/renderD128") {
 		// Try to detect via ffmpeg encoders
-		out, _ := exec.Command("ffmpeg", "-hide_banner", "-encoders").Output()
-		if contains(string(out), "hevc_qsv") {
+		encoders, _ := ListEncoders("")
+		if containsString(encoders, "hevc_qsv") {
 			log.Println("[System] Auto-detected Intel GPU via QSV encoder availability")
 			return "intel"
 		}
@@ -53,6 +58,104 @@ func DetectGPU() string {
 	return "cpu"
 }
 
+// GPUDevice is a GPU found on the host, Device is what GPU_DEVICE takes to select it
+type GPUDevice struct {
+	Vendor string `json:"vendor"`
+	Device string `json:"device"` // Render node path for VAAPI, index for NVIDIA
+	Name   string `json:"name,omitempty"`
+}
+
+// pciVendors maps PCI vendor IDs from sysfs to GPU vendors
+var pciVendors = map[string]string{
+	"0x8086": "intel",
+	"0x1002": "amd",
+	"0x10de": "nvidia",
+}
+
+// ListGPUDevices returns the NVIDIA GPUs reported by nvidia-smi and the VAAPI render
+// nodes under /dev/dri
+func ListGPUDevices() []GPUDevice {
+	devices := []GPUDevice{}
+	if out, err := exec.Command("nvidia-smi", "-L").Output(); err == nil {
+		devices = append(devices, parseNvidiaSmiList(string(out))...)
+	}
+
+	nodes, _ := filepath.Glob("/dev/dri/renderD*")
+	for _, node := range nodes {
+		vendor := "unknown"
+		if id, err := os.ReadFile(filepath.Join("/sys/class/drm", filepath.Base(node), "device", "vendor")); err == nil {
+			if v, ok := pciVendors[strings.TrimSpace(string(id))]; ok {
+				vendor = v
+			}
+		}
+		// NVIDIA is selected by index, its render nodes aren't usable as GPU_DEVICE
+		if vendor == "nvidia" {
+			continue
+		}
+		devices = append(devices, GPUDevice{Vendor: vendor, Device: node})
+	}
+	return devices
+}
+
+var nvidiaSmiLineRegex = regexp.MustCompile(`^GPU (\d+): (.+?)(?: \(UUID: [^)]*\))?$`)
+
+// parseNvidiaSmiList parses `nvidia-smi -L` lines such as
+// "GPU 0: NVIDIA GeForce RTX 3080 (UUID: GPU-...)"
+func parseNvidiaSmiList(out string) []GPUDevice {
+	var devices []GPUDevice
+	for _, line := range strings.Split(out, "\n") {
+		if m := nvidiaSmiLineRegex.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+			devices = append(devices, GPUDevice{Vendor: "nvidia", Device: m[1], Name: m[2]})
+		}
+	}
+	return devices
+}
+
+// ListEncoders returns the names of the encoders ffmpeg was built with, as reported by
+// `ffmpeg -encoders`. ffmpegPath is the configured binary, empty to look it up in PATH.
+func ListEncoders(ffmpegPath string) ([]string, error) {
+	path, err := ResolveTool("ffmpeg", ffmpegPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, path, "-hide_banner", "-encoders").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ffmpeg encoders: %w", err)
+	}
+	return parseEncoders(string(out)), nil
+}
+
+// parseEncoders parses the encoder table of `ffmpeg -encoders`, the lines after the
+// "------" separator such as " V....D libx265              libx265 H.265 / HEVC"
+func parseEncoders(out string) []string {
+	encoders := []string{}
+	inTable := false
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if !inTable {
+			inTable = len(fields) == 1 && strings.HasPrefix(fields[0], "---")
+			continue
+		}
+		if len(fields) >= 2 {
+			encoders = append(encoders, fields[1])
+		}
+	}
+	return encoders
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) && stringContains(s, substr)
 }
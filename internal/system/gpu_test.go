@@ -29,3 +29,32 @@ func TestDetectGPU(t *testing.T) {
 		t.Error("DetectGPU returned empty string")
 	}
 }
+
+func TestParseNvidiaSmiList(t *testing.T) {
+	out := "GPU 0: NVIDIA GeForce RTX 3080 (UUID: GPU-1234abcd)\nGPU 1: Tesla T4 (UUID: GPU-5678ef90)\n\nNo devices were found\n"
+	devices := parseNvidiaSmiList(out)
+	if len(devices) != 2 {
+		t.Fatalf("expected 2 devices, got %+v", devices)
+	}
+	if devices[0].Device != "0" || devices[0].Name != "NVIDIA GeForce RTX 3080" || devices[0].Vendor != "nvidia" {
+		t.Errorf("unexpected first device: %+v", devices[0])
+	}
+	if devices[1].Device != "1" || devices[1].Name != "Tesla T4" {
+		t.Errorf("unexpected second device: %+v", devices[1])
+	}
+}
+
+func TestParseEncoders(t *testing.T) {
+	out := `Encoders:
+ V..... = Video
+ A..... = Audio
+ ------
+ V....D libx265              libx265 H.265 / HEVC (codec hevc)
+ V....D hevc_nvenc           NVIDIA NVENC hevc encoder (codec hevc)
+ A....D aac                  AAC (Advanced Audio Coding)
+`
+	encoders := parseEncoders(out)
+	if len(encoders) != 3 || encoders[0] != "libx265" || encoders[1] != "hevc_nvenc" || encoders[2] != "aac" {
+		t.Errorf("unexpected encoders: %v", encoders)
+	}
+}
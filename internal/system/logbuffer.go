@@ -0,0 +1,70 @@
+package system
+
+import (
+	"strings"
+	"sync"
+)
+
+// DefaultLogLines is how many lines of server output the log buffer keeps
+const DefaultLogLines = 1000
+
+// maxLogLineLength truncates very long lines so the buffer stays bounded in bytes
+const maxLogLineLength = 4096
+
+// Logs receives the standard logger's output once main installs it with log.SetOutput
+var Logs = NewLogBuffer(DefaultLogLines)
+
+// LogBuffer is an io.Writer keeping the last lines written to it in a ring buffer
+type LogBuffer struct {
+	mu    sync.RWMutex
+	lines []string
+	next  int // Slot the next line is written to
+	count int
+}
+
+// NewLogBuffer creates a buffer holding the last capacity lines
+func NewLogBuffer(capacity int) *LogBuffer {
+	if capacity <= 0 {
+		capacity = DefaultLogLines
+	}
+	return &LogBuffer{lines: make([]string, capacity)}
+}
+
+// Write records each line in p, overwriting the oldest lines when the buffer is full
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	text := strings.TrimRight(string(p), "\n")
+	if text == "" {
+		return len(p), nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, line := range strings.Split(text, "\n") {
+		if len(line) > maxLogLineLength {
+			line = line[:maxLogLineLength] + "..."
+		}
+		b.lines[b.next] = line
+		b.next = (b.next + 1) % len(b.lines)
+		if b.count < len(b.lines) {
+			b.count++
+		}
+	}
+	return len(p), nil
+}
+
+// Tail returns up to the last n lines, oldest first. n <= 0 returns everything kept.
+func (b *LogBuffer) Tail(n int) []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if n <= 0 || n > b.count {
+		n = b.count
+	}
+	result := make([]string, n)
+	start := (b.next - n + len(b.lines)) % len(b.lines)
+	for i := 0; i < n; i++ {
+		result[i] = b.lines[(start+i)%len(b.lines)]
+	}
+	return result
+}
@@ -28,6 +28,10 @@ type DashboardStats struct {
 	TotalUpscales         int     `json:"totalUpscales"`
 	TotalCleaned          int     `json:"totalCleaned"`
 	EfficiencyScore       float64 `json:"efficiencyScore"`
+
+	// Projection for the pending optimize jobs, see jobs.Manager.PendingSavings
+	PendingFiles     int   `json:"pendingFiles"`
+	EstimatedSavings int64 `json:"estimatedSavings"` // Bytes the pending jobs are estimated to save
 }
 
 func GetStats() Stats {
@@ -0,0 +1,95 @@
+package system
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// CheckWritable verifies that files can be created in dir
+func CheckWritable(dir string) error {
+	f, err := os.CreateTemp(dir, ".vastiva-write-check-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
+
+// FreeSpace returns the bytes available to unprivileged users on the filesystem
+// holding path. If path doesn't exist yet, its nearest existing parent is used.
+func FreeSpace(path string) (uint64, error) {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+	}
+	return availableSpace(path)
+}
+
+// BackupSuffix is appended to a path for the previous version kept by WriteFileAtomic
+const BackupSuffix = ".bak"
+
+// WriteFileAtomic replaces the file at path with data. The data is written to a temp file
+// in the same directory and renamed into place, so a crash leaves either the old or the
+// new file complete, and the file it replaces is kept as path+BackupSuffix.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	if err := os.Rename(path, path+BackupSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to keep backup: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadWithBackup reads the file at path and hands it to parse. When the file is missing,
+// unreadable or fails to parse, the backup kept by WriteFileAtomic is tried instead and
+// the recovery logged. parse may be called twice and must not keep state from a failed
+// call. The error is the primary file's if neither loads.
+func LoadWithBackup(path string, parse func(data []byte) error) error {
+	err := loadFile(path, parse)
+	if err == nil {
+		return nil
+	}
+
+	backup := path + BackupSuffix
+	if loadFile(backup, parse) != nil {
+		return err
+	}
+	log.Printf("Warning: failed to load %s (%v), recovered from backup %s", path, err, backup)
+	return nil
+}
+
+func loadFile(path string, parse func(data []byte) error) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return parse(data)
+}
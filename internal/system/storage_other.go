@@ -0,0 +1,13 @@
+//go:build !unix
+
+package system
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// availableSpace isn't implemented on this platform, callers skip the free space check
+func availableSpace(path string) (uint64, error) {
+	return 0, fmt.Errorf("free space of %s can't be checked on %s", path, runtime.GOOS)
+}
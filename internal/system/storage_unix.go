@@ -0,0 +1,18 @@
+//go:build unix
+
+package system
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// availableSpace returns the bytes available to unprivileged users on the filesystem
+// holding the existing path
+func availableSpace(path string) (uint64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, fmt.Errorf("failed to stat filesystem of %s: %w", path, err)
+	}
+	return st.Bavail * uint64(st.Bsize), nil
+}
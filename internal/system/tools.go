@@ -0,0 +1,28 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// ResolveTool returns the path of an external tool. A configured path is used as is once
+// it is checked to be an executable file, otherwise the tool is looked up in PATH.
+func ResolveTool(name, configured string) (string, error) {
+	if configured == "" {
+		path, err := exec.LookPath(name)
+		if err != nil {
+			return "", fmt.Errorf("%s not found in PATH: %w", name, err)
+		}
+		return path, nil
+	}
+
+	info, err := os.Stat(configured)
+	if err != nil {
+		return "", fmt.Errorf("configured %s path: %w", name, err)
+	}
+	if info.IsDir() || info.Mode().Perm()&0111 == 0 {
+		return "", fmt.Errorf("configured %s path %s is not an executable file", name, configured)
+	}
+	return configured, nil
+}
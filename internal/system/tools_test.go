@@ -0,0 +1,38 @@
+package system
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveTool(t *testing.T) {
+	dir := t.TempDir()
+	writeTool := func(name string, perm os.FileMode) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("#!/bin/sh\n"), perm); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	onPath := writeTool("vastiva-test-tool", 0755)
+	custom := writeTool("custom-build", 0755)
+	plain := writeTool("not-executable", 0644)
+	t.Setenv("PATH", dir)
+
+	if path, err := ResolveTool("vastiva-test-tool", custom); err != nil || path != custom {
+		t.Errorf("expected the configured path to be used, got %q %v", path, err)
+	}
+	if path, err := ResolveTool("vastiva-test-tool", ""); err != nil || path != onPath {
+		t.Errorf("expected a PATH lookup without a configured path, got %q %v", path, err)
+	}
+
+	for _, configured := range []string{plain, dir, filepath.Join(dir, "missing")} {
+		if _, err := ResolveTool("vastiva-test-tool", configured); err == nil {
+			t.Errorf("expected %s to be rejected", configured)
+		}
+	}
+	if _, err := ResolveTool("vastiva-missing-tool", ""); err == nil {
+		t.Error("expected an error for a tool that isn't in PATH")
+	}
+}
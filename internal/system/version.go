@@ -0,0 +1,63 @@
+package system
+
+import (
+	"context"
+	"os/exec"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Version is the application version, set at build time with
+// -ldflags "-X github.com/Vasteva/MediaConverter/internal/system.Version=1.2.3"
+var Version = "1.0.0"
+
+// versionTimeout bounds how long a tool may take to report its version
+const versionTimeout = 10 * time.Second
+
+var (
+	toolVersionsOnce sync.Once
+	toolVersions     map[string]string
+
+	ffmpegVersionRegex  = regexp.MustCompile(`(?m)^ff(?:mpeg|probe) version (\S+)`)
+	makemkvVersionRegex = regexp.MustCompile(`MakeMKV v(\S+)`)
+)
+
+// ToolVersions returns the versions of the external tools, detected once and cached.
+// paths are the configured tool paths by name, tools without one are looked up in PATH.
+// Tools that aren't installed or can't be parsed are reported as "not found" or "unknown".
+func ToolVersions(paths map[string]string) map[string]string {
+	toolVersionsOnce.Do(func() {
+		toolVersions = map[string]string{
+			"ffmpeg":     toolVersion(ffmpegVersionRegex, "ffmpeg", paths["ffmpeg"], "-version"),
+			"ffprobe":    toolVersion(ffmpegVersionRegex, "ffprobe", paths["ffprobe"], "-version"),
+			"makemkvcon": toolVersion(makemkvVersionRegex, "makemkvcon", paths["makemkvcon"], "--version"),
+		}
+	})
+	return toolVersions
+}
+
+func toolVersion(re *regexp.Regexp, name, configured string, args ...string) string {
+	path, err := ResolveTool(name, configured)
+	if err != nil {
+		return "not found"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), versionTimeout)
+	defer cancel()
+
+	// makemkvcon exits non-zero for --version but still prints its banner
+	out, _ := exec.CommandContext(ctx, path, args...).CombinedOutput()
+	if version := parseVersion(re, string(out)); version != "" {
+		return version
+	}
+	return "unknown"
+}
+
+// parseVersion extracts the first capture group of re from a tool's version output
+func parseVersion(re *regexp.Regexp, output string) string {
+	if m := re.FindStringSubmatch(output); m != nil {
+		return m[1]
+	}
+	return ""
+}
@@ -0,0 +1,44 @@
+package system
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   string
+	}{
+		{
+			name:   "ffmpeg release",
+			output: "ffmpeg version 6.1.1-3ubuntu5 Copyright (c) 2000-2023 the FFmpeg developers\nbuilt with gcc 13 (Ubuntu 13.2.0-23ubuntu3)\n",
+			want:   "6.1.1-3ubuntu5",
+		},
+		{
+			name:   "ffmpeg git build",
+			output: "ffmpeg version N-113350-g3a2b9d5f1e-20240101 Copyright (c) 2000-2024 the FFmpeg developers\n",
+			want:   "N-113350-g3a2b9d5f1e-20240101",
+		},
+		{
+			name:   "ffprobe",
+			output: "ffprobe version 7.0 Copyright (c) 2007-2024 the FFmpeg developers\n",
+			want:   "7.0",
+		},
+		{
+			name:   "unrelated output",
+			output: "bash: ffmpeg: command not found\n",
+			want:   "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseVersion(ffmpegVersionRegex, tt.output); got != tt.want {
+				t.Errorf("parseVersion() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := parseVersion(makemkvVersionRegex, "MakeMKV v1.17.7 linux(x64-release) started\n"); got != "1.17.7" {
+		t.Errorf("expected makemkv version 1.17.7, got %q", got)
+	}
+}
@@ -175,11 +175,20 @@ function App() {
   // Create new job
   const createJob = useCallback(async (jobData: Partial<Job>) => {
     try {
-      const response = await authFetch('/api/jobs', {
+      const post = (data: Partial<Job>) => authFetch('/api/jobs', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify(jobData),
+        body: JSON.stringify(data),
       });
+      let response = await post(jobData);
+      // Queued or processed already, offer to re-encode anyway
+      if (response.status === 409 && !jobData.force) {
+        const { error } = await response.json();
+        if (!window.confirm(`${error}\n\nCreate the job anyway?`)) {
+          return false;
+        }
+        response = await post({ ...jobData, force: true });
+      }
       if (response.ok) {
         await fetchJobs();
         return true;
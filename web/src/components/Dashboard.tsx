@@ -47,7 +47,11 @@ export default function Dashboard({ jobs, config, stats, dashboardStats }: Dashb
                     <div className="insight-card glass">
                         <div className="insight-label">Storage Saved</div>
                         <div className="insight-value">{formatSize(dashboardStats.totalStorageSaved)}</div>
-                        <div className="insight-sub">Life-time reduction</div>
+                        <div className="insight-sub">
+                            {dashboardStats.estimatedSavings > 0
+                                ? `${formatSize(dashboardStats.estimatedSavings)} more to be saved`
+                                : 'Life-time reduction'}
+                        </div>
                         <div className="insight-icon">💾</div>
                     </div>
                     <div className="insight-card glass">
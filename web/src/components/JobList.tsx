@@ -153,6 +153,11 @@ export default function JobList({ jobs, onCreateJob, onCancelJob }: JobListProps
                                                 <span className="text-xs text-secondary" style={{ maxWidth: '300px', whiteSpace: 'nowrap', overflow: 'hidden', textOverflow: 'ellipsis' }}>
                                                     {job.sourcePath}
                                                 </span>
+                                                {job.encoding && (
+                                                    <span className="text-xs text-secondary" title={job.encoding.aiAdjustedCrf ? 'CRF suggested by AI' : ''}>
+                                                        {job.encoding.videoCodec} · {job.encoding.gpuVendor} · {job.encoding.preset} · CRF {job.encoding.crf}{job.encoding.aiAdjustedCrf ? ' (AI)' : ''} · audio {job.encoding.audioCodec}
+                                                    </span>
+                                                )}
                                             </div>
                                         </td>
                                         <td>
@@ -170,10 +175,10 @@ export default function JobList({ jobs, onCreateJob, onCancelJob }: JobListProps
                                         <td>
                                             <div style={{ minWidth: '150px' }}>
                                                 <div className="progress-bar">
-                                                    <div className="progress-fill" style={{ width: `${job.progress}%` }} />
+                                                    <div className="progress-fill" style={{ width: `${job.progressUnknown ? 0 : job.progress}%` }} />
                                                 </div>
                                                 <div className="flex justify-between mt-1 text-xs text-secondary">
-                                                    <span>{job.progress}%</span>
+                                                    <span>{job.progressUnknown ? `${job.framesEncoded ?? 0} frames` : `${job.progress}%`}</span>
                                                     {job.status === 'processing' && (
                                                         <span>{job.statusDetail ? job.statusDetail : ''} {job.eta} ({job.fps.toFixed(0)} fps)</span>
                                                     )}
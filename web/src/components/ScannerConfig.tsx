@@ -215,6 +215,20 @@ export default function ScannerConfigComponent({ config: initialConfig, onSave }
                             </label>
                         </div>
 
+                        <div className="form-group">
+                            <label className="label mb-2 block">Resolution Cap</label>
+                            <select
+                                className="input select text-xs"
+                                value={config.maxResolution || ''}
+                                onChange={e => setConfig({ ...config, maxResolution: e.target.value })}
+                            >
+                                <option value="">Keep source resolution</option>
+                                <option value="720p">Downscale to 720p</option>
+                                <option value="1080p">Downscale to 1080p</option>
+                                <option value="1440p">Downscale to 1440p</option>
+                            </select>
+                        </div>
+
                         <div className="form-group">
                             <label className="label mb-2 block flex items-center">
                                 AI Upscaling (Super Resolution)
@@ -304,6 +318,18 @@ export default function ScannerConfigComponent({ config: initialConfig, onSave }
                                                         />
                                                         Recursive
                                                     </label>
+                                                    <label className="flex items-center gap-1 text-xs text-secondary cursor-pointer">
+                                                        <input
+                                                            type="checkbox"
+                                                            checked={!!dir.includeHidden}
+                                                            onChange={() => {
+                                                                const newDirs = [...config.watchDirectories];
+                                                                newDirs[index].includeHidden = !newDirs[index].includeHidden;
+                                                                setConfig({ ...config, watchDirectories: newDirs });
+                                                            }}
+                                                        />
+                                                        Hidden files
+                                                    </label>
                                                     <span className="text-xs text-secondary">•</span>
                                                     <span className="text-xs text-secondary">
                                                         Include: {dir.includePatterns.join(', ')}
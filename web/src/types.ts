@@ -16,6 +16,28 @@ export interface Job {
     createSubtitles?: boolean;
     upscale?: boolean;
     resolution?: string;
+    maxResolution?: string;
+    force?: boolean;
+    progressUnknown?: boolean;
+    framesEncoded?: number;
+    encoding?: EncodingSettings;
+}
+
+export interface EncodingSettings {
+    videoCodec: string;
+    gpuVendor: string;
+    preset: string;
+    crf: number;
+    aiAdjustedCrf: boolean;
+    audioCodec: string;
+    container?: string;
+    maxBitrate?: string;
+    bufSize?: string;
+    normalizeAudio: boolean;
+    streamSelection?: string;
+    languages?: string[];
+    resolution?: string;
+    maxResolution?: string;
 }
 
 export interface SystemConfig {
@@ -40,6 +62,7 @@ export interface WatchDirectory {
     excludePatterns: string[];
     minFileSizeMB: number;
     minFileAgeMinutes: number;
+    includeHidden?: boolean;
 }
 
 export interface ScannerConfig {
@@ -51,11 +74,12 @@ export interface ScannerConfig {
     autoCreateSubtitles: boolean;
     autoUpscale: boolean;
     autoResolution: string;
+    maxResolution?: string;
     processedFilePath: string;
     defaultPriority: number;
     outputDirectory: string;
-    extractExtensions: string[];
-    optimizeExtensions: string[];
+    extensionJobTypes: Record<string, 'extract' | 'optimize'>;
+    splitPartPattern?: string;
 }
 export interface SystemStats {
     cpuUsage: number;
@@ -73,6 +97,8 @@ export interface DashboardStats {
     totalUpscales: number;
     totalCleaned: number;
     efficiencyScore: number;
+    pendingFiles: number;
+    estimatedSavings: number;
 }
 
 export interface ProcessedFile {